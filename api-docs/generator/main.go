@@ -1,6 +1,7 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"log"
 	"path/filepath"
@@ -10,9 +11,25 @@ import (
 )
 
 func main() {
+	format := flag.String("format", "markdown", "output format: markdown, openapi-json or openapi-yaml")
+	out := flag.String("out", "", "output directory (markdown) or file (openapi); defaults to ../docs or ../docs/openapi.{json,yaml}")
+	flag.Parse()
+
 	// Paths relative to the generator location
 	webServerPath := filepath.Join("..", "..", "web-server")
 	docsOutputPath := filepath.Join("..", "docs")
+	switch *format {
+	case "markdown":
+	case "openapi-json":
+		docsOutputPath = filepath.Join(docsOutputPath, "openapi.json")
+	case "openapi-yaml":
+		docsOutputPath = filepath.Join(docsOutputPath, "openapi.yaml")
+	default:
+		log.Fatalf("Unknown format %q (expected markdown, openapi-json or openapi-yaml)", *format)
+	}
+	if *out != "" {
+		docsOutputPath = *out
+	}
 
 	// Resolve absolute paths
 	absWebServerPath, err := filepath.Abs(webServerPath)
@@ -37,7 +54,15 @@ func main() {
 	fmt.Printf("Found %d endpoints\n", len(api.Endpoints))
 
 	// Generate documentation
-	if err := writer.GenerateDocs(api, absDocsPath); err != nil {
+	switch *format {
+	case "openapi-json":
+		err = writer.GenerateOpenAPI(api, absDocsPath, writer.OpenAPIFormatJSON)
+	case "openapi-yaml":
+		err = writer.GenerateOpenAPI(api, absDocsPath, writer.OpenAPIFormatYAML)
+	default:
+		err = writer.GenerateDocs(api, absDocsPath)
+	}
+	if err != nil {
 		log.Fatalf("Failed to generate docs: %v", err)
 	}
 
@@ -0,0 +1,402 @@
+package parser
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// codeIndex is a lightweight symbol table of the web-server's internal packages. It lets the
+// parser follow calls from a handler into services (h.bucketSvc.X, service.RequireBucketPermission,
+// ...) without type-checking the module.
+type codeIndex struct {
+	// funcs is keyed by "pkg.Func" or "pkg.Type.Method"
+	funcs map[string]*funcInfo
+	// fields maps "pkg.Type.field" to the qualified type of the struct field
+	fields map[string]string
+	// packages holds the names of the indexed packages
+	packages map[string]bool
+
+	errors     map[string][]ErrorResponse
+	inProgress map[string]bool
+}
+
+// funcInfo is a function or method declaration and the package it belongs to
+type funcInfo struct {
+	pkg  string
+	decl *ast.FuncDecl
+}
+
+// buildCodeIndex parses every non-test Go file below internalPath
+func buildCodeIndex(internalPath string) (*codeIndex, error) {
+	idx := &codeIndex{
+		funcs:      make(map[string]*funcInfo),
+		fields:     make(map[string]string),
+		packages:   make(map[string]bool),
+		errors:     make(map[string][]ErrorResponse),
+		inProgress: make(map[string]bool),
+	}
+
+	err := filepath.Walk(internalPath, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || !strings.HasSuffix(path, ".go") || strings.HasSuffix(path, "_test.go") {
+			return nil
+		}
+
+		fset := token.NewFileSet()
+		node, err := parser.ParseFile(fset, path, nil, parser.ParseComments)
+		if err != nil {
+			return err
+		}
+
+		pkg := node.Name.Name
+		idx.packages[pkg] = true
+
+		for _, decl := range node.Decls {
+			switch d := decl.(type) {
+			case *ast.FuncDecl:
+				key := pkg + "." + d.Name.Name
+				if d.Recv != nil && len(d.Recv.List) > 0 {
+					key = qualifyType(pkg, d.Recv.List[0].Type) + "." + d.Name.Name
+				}
+				idx.funcs[key] = &funcInfo{pkg: pkg, decl: d}
+			case *ast.GenDecl:
+				if d.Tok != token.TYPE {
+					continue
+				}
+				for _, spec := range d.Specs {
+					typeSpec, ok := spec.(*ast.TypeSpec)
+					if !ok {
+						continue
+					}
+					structType, ok := typeSpec.Type.(*ast.StructType)
+					if !ok {
+						continue
+					}
+					for _, field := range structType.Fields.List {
+						for _, name := range field.Names {
+							idx.fields[pkg+"."+typeSpec.Name.Name+"."+name.Name] = qualifyType(pkg, field.Type)
+						}
+					}
+				}
+			}
+		}
+
+		return nil
+	})
+
+	return idx, err
+}
+
+// matchHandlerBodies replaces the name-based model guesses with what each handler actually does:
+// the ParseAndValidateBody target, the SendSuccess payload and every reachable error code
+func matchHandlerBodies(api *API, idx *codeIndex) {
+	for i := range api.Endpoints {
+		endpoint := &api.Endpoints[i]
+		if endpoint.HandlerType == "" {
+			continue
+		}
+
+		key := "handler." + endpoint.HandlerType + "." + endpoint.Handler
+		fn, exists := idx.funcs[key]
+		if !exists || fn.decl.Body == nil {
+			continue
+		}
+
+		scope := idx.funcScope(fn)
+		endpoint.RequestModel = ""
+		endpoint.ResponseModel = ""
+		parsesBody := false
+
+		ast.Inspect(fn.decl.Body, func(n ast.Node) bool {
+			callExpr, ok := n.(*ast.CallExpr)
+			if !ok {
+				return true
+			}
+			ident, ok := callExpr.Fun.(*ast.Ident)
+			if !ok || len(callExpr.Args) < 2 {
+				return true
+			}
+
+			switch ident.Name {
+			case "ParseAndValidateBody", "parseAndValidateBodyLimit":
+				parsesBody = true
+				if name := modelName(exprType(fn.pkg, callExpr.Args[1], scope), api.Models); name != "" {
+					endpoint.RequestModel = name
+				}
+			case "SendSuccess":
+				if name := modelName(exprType(fn.pkg, callExpr.Args[1], scope), api.Models); name != "" {
+					endpoint.ResponseModel = name
+				}
+			}
+			return true
+		})
+
+		errors := append([]ErrorResponse(nil), idx.errorsOf(key)...)
+		if parsesBody {
+			errors = mergeErrors(errors, []ErrorResponse{{
+				Code:        "VALIDATION_ERROR",
+				Description: "The request body is malformed or fails validation.",
+			}})
+		}
+		sort.Slice(errors, func(a, b int) bool {
+			return errors[a].Code < errors[b].Code
+		})
+		endpoint.ErrorResponses = errors
+	}
+}
+
+// errorsOf returns every apperror.NewUserError code reachable from the function
+func (idx *codeIndex) errorsOf(key string) []ErrorResponse {
+	errors, _ := idx.collectErrors(key)
+	return errors
+}
+
+// collectErrors computes errorsOf, and also returns the functions still in progress further up the
+// call chain that were skipped to break a cycle. A result that skipped any function other than key
+// itself is incomplete, so it is only cached once no such function is left.
+func (idx *codeIndex) collectErrors(key string) ([]ErrorResponse, map[string]bool) {
+	if errors, done := idx.errors[key]; done {
+		return errors, nil
+	}
+	fn, exists := idx.funcs[key]
+	if !exists || fn.decl.Body == nil {
+		return nil, nil
+	}
+	if idx.inProgress[key] {
+		return nil, map[string]bool{key: true}
+	}
+	idx.inProgress[key] = true
+	defer delete(idx.inProgress, key)
+
+	scope := idx.funcScope(fn)
+	var errors []ErrorResponse
+	skipped := make(map[string]bool)
+
+	ast.Inspect(fn.decl.Body, func(n ast.Node) bool {
+		callExpr, ok := n.(*ast.CallExpr)
+		if !ok {
+			return true
+		}
+
+		if isNewUserError(fn.pkg, callExpr) {
+			if code := extractStringLiteral(callExpr.Args[0]); code != "" {
+				errors = mergeErrors(errors, []ErrorResponse{{
+					Code:        code,
+					Description: messageText(callExpr.Args[1]),
+				}})
+			}
+			return true
+		}
+
+		if callee := idx.resolveCall(fn.pkg, callExpr, scope); callee != "" {
+			calleeErrors, calleeSkipped := idx.collectErrors(callee)
+			errors = mergeErrors(errors, calleeErrors)
+			for k := range calleeSkipped {
+				skipped[k] = true
+			}
+		}
+		return true
+	})
+
+	delete(skipped, key)
+	if len(skipped) == 0 {
+		idx.errors[key] = errors
+	}
+	return errors, skipped
+}
+
+// resolveCall returns the index key of the function a call expression invokes, or "" if unknown
+func (idx *codeIndex) resolveCall(pkg string, callExpr *ast.CallExpr, scope map[string]string) string {
+	var key string
+	switch fun := callExpr.Fun.(type) {
+	case *ast.Ident:
+		// Func(...) in the same package
+		key = pkg + "." + fun.Name
+	case *ast.SelectorExpr:
+		switch x := fun.X.(type) {
+		case *ast.Ident:
+			if typeName, ok := scope[x.Name]; ok {
+				// s.Method(...) or param.Method(...)
+				key = typeName + "." + fun.Sel.Name
+			} else if idx.packages[x.Name] {
+				// service.Func(...)
+				key = x.Name + "." + fun.Sel.Name
+			}
+		case *ast.SelectorExpr:
+			// h.bucketSvc.Method(...)
+			if owner, ok := x.X.(*ast.Ident); ok {
+				if typeName, ok := scope[owner.Name]; ok {
+					if fieldType, ok := idx.fields[typeName+"."+x.Sel.Name]; ok {
+						key = fieldType + "." + fun.Sel.Name
+					}
+				}
+			}
+		}
+	}
+
+	if _, exists := idx.funcs[key]; !exists {
+		return ""
+	}
+	return key
+}
+
+// funcScope maps the receiver, parameters and simply-typed local variables of a function to
+// their qualified types
+func (idx *codeIndex) funcScope(fn *funcInfo) map[string]string {
+	scope := make(map[string]string)
+
+	addFields := func(list *ast.FieldList) {
+		if list == nil {
+			return
+		}
+		for _, field := range list.List {
+			for _, name := range field.Names {
+				scope[name.Name] = qualifyType(fn.pkg, field.Type)
+			}
+		}
+	}
+	addFields(fn.decl.Recv)
+	addFields(fn.decl.Type.Params)
+
+	if fn.decl.Body == nil {
+		return scope
+	}
+
+	ast.Inspect(fn.decl.Body, func(n ast.Node) bool {
+		switch stmt := n.(type) {
+		case *ast.ValueSpec:
+			// var req model.XRequest
+			if stmt.Type != nil {
+				for _, name := range stmt.Names {
+					scope[name.Name] = qualifyType(fn.pkg, stmt.Type)
+				}
+			}
+		case *ast.AssignStmt:
+			// resp := &model.XResponse{...}
+			if stmt.Tok != token.DEFINE || len(stmt.Lhs) != len(stmt.Rhs) {
+				return true
+			}
+			for i, lhs := range stmt.Lhs {
+				name, ok := lhs.(*ast.Ident)
+				if !ok {
+					continue
+				}
+				if typeName := compositeType(fn.pkg, stmt.Rhs[i]); typeName != "" {
+					scope[name.Name] = typeName
+				}
+			}
+		}
+		return true
+	})
+
+	return scope
+}
+
+// exprType returns the qualified type of &x, x, &T{...} or T{...}
+func exprType(pkg string, expr ast.Expr, scope map[string]string) string {
+	if typeName := compositeType(pkg, expr); typeName != "" {
+		return typeName
+	}
+	if unary, ok := expr.(*ast.UnaryExpr); ok && unary.Op == token.AND {
+		expr = unary.X
+	}
+	if ident, ok := expr.(*ast.Ident); ok {
+		return scope[ident.Name]
+	}
+	return ""
+}
+
+// compositeType returns the qualified type of a T{...} or &T{...} literal
+func compositeType(pkg string, expr ast.Expr) string {
+	if unary, ok := expr.(*ast.UnaryExpr); ok && unary.Op == token.AND {
+		expr = unary.X
+	}
+	lit, ok := expr.(*ast.CompositeLit)
+	if !ok || lit.Type == nil {
+		return ""
+	}
+	return qualifyType(pkg, lit.Type)
+}
+
+// qualifyType returns "pkg.Type" for Type, *Type, otherpkg.Type or *otherpkg.Type
+func qualifyType(pkg string, expr ast.Expr) string {
+	switch t := expr.(type) {
+	case *ast.StarExpr:
+		return qualifyType(pkg, t.X)
+	case *ast.Ident:
+		return pkg + "." + t.Name
+	case *ast.SelectorExpr:
+		if x, ok := t.X.(*ast.Ident); ok {
+			return x.Name + "." + t.Sel.Name
+		}
+	}
+	return ""
+}
+
+// modelName returns the model name for a "model.X" type if X is a parsed model
+func modelName(typeName string, models map[string]*Model) string {
+	name := strings.TrimPrefix(typeName, "model.")
+	if name == typeName {
+		return ""
+	}
+	if _, exists := models[name]; !exists {
+		return ""
+	}
+	return name
+}
+
+// isNewUserError reports whether the call is apperror.NewUserError(code, message)
+func isNewUserError(pkg string, callExpr *ast.CallExpr) bool {
+	if len(callExpr.Args) < 2 {
+		return false
+	}
+	switch fun := callExpr.Fun.(type) {
+	case *ast.Ident:
+		return pkg == "apperror" && fun.Name == "NewUserError"
+	case *ast.SelectorExpr:
+		x, ok := fun.X.(*ast.Ident)
+		return ok && x.Name == "apperror" && fun.Sel.Name == "NewUserError"
+	}
+	return false
+}
+
+// messageText renders an error message expression, replacing non-literal parts with "…"
+func messageText(expr ast.Expr) string {
+	switch e := expr.(type) {
+	case *ast.BasicLit:
+		if e.Kind == token.STRING {
+			text := strings.Trim(e.Value, "`")
+			text = strings.TrimSuffix(strings.TrimPrefix(text, `"`), `"`)
+			return strings.ReplaceAll(text, `\"`, `"`)
+		}
+	case *ast.BinaryExpr:
+		if e.Op == token.ADD {
+			return messageText(e.X) + messageText(e.Y)
+		}
+	}
+	return "…"
+}
+
+// mergeErrors appends the errors whose codes are not yet in list
+func mergeErrors(list, more []ErrorResponse) []ErrorResponse {
+	for _, e := range more {
+		found := false
+		for _, existing := range list {
+			if existing.Code == e.Code {
+				found = true
+				break
+			}
+		}
+		if !found {
+			list = append(list, e)
+		}
+	}
+	return list
+}
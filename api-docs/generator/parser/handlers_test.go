@@ -0,0 +1,155 @@
+package parser
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestParseAPIWalksHandlerBodies(t *testing.T) {
+	root := t.TempDir()
+	internal := filepath.Join(root, "internal")
+
+	writeFile(t, filepath.Join(internal, "router", "router.go"), `package router
+
+func New(widgetHandler *handler.WidgetHandler) http.Handler {
+	r := chi.NewRouter()
+	r.Route("/api", func(r chi.Router) {
+		r.Post("/widget/spin", widgetHandler.Spin)
+	})
+	return r
+}
+`)
+	writeFile(t, filepath.Join(internal, "model", "widget.go"), `package model
+
+type SpinWidgetRequest struct {
+	WidgetID string `+"`"+`json:"widgetId" validate:"required,len=16"`+"`"+`
+}
+
+type SpinResult struct {
+	HasError bool `+"`"+`json:"hasError"`+"`"+`
+}
+`)
+	writeFile(t, filepath.Join(internal, "handler", "widget_handler.go"), `package handler
+
+type WidgetHandler struct {
+	widgetSvc *service.WidgetService
+}
+
+func (h *WidgetHandler) Spin(w http.ResponseWriter, r *http.Request) {
+	var req model.SpinWidgetRequest
+	if err := ParseAndValidateBody(r, &req); err != nil {
+		SendErrorResponse(w, err)
+		return
+	}
+	if err := service.RequireWidget(req.WidgetID); err != nil {
+		SendErrorResponse(w, err)
+		return
+	}
+	if err := h.widgetSvc.Spin(r.Context(), req.WidgetID); err != nil {
+		SendErrorResponse(w, err)
+		return
+	}
+	SendSuccess(w, &model.SpinResult{HasError: false})
+}
+`)
+	writeFile(t, filepath.Join(internal, "service", "widget_service.go"), `package service
+
+type WidgetService struct{}
+
+func RequireWidget(id string) error {
+	if id == "" {
+		return apperror.NewUserError("WIDGET_NOT_FOUND", "The widget "+id+" could not be found.")
+	}
+	return nil
+}
+
+func (s *WidgetService) Spin(ctx context.Context, id string) error {
+	return s.ensureIdle(id)
+}
+
+func (s *WidgetService) ensureIdle(id string) error {
+	if err := RequireWidget(id); err != nil {
+		return err
+	}
+	return apperror.NewUserError("WIDGET_BUSY", "The widget is already spinning.")
+}
+`)
+
+	api, err := ParseAPI(root)
+	if err != nil {
+		t.Fatalf("ParseAPI: %v", err)
+	}
+	if len(api.Endpoints) != 1 {
+		t.Fatalf("expected 1 endpoint, got %d", len(api.Endpoints))
+	}
+
+	endpoint := api.Endpoints[0]
+	if endpoint.Path != "/api/widget/spin" || endpoint.HandlerType != "WidgetHandler" {
+		t.Errorf("unexpected endpoint: %+v", endpoint)
+	}
+	if endpoint.RequestModel != "SpinWidgetRequest" {
+		t.Errorf("RequestModel = %q", endpoint.RequestModel)
+	}
+	if endpoint.ResponseModel != "SpinResult" {
+		t.Errorf("ResponseModel = %q", endpoint.ResponseModel)
+	}
+
+	want := []ErrorResponse{
+		{Code: "VALIDATION_ERROR", Description: "The request body is malformed or fails validation."},
+		{Code: "WIDGET_BUSY", Description: "The widget is already spinning."},
+		{Code: "WIDGET_NOT_FOUND", Description: "The widget … could not be found."},
+	}
+	if !reflect.DeepEqual(endpoint.ErrorResponses, want) {
+		t.Errorf("ErrorResponses = %+v", endpoint.ErrorResponses)
+	}
+}
+
+func TestErrorsOfMutualRecursion(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "service", "tree_service.go"), `package service
+
+func Walk(id string) error {
+	if id == "" {
+		return apperror.NewUserError("WALK_FAILED", "The walk failed.")
+	}
+	return Visit(id)
+}
+
+func Visit(id string) error {
+	if id == "root" {
+		return apperror.NewUserError("VISIT_FAILED", "The visit failed.")
+	}
+	return Walk(id)
+}
+`)
+
+	idx, err := buildCodeIndex(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"VISIT_FAILED", "WALK_FAILED"}
+	// Visit is first reached through Walk, while Walk is still in progress
+	for _, key := range []string{"service.Walk", "service.Visit"} {
+		var codes []string
+		for _, e := range idx.errorsOf(key) {
+			codes = append(codes, e.Code)
+		}
+		sort.Strings(codes)
+		if !reflect.DeepEqual(codes, want) {
+			t.Errorf("errorsOf(%s) = %v, want %v", key, codes, want)
+		}
+	}
+}
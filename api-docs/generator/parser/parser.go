@@ -7,6 +7,7 @@ import (
 	"go/token"
 	"os"
 	"path/filepath"
+	"reflect"
 	"strings"
 )
 
@@ -35,6 +36,13 @@ func ParseAPI(webServerPath string) (*API, error) {
 	// Match endpoints with their request models
 	matchEndpointModels(api)
 
+	// Refine models and collect error codes by walking the handler bodies
+	idx, err := buildCodeIndex(filepath.Join(webServerPath, "internal"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to index handlers: %w", err)
+	}
+	matchHandlerBodies(api, idx)
+
 	return api, nil
 }
 
@@ -48,6 +56,53 @@ func parseRouter(routerPath string) ([]Endpoint, error) {
 
 	var endpoints []Endpoint
 
+	// Collect r.Route("/prefix", func(r chi.Router) { ... }) scopes so nested routes get their full path
+	var scopes []routeScope
+	ast.Inspect(node, func(n ast.Node) bool {
+		callExpr, ok := n.(*ast.CallExpr)
+		if !ok {
+			return true
+		}
+		selExpr, ok := callExpr.Fun.(*ast.SelectorExpr)
+		if !ok || selExpr.Sel.Name != "Route" || len(callExpr.Args) < 2 {
+			return true
+		}
+		if fn, ok := callExpr.Args[1].(*ast.FuncLit); ok {
+			scopes = append(scopes, routeScope{
+				prefix: extractStringLiteral(callExpr.Args[0]),
+				pos:    fn.Body.Pos(),
+				end:    fn.Body.End(),
+			})
+		}
+		return true
+	})
+
+	// Collect the types of handler variables, e.g. bucketHandler *handler.BucketHandler
+	handlerTypes := make(map[string]string)
+	ast.Inspect(node, func(n ast.Node) bool {
+		switch decl := n.(type) {
+		case *ast.Field:
+			for _, name := range decl.Names {
+				handlerTypes[name.Name] = handlerTypeName(decl.Type)
+			}
+		case *ast.AssignStmt:
+			for i, lhs := range decl.Lhs {
+				name, ok := lhs.(*ast.Ident)
+				if !ok || i >= len(decl.Rhs) {
+					continue
+				}
+				rhs := decl.Rhs[i]
+				if unary, ok := rhs.(*ast.UnaryExpr); ok {
+					rhs = unary.X
+				}
+				if lit, ok := rhs.(*ast.CompositeLit); ok {
+					handlerTypes[name.Name] = handlerTypeName(lit.Type)
+				}
+			}
+		}
+		return true
+	})
+
 	// Walk the AST to find route definitions
 	ast.Inspect(node, func(n ast.Node) bool {
 		// Look for method calls like r.Post("/api/user/login", userHandler.Login)
@@ -73,10 +128,12 @@ func parseRouter(routerPath string) ([]Endpoint, error) {
 			handler := extractHandler(callExpr.Args[1])
 
 			if path != "" && handler != "" {
+				path = routePrefix(scopes, callExpr.Pos()) + path
 				endpoint := Endpoint{
 					Method:       strings.ToUpper(method),
 					Path:         path,
 					Handler:      handler,
+					HandlerType:  handlerTypes[extractHandlerVar(callExpr.Args[1])],
 					RequiresAuth: isAuthRequired(path),
 					GroupName:    extractGroupName(path),
 				}
@@ -90,6 +147,24 @@ func parseRouter(routerPath string) ([]Endpoint, error) {
 	return endpoints, nil
 }
 
+// routeScope is the body of an r.Route call and the path prefix it applies
+type routeScope struct {
+	prefix string
+	pos    token.Pos
+	end    token.Pos
+}
+
+// routePrefix returns the combined prefix of every r.Route scope enclosing pos
+func routePrefix(scopes []routeScope, pos token.Pos) string {
+	var prefix string
+	for _, scope := range scopes {
+		if pos >= scope.pos && pos < scope.end {
+			prefix += scope.prefix
+		}
+	}
+	return prefix
+}
+
 // parseModels parses the model package and extracts struct definitions
 func parseModels(modelsPath string) (map[string]*Model, error) {
 	models := make(map[string]*Model)
@@ -153,14 +228,17 @@ func parseStruct(name string, structType *ast.StructType, doc *ast.CommentGroup)
 
 		fieldName := field.Names[0].Name
 		fieldType := extractTypeName(field.Type)
+		_, nullable := field.Type.(*ast.StarExpr)
 
 		// Parse struct tags
-		jsonName, required, constraints := parseStructTag(field.Tag)
+		jsonName, omitEmpty, required, constraints := parseStructTag(field.Tag)
 
 		f := Field{
 			Name:        fieldName,
 			JSONName:    jsonName,
 			Type:        fieldType,
+			Nullable:    nullable,
+			OmitEmpty:   omitEmpty,
 			Required:    required,
 			Constraints: constraints,
 			Description: extractComment(field.Doc),
@@ -173,9 +251,9 @@ func parseStruct(name string, structType *ast.StructType, doc *ast.CommentGroup)
 }
 
 // parseStructTag parses struct tags and extracts validation information
-func parseStructTag(tag *ast.BasicLit) (jsonName string, required bool, constraints string) {
+func parseStructTag(tag *ast.BasicLit) (jsonName string, omitEmpty bool, required bool, constraints string) {
 	if tag == nil {
-		return "", false, ""
+		return "", false, false, ""
 	}
 
 	tagValue := strings.Trim(tag.Value, "`")
@@ -185,6 +263,11 @@ func parseStructTag(tag *ast.BasicLit) (jsonName string, required bool, constrai
 	if jsonTag != "" {
 		parts := strings.Split(jsonTag, ",")
 		jsonName = parts[0]
+		for _, opt := range parts[1:] {
+			if opt == "omitempty" {
+				omitEmpty = true
+			}
+		}
 	}
 
 	// Extract validation tag
@@ -194,20 +277,12 @@ func parseStructTag(tag *ast.BasicLit) (jsonName string, required bool, constrai
 		constraints = validateTag
 	}
 
-	return jsonName, required, constraints
+	return jsonName, omitEmpty, required, constraints
 }
 
 // extractTag extracts a specific tag value from a struct tag string
 func extractTag(tagStr, tagName string) string {
-	parts := strings.Split(tagStr, " ")
-	for _, part := range parts {
-		if strings.HasPrefix(part, tagName+":") {
-			value := strings.TrimPrefix(part, tagName+":")
-			value = strings.Trim(value, `"`)
-			return value
-		}
-	}
-	return ""
+	return reflect.StructTag(tagStr).Get(tagName)
 }
 
 // matchEndpointModels matches endpoints with their request and response models
@@ -348,6 +423,34 @@ func extractHandler(expr ast.Expr) string {
 	return selExpr.Sel.Name
 }
 
+// extractHandlerVar returns the variable a handler method is called on, e.g. bucketHandler
+func extractHandlerVar(expr ast.Expr) string {
+	selExpr, ok := expr.(*ast.SelectorExpr)
+	if !ok {
+		return ""
+	}
+	ident, ok := selExpr.X.(*ast.Ident)
+	if !ok {
+		return ""
+	}
+	return ident.Name
+}
+
+// handlerTypeName returns X for a handler.X or *handler.X type expression
+func handlerTypeName(expr ast.Expr) string {
+	if star, ok := expr.(*ast.StarExpr); ok {
+		expr = star.X
+	}
+	selExpr, ok := expr.(*ast.SelectorExpr)
+	if !ok {
+		return ""
+	}
+	if pkg, ok := selExpr.X.(*ast.Ident); !ok || pkg.Name != "handler" {
+		return ""
+	}
+	return selExpr.Sel.Name
+}
+
 func extractTypeName(expr ast.Expr) string {
 	switch t := expr.(type) {
 	case *ast.Ident:
@@ -392,6 +495,10 @@ func isAuthRequired(path string) bool {
 		"/metrics",
 		"/api/user/login",
 		"/user/login", // Both versions (with and without /api prefix)
+		"/api/user/register",
+		"/user/register",
+		"/api/user/redeem-invitation",
+		"/user/redeem-invitation",
 	}
 
 	for _, public := range publicEndpoints {
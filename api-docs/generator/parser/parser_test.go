@@ -0,0 +1,37 @@
+package parser
+
+import (
+	"go/ast"
+	goparser "go/parser"
+	"go/token"
+	"testing"
+)
+
+func TestParseStructTags(t *testing.T) {
+	src := `package model
+
+type FindUserFilter struct {
+	By    string ` + "`" + `json:"by" validate:"required,oneof=userName userId"` + "`" + `
+	Query string ` + "`" + `json:"query,omitempty" validate:"omitempty,min=1"` + "`" + `
+	Notes string
+}
+`
+	file, err := goparser.ParseFile(token.NewFileSet(), "filter.go", src, goparser.ParseComments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	spec := file.Decls[0].(*ast.GenDecl).Specs[0].(*ast.TypeSpec)
+	model := parseStruct(spec.Name.Name, spec.Type.(*ast.StructType), nil)
+
+	by := model.Fields[0]
+	if by.JSONName != "by" || !by.Required || by.Constraints != "required,oneof=userName userId" {
+		t.Errorf("multi-value oneof not kept whole: %+v", by)
+	}
+	query := model.Fields[1]
+	if query.JSONName != "query" || !query.OmitEmpty || query.Required || query.Constraints != "omitempty,min=1" {
+		t.Errorf("unexpected field: %+v", query)
+	}
+	if notes := model.Fields[2]; notes.JSONName != "" || notes.Constraints != "" {
+		t.Errorf("untagged field got tags: %+v", notes)
+	}
+}
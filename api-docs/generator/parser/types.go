@@ -11,6 +11,7 @@ type Endpoint struct {
 	Method            string
 	Path              string
 	Handler           string
+	HandlerType       string // e.g., "BucketHandler"
 	Description       string
 	RequiresAuth      bool
 	RequestModel      string
@@ -31,6 +32,8 @@ type Field struct {
 	Name        string
 	JSONName    string
 	Type        string
+	Nullable    bool // pointer field, may be null in JSON
+	OmitEmpty   bool // json tag has omitempty
 	Required    bool
 	Constraints string
 	Description string
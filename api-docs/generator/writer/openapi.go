@@ -0,0 +1,725 @@
+package writer
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/nkrypt-xyz/nkrypt-xyz-web-server/api-docs/generator/parser"
+)
+
+// OpenAPI output formats accepted by GenerateOpenAPI
+const (
+	OpenAPIFormatJSON = "json"
+	OpenAPIFormatYAML = "yaml"
+)
+
+const (
+	schemaRefPrefix    = "#/components/schemas/"
+	responseRefPrefix  = "#/components/responses/"
+	securitySchemeKey  = "apiKey"
+	cryptoMetaHeader   = "nk-crypto-meta"
+	partChecksumHeader = "nk-part-sha256"
+	bucketNameHeader   = "nk-bucket-name"
+	bucketExportPath   = "/api/bucket/export"
+	bucketImportPath   = "/api/bucket/import"
+)
+
+type openAPISpec struct {
+	OpenAPI    string                      `json:"openapi" yaml:"openapi"`
+	Info       openAPIInfo                 `json:"info" yaml:"info"`
+	Tags       []openAPITag                `json:"tags" yaml:"tags"`
+	Paths      map[string]*openAPIPathItem `json:"paths" yaml:"paths"`
+	Components openAPIComponents           `json:"components" yaml:"components"`
+}
+
+type openAPIInfo struct {
+	Title       string `json:"title" yaml:"title"`
+	Description string `json:"description" yaml:"description"`
+	Version     string `json:"version" yaml:"version"`
+}
+
+type openAPITag struct {
+	Name string `json:"name" yaml:"name"`
+}
+
+type openAPIPathItem struct {
+	Get    *openAPIOperation `json:"get,omitempty" yaml:"get,omitempty"`
+	Post   *openAPIOperation `json:"post,omitempty" yaml:"post,omitempty"`
+	Put    *openAPIOperation `json:"put,omitempty" yaml:"put,omitempty"`
+	Patch  *openAPIOperation `json:"patch,omitempty" yaml:"patch,omitempty"`
+	Delete *openAPIOperation `json:"delete,omitempty" yaml:"delete,omitempty"`
+}
+
+type openAPIOperation struct {
+	OperationID string                      `json:"operationId" yaml:"operationId"`
+	Summary     string                      `json:"summary,omitempty" yaml:"summary,omitempty"`
+	Description string                      `json:"description,omitempty" yaml:"description,omitempty"`
+	Tags        []string                    `json:"tags" yaml:"tags"`
+	Security    []map[string][]string       `json:"security,omitempty" yaml:"security,omitempty"`
+	Parameters  []openAPIParameter          `json:"parameters,omitempty" yaml:"parameters,omitempty"`
+	RequestBody *openAPIRequestBody         `json:"requestBody,omitempty" yaml:"requestBody,omitempty"`
+	Responses   map[string]*openAPIResponse `json:"responses" yaml:"responses"`
+}
+
+type openAPIParameter struct {
+	Name        string         `json:"name" yaml:"name"`
+	In          string         `json:"in" yaml:"in"`
+	Description string         `json:"description,omitempty" yaml:"description,omitempty"`
+	Required    bool           `json:"required" yaml:"required"`
+	Schema      *openAPISchema `json:"schema" yaml:"schema"`
+}
+
+type openAPIRequestBody struct {
+	Required bool                         `json:"required" yaml:"required"`
+	Content  map[string]*openAPIMediaType `json:"content" yaml:"content"`
+}
+
+type openAPIMediaType struct {
+	Schema *openAPISchema `json:"schema" yaml:"schema"`
+}
+
+type openAPIResponse struct {
+	Ref         string                       `json:"$ref,omitempty" yaml:"$ref,omitempty"`
+	Description string                       `json:"description,omitempty" yaml:"description,omitempty"`
+	Headers     map[string]*openAPIHeader    `json:"headers,omitempty" yaml:"headers,omitempty"`
+	Content     map[string]*openAPIMediaType `json:"content,omitempty" yaml:"content,omitempty"`
+}
+
+type openAPIHeader struct {
+	Description string         `json:"description,omitempty" yaml:"description,omitempty"`
+	Schema      *openAPISchema `json:"schema" yaml:"schema"`
+}
+
+type openAPISecurityScheme struct {
+	Type        string `json:"type" yaml:"type"`
+	Scheme      string `json:"scheme" yaml:"scheme"`
+	Description string `json:"description" yaml:"description"`
+}
+
+type openAPIComponents struct {
+	Schemas         map[string]*openAPISchema         `json:"schemas" yaml:"schemas"`
+	Responses       map[string]*openAPIResponse       `json:"responses" yaml:"responses"`
+	SecuritySchemes map[string]*openAPISecurityScheme `json:"securitySchemes" yaml:"securitySchemes"`
+}
+
+// openAPISchema is the subset of JSON Schema (2020-12) used by OpenAPI 3.1 that the models need
+type openAPISchema struct {
+	Ref                  string                    `json:"$ref,omitempty" yaml:"$ref,omitempty"`
+	Type                 interface{}               `json:"type,omitempty" yaml:"type,omitempty"`
+	Format               string                    `json:"format,omitempty" yaml:"format,omitempty"`
+	Description          string                    `json:"description,omitempty" yaml:"description,omitempty"`
+	Const                interface{}               `json:"const,omitempty" yaml:"const,omitempty"`
+	Enum                 []string                  `json:"enum,omitempty" yaml:"enum,omitempty"`
+	Pattern              string                    `json:"pattern,omitempty" yaml:"pattern,omitempty"`
+	MinLength            *int64                    `json:"minLength,omitempty" yaml:"minLength,omitempty"`
+	MaxLength            *int64                    `json:"maxLength,omitempty" yaml:"maxLength,omitempty"`
+	Minimum              *int64                    `json:"minimum,omitempty" yaml:"minimum,omitempty"`
+	Maximum              *int64                    `json:"maximum,omitempty" yaml:"maximum,omitempty"`
+	MinItems             *int64                    `json:"minItems,omitempty" yaml:"minItems,omitempty"`
+	MaxItems             *int64                    `json:"maxItems,omitempty" yaml:"maxItems,omitempty"`
+	MinProperties        *int64                    `json:"minProperties,omitempty" yaml:"minProperties,omitempty"`
+	MaxProperties        *int64                    `json:"maxProperties,omitempty" yaml:"maxProperties,omitempty"`
+	Items                *openAPISchema            `json:"items,omitempty" yaml:"items,omitempty"`
+	Properties           map[string]*openAPISchema `json:"properties,omitempty" yaml:"properties,omitempty"`
+	Required             []string                  `json:"required,omitempty" yaml:"required,omitempty"`
+	AdditionalProperties interface{}               `json:"additionalProperties,omitempty" yaml:"additionalProperties,omitempty"`
+	AnyOf                []*openAPISchema          `json:"anyOf,omitempty" yaml:"anyOf,omitempty"`
+}
+
+// GenerateOpenAPI writes an OpenAPI 3.1 specification of the API to outputFile in the given format
+func GenerateOpenAPI(api *parser.API, outputFile string, format string) error {
+	spec := buildOpenAPISpec(api)
+
+	var data []byte
+	var err error
+	switch format {
+	case OpenAPIFormatJSON:
+		data, err = json.MarshalIndent(spec, "", "  ")
+		data = append(data, '\n')
+	case OpenAPIFormatYAML:
+		var buf bytes.Buffer
+		enc := yaml.NewEncoder(&buf)
+		enc.SetIndent(2)
+		if err = enc.Encode(spec); err == nil {
+			err = enc.Close()
+		}
+		data = buf.Bytes()
+	default:
+		return fmt.Errorf("unsupported OpenAPI format %q", format)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to encode OpenAPI spec: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(outputFile), 0755); err != nil {
+		return fmt.Errorf("failed to create output directory: %w", err)
+	}
+	return os.WriteFile(outputFile, data, 0644)
+}
+
+// buildOpenAPISpec converts the parsed API into an OpenAPI document
+func buildOpenAPISpec(api *parser.API) *openAPISpec {
+	spec := &openAPISpec{
+		OpenAPI: "3.1.0",
+		Info: openAPIInfo{
+			Title:       "nkrypt-xyz web server API",
+			Description: "This specification is automatically generated from the Go source code.",
+			Version:     "1.0.0",
+		},
+		Paths: make(map[string]*openAPIPathItem),
+		Components: openAPIComponents{
+			Schemas:   make(map[string]*openAPISchema),
+			Responses: errorResponses(),
+			SecuritySchemes: map[string]*openAPISecurityScheme{
+				securitySchemeKey: {
+					Type:        "http",
+					Scheme:      "bearer",
+					Description: "API key returned by /api/user/login, sent as \"Authorization: Bearer <apiKey>\".",
+				},
+			},
+		},
+	}
+
+	tagSet := make(map[string]bool)
+	referenced := make(map[string]bool)
+	for _, endpoint := range api.Endpoints {
+		item := spec.Paths[endpoint.Path]
+		if item == nil {
+			item = &openAPIPathItem{}
+			spec.Paths[endpoint.Path] = item
+		}
+
+		op := buildOperation(endpoint, api.Models)
+		switch endpoint.Method {
+		case "GET":
+			item.Get = op
+		case "POST":
+			item.Post = op
+		case "PUT":
+			item.Put = op
+		case "PATCH":
+			item.Patch = op
+		case "DELETE":
+			item.Delete = op
+		}
+
+		tagSet[endpoint.GroupName] = true
+		collectModelRefs(endpoint.RequestModel, api.Models, referenced)
+		collectModelRefs(endpoint.ResponseModel, api.Models, referenced)
+	}
+
+	for name := range referenced {
+		spec.Components.Schemas[name] = modelSchema(api.Models[name], api.Models)
+	}
+	for name, schema := range commonSchemas() {
+		spec.Components.Schemas[name] = schema
+	}
+
+	var tags []string
+	for name := range tagSet {
+		tags = append(tags, name)
+	}
+	sort.Strings(tags)
+	for _, name := range tags {
+		spec.Tags = append(spec.Tags, openAPITag{Name: name})
+	}
+
+	return spec
+}
+
+// buildOperation builds the operation object for a single endpoint
+func buildOperation(endpoint parser.Endpoint, models map[string]*parser.Model) *openAPIOperation {
+	op := &openAPIOperation{
+		OperationID: operationID(endpoint.Path),
+		Summary:     endpoint.Method + " " + endpoint.Path,
+		Description: endpoint.Description,
+		Tags:        []string{endpoint.GroupName},
+		Parameters:  pathParameters(endpoint.Path),
+		Responses:   make(map[string]*openAPIResponse),
+	}
+
+	if endpoint.RequiresAuth {
+		op.Security = []map[string][]string{{securitySchemeKey: {}}}
+	}
+
+	switch {
+	case endpoint.GroupName == "blob" && blobAction(endpoint.Path) == "read":
+		op.Responses["200"] = &openAPIResponse{
+			Description: "The blob contents, streamed.",
+			Headers: map[string]*openAPIHeader{
+				cryptoMetaHeader: {
+					Description: "Client-side encryption metadata stored with the blob.",
+					Schema:      &openAPISchema{Type: "string"},
+				},
+			},
+			Content: map[string]*openAPIMediaType{
+				"application/octet-stream": {Schema: &openAPISchema{Type: "string", Format: "binary"}},
+			},
+		}
+	case endpoint.Path == bucketExportPath:
+		op.Responses["200"] = &openAPIResponse{
+			Description: "The bucket as a tar archive, streamed.",
+			Content: map[string]*openAPIMediaType{
+				"application/x-tar": {Schema: &openAPISchema{Type: "string", Format: "binary"}},
+			},
+		}
+	case endpoint.GroupName == "system" && endpoint.Path == "/metrics":
+		op.Responses["200"] = &openAPIResponse{
+			Description: "Prometheus metrics in the text exposition format.",
+			Content: map[string]*openAPIMediaType{
+				"text/plain": {Schema: &openAPISchema{Type: "string"}},
+			},
+		}
+	default:
+		op.Responses["200"] = &openAPIResponse{
+			Description: "Success",
+			Content: map[string]*openAPIMediaType{
+				"application/json": {Schema: successSchema(endpoint, models)},
+			},
+		}
+	}
+
+	if endpoint.Path == bucketImportPath {
+		op.Parameters = append(op.Parameters, openAPIParameter{
+			Name:        bucketNameHeader,
+			In:          "header",
+			Description: "Name of the new bucket, at most 64 characters. By default it is named as in the archive.",
+			Schema:      &openAPISchema{Type: "string", MaxLength: int64Ptr(64)},
+		})
+		op.RequestBody = &openAPIRequestBody{
+			Required: true,
+			Content: map[string]*openAPIMediaType{
+				"application/x-tar": {Schema: &openAPISchema{Type: "string", Format: "binary"}},
+			},
+		}
+	} else if endpoint.GroupName == "blob" && streamsBlobBody(endpoint.Path) {
+		if blobAction(endpoint.Path) == "upload" {
+			op.Parameters = append(op.Parameters, openAPIParameter{
+				Name:        partChecksumHeader,
+				In:          "header",
+				Description: "Hex SHA-256 of the part. A part that does not match it is rejected.",
+				Schema:      &openAPISchema{Type: "string"},
+			})
+		} else {
+			op.Parameters = append(op.Parameters, openAPIParameter{
+				Name:        cryptoMetaHeader,
+				In:          "header",
+				Description: "Client-side encryption metadata to store with the blob. Required when a new blob is started.",
+				Required:    blobAction(endpoint.Path) == "write",
+				Schema:      &openAPISchema{Type: "string"},
+			})
+		}
+		op.RequestBody = &openAPIRequestBody{
+			Required: true,
+			Content: map[string]*openAPIMediaType{
+				"application/octet-stream": {Schema: &openAPISchema{Type: "string", Format: "binary"}},
+			},
+		}
+	} else if endpoint.RequestModel != "" {
+		if _, exists := models[endpoint.RequestModel]; exists {
+			op.RequestBody = &openAPIRequestBody{
+				Required: true,
+				Content: map[string]*openAPIMediaType{
+					"application/json": {Schema: &openAPISchema{Ref: schemaRefPrefix + endpoint.RequestModel}},
+				},
+			}
+		}
+	}
+
+	if endpoint.GroupName != "system" {
+		op.Responses["400"] = &openAPIResponse{Ref: responseRefPrefix + "UserError"}
+		if len(endpoint.ErrorResponses) > 0 {
+			op.Responses["400"] = userErrorResponse(endpoint.ErrorResponses)
+		}
+		op.Responses["500"] = &openAPIResponse{Ref: responseRefPrefix + "ServerError"}
+	}
+	if endpoint.RequiresAuth {
+		op.Responses["401"] = &openAPIResponse{Ref: responseRefPrefix + "Unauthenticated"}
+		op.Responses["403"] = &openAPIResponse{Ref: responseRefPrefix + "AccessDenied"}
+		op.Responses["412"] = &openAPIResponse{Ref: responseRefPrefix + "AuthorizationHeaderInvalid"}
+	}
+
+	return op
+}
+
+// successSchema returns the schema of a successful JSON response
+func successSchema(endpoint parser.Endpoint, models map[string]*parser.Model) *openAPISchema {
+	if _, exists := models[endpoint.ResponseModel]; exists && endpoint.ResponseModel != "" {
+		return &openAPISchema{Ref: schemaRefPrefix + endpoint.ResponseModel}
+	}
+	if endpoint.GroupName == "system" {
+		return &openAPISchema{Type: "object"}
+	}
+	return &openAPISchema{Ref: schemaRefPrefix + "SuccessResponse"}
+}
+
+// userErrorResponse documents the error codes an endpoint is known to return
+func userErrorResponse(errors []parser.ErrorResponse) *openAPIResponse {
+	var sb strings.Builder
+	sb.WriteString("Validation or user error. Known error codes:\n")
+	for _, e := range errors {
+		if nonUserErrorCodes[e.Code] {
+			continue
+		}
+		sb.WriteString("\n- `" + e.Code + "`")
+		if e.Description != "" {
+			sb.WriteString(": " + e.Description)
+		}
+	}
+	return &openAPIResponse{
+		Description: sb.String(),
+		Content: map[string]*openAPIMediaType{
+			"application/json": {Schema: &openAPISchema{Ref: schemaRefPrefix + "ErrorResponse"}},
+		},
+	}
+}
+
+// nonUserErrorCodes are user errors served with a status other than 400, documented by the
+// shared 401/403/412 responses instead
+var nonUserErrorCodes = map[string]bool{
+	"API_KEY_EXPIRED":                   true,
+	"API_KEY_NOT_FOUND":                 true,
+	"ACCESS_DENIED":                     true,
+	"USER_BANNED":                       true,
+	"AUTHORIZATION_HEADER_MISSING":      true,
+	"AUTHORIZATION_HEADER_MALFORMATTED": true,
+}
+
+// errorResponses returns the shared error responses referenced by every operation
+func errorResponses() map[string]*openAPIResponse {
+	errorContent := func() map[string]*openAPIMediaType {
+		return map[string]*openAPIMediaType{
+			"application/json": {Schema: &openAPISchema{Ref: schemaRefPrefix + "ErrorResponse"}},
+		}
+	}
+	return map[string]*openAPIResponse{
+		"UserError": {
+			Description: "Validation or user error (e.g. `VALIDATION_ERROR`, `NO_AUTHORIZATION`).",
+			Content:     errorContent(),
+		},
+		"Unauthenticated": {
+			Description: "The API key is unknown or expired (`API_KEY_NOT_FOUND`, `API_KEY_EXPIRED`).",
+			Content:     errorContent(),
+		},
+		"AccessDenied": {
+			Description: "The user is banned or lacks a required permission (`ACCESS_DENIED`, `USER_BANNED`).",
+			Content:     errorContent(),
+		},
+		"AuthorizationHeaderInvalid": {
+			Description: "The Authorization header is missing or malformed (`AUTHORIZATION_HEADER_MISSING`, `AUTHORIZATION_HEADER_MALFORMATTED`).",
+			Content:     errorContent(),
+		},
+		"ServerError": {
+			Description: "Unexpected server error (`GENERIC_SERVER_ERROR` or a developer error code).",
+			Content:     errorContent(),
+		},
+	}
+}
+
+// commonSchemas returns the schemas of the response envelopes shared by every endpoint
+func commonSchemas() map[string]*openAPISchema {
+	return map[string]*openAPISchema{
+		"ErrorResponse": {
+			Type: "object",
+			Properties: map[string]*openAPISchema{
+				"hasError": {Type: "boolean", Const: true},
+				"error":    {Ref: schemaRefPrefix + "SerializedError"},
+			},
+			Required: []string{"hasError", "error"},
+		},
+		"SerializedError": {
+			Type: "object",
+			Properties: map[string]*openAPISchema{
+				"code":    {Type: "string", Description: "Machine-readable error code, e.g. VALIDATION_ERROR."},
+				"message": {Type: "string", Description: "Human-readable error message."},
+				"details": {Description: "Additional details; validation errors list the offending fields."},
+			},
+			Required: []string{"code", "message", "details"},
+		},
+		"SuccessResponse": {
+			Type:                 "object",
+			Description:          "Generic success envelope for endpoints without a dedicated response model.",
+			Properties:           map[string]*openAPISchema{"hasError": {Type: "boolean", Const: false}},
+			Required:             []string{"hasError"},
+			AdditionalProperties: true,
+		},
+	}
+}
+
+// collectModelRefs marks the named model and every model reachable from its fields
+func collectModelRefs(name string, models map[string]*parser.Model, seen map[string]bool) {
+	model, exists := models[name]
+	if name == "" || !exists || seen[name] {
+		return
+	}
+	seen[name] = true
+	for _, field := range model.Fields {
+		collectModelRefs(baseTypeName(field.Type), models, seen)
+	}
+}
+
+// baseTypeName strips slice and map wrappers from a Go type name
+func baseTypeName(goType string) string {
+	for {
+		switch {
+		case strings.HasPrefix(goType, "[]"):
+			goType = strings.TrimPrefix(goType, "[]")
+		case strings.HasPrefix(goType, "map["):
+			goType = goType[strings.Index(goType, "]")+1:]
+		default:
+			return goType
+		}
+	}
+}
+
+// modelSchema converts a model into an object schema
+func modelSchema(model *parser.Model, models map[string]*parser.Model) *openAPISchema {
+	schema := &openAPISchema{
+		Type:        "object",
+		Description: model.Description,
+		Properties:  make(map[string]*openAPISchema),
+	}
+
+	// Request models are validated, so only validate:"required" fields must be sent.
+	// Response fields are always serialized unless tagged omitempty.
+	isRequest := strings.HasSuffix(model.Name, "Request")
+
+	for _, field := range model.Fields {
+		jsonName := field.JSONName
+		if jsonName == "-" {
+			continue
+		}
+		if jsonName == "" {
+			jsonName = field.Name
+		}
+
+		prop := fieldSchema(field, models)
+		schema.Properties[jsonName] = prop
+
+		if (isRequest && field.Required) || (!isRequest && !field.OmitEmpty) {
+			schema.Required = append(schema.Required, jsonName)
+		}
+	}
+
+	return schema
+}
+
+// fieldSchema builds the schema of a single field including its validation constraints
+func fieldSchema(field parser.Field, models map[string]*parser.Model) *openAPISchema {
+	schema := typeSchema(field.Type, models)
+	applyConstraints(schema, field.Constraints)
+	schema.Description = field.Description
+
+	if field.Nullable {
+		if schema.Ref != "" {
+			return &openAPISchema{
+				AnyOf:       []*openAPISchema{{Ref: schema.Ref}, {Type: "null"}},
+				Description: field.Description,
+			}
+		}
+		if t, ok := schema.Type.(string); ok {
+			schema.Type = []string{t, "null"}
+		}
+	}
+
+	return schema
+}
+
+// typeSchema maps a Go type name to a schema
+func typeSchema(goType string, models map[string]*parser.Model) *openAPISchema {
+	switch {
+	case goType == "[]byte":
+		return &openAPISchema{Type: "string", Format: "byte"}
+	case strings.HasPrefix(goType, "[]"):
+		return &openAPISchema{Type: "array", Items: typeSchema(strings.TrimPrefix(goType, "[]"), models)}
+	case strings.HasPrefix(goType, "map["):
+		return &openAPISchema{Type: "object", AdditionalProperties: typeSchema(goType[strings.Index(goType, "]")+1:], models)}
+	}
+
+	switch goType {
+	case "string":
+		return &openAPISchema{Type: "string"}
+	case "bool":
+		return &openAPISchema{Type: "boolean"}
+	case "int", "int64", "uint", "uint64":
+		return &openAPISchema{Type: "integer", Format: "int64"}
+	case "int8", "int16", "int32", "uint8", "uint16", "uint32":
+		return &openAPISchema{Type: "integer", Format: "int32"}
+	case "float32":
+		return &openAPISchema{Type: "number", Format: "float"}
+	case "float64":
+		return &openAPISchema{Type: "number", Format: "double"}
+	case "time.Time":
+		return &openAPISchema{Type: "string", Format: "date-time"}
+	case "interface{}", "any":
+		return &openAPISchema{}
+	}
+
+	if _, exists := models[goType]; exists {
+		return &openAPISchema{Ref: schemaRefPrefix + goType}
+	}
+	return &openAPISchema{}
+}
+
+// applyConstraints maps validate tag rules onto schema keywords. Rules after "dive" apply to the
+// elements of a slice or the values of a map.
+func applyConstraints(schema *openAPISchema, constraints string) {
+	if constraints == "" {
+		return
+	}
+
+	rules := strings.Split(constraints, ",")
+	for i, rule := range rules {
+		rule = strings.TrimSpace(rule)
+		if rule == "dive" {
+			var elem *openAPISchema
+			if schema.Items != nil {
+				elem = schema.Items
+			} else if s, ok := schema.AdditionalProperties.(*openAPISchema); ok {
+				elem = s
+			}
+			if elem != nil {
+				applyConstraints(elem, strings.Join(rules[i+1:], ","))
+			}
+			return
+		}
+
+		name, value, _ := strings.Cut(rule, "=")
+		switch name {
+		case "min", "gte":
+			setBound(schema, value, true)
+		case "max", "lte":
+			setBound(schema, value, false)
+		case "len":
+			setBound(schema, value, true)
+			setBound(schema, value, false)
+		case "oneof":
+			schema.Enum = strings.Fields(value)
+		case "alphanum":
+			schema.Pattern = "^[a-zA-Z0-9]*$"
+		case "email":
+			schema.Format = "email"
+		case "url":
+			schema.Format = "uri"
+		}
+	}
+}
+
+// setBound sets the lower or upper bound keyword that matches the schema type
+func setBound(schema *openAPISchema, value string, lower bool) {
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return
+	}
+
+	switch schema.Type {
+	case "string":
+		if lower {
+			schema.MinLength = &n
+		} else {
+			schema.MaxLength = &n
+		}
+	case "integer", "number":
+		if lower {
+			schema.Minimum = &n
+		} else {
+			schema.Maximum = &n
+		}
+	case "array":
+		if lower {
+			schema.MinItems = &n
+		} else {
+			schema.MaxItems = &n
+		}
+	case "object":
+		if lower {
+			schema.MinProperties = &n
+		} else {
+			schema.MaxProperties = &n
+		}
+	}
+}
+
+// pathParameters returns the chi URL parameters of a path such as /blob/read/{bucketId}/{fileId}
+func pathParameters(path string) []openAPIParameter {
+	var params []openAPIParameter
+	for _, segment := range strings.Split(path, "/") {
+		if !strings.HasPrefix(segment, "{") || !strings.HasSuffix(segment, "}") {
+			continue
+		}
+		name := strings.Trim(segment, "{}")
+		param := openAPIParameter{Name: name, In: "path", Required: true}
+		switch name {
+		case "offset":
+			param.Schema = &openAPISchema{Type: "integer", Format: "int64", Minimum: int64Ptr(0)}
+			param.Description = "Byte offset of this chunk within the blob."
+		case "shouldEnd":
+			param.Schema = &openAPISchema{Type: "boolean"}
+			param.Description = "Whether this is the final chunk of the blob."
+		case "blobId":
+			param.Schema = &openAPISchema{Type: "string"}
+			param.Description = "Blob ID returned by the first chunk, or \"null\" to start a new blob."
+		default:
+			param.Schema = &openAPISchema{Type: "string", MinLength: int64Ptr(16), MaxLength: int64Ptr(16), Pattern: "^[a-zA-Z0-9]*$"}
+		}
+		params = append(params, param)
+	}
+	return params
+}
+
+// operationID derives a unique camelCase identifier from the static segments of a path,
+// e.g. /api/admin/iam/add-user -> adminIamAddUser
+func operationID(path string) string {
+	var sb strings.Builder
+	for _, segment := range strings.Split(strings.Trim(path, "/"), "/") {
+		if segment == "" || segment == "api" || strings.HasPrefix(segment, "{") {
+			continue
+		}
+		words := strings.FieldsFunc(segment, func(r rune) bool {
+			return r == '-' || r == '_'
+		})
+		for _, word := range words {
+			if sb.Len() == 0 {
+				sb.WriteString(word)
+			} else {
+				sb.WriteString(strings.ToUpper(word[:1]) + word[1:])
+			}
+		}
+	}
+	return sb.String()
+}
+
+// streamsBlobBody reports whether a blob route takes raw blob contents as its request body.
+// The upload session routes other than upload/part take JSON.
+func streamsBlobBody(path string) bool {
+	switch blobAction(path) {
+	case "write", "write-quantized":
+		return true
+	case "upload":
+		return strings.Contains(path, "/upload/part/")
+	}
+	return false
+}
+
+// blobAction returns the segment after "blob" in a blob route, e.g. "read" or "write-quantized"
+func blobAction(path string) string {
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	for i, part := range parts {
+		if part == "blob" && i+1 < len(parts) {
+			return parts[i+1]
+		}
+	}
+	return ""
+}
+
+func int64Ptr(n int64) *int64 {
+	return &n
+}
@@ -0,0 +1,124 @@
+package writer
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/nkrypt-xyz/nkrypt-xyz-web-server/api-docs/generator/parser"
+)
+
+func TestFieldSchemaConstraints(t *testing.T) {
+	models := map[string]*parser.Model{"Grant": {Name: "Grant"}}
+
+	s := fieldSchema(parser.Field{Type: "string", Constraints: "required,min=4,max=32"}, models)
+	if s.Type != "string" || *s.MinLength != 4 || *s.MaxLength != 32 {
+		t.Errorf("string min/max not mapped: %+v", s)
+	}
+
+	s = fieldSchema(parser.Field{Type: "string", Constraints: "required,len=16,alphanum"}, models)
+	if *s.MinLength != 16 || *s.MaxLength != 16 || s.Pattern == "" {
+		t.Errorf("len/alphanum not mapped: %+v", s)
+	}
+
+	s = fieldSchema(parser.Field{Type: "string", Constraints: "required,oneof=userName userId"}, models)
+	if !reflect.DeepEqual(s.Enum, []string{"userName", "userId"}) {
+		t.Errorf("oneof not mapped: %+v", s.Enum)
+	}
+
+	s = fieldSchema(parser.Field{Type: "int64", Constraints: "omitempty,min=60,max=2592000"}, models)
+	if *s.Minimum != 60 || *s.Maximum != 2592000 {
+		t.Errorf("integer min/max not mapped: %+v", s)
+	}
+
+	s = fieldSchema(parser.Field{Type: "[]string", Constraints: "required,max=64,dive,len=16"}, models)
+	if *s.MaxItems != 64 || *s.Items.MinLength != 16 || *s.Items.MaxLength != 16 {
+		t.Errorf("array/dive not mapped: %+v", s)
+	}
+
+	s = fieldSchema(parser.Field{Type: "Grant", Nullable: true}, models)
+	if len(s.AnyOf) != 2 || s.AnyOf[0].Ref != schemaRefPrefix+"Grant" {
+		t.Errorf("nullable ref not mapped: %+v", s)
+	}
+
+	s = fieldSchema(parser.Field{Type: "string", Nullable: true}, models)
+	if !reflect.DeepEqual(s.Type, []string{"string", "null"}) {
+		t.Errorf("nullable string not mapped: %+v", s.Type)
+	}
+}
+
+func TestModelSchemaRequired(t *testing.T) {
+	req := modelSchema(&parser.Model{Name: "FindUserRequest", Fields: []parser.Field{
+		{Name: "Filters", JSONName: "filters", Type: "[]string", Required: true},
+		{Name: "Notes", JSONName: "notes", Type: "string"},
+	}}, nil)
+	if !reflect.DeepEqual(req.Required, []string{"filters"}) {
+		t.Errorf("request required = %v", req.Required)
+	}
+
+	resp := modelSchema(&parser.Model{Name: "FindUserResponse", Fields: []parser.Field{
+		{Name: "HasError", JSONName: "hasError", Type: "bool"},
+		{Name: "UserID", JSONName: "userId", Type: "string", OmitEmpty: true},
+		{Name: "Secret", JSONName: "-", Type: "string"},
+	}}, nil)
+	if !reflect.DeepEqual(resp.Required, []string{"hasError"}) {
+		t.Errorf("response required = %v", resp.Required)
+	}
+	if _, ok := resp.Properties["-"]; ok {
+		t.Error("json:\"-\" field must be skipped")
+	}
+}
+
+func TestBuildOperationBlobRoutes(t *testing.T) {
+	read := buildOperation(parser.Endpoint{Method: "POST", Path: "/api/blob/read/{bucketId}/{fileId}", GroupName: "blob", RequiresAuth: true}, nil)
+	if read.RequestBody != nil || read.Responses["200"].Content["application/octet-stream"] == nil {
+		t.Errorf("blob read should stream the response: %+v", read)
+	}
+	if len(read.Parameters) != 2 || read.OperationID != "blobRead" {
+		t.Errorf("unexpected parameters/operationId: %+v", read)
+	}
+
+	write := buildOperation(parser.Endpoint{Method: "POST", Path: "/api/blob/write/{bucketId}/{fileId}", GroupName: "blob", RequiresAuth: true}, nil)
+	if write.RequestBody == nil || write.RequestBody.Content["application/octet-stream"] == nil {
+		t.Errorf("blob write should stream the request body: %+v", write)
+	}
+	if len(write.Security) != 1 || write.Responses["401"] == nil {
+		t.Errorf("blob write should require auth: %+v", write)
+	}
+
+	part := buildOperation(parser.Endpoint{Method: "POST", Path: "/api/blob/upload/part/{bucketId}/{fileId}/{blobId}/{partNumber}", GroupName: "blob", RequiresAuth: true}, nil)
+	if part.RequestBody == nil || part.RequestBody.Content["application/octet-stream"] == nil {
+		t.Errorf("upload part should stream the request body: %+v", part)
+	}
+
+	models := map[string]*parser.Model{"InitiateBlobUploadRequest": {Name: "InitiateBlobUploadRequest"}}
+	initiate := buildOperation(parser.Endpoint{Method: "POST", Path: "/api/blob/upload/initiate", GroupName: "blob", RequiresAuth: true, RequestModel: "InitiateBlobUploadRequest"}, models)
+	if initiate.RequestBody == nil || initiate.RequestBody.Content["application/json"] == nil || initiate.RequestBody.Content["application/octet-stream"] != nil {
+		t.Errorf("upload initiate should take a JSON body: %+v", initiate.RequestBody)
+	}
+	for _, param := range initiate.Parameters {
+		if param.In == "header" {
+			t.Errorf("upload initiate should not take header %q", param.Name)
+		}
+	}
+
+	login := buildOperation(parser.Endpoint{Method: "POST", Path: "/api/user/login", GroupName: "user"}, nil)
+	if len(login.Security) != 0 || login.Responses["401"] != nil || login.Responses["400"] == nil {
+		t.Errorf("public endpoint should not require auth: %+v", login)
+	}
+}
+
+func TestBuildOperationBucketArchiveRoutes(t *testing.T) {
+	models := map[string]*parser.Model{"ExportBucketRequest": {Name: "ExportBucketRequest"}}
+	export := buildOperation(parser.Endpoint{Method: "POST", Path: "/api/bucket/export", GroupName: "bucket", RequiresAuth: true, RequestModel: "ExportBucketRequest"}, models)
+	if export.Responses["200"].Content["application/x-tar"] == nil || export.RequestBody.Content["application/json"] == nil {
+		t.Errorf("bucket export should take JSON and stream a tar archive: %+v", export)
+	}
+
+	imp := buildOperation(parser.Endpoint{Method: "POST", Path: "/api/bucket/import", GroupName: "bucket", RequiresAuth: true}, nil)
+	if imp.RequestBody == nil || imp.RequestBody.Content["application/x-tar"] == nil {
+		t.Errorf("bucket import should take a tar archive: %+v", imp.RequestBody)
+	}
+	if len(imp.Parameters) != 1 || imp.Parameters[0].Name != bucketNameHeader {
+		t.Errorf("bucket import should take the bucket name header: %+v", imp.Parameters)
+	}
+}
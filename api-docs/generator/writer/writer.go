@@ -179,6 +179,15 @@ func writeEndpoint(sb *strings.Builder, endpoint parser.Endpoint, models map[str
 
 	// Error responses
 	sb.WriteString("**Error Responses:**\n\n")
+	if len(endpoint.ErrorResponses) > 0 {
+		sb.WriteString("| Code | Description |\n")
+		sb.WriteString("|------|-------------|\n")
+		for _, e := range endpoint.ErrorResponses {
+			sb.WriteString(fmt.Sprintf("| `%s` | %s |\n", e.Code, strings.ReplaceAll(e.Description, "|", "\\|")))
+		}
+		sb.WriteString("\n")
+		return
+	}
 	sb.WriteString("Common error codes:\n")
 	sb.WriteString("- `ACCESS_DENIED` - Authentication required or insufficient permissions\n")
 	sb.WriteString("- `VALIDATION_ERROR` - Request validation failed\n")
@@ -0,0 +1,79 @@
+package client
+
+import "context"
+
+// AddUser creates a user. Requires CREATE_USER.
+func (c *Client) AddUser(ctx context.Context, req *AddUserRequest) (*AddUserResponse, error) {
+	var resp AddUserResponse
+	if err := c.postJSON(ctx, "/api/admin/iam/add-user", req, &resp, true); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// SetGlobalPermissions changes a user's global permissions. Requires MANAGE_ALL_USER.
+func (c *Client) SetGlobalPermissions(ctx context.Context, req *SetGlobalPermissionsRequest) error {
+	return c.postJSON(ctx, "/api/admin/iam/set-global-permissions", req, nil, true)
+}
+
+// SetBanningStatus bans or unbans a user. Requires MANAGE_ALL_USER.
+func (c *Client) SetBanningStatus(ctx context.Context, req *SetBanningStatusRequest) error {
+	return c.postJSON(ctx, "/api/admin/iam/set-banning-status", req, nil, true)
+}
+
+// OverwriteUserPassword resets a user's password. Requires MANAGE_ALL_USER.
+func (c *Client) OverwriteUserPassword(ctx context.Context, req *OverwriteUserPasswordRequest) error {
+	return c.postJSON(ctx, "/api/admin/iam/overwrite-user-password", req, nil, true)
+}
+
+// DeleteUser deletes a user, transferring what they own. Requires MANAGE_ALL_USER.
+func (c *Client) DeleteUser(ctx context.Context, req *DeleteUserRequest) error {
+	return c.postJSON(ctx, "/api/admin/iam/delete-user", req, nil, true)
+}
+
+// CreateGroup creates a user group.
+func (c *Client) CreateGroup(ctx context.Context, req *CreateGroupRequest) (*CreateGroupResponse, error) {
+	var resp CreateGroupResponse
+	if err := c.postJSON(ctx, "/api/admin/iam/create-group", req, &resp, true); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// DeleteGroup deletes a user group.
+func (c *Client) DeleteGroup(ctx context.Context, req *DeleteGroupRequest) error {
+	return c.postJSON(ctx, "/api/admin/iam/delete-group", req, nil, true)
+}
+
+// AddGroupMember adds a user to a group.
+func (c *Client) AddGroupMember(ctx context.Context, req *AddGroupMemberRequest) error {
+	return c.postJSON(ctx, "/api/admin/iam/add-group-member", req, nil, true)
+}
+
+// RemoveGroupMember removes a user from a group.
+func (c *Client) RemoveGroupMember(ctx context.Context, req *RemoveGroupMemberRequest) error {
+	return c.postJSON(ctx, "/api/admin/iam/remove-group-member", req, nil, true)
+}
+
+// CreateInvitation creates an invitation. The token is only returned here.
+func (c *Client) CreateInvitation(ctx context.Context, req *CreateInvitationRequest) (*CreateInvitationResponse, error) {
+	var resp CreateInvitationResponse
+	if err := c.postJSON(ctx, "/api/admin/iam/create-invitation", req, &resp, true); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// ListInvitations lists the invitations visible to the current user.
+func (c *Client) ListInvitations(ctx context.Context) (*InvitationListResponse, error) {
+	var resp InvitationListResponse
+	if err := c.postJSON(ctx, "/api/admin/iam/list-invitations", nil, &resp, true); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// RevokeInvitation deletes an unredeemed invitation.
+func (c *Client) RevokeInvitation(ctx context.Context, req *RevokeInvitationRequest) error {
+	return c.postJSON(ctx, "/api/admin/iam/revoke-invitation", req, nil, true)
+}
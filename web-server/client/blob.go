@@ -0,0 +1,328 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// CryptoMetaHeader carries the client-side encryption metadata stored with a blob.
+const CryptoMetaHeader = "nk-crypto-meta"
+
+// DefaultQuantizedChunkSize is the chunk size UploadQuantized uses when none is set. It matches the
+// packet size of the web client's quantized streams.
+const DefaultQuantizedChunkSize = 100 * 1024 * 1024
+
+// IfMatchHeader carries the blob a write expects to replace. The write fails with WRITE_CONFLICT if
+// another blob became the file's content in the meantime.
+const IfMatchHeader = "If-Match"
+
+// BlobContent is an open blob. The caller must close it.
+type BlobContent struct {
+	io.ReadCloser
+	// BlobID identifies the content read; pass it as the expected blob ID of a write to make sure
+	// the write does not overwrite changes made since.
+	BlobID     string
+	CryptoMeta string
+}
+
+// OpenBlob streams the latest finished blob of a file.
+func (c *Client) OpenBlob(ctx context.Context, bucketID, fileID string) (*BlobContent, error) {
+	resp, err := c.do(ctx, true, func() (*http.Request, error) {
+		return http.NewRequestWithContext(ctx, http.MethodPost, c.blobURL("read", bucketID, fileID), nil)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		return nil, decodeResponse(resp, nil)
+	}
+	return &BlobContent{
+		ReadCloser: resp.Body,
+		BlobID:     strings.Trim(resp.Header.Get("ETag"), `"`),
+		CryptoMeta: resp.Header.Get(CryptoMetaHeader),
+	}, nil
+}
+
+// ReadBlob streams the latest finished blob of a file and returns it with its crypto metadata. The
+// caller must close the reader.
+func (c *Client) ReadBlob(ctx context.Context, bucketID, fileID string) (io.ReadCloser, string, error) {
+	blob, err := c.OpenBlob(ctx, bucketID, fileID)
+	if err != nil {
+		return nil, "", err
+	}
+	return blob, blob.CryptoMeta, nil
+}
+
+// WriteBlob streams body as the new content of a file and returns the new blob ID. If body is an
+// io.Seeker the upload can be resent after an automatic re-login.
+func (c *Client) WriteBlob(ctx context.Context, bucketID, fileID, cryptoMeta string, body io.Reader) (string, error) {
+	return c.WriteBlobIfMatch(ctx, bucketID, fileID, cryptoMeta, "", body)
+}
+
+// WriteBlobIfMatch is WriteBlob that fails with WRITE_CONFLICT unless expectedBlobID is still the
+// file's content when the write finishes. An empty expectedBlobID disables the check.
+func (c *Client) WriteBlobIfMatch(ctx context.Context, bucketID, fileID, cryptoMeta, expectedBlobID string, body io.Reader) (string, error) {
+	var resp CreateBlobResponse
+	if err := c.postStream(ctx, c.blobURL("write", bucketID, fileID), writeHeaders(cryptoMeta, expectedBlobID), body, &resp); err != nil {
+		return "", err
+	}
+	return resp.BlobID, nil
+}
+
+// WriteBlobQuantized uploads one chunk of a chunked upload. Pass an empty blobID for the first
+// chunk; the server then starts a new blob using cryptoMeta and returns its ID. shouldEnd finalizes
+// the blob after this chunk. Chunks may arrive in any order but must not overlap; resending a chunk
+// with the same offset and length replaces it. The server refuses to finalize while a chunk is
+// missing, and the response reports where the chunks stored so far stop being contiguous.
+func (c *Client) WriteBlobQuantized(ctx context.Context, bucketID, fileID, blobID string, offset int64, shouldEnd bool, cryptoMeta string, chunk io.Reader) (*WriteQuantizedResponse, error) {
+	return c.writeBlobQuantized(ctx, bucketID, fileID, blobID, offset, shouldEnd, writeHeaders(cryptoMeta, ""), chunk)
+}
+
+func (c *Client) writeBlobQuantized(ctx context.Context, bucketID, fileID, blobID string, offset int64, shouldEnd bool, headers map[string]string, chunk io.Reader) (*WriteQuantizedResponse, error) {
+	if blobID == "" {
+		blobID = "null"
+	}
+	endpoint := c.blobURL("write-quantized", bucketID, fileID, blobID, strconv.FormatInt(offset, 10), strconv.FormatBool(shouldEnd))
+
+	var resp WriteQuantizedResponse
+	if err := c.postStream(ctx, endpoint, headers, chunk, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// QuantizedUpload is the progress of a chunked upload. If UploadQuantized fails, calling it again
+// with the same QuantizedUpload (e.g. restored from its JSON form) uploads only the chunks the
+// server has not acknowledged. Do not change ChunkSize between attempts.
+type QuantizedUpload struct {
+	BucketID   string `json:"bucketId"`
+	FileID     string `json:"fileId"`
+	CryptoMeta string `json:"cryptoMeta"`
+	// Size is the total number of bytes to upload.
+	Size int64 `json:"size"`
+	// ChunkSize is the number of bytes per request; 0 means DefaultQuantizedChunkSize.
+	ChunkSize int64 `json:"chunkSize"`
+	// Parallelism is the number of chunks uploaded concurrently; 0 means 1. The first chunk,
+	// which starts the blob, and the final chunk, which finalizes it, are always sent alone.
+	Parallelism int `json:"-"`
+	// Progress, if set, is called after every acknowledged chunk, one call at a time.
+	Progress func(*QuantizedUpload) `json:"-"`
+	// ExpectedBlobID, if set, makes the upload fail with WRITE_CONFLICT unless it is still the
+	// file's content when the upload finishes.
+	ExpectedBlobID string `json:"expectedBlobId,omitempty"`
+
+	// BlobID is set once the server has accepted the first chunk.
+	BlobID string `json:"blobId"`
+	// Offset is the number of leading bytes the server has acknowledged.
+	Offset int64 `json:"offset"`
+	// Completed holds the offsets of acknowledged chunks beyond Offset.
+	Completed []int64 `json:"completed,omitempty"`
+}
+
+// Done reports whether every chunk, including the final one, has been acknowledged.
+func (u *QuantizedUpload) Done() bool {
+	return u.BlobID != "" && u.Offset >= u.Size
+}
+
+func (u *QuantizedUpload) chunkSize() int64 {
+	if u.ChunkSize <= 0 {
+		return DefaultQuantizedChunkSize
+	}
+	return u.ChunkSize
+}
+
+func (u *QuantizedUpload) isCompleted(offset int64) bool {
+	if offset < u.Offset {
+		return true
+	}
+	for _, o := range u.Completed {
+		if o == offset {
+			return true
+		}
+	}
+	return false
+}
+
+// acknowledge records the chunk at offset and advances Offset over every leading completed chunk.
+func (u *QuantizedUpload) acknowledge(offset int64) {
+	u.Completed = append(u.Completed, offset)
+	for advanced := true; advanced; {
+		advanced = false
+		for i, o := range u.Completed {
+			if o == u.Offset {
+				u.Offset = min(u.Offset+u.chunkSize(), u.Size)
+				u.Completed = append(u.Completed[:i], u.Completed[i+1:]...)
+				advanced = true
+				break
+			}
+		}
+	}
+	if u.Progress != nil {
+		u.Progress(u)
+	}
+}
+
+// UploadQuantized uploads src in chunks as the new content of a file, skipping the chunks already
+// acknowledged in upload. upload is updated after every acknowledged chunk.
+func (c *Client) UploadQuantized(ctx context.Context, upload *QuantizedUpload, src io.ReaderAt) error {
+	chunkSize := upload.chunkSize()
+	headers := writeHeaders(upload.CryptoMeta, upload.ExpectedBlobID)
+	send := func(ctx context.Context, offset int64, shouldEnd bool) (string, error) {
+		n := min(chunkSize, upload.Size-offset)
+		resp, err := c.writeBlobQuantized(ctx, upload.BucketID, upload.FileID, upload.BlobID, offset, shouldEnd, headers, io.NewSectionReader(src, offset, n))
+		if err != nil {
+			return "", err
+		}
+		return resp.BlobID, nil
+	}
+
+	// The first chunk starts the blob and returns its ID.
+	lastOffset := int64(0)
+	if upload.Size > 0 {
+		lastOffset = (upload.Size - 1) / chunkSize * chunkSize
+	}
+	if upload.BlobID == "" {
+		blobID, err := send(ctx, 0, lastOffset == 0)
+		if err != nil {
+			return err
+		}
+		upload.BlobID = blobID
+		upload.acknowledge(0)
+	}
+	if upload.Done() {
+		return nil
+	}
+
+	// Middle chunks can go in any order.
+	var pending []int64
+	for offset := chunkSize; offset < lastOffset; offset += chunkSize {
+		if !upload.isCompleted(offset) {
+			pending = append(pending, offset)
+		}
+	}
+
+	parallelism := max(upload.Parallelism, 1)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		mu       sync.Mutex
+		wg       sync.WaitGroup
+		firstErr error
+	)
+	offsets := make(chan int64)
+	for i := 0; i < parallelism; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for offset := range offsets {
+				_, err := send(ctx, offset, false)
+				mu.Lock()
+				if err != nil {
+					if firstErr == nil {
+						firstErr = err
+						cancel()
+					}
+				} else {
+					upload.acknowledge(offset)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+feed:
+	for _, offset := range pending {
+		select {
+		case offsets <- offset:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(offsets)
+	wg.Wait()
+	if firstErr != nil {
+		return firstErr
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	// The final chunk finalizes the blob once every other chunk is stored.
+	if _, err := send(ctx, lastOffset, true); err != nil {
+		return err
+	}
+	upload.acknowledge(lastOffset)
+	return nil
+}
+
+// postStream posts body as application/octet-stream with the given headers and decodes the JSON
+// response into out.
+func (c *Client) postStream(ctx context.Context, endpoint string, headers map[string]string, body io.Reader, out interface{}) error {
+	seeker, seekable := body.(io.Seeker)
+	var start int64
+	if seekable {
+		pos, err := seeker.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return fmt.Errorf("client: seek request body: %w", err)
+		}
+		start = pos
+	}
+
+	sent := false
+	resp, err := c.do(ctx, true, func() (*http.Request, error) {
+		if sent {
+			if !seekable {
+				return nil, errNotRetryable
+			}
+			if _, err := seeker.Seek(start, io.SeekStart); err != nil {
+				return nil, err
+			}
+		}
+		sent = true
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, io.NopCloser(body))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/octet-stream")
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		return req, nil
+	})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	return decodeResponse(resp, out)
+}
+
+// writeHeaders returns the crypto metadata and expected blob headers of a write, leaving out
+// empty ones.
+func writeHeaders(cryptoMeta, expectedBlobID string) map[string]string {
+	headers := map[string]string{}
+	if cryptoMeta != "" {
+		headers[CryptoMetaHeader] = cryptoMeta
+	}
+	if expectedBlobID != "" {
+		headers[IfMatchHeader] = `"` + expectedBlobID + `"`
+	}
+	return headers
+}
+
+// blobURL builds /api/blob/<action>/<params...> with escaped path segments.
+func (c *Client) blobURL(action string, params ...string) string {
+	endpoint := c.baseURL + "/api/blob/" + action
+	for _, p := range params {
+		endpoint += "/" + url.PathEscape(p)
+	}
+	return endpoint
+}
@@ -0,0 +1,198 @@
+package client
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"strconv"
+	"sync"
+)
+
+// PartChecksumHeader carries the SHA-256 of an uploaded part, so the server rejects a part that
+// was corrupted in transit.
+const PartChecksumHeader = "nk-part-sha256"
+
+// DefaultUploadPartSize is the part size UploadMultipart uses when none is set. Every part but the
+// last must be at least 5 MiB.
+const DefaultUploadPartSize = 16 * 1024 * 1024
+
+// InitiateBlobUpload starts an upload session for a new blob of a file.
+func (c *Client) InitiateBlobUpload(ctx context.Context, req *InitiateBlobUploadRequest) (*InitiateBlobUploadResponse, error) {
+	return c.initiateBlobUpload(ctx, req, "")
+}
+
+func (c *Client) initiateBlobUpload(ctx context.Context, req *InitiateBlobUploadRequest, expectedBlobID string) (*InitiateBlobUploadResponse, error) {
+	var resp InitiateBlobUploadResponse
+	if err := c.postJSONWithHeaders(ctx, "/api/blob/upload/initiate", writeHeaders("", expectedBlobID), req, &resp, true); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// UploadBlobPart uploads one part of an upload session. Parts can be sent in any order and in
+// parallel; sending a part again replaces it. If checksum is set, it must be the hex SHA-256 of
+// the part.
+func (c *Client) UploadBlobPart(ctx context.Context, bucketID, fileID, blobID string, partNumber int, checksum string, part io.Reader) (*UploadBlobPartResponse, error) {
+	var headers map[string]string
+	if checksum != "" {
+		headers = map[string]string{PartChecksumHeader: checksum}
+	}
+	var resp UploadBlobPartResponse
+	if err := c.postStream(ctx, c.blobURL("upload/part", bucketID, fileID, blobID, strconv.Itoa(partNumber)), headers, part, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// GetBlobUploadStatus returns the parts of an upload session stored so far.
+func (c *Client) GetBlobUploadStatus(ctx context.Context, bucketID, fileID, blobID string) (*BlobUploadStatusResponse, error) {
+	var resp BlobUploadStatusResponse
+	req := &BlobUploadRequest{BucketID: bucketID, FileID: fileID, BlobID: blobID}
+	if err := c.postJSON(ctx, "/api/blob/upload/status", req, &resp, true); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// CompleteBlobUpload assembles the parts and makes the blob the file's content.
+func (c *Client) CompleteBlobUpload(ctx context.Context, req *CompleteBlobUploadRequest) (string, error) {
+	return c.CompleteBlobUploadIfMatch(ctx, req, "")
+}
+
+// CompleteBlobUploadIfMatch is CompleteBlobUpload that fails with WRITE_CONFLICT, discarding the
+// upload, unless expectedBlobID is still the file's content. An empty expectedBlobID disables the
+// check.
+func (c *Client) CompleteBlobUploadIfMatch(ctx context.Context, req *CompleteBlobUploadRequest, expectedBlobID string) (string, error) {
+	var resp CreateBlobResponse
+	if err := c.postJSONWithHeaders(ctx, "/api/blob/upload/complete", writeHeaders("", expectedBlobID), req, &resp, true); err != nil {
+		return "", err
+	}
+	return resp.BlobID, nil
+}
+
+// AbortBlobUpload discards an upload session and its parts.
+func (c *Client) AbortBlobUpload(ctx context.Context, bucketID, fileID, blobID string) error {
+	req := &BlobUploadRequest{BucketID: bucketID, FileID: fileID, BlobID: blobID}
+	return c.postJSON(ctx, "/api/blob/upload/abort", req, nil, true)
+}
+
+// MultipartUpload describes an upload through an upload session. If UploadMultipart fails,
+// calling it again with the same MultipartUpload (e.g. restored from its JSON form) asks the server
+// which parts are stored and sends only the others.
+type MultipartUpload struct {
+	BucketID   string `json:"bucketId"`
+	FileID     string `json:"fileId"`
+	CryptoMeta string `json:"cryptoMeta"`
+	// Size is the total number of bytes to upload.
+	Size int64 `json:"size"`
+	// PartSize is the number of bytes per part; 0 means DefaultUploadPartSize.
+	PartSize int64 `json:"partSize"`
+	// Parallelism is the number of parts uploaded concurrently; 0 means 1.
+	Parallelism int `json:"-"`
+	// ExpectedBlobID, if set, makes the upload fail with WRITE_CONFLICT unless it is still the
+	// file's content when the upload completes.
+	ExpectedBlobID string `json:"expectedBlobId,omitempty"`
+
+	// BlobID is set once the upload session has started.
+	BlobID string `json:"blobId"`
+}
+
+// UploadMultipart uploads src through an upload session, starting one unless upload.BlobID is set.
+func (c *Client) UploadMultipart(ctx context.Context, upload *MultipartUpload, src io.ReaderAt) error {
+	partSize := upload.PartSize
+	if partSize <= 0 {
+		partSize = DefaultUploadPartSize
+	}
+
+	var missing []int
+	if upload.BlobID == "" {
+		resp, err := c.initiateBlobUpload(ctx, &InitiateBlobUploadRequest{
+			BucketID:       upload.BucketID,
+			FileID:         upload.FileID,
+			TotalSizeBytes: upload.Size,
+			PartSizeBytes:  partSize,
+			CryptoMeta:     upload.CryptoMeta,
+		}, upload.ExpectedBlobID)
+		if err != nil {
+			return err
+		}
+		upload.BlobID = resp.BlobID
+		for n := 1; n <= resp.PartCount; n++ {
+			missing = append(missing, n)
+		}
+	} else {
+		status, err := c.GetBlobUploadStatus(ctx, upload.BucketID, upload.FileID, upload.BlobID)
+		if err != nil {
+			return err
+		}
+		missing = status.MissingPartNumbers
+	}
+
+	partCount := int((upload.Size + partSize - 1) / partSize)
+	section := func(n int) *io.SectionReader {
+		offset := int64(n-1) * partSize
+		return io.NewSectionReader(src, offset, min(partSize, upload.Size-offset))
+	}
+
+	// The checksums of every part are sent on completion, including parts stored by an earlier attempt
+	checksums := make([]string, partCount)
+	for n := 1; n <= partCount; n++ {
+		h := sha256.New()
+		if _, err := io.Copy(h, section(n)); err != nil {
+			return err
+		}
+		checksums[n-1] = hex.EncodeToString(h.Sum(nil))
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		mu       sync.Mutex
+		wg       sync.WaitGroup
+		firstErr error
+	)
+	parts := make(chan int)
+	for i := 0; i < max(upload.Parallelism, 1); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for n := range parts {
+				_, err := c.UploadBlobPart(ctx, upload.BucketID, upload.FileID, upload.BlobID, n, checksums[n-1], section(n))
+				if err != nil {
+					mu.Lock()
+					if firstErr == nil {
+						firstErr = err
+						cancel()
+					}
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+feed:
+	for _, n := range missing {
+		select {
+		case parts <- n:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(parts)
+	wg.Wait()
+	if firstErr != nil {
+		return firstErr
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	_, err := c.CompleteBlobUploadIfMatch(ctx, &CompleteBlobUploadRequest{
+		BucketID:      upload.BucketID,
+		FileID:        upload.FileID,
+		BlobID:        upload.BlobID,
+		PartChecksums: checksums,
+	}, upload.ExpectedBlobID)
+	return err
+}
@@ -0,0 +1,118 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// BucketNameHeader names the bucket created by ImportBucket.
+const BucketNameHeader = "nk-bucket-name"
+
+// CreateBucket creates a bucket and its root directory.
+func (c *Client) CreateBucket(ctx context.Context, req *CreateBucketRequest) (*CreateBucketResponse, error) {
+	var resp CreateBucketResponse
+	if err := c.postJSON(ctx, "/api/bucket/create", req, &resp, true); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// ListBuckets lists the buckets the current user can access.
+func (c *Client) ListBuckets(ctx context.Context) (*BucketListResponse, error) {
+	var resp BucketListResponse
+	if err := c.postJSON(ctx, "/api/bucket/list", nil, &resp, true); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// RenameBucket renames a bucket.
+func (c *Client) RenameBucket(ctx context.Context, req *RenameBucketRequest) error {
+	return c.postJSON(ctx, "/api/bucket/rename", req, nil, true)
+}
+
+// SetBucketMetaData replaces a bucket's metadata.
+func (c *Client) SetBucketMetaData(ctx context.Context, req *SetBucketMetaDataRequest) error {
+	return c.postJSON(ctx, "/api/bucket/set-metadata", req, nil, true)
+}
+
+// SetBucketCompression sets the codec that blobs written to a bucket from now on are stored with.
+func (c *Client) SetBucketCompression(ctx context.Context, req *SetBucketCompressionRequest) error {
+	return c.postJSON(ctx, "/api/bucket/set-compression", req, nil, true)
+}
+
+// SetBucketAuthorization changes a user's permissions on a bucket.
+func (c *Client) SetBucketAuthorization(ctx context.Context, req *SetBucketAuthorizationRequest) error {
+	return c.postJSON(ctx, "/api/bucket/set-authorization", req, nil, true)
+}
+
+// SetBucketGroupAuthorization changes a group's permissions on a bucket.
+func (c *Client) SetBucketGroupAuthorization(ctx context.Context, req *SetBucketGroupAuthorizationRequest) error {
+	return c.postJSON(ctx, "/api/bucket/set-group-authorization", req, nil, true)
+}
+
+// RemoveBucketMember removes a user's direct authorization on a bucket.
+func (c *Client) RemoveBucketMember(ctx context.Context, req *RemoveBucketMemberRequest) error {
+	return c.postJSON(ctx, "/api/bucket/remove-member", req, nil, true)
+}
+
+// TransferBucketOwnership makes another user the owner of a bucket.
+func (c *Client) TransferBucketOwnership(ctx context.Context, req *TransferBucketOwnershipRequest) error {
+	return c.postJSON(ctx, "/api/bucket/transfer-ownership", req, nil, true)
+}
+
+// ListBucketMembers lists the users with access to a bucket.
+func (c *Client) ListBucketMembers(ctx context.Context, req *ListBucketMembersRequest) (*ListBucketMembersResponse, error) {
+	var resp ListBucketMembersResponse
+	if err := c.postJSON(ctx, "/api/bucket/list-members", req, &resp, true); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// DestroyBucket deletes a bucket and all of its content.
+func (c *Client) DestroyBucket(ctx context.Context, req *DestroyBucketRequest) error {
+	return c.postJSON(ctx, "/api/bucket/destroy", req, nil, true)
+}
+
+// ExportBucket streams a bucket as a tar archive. The caller must close the reader.
+func (c *Client) ExportBucket(ctx context.Context, req *ExportBucketRequest) (io.ReadCloser, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("client: encode request: %w", err)
+	}
+	resp, err := c.do(ctx, true, func() (*http.Request, error) {
+		httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/api/bucket/export", bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		httpReq.Header.Set("Content-Type", "application/json")
+		return httpReq, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		return nil, decodeResponse(resp, nil)
+	}
+	return resp.Body, nil
+}
+
+// ImportBucket creates a bucket from an archive written by ExportBucket. The bucket is named name,
+// or as in the archive if name is empty.
+func (c *Client) ImportBucket(ctx context.Context, name string, archive io.Reader) (*CreateBucketResponse, error) {
+	headers := map[string]string{}
+	if name != "" {
+		headers[BucketNameHeader] = name
+	}
+	var resp CreateBucketResponse
+	if err := c.postStream(ctx, c.baseURL+"/api/bucket/import", headers, archive, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
@@ -0,0 +1,224 @@
+// Package client is a typed Go client for the nkrypt-xyz web server API.
+//
+// Request and response types are aliases of the server's own models, so the client stays in sync
+// with the API. Every route registered in router.New has a matching method.
+//
+//	c := client.New("http://localhost:9041", nil)
+//	if _, err := c.Login(ctx, userName, password); err != nil {
+//		return err
+//	}
+//	buckets, err := c.ListBuckets(ctx)
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// Client talks to one nkrypt-xyz server. It is safe for concurrent use.
+//
+// After Login the client remembers the credentials; when the server reports the API key as expired
+// or unknown, the client logs in again and retries the request once.
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+
+	mu       sync.Mutex
+	apiKey   string
+	userName string
+	password string
+}
+
+// New creates a client for the server at baseURL (e.g. "http://localhost:9041"). A nil httpClient
+// uses http.DefaultClient.
+func New(baseURL string, httpClient *http.Client) *Client {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return &Client{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		httpClient: httpClient,
+	}
+}
+
+// APIKey returns the API key of the current session, or "" if there is none.
+func (c *Client) APIKey() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.apiKey
+}
+
+// SetAPIKey uses an existing API key. The client cannot log in again on its own when it expires.
+func (c *Client) SetAPIKey(apiKey string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.apiKey = apiKey
+	c.userName = ""
+	c.password = ""
+}
+
+// Login creates a session and keeps the credentials for automatic re-login.
+func (c *Client) Login(ctx context.Context, userName, password string) (*LoginResponse, error) {
+	var resp LoginResponse
+	if err := c.postJSON(ctx, "/api/user/login", &LoginRequest{UserName: userName, Password: password}, &resp, false); err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	c.apiKey = resp.APIKey
+	c.userName = userName
+	c.password = password
+	c.mu.Unlock()
+	return &resp, nil
+}
+
+// relogin replaces an API key the server rejected. It returns false if the client has no
+// credentials or another request has already refreshed the key.
+func (c *Client) relogin(ctx context.Context, rejectedKey string) (bool, error) {
+	c.mu.Lock()
+	userName, password, current := c.userName, c.password, c.apiKey
+	c.mu.Unlock()
+
+	if userName == "" {
+		return false, nil
+	}
+	if current != rejectedKey {
+		return true, nil
+	}
+	_, err := c.Login(ctx, userName, password)
+	return err == nil, err
+}
+
+// clearSession forgets the API key and credentials.
+func (c *Client) clearSession() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.apiKey = ""
+	c.userName = ""
+	c.password = ""
+}
+
+// postJSON sends in as JSON to path and decodes the success response into out (which may be nil).
+func (c *Client) postJSON(ctx context.Context, path string, in, out interface{}, authenticated bool) error {
+	return c.postJSONWithHeaders(ctx, path, nil, in, out, authenticated)
+}
+
+// postJSONWithHeaders is postJSON with extra request headers.
+func (c *Client) postJSONWithHeaders(ctx context.Context, path string, headers map[string]string, in, out interface{}, authenticated bool) error {
+	if in == nil {
+		in = struct{}{}
+	}
+	body, err := json.Marshal(in)
+	if err != nil {
+		return fmt.Errorf("client: encode request: %w", err)
+	}
+
+	resp, err := c.do(ctx, authenticated, func() (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+path, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		return req, nil
+	})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	return decodeResponse(resp, out)
+}
+
+// do sends the request built by build. For authenticated requests it adds the API key and, if the
+// key was rejected, logs in again and resends once. build must be callable more than once; return
+// errNotRetryable from a second call to disable the retry.
+func (c *Client) do(ctx context.Context, authenticated bool, build func() (*http.Request, error)) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		req, err := build()
+		if err != nil {
+			if errors.Is(err, errNotRetryable) {
+				return nil, &Error{StatusCode: http.StatusUnauthorized, Code: "API_KEY_EXPIRED", Message: "The API key was rejected and the request body cannot be resent."}
+			}
+			return nil, fmt.Errorf("client: build request: %w", err)
+		}
+
+		apiKey := c.APIKey()
+		if authenticated && apiKey != "" {
+			req.Header.Set("Authorization", "Bearer "+apiKey)
+		}
+
+		resp, err := c.httpClient.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("client: %s %s: %w", req.Method, req.URL.Path, err)
+		}
+
+		if !authenticated || attempt > 0 || resp.StatusCode != http.StatusUnauthorized {
+			return resp, nil
+		}
+
+		// 401 means API_KEY_EXPIRED or API_KEY_NOT_FOUND
+		apiErr := decodeResponse(resp, nil)
+		resp.Body.Close()
+		refreshed, err := c.relogin(ctx, apiKey)
+		if err != nil {
+			return nil, err
+		}
+		if !refreshed {
+			return nil, apiErr
+		}
+	}
+}
+
+// errNotRetryable is returned by a request builder whose body has already been consumed.
+var errNotRetryable = errors.New("request body cannot be resent")
+
+// decodeResponse turns a non-200 or hasError response into an *Error and otherwise decodes the
+// body into out.
+func decodeResponse(resp *http.Response, out interface{}) error {
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("client: read response: %w", err)
+	}
+
+	var envelope struct {
+		HasError bool `json:"hasError"`
+		Error    struct {
+			Code    string      `json:"code"`
+			Message string      `json:"message"`
+			Details interface{} `json:"details"`
+		} `json:"error"`
+	}
+	jsonErr := json.Unmarshal(data, &envelope)
+
+	if resp.StatusCode != http.StatusOK || envelope.HasError {
+		if jsonErr != nil || envelope.Error.Code == "" {
+			return &Error{StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(data))}
+		}
+		return &Error{
+			StatusCode: resp.StatusCode,
+			Code:       envelope.Error.Code,
+			Message:    envelope.Error.Message,
+			Details:    envelope.Error.Details,
+		}
+	}
+	if jsonErr != nil {
+		return fmt.Errorf("client: decode response: %w", jsonErr)
+	}
+
+	if out == nil {
+		return nil
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("client: decode response: %w", err)
+	}
+	return nil
+}
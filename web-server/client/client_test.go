@@ -0,0 +1,342 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	writeJSON(w, status, map[string]interface{}{
+		"hasError": true,
+		"error":    map[string]interface{}{"code": code, "message": message, "details": map[string]interface{}{}},
+	})
+}
+
+func TestErrorResponseCarriesCode(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, http.StatusBadRequest, "BUCKET_NOT_FOUND", "The requested bucket could not be found.")
+	}))
+	defer srv.Close()
+
+	c := New(srv.URL, nil)
+	err := c.RenameBucket(context.Background(), &RenameBucketRequest{BucketID: "bucket0000000001", Name: "x"})
+	if !IsErrorCode(err, "BUCKET_NOT_FOUND") {
+		t.Fatalf("Expected BUCKET_NOT_FOUND, got %v", err)
+	}
+	if apiErr := err.(*Error); apiErr.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected status 400, got %d", apiErr.StatusCode)
+	}
+}
+
+func TestExpiredAPIKeyLogsInAgain(t *testing.T) {
+	var mu sync.Mutex
+	validKey := "key-1"
+	logins := 0
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch r.URL.Path {
+		case "/api/user/login":
+			logins++
+			validKey = "key-" + strconv.Itoa(logins)
+			writeJSON(w, http.StatusOK, map[string]interface{}{"hasError": false, "apiKey": validKey})
+		case "/api/bucket/list":
+			if r.Header.Get("Authorization") != "Bearer "+validKey {
+				writeError(w, http.StatusUnauthorized, "API_KEY_EXPIRED", "Your session has expired.")
+				return
+			}
+			writeJSON(w, http.StatusOK, map[string]interface{}{"hasError": false, "bucketList": []interface{}{}})
+		}
+	}))
+	defer srv.Close()
+
+	ctx := context.Background()
+	c := New(srv.URL, nil)
+	if _, err := c.Login(ctx, "admin", "password1"); err != nil {
+		t.Fatalf("Login failed: %v", err)
+	}
+
+	// Expire the session on the server side
+	mu.Lock()
+	validKey = "key-expired"
+	mu.Unlock()
+
+	if _, err := c.ListBuckets(ctx); err != nil {
+		t.Fatalf("Expected ListBuckets to succeed after re-login, got %v", err)
+	}
+	if logins != 2 || c.APIKey() != "key-2" {
+		t.Errorf("Expected a second login and key-2, got %d logins and %q", logins, c.APIKey())
+	}
+}
+
+func TestExpiredAPIKeyWithoutCredentials(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, http.StatusUnauthorized, "API_KEY_NOT_FOUND", "The API key is not valid.")
+	}))
+	defer srv.Close()
+
+	c := New(srv.URL, nil)
+	c.SetAPIKey("unknown")
+	if _, err := c.ListBuckets(context.Background()); !IsErrorCode(err, "API_KEY_NOT_FOUND") {
+		t.Fatalf("Expected API_KEY_NOT_FOUND, got %v", err)
+	}
+}
+
+func TestReadBlobReturnsStreamAndCryptoMeta(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/blob/read/bucket0000000001/file000000000001" {
+			t.Errorf("Unexpected path %s", r.URL.Path)
+		}
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set(CryptoMetaHeader, "iv=abc")
+		_, _ = w.Write([]byte("ciphertext"))
+	}))
+	defer srv.Close()
+
+	body, meta, err := New(srv.URL, nil).ReadBlob(context.Background(), "bucket0000000001", "file000000000001")
+	if err != nil {
+		t.Fatalf("ReadBlob failed: %v", err)
+	}
+	defer body.Close()
+	data, _ := io.ReadAll(body)
+	if string(data) != "ciphertext" || meta != "iv=abc" {
+		t.Errorf("Unexpected blob %q with meta %q", data, meta)
+	}
+}
+
+func TestWriteBlobIfMatchDetectsConflict(t *testing.T) {
+	current := "blob000000000001"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasPrefix(r.URL.Path, "/api/blob/read/"):
+			w.Header().Set("ETag", `"`+current+`"`)
+			_, _ = w.Write([]byte("ciphertext"))
+		case strings.HasPrefix(r.URL.Path, "/api/blob/write/"):
+			if r.Header.Get(IfMatchHeader) != `"`+current+`"` {
+				writeError(w, http.StatusConflict, "WRITE_CONFLICT", "The file was written by someone else")
+				return
+			}
+			current = "blob000000000002"
+			writeJSON(w, http.StatusOK, map[string]interface{}{"hasError": false, "blobId": current})
+		}
+	}))
+	defer srv.Close()
+
+	c := New(srv.URL, nil)
+	ctx := context.Background()
+	blob, err := c.OpenBlob(ctx, "bucket0000000001", "file000000000001")
+	if err != nil {
+		t.Fatalf("OpenBlob failed: %v", err)
+	}
+	blob.Close()
+	if blob.BlobID != "blob000000000001" {
+		t.Fatalf("Expected the blob ID from the ETag, got %q", blob.BlobID)
+	}
+
+	if _, err := c.WriteBlobIfMatch(ctx, "bucket0000000001", "file000000000001", "", blob.BlobID, strings.NewReader("new")); err != nil {
+		t.Fatalf("First write failed: %v", err)
+	}
+	// The second write still expects the blob the first one replaced
+	_, err = c.WriteBlobIfMatch(ctx, "bucket0000000001", "file000000000001", "", blob.BlobID, strings.NewReader("newer"))
+	if !IsErrorCode(err, "WRITE_CONFLICT") {
+		t.Fatalf("Expected WRITE_CONFLICT, got %v", err)
+	}
+}
+
+func TestUploadQuantizedResumesAfterFailure(t *testing.T) {
+	var mu sync.Mutex
+	chunks := map[int64][]byte{}
+	failOffset := int64(4)
+	finished := false
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		// /api/blob/write-quantized/{bucketId}/{fileId}/{blobId}/{offset}/{shouldEnd}
+		parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/blob/write-quantized/"), "/")
+		blobID, shouldEnd := parts[2], parts[4] == "true"
+		offset, _ := strconv.ParseInt(parts[3], 10, 64)
+
+		if offset == failOffset {
+			failOffset = -1
+			writeError(w, http.StatusInternalServerError, "GENERIC_SERVER_ERROR", "boom")
+			return
+		}
+		if offset == 0 {
+			if blobID != "null" || r.Header.Get(CryptoMetaHeader) != "meta" {
+				t.Errorf("First chunk should start a new blob with crypto meta, got %s", blobID)
+			}
+			blobID = "blob000000000001"
+		}
+		data, _ := io.ReadAll(r.Body)
+		chunks[offset] = data
+		finished = shouldEnd
+		writeJSON(w, http.StatusOK, map[string]interface{}{"hasError": false, "blobId": blobID, "bytesTransfered": len(data)})
+	}))
+	defer srv.Close()
+
+	ctx := context.Background()
+	c := New(srv.URL, nil)
+	src := bytes.NewReader([]byte("0123456789"))
+	upload := &QuantizedUpload{BucketID: "bucket0000000001", FileID: "file000000000001", CryptoMeta: "meta", Size: 10, ChunkSize: 4}
+
+	if err := c.UploadQuantized(ctx, upload, src); ErrorCode(err) != "GENERIC_SERVER_ERROR" {
+		t.Fatalf("Expected the second chunk to fail, got %v", err)
+	}
+	if upload.Offset != 4 || upload.BlobID != "blob000000000001" || upload.Done() {
+		t.Fatalf("Unexpected progress after failure: %+v", upload)
+	}
+
+	if err := c.UploadQuantized(ctx, upload, src); err != nil {
+		t.Fatalf("Resume failed: %v", err)
+	}
+	if !upload.Done() || !finished {
+		t.Fatalf("Expected the upload to be finished: %+v", upload)
+	}
+	got := string(chunks[0]) + string(chunks[4]) + string(chunks[8])
+	if got != "0123456789" {
+		t.Errorf("Unexpected uploaded content %q", got)
+	}
+}
+
+func TestUploadQuantizedParallelFinalizesLast(t *testing.T) {
+	var mu sync.Mutex
+	chunks := map[int64][]byte{}
+	var finalizedWith int
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/blob/write-quantized/"), "/")
+		offset, _ := strconv.ParseInt(parts[3], 10, 64)
+		data, _ := io.ReadAll(r.Body)
+
+		mu.Lock()
+		defer mu.Unlock()
+		chunks[offset] = data
+		if parts[4] == "true" {
+			finalizedWith = len(chunks)
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"hasError": false, "blobId": "blob000000000001", "bytesTransfered": len(data)})
+	}))
+	defer srv.Close()
+
+	content := []byte(strings.Repeat("abcdefghij", 10))
+	progressCalls := 0
+	upload := &QuantizedUpload{
+		BucketID: "bucket0000000001", FileID: "file000000000001", CryptoMeta: "meta",
+		Size: int64(len(content)), ChunkSize: 7, Parallelism: 4,
+		Progress: func(*QuantizedUpload) { progressCalls++ },
+	}
+	if err := New(srv.URL, nil).UploadQuantized(context.Background(), upload, bytes.NewReader(content)); err != nil {
+		t.Fatalf("UploadQuantized failed: %v", err)
+	}
+
+	if finalizedWith != 15 || progressCalls != 15 {
+		t.Errorf("Expected the final chunk to be the 15th of 15, got %d chunks at finalization and %d progress calls", finalizedWith, progressCalls)
+	}
+	var got []byte
+	for offset := int64(0); offset < upload.Size; offset += 7 {
+		got = append(got, chunks[offset]...)
+	}
+	if !bytes.Equal(got, content) || !upload.Done() || len(upload.Completed) != 0 {
+		t.Errorf("Unexpected result: %q, %+v", got, upload)
+	}
+}
+
+func TestUploadMultipartResumesMissingParts(t *testing.T) {
+	var mu sync.Mutex
+	parts := map[int][]byte{}
+	failPart := 2
+	var completedWith []string
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		switch {
+		case r.URL.Path == "/api/blob/upload/initiate":
+			var req InitiateBlobUploadRequest
+			_ = json.NewDecoder(r.Body).Decode(&req)
+			if req.TotalSizeBytes != 10 || req.PartSizeBytes != 4 || req.CryptoMeta != "meta" {
+				t.Errorf("Unexpected initiate request %+v", req)
+			}
+			writeJSON(w, http.StatusOK, map[string]interface{}{"hasError": false, "blobId": "blob000000000001", "partSizeBytes": 4, "partCount": 3})
+		case strings.HasPrefix(r.URL.Path, "/api/blob/upload/part/"):
+			n, _ := strconv.Atoi(r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:])
+			if n == failPart {
+				failPart = 0
+				writeError(w, http.StatusInternalServerError, "GENERIC_SERVER_ERROR", "boom")
+				return
+			}
+			data, _ := io.ReadAll(r.Body)
+			if r.Header.Get(PartChecksumHeader) != sha256Hex(data) {
+				t.Errorf("Part %d sent with checksum %q", n, r.Header.Get(PartChecksumHeader))
+			}
+			parts[n] = data
+			writeJSON(w, http.StatusOK, map[string]interface{}{"hasError": false, "partNumber": n, "sizeBytes": len(data)})
+		case r.URL.Path == "/api/blob/upload/status":
+			missing := []int{}
+			for n := 1; n <= 3; n++ {
+				if parts[n] == nil {
+					missing = append(missing, n)
+				}
+			}
+			writeJSON(w, http.StatusOK, map[string]interface{}{"hasError": false, "blobId": "blob000000000001", "partCount": 3, "missingPartNumbers": missing})
+		case r.URL.Path == "/api/blob/upload/complete":
+			var req CompleteBlobUploadRequest
+			_ = json.NewDecoder(r.Body).Decode(&req)
+			completedWith = req.PartChecksums
+			writeJSON(w, http.StatusOK, map[string]interface{}{"hasError": false, "blobId": req.BlobID})
+		default:
+			t.Errorf("Unexpected request %s", r.URL.Path)
+		}
+	}))
+	defer srv.Close()
+
+	ctx := context.Background()
+	c := New(srv.URL, nil)
+	src := bytes.NewReader([]byte("0123456789"))
+	upload := &MultipartUpload{BucketID: "bucket0000000001", FileID: "file000000000001", CryptoMeta: "meta", Size: 10, PartSize: 4}
+
+	if err := c.UploadMultipart(ctx, upload, src); ErrorCode(err) != "GENERIC_SERVER_ERROR" {
+		t.Fatalf("Expected part 2 to fail, got %v", err)
+	}
+	if upload.BlobID != "blob000000000001" || completedWith != nil {
+		t.Fatalf("Unexpected state after failure: %+v, completed with %v", upload, completedWith)
+	}
+
+	delete(parts, 3) // only resent if the server reports it missing
+	parts[1] = []byte("kept")
+	if err := c.UploadMultipart(ctx, upload, src); err != nil {
+		t.Fatalf("Resume failed: %v", err)
+	}
+	if string(parts[1]) != "kept" || string(parts[2]) != "4567" || string(parts[3]) != "89" {
+		t.Errorf("Expected only the missing parts to be sent, got %q", parts)
+	}
+	want := []string{sha256Hex([]byte("0123")), sha256Hex([]byte("4567")), sha256Hex([]byte("89"))}
+	if strings.Join(completedWith, ",") != strings.Join(want, ",") {
+		t.Errorf("Expected completion with %v, got %v", want, completedWith)
+	}
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
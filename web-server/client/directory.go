@@ -0,0 +1,69 @@
+package client
+
+import "context"
+
+// CreateDirectory creates a directory.
+func (c *Client) CreateDirectory(ctx context.Context, req *CreateDirectoryRequest) (*CreateDirectoryResponse, error) {
+	var resp CreateDirectoryResponse
+	if err := c.postJSON(ctx, "/api/directory/create", req, &resp, true); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// GetDirectory returns a directory with its child directories and files.
+func (c *Client) GetDirectory(ctx context.Context, req *GetDirectoryRequest) (*GetDirectoryResponse, error) {
+	var resp GetDirectoryResponse
+	if err := c.postJSON(ctx, "/api/directory/get", req, &resp, true); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// RenameDirectory renames a directory.
+func (c *Client) RenameDirectory(ctx context.Context, req *RenameDirectoryRequest) error {
+	return c.postJSON(ctx, "/api/directory/rename", req, nil, true)
+}
+
+// MoveDirectory moves a directory to a new parent.
+func (c *Client) MoveDirectory(ctx context.Context, req *MoveDirectoryRequest) error {
+	return c.postJSON(ctx, "/api/directory/move", req, nil, true)
+}
+
+// DeleteDirectory deletes a directory and everything below it.
+func (c *Client) DeleteDirectory(ctx context.Context, req *DeleteDirectoryRequest) error {
+	return c.postJSON(ctx, "/api/directory/delete", req, nil, true)
+}
+
+// SetDirectoryMetaData replaces a directory's metadata.
+func (c *Client) SetDirectoryMetaData(ctx context.Context, req *SetDirectoryMetaDataRequest) error {
+	return c.postJSON(ctx, "/api/directory/set-metadata", req, nil, true)
+}
+
+// SetDirectoryEncryptedMetaData replaces a directory's encrypted metadata.
+func (c *Client) SetDirectoryEncryptedMetaData(ctx context.Context, req *SetDirectoryEncryptedMetaDataRequest) error {
+	return c.postJSON(ctx, "/api/directory/set-encrypted-metadata", req, nil, true)
+}
+
+// SetDirectoryPermissionOverride sets or clears a per-directory permission override.
+func (c *Client) SetDirectoryPermissionOverride(ctx context.Context, req *SetDirectoryPermissionOverrideRequest) error {
+	return c.postJSON(ctx, "/api/directory/set-permission-override", req, nil, true)
+}
+
+// ListDirectoryPermissionOverrides lists the overrides set on a directory.
+func (c *Client) ListDirectoryPermissionOverrides(ctx context.Context, req *ListDirectoryPermissionOverridesRequest) (*ListDirectoryPermissionOverridesResponse, error) {
+	var resp ListDirectoryPermissionOverridesResponse
+	if err := c.postJSON(ctx, "/api/directory/list-permission-overrides", req, &resp, true); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// GetEffectiveDirectoryPermissions returns a user's permissions on a directory after overrides.
+func (c *Client) GetEffectiveDirectoryPermissions(ctx context.Context, req *GetEffectiveDirectoryPermissionsRequest) (*GetEffectiveDirectoryPermissionsResponse, error) {
+	var resp GetEffectiveDirectoryPermissionsResponse
+	if err := c.postJSON(ctx, "/api/directory/get-effective-permissions", req, &resp, true); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
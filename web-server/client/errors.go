@@ -0,0 +1,37 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Error is an error response from the server. Code is the server's error code, e.g.
+// "BUCKET_NOT_FOUND" or "VALIDATION_ERROR"; it is empty if the server did not send the JSON
+// error envelope (e.g. a failing health probe).
+type Error struct {
+	StatusCode int
+	Code       string
+	Message    string
+	Details    interface{}
+}
+
+func (e *Error) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("nkrypt: HTTP %d: %s", e.StatusCode, e.Message)
+	}
+	return fmt.Sprintf("nkrypt: %s: %s", e.Code, e.Message)
+}
+
+// ErrorCode returns the server error code carried by err, or "" if err is not an *Error.
+func ErrorCode(err error) string {
+	var apiErr *Error
+	if errors.As(err, &apiErr) {
+		return apiErr.Code
+	}
+	return ""
+}
+
+// IsErrorCode reports whether err is a server error with the given code.
+func IsErrorCode(err error, code string) bool {
+	return err != nil && ErrorCode(err) == code
+}
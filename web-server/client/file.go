@@ -0,0 +1,46 @@
+package client
+
+import "context"
+
+// CreateFile creates a file entry. Upload its content with WriteBlob or UploadQuantized.
+func (c *Client) CreateFile(ctx context.Context, req *CreateFileRequest) (*CreateFileResponse, error) {
+	var resp CreateFileResponse
+	if err := c.postJSON(ctx, "/api/file/create", req, &resp, true); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// GetFile returns a file entry.
+func (c *Client) GetFile(ctx context.Context, req *GetFileRequest) (*GetFileResponse, error) {
+	var resp GetFileResponse
+	if err := c.postJSON(ctx, "/api/file/get", req, &resp, true); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// RenameFile renames a file.
+func (c *Client) RenameFile(ctx context.Context, req *RenameFileRequest) error {
+	return c.postJSON(ctx, "/api/file/rename", req, nil, true)
+}
+
+// MoveFile moves a file to another directory.
+func (c *Client) MoveFile(ctx context.Context, req *MoveFileRequest) error {
+	return c.postJSON(ctx, "/api/file/move", req, nil, true)
+}
+
+// DeleteFile deletes a file and its blobs.
+func (c *Client) DeleteFile(ctx context.Context, req *DeleteFileRequest) error {
+	return c.postJSON(ctx, "/api/file/delete", req, nil, true)
+}
+
+// SetFileMetaData replaces a file's metadata.
+func (c *Client) SetFileMetaData(ctx context.Context, req *SetFileMetaDataRequest) error {
+	return c.postJSON(ctx, "/api/file/set-metadata", req, nil, true)
+}
+
+// SetFileEncryptedMetaData replaces a file's encrypted metadata.
+func (c *Client) SetFileEncryptedMetaData(ctx context.Context, req *SetFileEncryptedMetaDataRequest) error {
+	return c.postJSON(ctx, "/api/file/set-encrypted-metadata", req, nil, true)
+}
@@ -0,0 +1,12 @@
+package client
+
+import "context"
+
+// ListGroups lists all user groups.
+func (c *Client) ListGroups(ctx context.Context) (*GroupListResponse, error) {
+	var resp GroupListResponse
+	if err := c.postJSON(ctx, "/api/group/list", nil, &resp, true); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
@@ -0,0 +1,68 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// GetMetricsSummary returns the usage of the user and of the buckets they can access. Disk is
+// only set for users with MANAGE_ALL_USER.
+func (c *Client) GetMetricsSummary(ctx context.Context) (*MetricsGetSummaryResponse, error) {
+	var resp MetricsGetSummaryResponse
+	if err := c.postJSON(ctx, "/api/metrics/get-summary", nil, &resp, true); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Healthz returns nil if the server process is running.
+func (c *Client) Healthz(ctx context.Context) error {
+	_, err := c.getText(ctx, "/healthz")
+	return err
+}
+
+// Readyz returns nil if the server and its dependencies are ready to serve requests.
+func (c *Client) Readyz(ctx context.Context) error {
+	_, err := c.getText(ctx, "/readyz")
+	return err
+}
+
+// PrometheusMetrics returns the server's Prometheus metrics in the text exposition format.
+func (c *Client) PrometheusMetrics(ctx context.Context) (string, error) {
+	return c.getText(ctx, "/metrics")
+}
+
+// PrometheusMetricsWithToken is PrometheusMetrics for a server that protects /metrics with a
+// bearer token (NK_METRICS_BEARER_TOKEN).
+func (c *Client) PrometheusMetricsWithToken(ctx context.Context, token string) (string, error) {
+	return c.getText(ctx, "/metrics", "Bearer "+token)
+}
+
+// getText GETs a plain-text endpoint that does not use the API key, sending authorization if it
+// is given; any status other than 200 is an *Error.
+func (c *Client) getText(ctx context.Context, path string, authorization ...string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+path, nil)
+	if err != nil {
+		return "", fmt.Errorf("client: build request: %w", err)
+	}
+	for _, value := range authorization {
+		req.Header.Set("Authorization", value)
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("client: GET %s: %w", path, err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("client: read response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", &Error{StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(data))}
+	}
+	return string(data), nil
+}
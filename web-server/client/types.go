@@ -0,0 +1,113 @@
+package client
+
+import "github.com/nkrypt-xyz/nkrypt-xyz-web-server/internal/model"
+
+// The request and response types are aliases of the server models so they cannot drift from the
+// API. They are exported here because internal/model cannot be imported outside this module.
+
+// Requests
+type (
+	LoginRequest                            = model.LoginRequest
+	AssertRequest                           = model.AssertRequest
+	LogoutRequest                           = model.LogoutRequest
+	LogoutAllSessionsRequest                = model.LogoutAllSessionsRequest
+	UpdateProfileRequest                    = model.UpdateProfileRequest
+	UpdatePasswordRequest                   = model.UpdatePasswordRequest
+	FindUserFilter                          = model.FindUserFilter
+	FindUserRequest                         = model.FindUserRequest
+	CreateBucketRequest                     = model.CreateBucketRequest
+	RenameBucketRequest                     = model.RenameBucketRequest
+	SetBucketMetaDataRequest                = model.SetBucketMetaDataRequest
+	SetBucketCompressionRequest             = model.SetBucketCompressionRequest
+	SetBucketAuthorizationRequest           = model.SetBucketAuthorizationRequest
+	SetBucketGroupAuthorizationRequest      = model.SetBucketGroupAuthorizationRequest
+	RemoveBucketMemberRequest               = model.RemoveBucketMemberRequest
+	TransferBucketOwnershipRequest          = model.TransferBucketOwnershipRequest
+	ListBucketMembersRequest                = model.ListBucketMembersRequest
+	ExportBucketRequest                     = model.ExportBucketRequest
+	DestroyBucketRequest                    = model.DestroyBucketRequest
+	CreateDirectoryRequest                  = model.CreateDirectoryRequest
+	GetDirectoryRequest                     = model.GetDirectoryRequest
+	RenameDirectoryRequest                  = model.RenameDirectoryRequest
+	MoveDirectoryRequest                    = model.MoveDirectoryRequest
+	DeleteDirectoryRequest                  = model.DeleteDirectoryRequest
+	SetDirectoryMetaDataRequest             = model.SetDirectoryMetaDataRequest
+	SetDirectoryEncryptedMetaDataRequest    = model.SetDirectoryEncryptedMetaDataRequest
+	SetDirectoryPermissionOverrideRequest   = model.SetDirectoryPermissionOverrideRequest
+	ListDirectoryPermissionOverridesRequest = model.ListDirectoryPermissionOverridesRequest
+	GetEffectiveDirectoryPermissionsRequest = model.GetEffectiveDirectoryPermissionsRequest
+	CreateFileRequest                       = model.CreateFileRequest
+	GetFileRequest                          = model.GetFileRequest
+	RenameFileRequest                       = model.RenameFileRequest
+	MoveFileRequest                         = model.MoveFileRequest
+	DeleteFileRequest                       = model.DeleteFileRequest
+	SetFileMetaDataRequest                  = model.SetFileMetaDataRequest
+	SetFileEncryptedMetaDataRequest         = model.SetFileEncryptedMetaDataRequest
+	AddUserRequest                          = model.AddUserRequest
+	SetGlobalPermissionsRequest             = model.SetGlobalPermissionsRequest
+	SetBanningStatusRequest                 = model.SetBanningStatusRequest
+	OverwriteUserPasswordRequest            = model.OverwriteUserPasswordRequest
+	DeleteUserRequest                       = model.DeleteUserRequest
+	InvitationBucketGrantRequest            = model.InvitationBucketGrantRequest
+	CreateInvitationRequest                 = model.CreateInvitationRequest
+	RevokeInvitationRequest                 = model.RevokeInvitationRequest
+	RedeemInvitationRequest                 = model.RedeemInvitationRequest
+	RegisterRequest                         = model.RegisterRequest
+	CreateGroupRequest                      = model.CreateGroupRequest
+	DeleteGroupRequest                      = model.DeleteGroupRequest
+	AddGroupMemberRequest                   = model.AddGroupMemberRequest
+	RemoveGroupMemberRequest                = model.RemoveGroupMemberRequest
+	InitiateBlobUploadRequest               = model.InitiateBlobUploadRequest
+	BlobUploadRequest                       = model.BlobUploadRequest
+	CompleteBlobUploadRequest               = model.CompleteBlobUploadRequest
+)
+
+// Responses
+type (
+	UserResponse                             = model.UserResponse
+	SessionResponse                          = model.SessionResponse
+	DirectoryResponse                        = model.DirectoryResponse
+	FileResponse                             = model.FileResponse
+	BucketAuthorizationResponse              = model.BucketAuthorizationResponse
+	BucketGroupAuthorizationResponse         = model.BucketGroupAuthorizationResponse
+	BucketResponse                           = model.BucketResponse
+	BucketMemberResponse                     = model.BucketMemberResponse
+	GroupResponse                            = model.GroupResponse
+	UserListItemResponse                     = model.UserListItemResponse
+	CreateDirectoryResponse                  = model.CreateDirectoryResponse
+	GetDirectoryResponse                     = model.GetDirectoryResponse
+	DirectoryPermissionOverrideResponse      = model.DirectoryPermissionOverrideResponse
+	ListDirectoryPermissionOverridesResponse = model.ListDirectoryPermissionOverridesResponse
+	GetEffectiveDirectoryPermissionsResponse = model.GetEffectiveDirectoryPermissionsResponse
+	CreateFileResponse                       = model.CreateFileResponse
+	GetFileResponse                          = model.GetFileResponse
+	CreateBucketResponse                     = model.CreateBucketResponse
+	ListBucketMembersResponse                = model.ListBucketMembersResponse
+	BucketListResponse                       = model.BucketListResponse
+	LoginResponse                            = model.LoginResponse
+	AssertResponse                           = model.AssertResponse
+	UserListResponse                         = model.UserListResponse
+	FindUserResponse                         = model.FindUserResponse
+	SessionListResponse                      = model.SessionListResponse
+	CreateBlobResponse                       = model.CreateBlobResponse
+	WriteQuantizedResponse                   = model.WriteQuantizedResponse
+	InitiateBlobUploadResponse               = model.InitiateBlobUploadResponse
+	BlobUploadPartResponse                   = model.BlobUploadPartResponse
+	UploadBlobPartResponse                   = model.UploadBlobPartResponse
+	BlobUploadStatusResponse                 = model.BlobUploadStatusResponse
+	AddUserResponse                          = model.AddUserResponse
+	RegisterResponse                         = model.RegisterResponse
+	CreateInvitationResponse                 = model.CreateInvitationResponse
+	InvitationBucketGrantResponse            = model.InvitationBucketGrantResponse
+	InvitationResponse                       = model.InvitationResponse
+	InvitationListResponse                   = model.InvitationListResponse
+	CreateGroupResponse                      = model.CreateGroupResponse
+	GroupListResponse                        = model.GroupListResponse
+	EmptySuccessResponse                     = model.EmptySuccessResponse
+	VersionResponse                          = model.VersionResponse
+	MetricsDiskResponse                      = model.MetricsDiskResponse
+	MetricsUsageResponse                     = model.MetricsUsageResponse
+	MetricsBucketUsageResponse               = model.MetricsBucketUsageResponse
+	MetricsGetSummaryResponse                = model.MetricsGetSummaryResponse
+	SessionListItem                          = model.SessionListItem
+)
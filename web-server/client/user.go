@@ -0,0 +1,85 @@
+package client
+
+import "context"
+
+// Logout expires the current session and forgets the stored credentials.
+func (c *Client) Logout(ctx context.Context, message string) error {
+	if err := c.postJSON(ctx, "/api/user/logout", &LogoutRequest{Message: message}, nil, true); err != nil {
+		return err
+	}
+	c.clearSession()
+	return nil
+}
+
+// LogoutAllSessions expires every session of the current user and forgets the stored credentials.
+func (c *Client) LogoutAllSessions(ctx context.Context, message string) error {
+	if err := c.postJSON(ctx, "/api/user/logout-all-sessions", &LogoutAllSessionsRequest{Message: message}, nil, true); err != nil {
+		return err
+	}
+	c.clearSession()
+	return nil
+}
+
+// Register creates an account when the server allows open registration. It does not log in.
+func (c *Client) Register(ctx context.Context, req *RegisterRequest) (*RegisterResponse, error) {
+	var resp RegisterResponse
+	if err := c.postJSON(ctx, "/api/user/register", req, &resp, false); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// RedeemInvitation creates an account from an invitation token. It does not log in.
+func (c *Client) RedeemInvitation(ctx context.Context, req *RedeemInvitationRequest) (*RegisterResponse, error) {
+	var resp RegisterResponse
+	if err := c.postJSON(ctx, "/api/user/redeem-invitation", req, &resp, false); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Assert returns the user and session behind the current API key.
+func (c *Client) Assert(ctx context.Context) (*AssertResponse, error) {
+	var resp AssertResponse
+	if err := c.postJSON(ctx, "/api/user/assert", nil, &resp, true); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// ListAllSessions lists the sessions of the current user.
+func (c *Client) ListAllSessions(ctx context.Context) (*SessionListResponse, error) {
+	var resp SessionListResponse
+	if err := c.postJSON(ctx, "/api/user/list-all-sessions", nil, &resp, true); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// ListUsers lists all users.
+func (c *Client) ListUsers(ctx context.Context) (*UserListResponse, error) {
+	var resp UserListResponse
+	if err := c.postJSON(ctx, "/api/user/list", nil, &resp, true); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// FindUsers looks up users by user name or ID.
+func (c *Client) FindUsers(ctx context.Context, req *FindUserRequest) (*FindUserResponse, error) {
+	var resp FindUserResponse
+	if err := c.postJSON(ctx, "/api/user/find", req, &resp, true); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// UpdateProfile changes the current user's display name.
+func (c *Client) UpdateProfile(ctx context.Context, req *UpdateProfileRequest) error {
+	return c.postJSON(ctx, "/api/user/update-profile", req, nil, true)
+}
+
+// UpdatePassword changes the current user's password.
+func (c *Client) UpdatePassword(ctx context.Context, req *UpdatePasswordRequest) error {
+	return c.postJSON(ctx, "/api/user/update-password", req, nil, true)
+}
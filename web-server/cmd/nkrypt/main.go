@@ -0,0 +1,17 @@
+// Command nkrypt is a command-line client for the nkrypt-xyz web server.
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+
+	"github.com/nkrypt-xyz/nkrypt-xyz-web-server/internal/cli"
+)
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	code := cli.Run(ctx, os.Args[1:], os.Stdin, os.Stdout, os.Stderr)
+	stop()
+	os.Exit(code)
+}
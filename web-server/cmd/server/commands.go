@@ -0,0 +1,892 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/redis/go-redis/v9"
+
+	"github.com/nkrypt-xyz/nkrypt-xyz-web-server/internal/config"
+	"github.com/nkrypt-xyz/nkrypt-xyz-web-server/internal/model"
+	"github.com/nkrypt-xyz/nkrypt-xyz-web-server/internal/pkg/migrate"
+	"github.com/nkrypt-xyz/nkrypt-xyz-web-server/internal/pkg/storage"
+	"github.com/nkrypt-xyz/nkrypt-xyz-web-server/internal/repository"
+	"github.com/nkrypt-xyz/nkrypt-xyz-web-server/internal/service"
+	"github.com/nkrypt-xyz/nkrypt-xyz-web-server/migrations"
+)
+
+const usage = `Usage: nkrypt-server [command]
+
+Commands:
+  serve                                   Start the HTTP server (default)
+  migrate up|down [N]|status [--path DIR] Apply, revert or show database migrations
+  reset-admin [--password-stdin]          Create the default admin, or restore its password,
+                                          permissions and ban status
+  users                                   List users
+  sessions [--user NAME] [--all] [--limit N]
+                                          List sessions, newest first
+  expire-sessions --user NAME | --session ID [--reason TEXT]
+                                          Force-expire sessions
+  fsck [--repair]                         Check that blobs and stored objects match
+  export-bucket --bucket ID|NAME [--output FILE]
+                                          Write a bucket to a tar archive, or to stdout
+  import-bucket --owner NAME [--name NAME] [--input FILE]
+                                          Create a bucket from a tar archive, or from stdin
+  backup --output DIR|s3://BUCKET/PREFIX  Write a consistent snapshot of the instance
+  restore --input DIR|s3://BUCKET/PREFIX  Rebuild an empty instance from a snapshot
+  replication [--backfill]                Show the replication queue, or queue every finished
+                                          blob for replication
+  tiering [--run]                         Count blobs by storage tier, or move blobs matching
+                                          the tiering rules now
+  config                                  Print the effective configuration, secrets redacted
+
+Commands that print results accept --json. Configuration is read from the environment as for serve.`
+
+var errUsage = errors.New("usage")
+
+// adminCommands are the subcommands besides serve
+var adminCommands = map[string]func(*command, []string) error{
+	"migrate":         (*command).migrate,
+	"reset-admin":     (*command).resetAdmin,
+	"users":           (*command).users,
+	"sessions":        (*command).sessions,
+	"expire-sessions": (*command).expireSessions,
+	"fsck":            (*command).fsck,
+	"export-bucket":   (*command).exportBucket,
+	"import-bucket":   (*command).importBucket,
+	"backup":          (*command).backup,
+	"restore":         (*command).restore,
+	"replication":     (*command).replication,
+	"tiering":         (*command).tiering,
+	"config":          (*command).config,
+}
+
+// command holds the state of one admin subcommand. Dependencies are opened on first use.
+type command struct {
+	ctx    context.Context
+	cfg    *config.Config
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+	json   bool
+
+	db    *pgxpool.Pool
+	redis *redis.Client
+}
+
+// runCommand runs an admin subcommand and returns the process exit code
+func runCommand(args []string) int {
+	run, ok := adminCommands[args[0]]
+	if !ok {
+		if args[0] != "help" && args[0] != "-h" && args[0] != "--help" {
+			fmt.Fprintf(os.Stderr, "unknown command %q\n\n", args[0])
+		}
+		fmt.Fprintln(os.Stderr, usage)
+		return 2
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		return 1
+	}
+	// Keep stdout for the command output
+	setupLogging(cfg, os.Stderr)
+
+	c := &command{ctx: context.Background(), cfg: cfg, stdin: os.Stdin, stdout: os.Stdout, stderr: os.Stderr}
+	defer c.close()
+
+	err = run(c, args[1:])
+	switch {
+	case errors.Is(err, errUsage):
+		return 2
+	case err != nil:
+		fmt.Fprintln(os.Stderr, "error:", err)
+		return 1
+	}
+	return 0
+}
+
+// flags returns a flag set for name with the common --json flag
+func (c *command) flags(name, usageLine string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(c.stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(c.stderr, "Usage: nkrypt-server %s\n", usageLine)
+		fs.PrintDefaults()
+	}
+	fs.BoolVar(&c.json, "json", false, "print the result as JSON")
+	return fs
+}
+
+// output prints result as JSON with --json, and as a table otherwise
+func (c *command) output(result interface{}, table func(w io.Writer)) error {
+	if c.json {
+		enc := json.NewEncoder(c.stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(result)
+	}
+	tw := tabwriter.NewWriter(c.stdout, 0, 4, 2, ' ', 0)
+	table(tw)
+	return tw.Flush()
+}
+
+func (c *command) database() (*pgxpool.Pool, error) {
+	if c.db != nil {
+		return c.db, nil
+	}
+	db, err := pgxpool.New(c.ctx, c.cfg.Database.URL)
+	if err != nil {
+		return nil, fmt.Errorf("create PostgreSQL pool: %w", err)
+	}
+	if err := db.Ping(c.ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("ping PostgreSQL: %w", err)
+	}
+	c.db = db
+	return db, nil
+}
+
+func (c *command) redisClient() (*redis.Client, error) {
+	if c.redis != nil {
+		return c.redis, nil
+	}
+	client := redis.NewClient(&redis.Options{
+		Addr:     c.cfg.Redis.Addr,
+		Password: c.cfg.Redis.Password,
+		DB:       c.cfg.Redis.DB,
+	})
+	if err := client.Ping(c.ctx).Err(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("ping Redis: %w", err)
+	}
+	c.redis = client
+	return client, nil
+}
+
+func (c *command) storageClient() (*storage.MinIOClient, error) {
+	redisClient, err := c.redisClient()
+	if err != nil {
+		return nil, err
+	}
+	client, err := storage.NewMinIOClient(
+		c.cfg.MinIO.Endpoint,
+		c.cfg.MinIO.AccessKey,
+		c.cfg.MinIO.SecretKey,
+		c.cfg.MinIO.BucketName,
+		c.cfg.MinIO.UseSSL,
+		redisClient,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if err := setColdTier(c.cfg, client); err != nil {
+		return nil, err
+	}
+	return client, nil
+}
+
+func (c *command) sessionService() (*service.SessionService, error) {
+	db, err := c.database()
+	if err != nil {
+		return nil, err
+	}
+	redisClient, err := c.redisClient()
+	if err != nil {
+		return nil, err
+	}
+	return service.NewSessionService(redisClient, repository.NewSessionRepository(db), c.cfg), nil
+}
+
+func (c *command) bucketArchiveService() (*service.BucketArchiveService, *service.BucketService, error) {
+	db, err := c.database()
+	if err != nil {
+		return nil, nil, err
+	}
+	storageClient, err := c.storageClient()
+	if err != nil {
+		return nil, nil, err
+	}
+	replicationSvc, err := newReplicationService(c.cfg, db, storageClient)
+	if err != nil {
+		return nil, nil, err
+	}
+	directoryRepo := repository.NewDirectoryRepository(db)
+	bucketSvc := service.NewBucketService(repository.NewBucketRepository(db), directoryRepo, repository.NewGroupRepository(db), repository.NewUserRepository(db))
+	blobSvc := service.NewBlobService(repository.NewBlobRepository(db), storageClient, replicationSvc, c.cfg)
+	return service.NewBucketArchiveService(bucketSvc, directoryRepo, repository.NewFileRepository(db), blobSvc), bucketSvc, nil
+}
+
+func (c *command) backupService() (*service.BackupService, error) {
+	db, err := c.database()
+	if err != nil {
+		return nil, err
+	}
+	storageClient, err := c.storageClient()
+	if err != nil {
+		return nil, err
+	}
+	m, err := newMigrator("", db)
+	if err != nil {
+		return nil, err
+	}
+	replicationSvc, err := newReplicationService(c.cfg, db, storageClient)
+	if err != nil {
+		return nil, err
+	}
+	blobSvc := service.NewBlobService(repository.NewBlobRepository(db), storageClient, replicationSvc, c.cfg)
+	return service.NewBackupService(repository.NewSnapshotRepository(db), blobSvc, storageClient, m), nil
+}
+
+// backupTarget opens a local directory, or a bucket prefix in the backup object store for an
+// s3://BUCKET/PREFIX location
+func (c *command) backupTarget(location string) (storage.BackupTarget, error) {
+	rest, ok := strings.CutPrefix(location, "s3://")
+	if !ok {
+		return storage.NewDirBackupTarget(location), nil
+	}
+	bucket, prefix, _ := strings.Cut(rest, "/")
+	if bucket == "" {
+		return nil, fmt.Errorf("no bucket in %q", location)
+	}
+	cfg := c.cfg.Backup
+	if cfg.Endpoint == "" {
+		cfg = config.BackupConfig{Endpoint: c.cfg.MinIO.Endpoint, AccessKey: c.cfg.MinIO.AccessKey, SecretKey: c.cfg.MinIO.SecretKey, UseSSL: c.cfg.MinIO.UseSSL}
+	}
+	return storage.NewS3BackupTarget(cfg.Endpoint, cfg.AccessKey, cfg.SecretKey, cfg.UseSSL, bucket, prefix)
+}
+
+func (c *command) close() {
+	if c.db != nil {
+		c.db.Close()
+	}
+	if c.redis != nil {
+		c.redis.Close()
+	}
+}
+
+// migrate handles "migrate up|down [N]|status"
+func (c *command) migrate(args []string) error {
+	fs := c.flags("migrate", "migrate up|down [N]|status [--path DIR] [--json]")
+	path := fs.String("path", "", "directory with the migration files (default: the migrations built into the binary)")
+	if len(args) == 0 {
+		fs.Usage()
+		return errUsage
+	}
+	if err := fs.Parse(args[1:]); err != nil {
+		return errUsage
+	}
+
+	steps := 1
+	switch {
+	case args[0] == "down" && fs.NArg() == 1:
+		n, err := strconv.Atoi(fs.Arg(0))
+		if err != nil || n < 1 {
+			fs.Usage()
+			return errUsage
+		}
+		steps = n
+	case (args[0] == "up" || args[0] == "down" || args[0] == "status") && fs.NArg() == 0:
+	default:
+		fs.Usage()
+		return errUsage
+	}
+
+	db, err := c.database()
+	if err != nil {
+		return err
+	}
+	m, err := newMigrator(*path, db)
+	if err != nil {
+		return err
+	}
+
+	var changed []migrate.Migration
+	switch args[0] {
+	case "up":
+		changed, err = m.Up(c.ctx)
+	case "down":
+		changed, err = m.Down(c.ctx, steps)
+	}
+	// Report what was done even if a later migration failed
+	for _, migration := range changed {
+		fmt.Fprintf(c.stderr, "%s %d_%s\n", args[0], migration.Version, migration.Name)
+	}
+	if err != nil {
+		return err
+	}
+
+	status, err := m.Status(c.ctx)
+	if err != nil {
+		return err
+	}
+	pending := make([]string, 0, len(status.Pending))
+	for _, migration := range status.Pending {
+		pending = append(pending, fmt.Sprintf("%d_%s", migration.Version, migration.Name))
+	}
+	result := map[string]interface{}{
+		"version": status.Version,
+		"dirty":   status.Dirty,
+		"latest":  status.Latest,
+		"pending": pending,
+	}
+	return c.output(result, func(w io.Writer) {
+		fmt.Fprintf(w, "Version:\t%d\n", status.Version)
+		fmt.Fprintf(w, "Latest:\t%d\n", status.Latest)
+		fmt.Fprintf(w, "Dirty:\t%t\n", status.Dirty)
+		if len(pending) == 0 {
+			fmt.Fprintln(w, "Pending:\t-")
+		} else {
+			fmt.Fprintf(w, "Pending:\t%s\n", strings.Join(pending, ", "))
+		}
+	})
+}
+
+// newMigrator returns a migrator for the migrations in dir, or for the embedded ones if dir is empty
+func newMigrator(dir string, db *pgxpool.Pool) (*migrate.Migrator, error) {
+	fsys := fs.FS(migrations.FS)
+	if dir != "" {
+		fsys = os.DirFS(dir)
+	}
+	all, err := migrate.Load(fsys)
+	if err != nil {
+		return nil, err
+	}
+	return migrate.New(db, all), nil
+}
+
+// resetAdmin handles "reset-admin"
+func (c *command) resetAdmin(args []string) error {
+	fs := c.flags("reset-admin", "reset-admin [--password-stdin] [--json]")
+	passwordStdin := fs.Bool("password-stdin", false, "read the new password from stdin instead of NK_IAM_DEFAULT_ADMIN_PASSWORD")
+	if err := fs.Parse(args); err != nil || fs.NArg() != 0 {
+		return errUsage
+	}
+
+	password := c.cfg.IAM.DefaultAdminPassword
+	if *passwordStdin {
+		line, err := bufio.NewReader(c.stdin).ReadString('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return err
+		}
+		password = strings.TrimRight(line, "\r\n")
+	}
+	if password == "" {
+		return errors.New("the new password is empty")
+	}
+
+	db, err := c.database()
+	if err != nil {
+		return err
+	}
+	sessionSvc, err := c.sessionService()
+	if err != nil {
+		return err
+	}
+	adminSvc := service.NewAdminService(repository.NewUserRepository(db), sessionSvc, c.cfg)
+	created, err := adminSvc.ResetDefaultAdmin(c.ctx, password)
+	if err != nil {
+		return err
+	}
+
+	userName := c.cfg.IAM.DefaultAdminUsername
+	return c.output(map[string]interface{}{"userName": userName, "created": created}, func(w io.Writer) {
+		if created {
+			fmt.Fprintf(w, "Created admin user %s\n", userName)
+		} else {
+			fmt.Fprintf(w, "Reset admin user %s and expired its sessions\n", userName)
+		}
+	})
+}
+
+// users handles "users"
+func (c *command) users(args []string) error {
+	fs := c.flags("users", "users [--json]")
+	if err := fs.Parse(args); err != nil || fs.NArg() != 0 {
+		return errUsage
+	}
+	db, err := c.database()
+	if err != nil {
+		return err
+	}
+	users, err := repository.NewUserRepository(db).ListAllUsers(c.ctx)
+	if err != nil {
+		return err
+	}
+
+	result := make([]map[string]interface{}, 0, len(users))
+	for _, u := range users {
+		result = append(result, map[string]interface{}{
+			"_id":         u.ID,
+			"userName":    u.UserName,
+			"displayName": u.DisplayName,
+			"isBanned":    u.IsBanned,
+		})
+	}
+	return c.output(result, func(w io.Writer) {
+		fmt.Fprintln(w, "ID\tUSER\tDISPLAY NAME\tBANNED")
+		for _, u := range users {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%t\n", u.ID, u.UserName, u.DisplayName, u.IsBanned)
+		}
+	})
+}
+
+// sessions handles "sessions"
+func (c *command) sessions(args []string) error {
+	fs := c.flags("sessions", "sessions [--user NAME] [--all] [--limit N] [--json]")
+	userName := fs.String("user", "", "only list the sessions of this user")
+	all := fs.Bool("all", false, "include expired sessions")
+	limit := fs.Int("limit", 100, "maximum number of sessions to list")
+	if err := fs.Parse(args); err != nil || fs.NArg() != 0 || *limit < 1 {
+		return errUsage
+	}
+
+	db, err := c.database()
+	if err != nil {
+		return err
+	}
+	userRepo := repository.NewUserRepository(db)
+	users, err := userRepo.ListAllUsers(c.ctx)
+	if err != nil {
+		return err
+	}
+	names := make(map[string]string, len(users))
+	var userID string
+	for _, u := range users {
+		names[u.ID] = u.UserName
+		if u.UserName == *userName {
+			userID = u.ID
+		}
+	}
+	if *userName != "" && userID == "" {
+		return fmt.Errorf("user %q not found", *userName)
+	}
+
+	sessions, err := repository.NewSessionRepository(db).ListSessions(c.ctx, userID, *all, int32(*limit))
+	if err != nil {
+		return err
+	}
+
+	result := make([]map[string]interface{}, 0, len(sessions))
+	for _, s := range sessions {
+		item := map[string]interface{}{
+			"_id":        s.ID,
+			"userId":     s.UserID,
+			"userName":   names[s.UserID],
+			"hasExpired": s.HasExpired,
+			"createdAt":  s.CreatedAt.UnixMilli(),
+		}
+		if s.ExpiredAt != nil {
+			item["expiredAt"] = s.ExpiredAt.UnixMilli()
+		}
+		if s.ExpireReason != nil {
+			item["expireReason"] = *s.ExpireReason
+		}
+		result = append(result, item)
+	}
+	return c.output(result, func(w io.Writer) {
+		fmt.Fprintln(w, "ID\tUSER\tCREATED\tEXPIRED\tREASON")
+		for _, s := range sessions {
+			expired, reason := "-", "-"
+			if s.ExpiredAt != nil {
+				expired = s.ExpiredAt.Format(time.RFC3339)
+			}
+			if s.ExpireReason != nil {
+				reason = *s.ExpireReason
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", s.ID, names[s.UserID], s.CreatedAt.Format(time.RFC3339), expired, reason)
+		}
+	})
+}
+
+// expireSessions handles "expire-sessions"
+func (c *command) expireSessions(args []string) error {
+	fs := c.flags("expire-sessions", "expire-sessions --user NAME | --session ID [--reason TEXT] [--json]")
+	userName := fs.String("user", "", "expire all sessions of this user")
+	sessionID := fs.String("session", "", "expire the session with this ID")
+	reason := fs.String("reason", "Expired by an administrator", "reason recorded on the sessions")
+	if err := fs.Parse(args); err != nil || fs.NArg() != 0 || (*userName == "") == (*sessionID == "") {
+		fs.Usage()
+		return errUsage
+	}
+
+	db, err := c.database()
+	if err != nil {
+		return err
+	}
+	sessionSvc, err := c.sessionService()
+	if err != nil {
+		return err
+	}
+
+	result := map[string]interface{}{}
+	if *sessionID != "" {
+		if err := sessionSvc.ForceExpireSessionByID(c.ctx, *sessionID, *reason); err != nil {
+			return err
+		}
+		result["sessionId"] = *sessionID
+	} else {
+		u, err := repository.NewUserRepository(db).FindUserByUserName(c.ctx, *userName)
+		if err != nil {
+			return fmt.Errorf("user %q not found", *userName)
+		}
+		if err := sessionSvc.ExpireAllSessionsByUserID(c.ctx, u.ID, *reason); err != nil {
+			return err
+		}
+		result["userId"] = u.ID
+	}
+	return c.output(result, func(w io.Writer) {
+		if *sessionID != "" {
+			fmt.Fprintf(w, "Expired session %s\n", *sessionID)
+		} else {
+			fmt.Fprintf(w, "Expired all sessions of %s\n", *userName)
+		}
+	})
+}
+
+// fsck handles "fsck". It fails while unrepaired issues remain, so it can be used in scripts.
+func (c *command) fsck(args []string) error {
+	fs := c.flags("fsck", "fsck [--repair] [--json]")
+	repair := fs.Bool("repair", false, "fix the issues found")
+	if err := fs.Parse(args); err != nil || fs.NArg() != 0 {
+		return errUsage
+	}
+
+	db, err := c.database()
+	if err != nil {
+		return err
+	}
+	storageClient, err := c.storageClient()
+	if err != nil {
+		return err
+	}
+	replicationSvc, err := newReplicationService(c.cfg, db, storageClient)
+	if err != nil {
+		return err
+	}
+	report, repairErr := service.NewConsistencyService(repository.NewBlobRepository(db), storageClient, replicationSvc).Check(c.ctx, *repair)
+	if report == nil {
+		return repairErr
+	}
+
+	if err := c.output(report, func(w io.Writer) {
+		fmt.Fprintf(w, "Checked %d blobs and %d objects, found %d issues\n", report.BlobsChecked, report.ObjectsChecked, len(report.Issues))
+		if len(report.Issues) == 0 {
+			return
+		}
+		fmt.Fprintln(w, "ISSUE\tBLOB\tOBJECT\tREPAIRED")
+		for _, issue := range report.Issues {
+			blob, object := issue.BlobID, issue.ObjectKey
+			if blob == "" {
+				blob = "-"
+			}
+			if object == "" {
+				object = "-"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%t\n", issue.Kind, blob, object, issue.Repaired)
+		}
+	}); err != nil {
+		return err
+	}
+
+	if repairErr != nil {
+		return repairErr
+	}
+	for _, issue := range report.Issues {
+		if !issue.Repaired {
+			return fmt.Errorf("%d issues found; run with --repair to fix them", len(report.Issues))
+		}
+	}
+	return nil
+}
+
+// exportBucket handles "export-bucket". The archive goes to stdout unless --output is given.
+func (c *command) exportBucket(args []string) error {
+	fs := c.flags("export-bucket", "export-bucket --bucket ID|NAME [--output FILE] [--json]")
+	bucketRef := fs.String("bucket", "", "ID or name of the bucket to export")
+	output := fs.String("output", "-", "file to write the archive to, - for stdout")
+	if err := fs.Parse(args); err != nil || fs.NArg() != 0 || *bucketRef == "" {
+		fs.Usage()
+		return errUsage
+	}
+
+	archiveSvc, bucketSvc, err := c.bucketArchiveService()
+	if err != nil {
+		return err
+	}
+	bucket, _ := bucketSvc.FindBucketByID(c.ctx, *bucketRef)
+	if bucket == nil {
+		bucket, _ = bucketSvc.FindBucketByName(c.ctx, *bucketRef)
+	}
+	if bucket == nil {
+		return fmt.Errorf("bucket %q not found", *bucketRef)
+	}
+
+	export, err := archiveSvc.PrepareExport(c.ctx, bucket.ID, nil)
+	if err != nil {
+		return err
+	}
+	defer export.Close()
+
+	if *output == "-" {
+		return archiveSvc.WriteExport(c.ctx, export, c.stdout)
+	}
+	f, err := os.OpenFile(*output, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return err
+	}
+	if err := archiveSvc.WriteExport(c.ctx, export, f); err != nil {
+		f.Close()
+		os.Remove(*output)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	result := map[string]interface{}{
+		"bucketId":    bucket.ID,
+		"name":        bucket.Name,
+		"directories": len(export.Manifest.Directories),
+		"files":       len(export.Manifest.Files),
+		"output":      *output,
+	}
+	return c.output(result, func(w io.Writer) {
+		fmt.Fprintf(w, "Exported bucket %s with %d directories and %d files to %s\n", bucket.Name, len(export.Manifest.Directories), len(export.Manifest.Files), *output)
+	})
+}
+
+// importBucket handles "import-bucket". The archive is read from stdin unless --input is given.
+func (c *command) importBucket(args []string) error {
+	fs := c.flags("import-bucket", "import-bucket --owner NAME [--name NAME] [--input FILE] [--json]")
+	owner := fs.String("owner", "", "user name of the owner of the new bucket")
+	name := fs.String("name", "", "name of the new bucket (default: the name in the archive)")
+	input := fs.String("input", "-", "file to read the archive from, - for stdin")
+	if err := fs.Parse(args); err != nil || fs.NArg() != 0 || *owner == "" {
+		fs.Usage()
+		return errUsage
+	}
+
+	db, err := c.database()
+	if err != nil {
+		return err
+	}
+	u, err := repository.NewUserRepository(db).FindUserByUserName(c.ctx, *owner)
+	if err != nil {
+		return fmt.Errorf("user %q not found", *owner)
+	}
+	archiveSvc, _, err := c.bucketArchiveService()
+	if err != nil {
+		return err
+	}
+
+	archive := c.stdin
+	if *input != "-" {
+		f, err := os.Open(*input)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		archive = f
+	}
+	bucket, rootDirID, err := archiveSvc.Import(c.ctx, archive, *name, u.ID)
+	if err != nil {
+		return err
+	}
+
+	result := map[string]interface{}{
+		"bucketId":        bucket.ID,
+		"name":            bucket.Name,
+		"rootDirectoryId": rootDirID,
+	}
+	return c.output(result, func(w io.Writer) {
+		fmt.Fprintf(w, "Imported bucket %s as %s, owned by %s\n", bucket.Name, bucket.ID, *owner)
+	})
+}
+
+// backup handles "backup"
+func (c *command) backup(args []string) error {
+	fs := c.flags("backup", "backup --output DIR|s3://BUCKET/PREFIX [--json]")
+	output := fs.String("output", "", "directory, or s3://BUCKET/PREFIX in the backup object store, to write the backup to")
+	if err := fs.Parse(args); err != nil || fs.NArg() != 0 || *output == "" {
+		fs.Usage()
+		return errUsage
+	}
+
+	target, err := c.backupTarget(*output)
+	if err != nil {
+		return err
+	}
+	backupSvc, err := c.backupService()
+	if err != nil {
+		return err
+	}
+	manifest, err := backupSvc.Backup(c.ctx, target)
+	if err != nil {
+		return err
+	}
+	return c.output(manifest, func(w io.Writer) {
+		printBackupSummary(w, "Backed up", manifest, target)
+	})
+}
+
+// restore handles "restore". The database must hold no data; it is migrated as needed.
+func (c *command) restore(args []string) error {
+	fs := c.flags("restore", "restore --input DIR|s3://BUCKET/PREFIX [--json]")
+	input := fs.String("input", "", "directory, or s3://BUCKET/PREFIX in the backup object store, to read the backup from")
+	if err := fs.Parse(args); err != nil || fs.NArg() != 0 || *input == "" {
+		fs.Usage()
+		return errUsage
+	}
+
+	target, err := c.backupTarget(*input)
+	if err != nil {
+		return err
+	}
+	backupSvc, err := c.backupService()
+	if err != nil {
+		return err
+	}
+	manifest, err := backupSvc.Restore(c.ctx, target)
+	if err != nil {
+		return err
+	}
+	return c.output(manifest, func(w io.Writer) {
+		printBackupSummary(w, "Restored", manifest, target)
+	})
+}
+
+// replication handles "replication"
+func (c *command) replication(args []string) error {
+	fs := c.flags("replication", "replication [--backfill] [--json]")
+	backfill := fs.Bool("backfill", false, "queue the object of every finished blob; objects the replica has are not copied again")
+	if err := fs.Parse(args); err != nil || fs.NArg() != 0 {
+		fs.Usage()
+		return errUsage
+	}
+	if !c.cfg.Replication.Enabled {
+		return fmt.Errorf("replication is not enabled; set NK_REPLICATION_ENABLED=true")
+	}
+
+	db, err := c.database()
+	if err != nil {
+		return err
+	}
+	storageClient, err := c.storageClient()
+	if err != nil {
+		return err
+	}
+	replicationSvc, err := newReplicationService(c.cfg, db, storageClient)
+	if err != nil {
+		return err
+	}
+	queued := 0
+	if *backfill {
+		if queued, err = replicationSvc.Backfill(c.ctx); err != nil {
+			return err
+		}
+	}
+	status, err := replicationSvc.Status(c.ctx)
+	if err != nil {
+		return err
+	}
+
+	result := map[string]interface{}{"queue": status}
+	if *backfill {
+		result["backfilled"] = queued
+	}
+	return c.output(result, func(w io.Writer) {
+		if *backfill {
+			fmt.Fprintf(w, "Queued %d objects\n", queued)
+		}
+		fmt.Fprintf(w, "%d changes queued, %d of them retrying; the oldest has waited %s\n", status.Queued, status.Retrying, time.Duration(status.LagSeconds*float64(time.Second)).Round(time.Second))
+	})
+}
+
+// tiering handles "tiering"
+func (c *command) tiering(args []string) error {
+	fs := c.flags("tiering", "tiering [--run] [--json]")
+	run := fs.Bool("run", false, "sweep once: delete the hot copies of moved blobs that are due, then move a batch for each rule")
+	if err := fs.Parse(args); err != nil || fs.NArg() != 0 {
+		fs.Usage()
+		return errUsage
+	}
+	if !c.cfg.Tiering.Enabled {
+		return fmt.Errorf("tiering is not enabled; set NK_TIERING_ENABLED=true")
+	}
+
+	db, err := c.database()
+	if err != nil {
+		return err
+	}
+	storageClient, err := c.storageClient()
+	if err != nil {
+		return err
+	}
+	tieringSvc, err := service.NewTieringService(repository.NewBlobRepository(db), storageClient, c.cfg)
+	if err != nil {
+		return err
+	}
+	var summary *model.TieringSummary
+	if *run {
+		if err := tieringSvc.EnsureColdBucket(c.ctx); err != nil {
+			return err
+		}
+		if summary, err = tieringSvc.Sweep(c.ctx); err != nil {
+			return err
+		}
+	}
+	counts, err := tieringSvc.CountBlobsByLocation(c.ctx)
+	if err != nil {
+		return err
+	}
+
+	result := map[string]interface{}{"locations": counts}
+	if summary != nil {
+		result["sweep"] = summary
+	}
+	return c.output(result, func(w io.Writer) {
+		if summary != nil {
+			fmt.Fprintf(w, "Moved %d blobs, deleted %d hot copies, %d failed\n", summary.Demoted, summary.Purged, summary.Failed)
+		}
+		fmt.Fprintln(w, "LOCATION\tBLOBS")
+		for _, location := range []string{model.BlobLocationHot, model.BlobLocationCooling, model.BlobLocationCold} {
+			fmt.Fprintf(w, "%s\t%d\n", location, counts[location])
+		}
+	})
+}
+
+func printBackupSummary(w io.Writer, verb string, manifest *model.BackupManifest, target storage.BackupTarget) {
+	var bytes int64
+	for _, object := range manifest.Objects {
+		bytes += object.SizeBytes
+	}
+	fmt.Fprintf(w, "%s schema version %d, %d objects of %d bytes, %s\n", verb, manifest.SchemaVersion, len(manifest.Objects), bytes, target)
+	fmt.Fprintln(w, "TABLE\tROWS")
+	for _, table := range manifest.Tables {
+		fmt.Fprintf(w, "%s\t%d\n", table.Name, table.Rows)
+	}
+}
+
+// config handles "config"
+func (c *command) config(args []string) error {
+	fs := c.flags("config", "config")
+	if err := fs.Parse(args); err != nil || fs.NArg() != 0 {
+		return errUsage
+	}
+	// Always JSON: the configuration is nested
+	c.json = true
+	return c.output(c.cfg.Redacted(), nil)
+}
@@ -2,17 +2,21 @@ package main
 
 import (
 	"context"
+	"io"
 	"os"
 	"time"
 
 	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/redis/go-redis/v9"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 
 	"github.com/nkrypt-xyz/nkrypt-xyz-web-server/internal/config"
 	"github.com/nkrypt-xyz/nkrypt-xyz-web-server/internal/handler"
+	"github.com/nkrypt-xyz/nkrypt-xyz-web-server/internal/pkg/metrics"
 	"github.com/nkrypt-xyz/nkrypt-xyz-web-server/internal/pkg/storage"
+	"github.com/nkrypt-xyz/nkrypt-xyz-web-server/internal/pkg/tracing"
 	"github.com/nkrypt-xyz/nkrypt-xyz-web-server/internal/repository"
 	"github.com/nkrypt-xyz/nkrypt-xyz-web-server/internal/router"
 	"github.com/nkrypt-xyz/nkrypt-xyz-web-server/internal/server"
@@ -20,26 +24,41 @@ import (
 )
 
 func main() {
+	args := os.Args[1:]
+	if len(args) > 0 && args[0] != "serve" {
+		os.Exit(runCommand(args))
+	}
+	serve()
+}
+
+// serve starts the HTTP server
+func serve() {
 	ctx := context.Background()
 
 	cfg, err := config.Load()
 	if err != nil {
 		panic(err)
 	}
+	setupLogging(cfg, os.Stdout)
 
-	// Logging configuration
-	zerolog.TimeFieldFormat = time.RFC3339Nano
-	var logger zerolog.Logger
-	switch cfg.Log.Format {
-	case "console":
-		logger = zerolog.New(zerolog.ConsoleWriter{Out: os.Stdout}).With().Timestamp().Logger()
-	default:
-		logger = zerolog.New(os.Stdout).With().Timestamp().Logger()
+	// Tracing
+	shutdownTracing, err := tracing.Setup(ctx, cfg.Tracing)
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to set up tracing")
 	}
-	log.Logger = logger.Level(parseLogLevel(cfg.Log.Level))
+	defer func() {
+		if err := shutdownTracing(context.Background()); err != nil {
+			log.Error().Err(err).Msg("failed to flush traces")
+		}
+	}()
 
 	// PostgreSQL connection pool
-	dbPool, err := pgxpool.New(ctx, cfg.Database.URL)
+	poolConfig, err := pgxpool.ParseConfig(cfg.Database.URL)
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to parse the PostgreSQL URL")
+	}
+	poolConfig.ConnConfig.Tracer = tracing.QueryTracer{}
+	dbPool, err := pgxpool.NewWithConfig(ctx, poolConfig)
 	if err != nil {
 		log.Fatal().Err(err).Msg("failed to create PostgreSQL pool")
 	}
@@ -51,6 +70,30 @@ func main() {
 	}
 	log.Info().Msg("PostgreSQL connection established")
 
+	// Schema migrations
+	migrator, err := newMigrator("", dbPool)
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to load migrations")
+	}
+	if cfg.Database.AutoMigrate {
+		applied, err := migrator.Up(ctx)
+		for _, m := range applied {
+			log.Info().Int64("version", m.Version).Str("name", m.Name).Msg("applied migration")
+		}
+		if err != nil {
+			log.Fatal().Err(err).Msg("failed to apply migrations")
+		}
+	}
+	schema, err := migrator.Status(ctx)
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to read the schema version")
+	}
+	if !schema.UpToDate() {
+		log.Fatal().Int64("schemaVersion", schema.Version).Int64("latest", schema.Latest).Bool("dirty", schema.Dirty).
+			Msg("database schema is not up to date; run \"nkrypt-server migrate up\" or set NK_DATABASE_AUTO_MIGRATE=true")
+	}
+	log.Info().Int64("schemaVersion", schema.Version).Msg("database schema is up to date")
+
 	// Redis client
 	redisClient := redis.NewClient(&redis.Options{
 		Addr:     cfg.Redis.Addr,
@@ -58,6 +101,7 @@ func main() {
 		DB:       cfg.Redis.DB,
 	})
 	defer redisClient.Close()
+	redisClient.AddHook(tracing.RedisHook{})
 	
 	// Test Redis connection
 	if err := redisClient.Ping(ctx).Err(); err != nil {
@@ -80,6 +124,9 @@ func main() {
 	if err := minioClient.EnsureBucket(ctx); err != nil {
 		log.Fatal().Err(err).Msg("failed to ensure MinIO bucket exists")
 	}
+	if err := setColdTier(cfg, minioClient); err != nil {
+		log.Fatal().Err(err).Msg("failed to create the tiering store client")
+	}
 	log.Info().Msg("MinIO connection established")
 
 	// Repositories
@@ -89,17 +136,61 @@ func main() {
 	directoryRepo := repository.NewDirectoryRepository(dbPool)
 	fileRepo := repository.NewFileRepository(dbPool)
 	blobRepo := repository.NewBlobRepository(dbPool)
+	groupRepo := repository.NewGroupRepository(dbPool)
+	dirPermRepo := repository.NewDirectoryPermissionRepository(dbPool)
+	invitationRepo := repository.NewInvitationRepository(dbPool)
+	usageRepo := repository.NewUsageRepository(dbPool)
+	blobUploadRepo := repository.NewBlobUploadRepository(dbPool)
+
+	// Replication to a second object store, if configured
+	replicationSvc, err := newReplicationService(cfg, dbPool, minioClient)
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to set up replication")
+	}
+	if replicationSvc != nil {
+		if err := replicationSvc.EnsureReplicaBucket(ctx); err != nil {
+			log.Fatal().Err(err).Msg("failed to ensure the replica bucket exists")
+		}
+		workerCtx, stopReplication := context.WithCancel(ctx)
+		defer stopReplication()
+		go replicationSvc.Run(workerCtx)
+		prometheus.MustRegister(metrics.NewReplicationCollector(replicationSvc.QueueStatus))
+		log.Info().Str("endpoint", cfg.Replication.Endpoint).Msg("replication enabled")
+	}
+
+	// Tiering of cold blobs to a second object store, if configured
+	if cfg.Tiering.Enabled {
+		tieringSvc, err := service.NewTieringService(blobRepo, minioClient, cfg)
+		if err != nil {
+			log.Fatal().Err(err).Msg("failed to set up tiering")
+		}
+		if err := tieringSvc.EnsureColdBucket(ctx); err != nil {
+			log.Fatal().Err(err).Msg("failed to ensure the tiering bucket exists")
+		}
+		workerCtx, stopTiering := context.WithCancel(ctx)
+		defer stopTiering()
+		go tieringSvc.Run(workerCtx)
+		log.Info().Str("endpoint", cfg.Tiering.Endpoint).Msg("tiering enabled")
+	}
 
 	// Services
 	sessionSvc := service.NewSessionService(redisClient, sessionRepo, cfg)
 	userSvc := service.NewUserService(userRepo)
 	authSvc := service.NewAuthService(sessionSvc, userSvc, cfg)
 	adminSvc := service.NewAdminService(userRepo, sessionSvc, cfg)
-	bucketSvc := service.NewBucketService(bucketRepo, directoryRepo)
+	bucketSvc := service.NewBucketService(bucketRepo, directoryRepo, groupRepo, userRepo)
+	groupSvc := service.NewGroupService(groupRepo, userRepo, bucketRepo)
+	invitationSvc := service.NewInvitationService(invitationRepo, userRepo, adminSvc, bucketSvc, cfg)
 	directorySvc := service.NewDirectoryService(directoryRepo, fileRepo)
+	dirPermSvc := service.NewDirectoryPermissionService(dirPermRepo, directoryRepo, groupRepo, bucketSvc)
 	fileSvc := service.NewFileService(fileRepo)
-	blobSvc := service.NewBlobService(blobRepo, minioClient)
-	metricsSvc := service.NewMetricsService(minioClient)
+	blobSvc := service.NewBlobService(blobRepo, minioClient, replicationSvc, cfg)
+	blobUploadSvc := service.NewBlobUploadService(blobSvc, blobRepo, blobUploadRepo, minioClient, cfg)
+	bucketArchiveSvc := service.NewBucketArchiveService(bucketSvc, directoryRepo, fileRepo, blobSvc)
+	metricsSvc := service.NewMetricsService(minioClient, usageRepo, bucketRepo, dirPermSvc, redisClient, cfg)
+
+	// Metrics read from the database and connection pools at scrape time
+	prometheus.MustRegister(metrics.NewStateCollector(dbPool, redisClient, sessionSvc.CountActiveSessions, blobSvc.CountBlobsByStatus))
 
 	// Seed default admin
 	if err := adminSvc.CreateDefaultAdminIfNotExists(ctx); err != nil {
@@ -109,14 +200,16 @@ func main() {
 	// Handlers
 	userHandler := handler.NewUserHandler(userSvc, sessionSvc, authSvc, cfg)
 	adminHandler := handler.NewAdminHandler(adminSvc, userSvc)
-	bucketHandler := handler.NewBucketHandler(bucketSvc)
-	directoryHandler := handler.NewDirectoryHandler(bucketSvc, directorySvc)
-	fileHandler := handler.NewFileHandler(bucketSvc, directorySvc, fileSvc, blobSvc)
-	blobHandler := handler.NewBlobHandler(bucketSvc, fileSvc, blobSvc)
+	groupHandler := handler.NewGroupHandler(groupSvc)
+	invitationHandler := handler.NewInvitationHandler(invitationSvc)
+	bucketHandler := handler.NewBucketHandler(bucketSvc, bucketArchiveSvc, blobSvc, dirPermSvc)
+	directoryHandler := handler.NewDirectoryHandler(bucketSvc, directorySvc, blobSvc, dirPermSvc)
+	fileHandler := handler.NewFileHandler(bucketSvc, directorySvc, fileSvc, blobSvc, dirPermSvc)
+	blobHandler := handler.NewBlobHandler(bucketSvc, fileSvc, blobSvc, blobUploadSvc, dirPermSvc)
 	metricsHandler := handler.NewMetricsHandler(metricsSvc)
 
 	// Router & server
-	r := router.New(cfg, dbPool, redisClient, authSvc, userHandler, adminHandler, bucketHandler, directoryHandler, fileHandler, blobHandler, metricsHandler)
+	r := router.New(cfg, dbPool, redisClient, minioClient, migrator, authSvc, userHandler, adminHandler, groupHandler, invitationHandler, bucketHandler, directoryHandler, fileHandler, blobHandler, metricsHandler)
 	srv := server.New(cfg, r)
 
 	if err := srv.ListenAndServe(ctx); err != nil {
@@ -124,6 +217,58 @@ func main() {
 	}
 }
 
+// newReplicationService returns the replication service, or nil if replication is off
+func newReplicationService(cfg *config.Config, db *pgxpool.Pool, primary *storage.MinIOClient) (*service.ReplicationService, error) {
+	if !cfg.Replication.Enabled {
+		return nil, nil
+	}
+	replica, err := storage.NewMinIOClient(
+		cfg.Replication.Endpoint,
+		cfg.Replication.AccessKey,
+		cfg.Replication.SecretKey,
+		cfg.Replication.BucketName,
+		cfg.Replication.UseSSL,
+		nil,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return service.NewReplicationService(repository.NewReplicationRepository(db), repository.NewBlobRepository(db), primary, replica, cfg), nil
+}
+
+// setColdTier gives the storage client its tiering store, if tiering is on
+func setColdTier(cfg *config.Config, client *storage.MinIOClient) error {
+	if !cfg.Tiering.Enabled {
+		return nil
+	}
+	cold, err := storage.NewMinIOClient(
+		cfg.Tiering.Endpoint,
+		cfg.Tiering.AccessKey,
+		cfg.Tiering.SecretKey,
+		cfg.Tiering.BucketName,
+		cfg.Tiering.UseSSL,
+		nil,
+	)
+	if err != nil {
+		return err
+	}
+	client.SetColdTier(cold)
+	return nil
+}
+
+// setupLogging configures the global logger to write to out
+func setupLogging(cfg *config.Config, out io.Writer) {
+	zerolog.TimeFieldFormat = time.RFC3339Nano
+	var logger zerolog.Logger
+	switch cfg.Log.Format {
+	case "console":
+		logger = zerolog.New(zerolog.ConsoleWriter{Out: out}).With().Timestamp().Logger()
+	default:
+		logger = zerolog.New(out).With().Timestamp().Logger()
+	}
+	log.Logger = logger.Level(parseLogLevel(cfg.Log.Level))
+}
+
 func parseLogLevel(level string) zerolog.Level {
 	switch level {
 	case "trace":
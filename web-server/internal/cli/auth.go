@@ -0,0 +1,189 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/nkrypt-xyz/nkrypt-xyz-web-server/client"
+)
+
+const authUsage = `Usage:
+  nkrypt auth list <bucket>
+  nkrypt auth set <bucket> <userName> PERMISSION=true|false...
+  nkrypt auth set --group <bucket> <groupName> PERMISSION=true|false...
+  nkrypt auth remove <bucket> <userName>
+
+Bucket permissions: MODIFY, MANAGE_AUTHORIZATION, DESTROY, VIEW_CONTENT, MANAGE_CONTENT`
+
+// auth handles "nkrypt auth"
+func (a *app) auth(args []string) error {
+	if len(args) == 0 {
+		fmt.Fprintln(a.stderr, authUsage)
+		return errUsage
+	}
+
+	fs := a.flags("auth")
+	fs.Usage = func() { fmt.Fprintln(a.stderr, authUsage) }
+	group := fs.Bool("group", false, "set the authorization of a group instead of a user")
+	if err := fs.Parse(args[1:]); err != nil {
+		return errUsage
+	}
+	rest := fs.Args()
+
+	switch {
+	case args[0] == "list" && len(rest) == 1 && !*group:
+		return a.authList(rest[0])
+	case args[0] == "set" && len(rest) >= 3:
+		return a.authSet(rest[0], rest[1], rest[2:], *group)
+	case args[0] == "remove" && len(rest) == 2 && !*group:
+		return a.authRemove(rest[0], rest[1])
+	}
+	fs.Usage()
+	return errUsage
+}
+
+func (a *app) authList(bucketName string) error {
+	c, err := a.connect()
+	if err != nil {
+		return err
+	}
+	bucket, err := a.findBucket(c, bucketName)
+	if err != nil {
+		return err
+	}
+	resp, err := c.ListBucketMembers(a.ctx, &client.ListBucketMembersRequest{BucketID: bucket.ID})
+	if err != nil {
+		return err
+	}
+
+	result := map[string]interface{}{
+		"bucketId":                  bucket.ID,
+		"memberList":                resp.MemberList,
+		"bucketGroupAuthorizations": bucket.BucketGroupAuthorizations,
+	}
+	return a.output(result, func(w io.Writer) {
+		fmt.Fprintln(w, "USER\tOWNER\tPERMISSIONS\tVIA GROUPS")
+		for _, m := range resp.MemberList {
+			groups := "-"
+			if len(m.GroupIDs) > 0 {
+				groups = strings.Join(m.GroupIDs, ",")
+			}
+			fmt.Fprintf(w, "%s\t%t\t%s\t%s\n", m.UserName, m.IsOwner, joinSorted(m.Permissions), groups)
+		}
+		for _, g := range bucket.BucketGroupAuthorizations {
+			fmt.Fprintf(w, "group:%s\t-\t%s\t-\n", g.GroupID, joinSorted(g.Permissions))
+		}
+	})
+}
+
+func (a *app) authSet(bucketName, targetName string, assignments []string, group bool) error {
+	permissions, err := parsePermissions(assignments)
+	if err != nil {
+		return err
+	}
+	c, err := a.connect()
+	if err != nil {
+		return err
+	}
+	bucket, err := a.findBucket(c, bucketName)
+	if err != nil {
+		return err
+	}
+
+	if group {
+		groupID, err := a.findGroupID(c, targetName)
+		if err != nil {
+			return err
+		}
+		err = c.SetBucketGroupAuthorization(a.ctx, &client.SetBucketGroupAuthorizationRequest{
+			TargetGroupID:    groupID,
+			BucketID:         bucket.ID,
+			PermissionsToSet: permissions,
+		})
+		if err != nil {
+			return err
+		}
+	} else {
+		userID, err := a.findUserID(c, targetName)
+		if err != nil {
+			return err
+		}
+		err = c.SetBucketAuthorization(a.ctx, &client.SetBucketAuthorizationRequest{
+			TargetUserID:     userID,
+			BucketID:         bucket.ID,
+			PermissionsToSet: permissions,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	result := map[string]interface{}{"bucketId": bucket.ID, "target": targetName, "group": group, "permissionsSet": permissions}
+	return a.output(result, func(w io.Writer) {
+		fmt.Fprintf(w, "Updated the authorization of %s on %s\n", targetName, bucketName)
+	})
+}
+
+func (a *app) authRemove(bucketName, userName string) error {
+	c, err := a.connect()
+	if err != nil {
+		return err
+	}
+	bucket, err := a.findBucket(c, bucketName)
+	if err != nil {
+		return err
+	}
+	userID, err := a.findUserID(c, userName)
+	if err != nil {
+		return err
+	}
+	if err := c.RemoveBucketMember(a.ctx, &client.RemoveBucketMemberRequest{BucketID: bucket.ID, TargetUserID: userID}); err != nil {
+		return err
+	}
+
+	return a.output(map[string]interface{}{"bucketId": bucket.ID, "removedUserId": userID}, func(w io.Writer) {
+		fmt.Fprintf(w, "Removed %s from %s\n", userName, bucketName)
+	})
+}
+
+// parsePermissions parses PERMISSION=true|false assignments
+func parsePermissions(assignments []string) (map[string]bool, error) {
+	permissions := make(map[string]bool, len(assignments))
+	for _, assignment := range assignments {
+		name, value, found := strings.Cut(assignment, "=")
+		enabled, err := strconv.ParseBool(value)
+		if !found || name == "" || err != nil {
+			return nil, fmt.Errorf("invalid permission %q; expected PERMISSION=true or PERMISSION=false", assignment)
+		}
+		permissions[strings.ToUpper(name)] = enabled
+	}
+	return permissions, nil
+}
+
+func (a *app) findUserID(c *client.Client, userName string) (string, error) {
+	resp, err := c.FindUsers(a.ctx, &client.FindUserRequest{
+		Filters: []client.FindUserFilter{{By: "userName", UserName: userName}},
+	})
+	if err != nil {
+		return "", err
+	}
+	if len(resp.UserList) == 0 {
+		return "", fmt.Errorf("user %q not found", userName)
+	}
+	return resp.UserList[0].ID, nil
+}
+
+func (a *app) findGroupID(c *client.Client, groupName string) (string, error) {
+	resp, err := c.ListGroups(a.ctx)
+	if err != nil {
+		return "", err
+	}
+	for _, g := range resp.GroupList {
+		if g.Name == groupName {
+			return g.ID, nil
+		}
+	}
+	return "", fmt.Errorf("group %q not found", groupName)
+}
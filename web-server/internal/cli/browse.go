@@ -0,0 +1,313 @@
+package cli
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+
+	"github.com/nkrypt-xyz/nkrypt-xyz-web-server/client"
+)
+
+// buckets handles "nkrypt buckets"
+func (a *app) buckets(args []string) error {
+	if err := a.parseArgs(a.flags("buckets"), args, 0); err != nil {
+		return err
+	}
+	c, err := a.connect()
+	if err != nil {
+		return err
+	}
+	resp, err := c.ListBuckets(a.ctx)
+	if err != nil {
+		return err
+	}
+
+	return a.output(resp.BucketList, func(w io.Writer) {
+		fmt.Fprintln(w, "ID\tNAME\tCREATED")
+		for _, b := range resp.BucketList {
+			fmt.Fprintf(w, "%s\t%s\t%s\n", b.ID, b.Name, formatTime(b.CreatedAt))
+		}
+	})
+}
+
+// ls handles "nkrypt ls"
+func (a *app) ls(args []string) error {
+	fs := a.flags("ls")
+	if err := a.parseArgs(fs, args, 1); err != nil {
+		return err
+	}
+	p, err := parseRemotePath(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	c, err := a.connect()
+	if err != nil {
+		return err
+	}
+	e, err := a.resolve(c, p)
+	if err != nil {
+		return err
+	}
+
+	if !e.isDir() {
+		return a.output(e.File, func(w io.Writer) {
+			printFile(w, e.File)
+		})
+	}
+
+	listing := map[string]interface{}{
+		"directory":          e.Listing.Directory,
+		"childDirectoryList": e.Listing.ChildDirectoryList,
+		"childFileList":      e.Listing.ChildFileList,
+	}
+	return a.output(listing, func(w io.Writer) {
+		for _, d := range e.Listing.ChildDirectoryList {
+			fmt.Fprintf(w, "%s\t-\t%s\t%s/\n", d.ID, formatTime(d.UpdatedAt), d.Name)
+		}
+		for i := range e.Listing.ChildFileList {
+			printFile(w, &e.Listing.ChildFileList[i])
+		}
+	})
+}
+
+func printFile(w io.Writer, f *client.FileResponse) {
+	fmt.Fprintf(w, "%s\t%d\t%s\t%s\n", f.ID, f.SizeAfterEncryptionBytes, formatTime(f.ContentUpdatedAt), f.Name)
+}
+
+// metaDataFlags registers the plain and encrypted metadata flags used when creating entries. The
+// CLI does not encrypt, so the encrypted metadata is sent as given.
+func metaDataFlags(fs *flag.FlagSet) (*string, *string) {
+	var metaData, encryptedMetaData string
+	fs.StringVar(&metaData, "meta-data", "{}", "plain metadata as JSON")
+	fs.StringVar(&encryptedMetaData, "encrypted-meta-data", "{}", "encrypted metadata, sent as given")
+	return &metaData, &encryptedMetaData
+}
+
+func decodeMetaData(raw string) (interface{}, error) {
+	var v interface{}
+	if err := json.Unmarshal([]byte(raw), &v); err != nil {
+		return nil, fmt.Errorf("invalid --meta-data: %w", err)
+	}
+	return v, nil
+}
+
+// mkdir handles "nkrypt mkdir"
+func (a *app) mkdir(args []string) error {
+	fs := a.flags("mkdir")
+	parents := fs.Bool("p", false, "create missing parent directories and accept an existing directory")
+	metaData, encryptedMetaData := metaDataFlags(fs)
+	if err := a.parseArgs(fs, args, 1); err != nil {
+		return err
+	}
+	p, err := parseRemotePath(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	meta, err := decodeMetaData(*metaData)
+	if err != nil {
+		return err
+	}
+	c, err := a.connect()
+	if err != nil {
+		return err
+	}
+
+	if p.isRoot() {
+		return fmt.Errorf("%s: the root directory always exists", p)
+	}
+
+	create := func(dir *entry, name string) (string, error) {
+		resp, err := c.CreateDirectory(a.ctx, &client.CreateDirectoryRequest{
+			Name:              name,
+			BucketID:          dir.Bucket.ID,
+			ParentDirectoryID: dir.Directory.ID,
+			MetaData:          meta,
+			EncryptedMetaData: *encryptedMetaData,
+		})
+		if err != nil {
+			return "", err
+		}
+		return resp.DirectoryID, nil
+	}
+
+	var directoryID string
+	if *parents {
+		dir, err := a.resolveDir(c, remotePath{Bucket: p.Bucket})
+		if err != nil {
+			return err
+		}
+		for _, part := range p.Parts {
+			existing, err := a.resolve(c, dir.Path.child(part))
+			switch {
+			case err == nil && existing.isDir():
+				dir = existing
+				continue
+			case err == nil:
+				return fmt.Errorf("%s: not a directory", existing.Path)
+			case !errors.Is(err, errNotFound):
+				return err
+			}
+			if _, err := create(dir, part); err != nil {
+				return err
+			}
+			if dir, err = a.resolveDir(c, dir.Path.child(part)); err != nil {
+				return err
+			}
+		}
+		directoryID = dir.Directory.ID
+	} else {
+		dir, err := a.resolveDir(c, p.parent())
+		if err != nil {
+			return err
+		}
+		if directoryID, err = create(dir, p.name()); err != nil {
+			return err
+		}
+	}
+
+	return a.output(map[string]interface{}{"directoryId": directoryID, "path": p.String()}, func(w io.Writer) {
+		fmt.Fprintf(w, "Created %s\n", p)
+	})
+}
+
+// mv handles "nkrypt mv"
+func (a *app) mv(args []string) error {
+	fs := a.flags("mv")
+	if err := a.parseArgs(fs, args, 2); err != nil {
+		return err
+	}
+	src, err := parseRemotePath(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	dst, err := parseRemotePath(fs.Arg(1))
+	if err != nil {
+		return err
+	}
+	if src.Bucket != dst.Bucket {
+		return errors.New("cannot move between buckets; download and upload instead")
+	}
+	if src.isRoot() {
+		return fmt.Errorf("%s: cannot move the root directory", src)
+	}
+	c, err := a.connect()
+	if err != nil {
+		return err
+	}
+
+	e, err := a.resolve(c, src)
+	if err != nil {
+		return err
+	}
+	dir, name, err := a.resolveTarget(c, dst)
+	if err != nil {
+		return err
+	}
+	if name == "" {
+		name = src.name()
+	}
+
+	if e.isDir() {
+		err = c.MoveDirectory(a.ctx, &client.MoveDirectoryRequest{
+			BucketID:             e.Bucket.ID,
+			DirectoryID:          e.Directory.ID,
+			NewParentDirectoryID: dir.Directory.ID,
+			NewName:              name,
+		})
+	} else {
+		err = c.MoveFile(a.ctx, &client.MoveFileRequest{
+			BucketID:             e.Bucket.ID,
+			FileID:               e.File.ID,
+			NewParentDirectoryID: dir.Directory.ID,
+			NewName:              name,
+		})
+	}
+	if err != nil {
+		return err
+	}
+
+	target := dir.Path.child(name)
+	return a.output(map[string]interface{}{"from": src.String(), "to": target.String()}, func(w io.Writer) {
+		fmt.Fprintf(w, "Moved %s to %s\n", src, target)
+	})
+}
+
+// rename handles "nkrypt rename"
+func (a *app) rename(args []string) error {
+	fs := a.flags("rename")
+	if err := a.parseArgs(fs, args, 2); err != nil {
+		return err
+	}
+	p, err := parseRemotePath(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	newName := fs.Arg(1)
+	if p.isRoot() {
+		return fmt.Errorf("%s: cannot rename the root directory; rename the bucket instead", p)
+	}
+	c, err := a.connect()
+	if err != nil {
+		return err
+	}
+	e, err := a.resolve(c, p)
+	if err != nil {
+		return err
+	}
+
+	if e.isDir() {
+		err = c.RenameDirectory(a.ctx, &client.RenameDirectoryRequest{Name: newName, BucketID: e.Bucket.ID, DirectoryID: e.Directory.ID})
+	} else {
+		err = c.RenameFile(a.ctx, &client.RenameFileRequest{Name: newName, BucketID: e.Bucket.ID, FileID: e.File.ID})
+	}
+	if err != nil {
+		return err
+	}
+
+	target := p.parent().child(newName)
+	return a.output(map[string]interface{}{"from": p.String(), "to": target.String()}, func(w io.Writer) {
+		fmt.Fprintf(w, "Renamed %s to %s\n", p, target)
+	})
+}
+
+// rm handles "nkrypt rm"
+func (a *app) rm(args []string) error {
+	fs := a.flags("rm")
+	recursive := fs.Bool("r", false, "delete a directory and everything in it")
+	if err := a.parseArgs(fs, args, 1); err != nil {
+		return err
+	}
+	p, err := parseRemotePath(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	if p.isRoot() {
+		return fmt.Errorf("%s: cannot delete the root directory", p)
+	}
+	c, err := a.connect()
+	if err != nil {
+		return err
+	}
+	e, err := a.resolve(c, p)
+	if err != nil {
+		return err
+	}
+
+	if e.isDir() {
+		if !*recursive {
+			return fmt.Errorf("%s: is a directory; use -r to delete it", p)
+		}
+		err = c.DeleteDirectory(a.ctx, &client.DeleteDirectoryRequest{BucketID: e.Bucket.ID, DirectoryID: e.Directory.ID})
+	} else {
+		err = c.DeleteFile(a.ctx, &client.DeleteFileRequest{BucketID: e.Bucket.ID, FileID: e.File.ID})
+	}
+	if err != nil {
+		return err
+	}
+
+	return a.output(map[string]interface{}{"deleted": p.String()}, func(w io.Writer) {
+		fmt.Fprintf(w, "Deleted %s\n", p)
+	})
+}
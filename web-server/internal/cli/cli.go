@@ -0,0 +1,230 @@
+// Package cli implements the nkrypt command-line client. It is built on the client package and
+// talks to the server only through its HTTP API.
+//
+// Content and metadata are transferred as given; the CLI does not encrypt. Remote paths are
+// written as bucketName:/path/to/entry.
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/nkrypt-xyz/nkrypt-xyz-web-server/client"
+)
+
+// command is one nkrypt subcommand
+type command struct {
+	usage   string
+	summary string
+	run     func(a *app, args []string) error
+}
+
+var commands map[string]*command
+
+func init() {
+	commands = map[string]*command{
+		"login":    {"login [--password P] <userName>", "Log in and store the session", (*app).login},
+		"logout":   {"logout", "End the stored session", (*app).logout},
+		"whoami":   {"whoami", "Show the logged-in user", (*app).whoami},
+		"buckets":  {"buckets", "List the buckets you can access", (*app).buckets},
+		"ls":       {"ls <bucket:/path>", "List a directory or show a file", (*app).ls},
+		"mkdir":    {"mkdir [-p] <bucket:/path>", "Create a directory", (*app).mkdir},
+		"upload":   {"upload [--parallel N] [--chunk-size BYTES] [--crypto-meta S] <local> <bucket:/path>", "Upload a file, resuming an interrupted upload", (*app).upload},
+		"download": {"download <bucket:/path> <local>", "Download a file", (*app).download},
+		"mv":       {"mv <bucket:/path> <bucket:/path>", "Move a file or directory within a bucket", (*app).mv},
+		"rename":   {"rename <bucket:/path> <newName>", "Rename a file or directory", (*app).rename},
+		"rm":       {"rm [-r] <bucket:/path>", "Delete a file, or a directory with -r", (*app).rm},
+		"auth":     {"auth list|set|remove ...", "Manage bucket authorizations", (*app).auth},
+	}
+}
+
+// errUsage is returned when the command line is malformed; the usage has already been printed
+var errUsage = errors.New("usage error")
+
+// app holds the global options and the state shared by the subcommands
+type app struct {
+	ctx    context.Context
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+
+	server      string
+	sessionFile string
+	jsonOutput  bool
+
+	session *session
+	client  *client.Client
+}
+
+// Run executes the nkrypt command line in args (without the program name) and returns the exit code.
+func Run(ctx context.Context, args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	a := &app{
+		ctx:    ctx,
+		stdin:  stdin,
+		stdout: stdout,
+		stderr: stderr,
+	}
+
+	fs := flag.NewFlagSet("nkrypt", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.StringVar(&a.server, "server", os.Getenv("NK_SERVER"), "server URL (env NK_SERVER; defaults to the server of the stored session)")
+	fs.StringVar(&a.sessionFile, "session", defaultSessionFile(), "session file (env NK_SESSION_FILE)")
+	fs.BoolVar(&a.jsonOutput, "json", false, "print JSON instead of text")
+	fs.Usage = func() { a.printUsage(fs) }
+
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+	if fs.NArg() == 0 {
+		a.printUsage(fs)
+		return 2
+	}
+
+	name := fs.Arg(0)
+	cmd, exists := commands[name]
+	if !exists {
+		fmt.Fprintf(stderr, "nkrypt: unknown command %q\n", name)
+		a.printUsage(fs)
+		return 2
+	}
+
+	if err := cmd.run(a, fs.Args()[1:]); err != nil {
+		if errors.Is(err, errUsage) {
+			return 2
+		}
+		a.printError(err)
+		return 1
+	}
+	return 0
+}
+
+func (a *app) printUsage(fs *flag.FlagSet) {
+	fmt.Fprintln(a.stderr, "Usage: nkrypt [--server URL] [--session FILE] [--json] <command> [arguments]")
+	fmt.Fprintln(a.stderr, "\nCommands:")
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	tw := tabwriter.NewWriter(a.stderr, 0, 4, 2, ' ', 0)
+	for _, name := range names {
+		fmt.Fprintf(tw, "  %s\t%s\n", name, commands[name].summary)
+	}
+	tw.Flush()
+	fmt.Fprintln(a.stderr, "\nGlobal flags:")
+	fs.PrintDefaults()
+}
+
+// printError reports err on stderr, as {"error": {...}} when --json is set
+func (a *app) printError(err error) {
+	var apiErr *client.Error
+	if !a.jsonOutput {
+		if errors.As(err, &apiErr) && apiErr.Code != "" {
+			fmt.Fprintf(a.stderr, "nkrypt: %s: %s\n", apiErr.Code, apiErr.Message)
+			return
+		}
+		fmt.Fprintf(a.stderr, "nkrypt: %v\n", err)
+		return
+	}
+
+	out := map[string]interface{}{"code": "CLI_ERROR", "message": err.Error()}
+	if errors.As(err, &apiErr) && apiErr.Code != "" {
+		out = map[string]interface{}{"code": apiErr.Code, "message": apiErr.Message, "details": apiErr.Details}
+	}
+	enc := json.NewEncoder(a.stderr)
+	enc.SetIndent("", "  ")
+	_ = enc.Encode(map[string]interface{}{"error": out})
+}
+
+// flags creates the flag set of a subcommand
+func (a *app) flags(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet("nkrypt "+name, flag.ContinueOnError)
+	fs.SetOutput(a.stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(a.stderr, "Usage: nkrypt %s\n", commands[name].usage)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// parseArgs parses the arguments of a subcommand and checks the number of positional arguments
+func (a *app) parseArgs(fs *flag.FlagSet, args []string, positional int) error {
+	if err := fs.Parse(args); err != nil {
+		return errUsage
+	}
+	if fs.NArg() != positional {
+		fs.Usage()
+		return errUsage
+	}
+	return nil
+}
+
+// output prints v as JSON with --json, and otherwise calls text
+func (a *app) output(v interface{}, text func(w io.Writer)) error {
+	if a.jsonOutput {
+		enc := json.NewEncoder(a.stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	}
+	tw := tabwriter.NewWriter(a.stdout, 0, 4, 2, ' ', 0)
+	text(tw)
+	return tw.Flush()
+}
+
+// connect returns a client for the stored session
+func (a *app) connect() (*client.Client, error) {
+	if a.client != nil {
+		return a.client, nil
+	}
+
+	sess, err := loadSession(a.sessionFile)
+	if err != nil {
+		return nil, err
+	}
+	if sess == nil || sess.APIKey == "" {
+		return nil, errors.New("not logged in; run \"nkrypt login <userName>\" first")
+	}
+	if a.server != "" {
+		sess.Server = a.server
+	}
+
+	a.session = sess
+	a.client = client.New(sess.Server, nil)
+	a.client.SetAPIKey(sess.APIKey)
+	return a.client, nil
+}
+
+// formatTime renders a millisecond timestamp from the API
+func formatTime(ms int64) string {
+	if ms == 0 {
+		return "-"
+	}
+	return time.UnixMilli(ms).Local().Format("2006-01-02 15:04")
+}
+
+// joinSorted renders the enabled permissions of a permission map
+func joinSorted(permissions map[string]bool) string {
+	var names []string
+	for name, enabled := range permissions {
+		if enabled {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return "-"
+	}
+	sort.Strings(names)
+	return strings.Join(names, ",")
+}
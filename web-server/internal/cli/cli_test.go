@@ -0,0 +1,242 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestParseRemotePath(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    remotePath
+		wantErr bool
+	}{
+		{in: "photos:/", want: remotePath{Bucket: "photos"}},
+		{in: "photos:", want: remotePath{Bucket: "photos"}},
+		{in: "photos:/2024//trip/", want: remotePath{Bucket: "photos", Parts: []string{"2024", "trip"}}},
+		{in: "photos:a.jpg", want: remotePath{Bucket: "photos", Parts: []string{"a.jpg"}}},
+		{in: "/local/path", wantErr: true},
+		{in: ":/a", wantErr: true},
+		{in: "photos:/a/../b", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := parseRemotePath(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseRemotePath(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseRemotePath(%q) = %+v, want %+v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestParsePermissions(t *testing.T) {
+	got, err := parsePermissions([]string{"modify=true", "VIEW_CONTENT=false"})
+	if err != nil {
+		t.Fatalf("parsePermissions failed: %v", err)
+	}
+	if want := map[string]bool{"MODIFY": true, "VIEW_CONTENT": false}; !reflect.DeepEqual(got, want) {
+		t.Errorf("parsePermissions = %v, want %v", got, want)
+	}
+	if _, err := parsePermissions([]string{"MODIFY"}); err == nil {
+		t.Error("Expected an error for an assignment without a value")
+	}
+}
+
+// fakeServer implements just enough of the API for one bucket "docs" with a flat root directory
+type fakeServer struct {
+	mu       sync.Mutex
+	files    map[string]string // name -> file ID
+	chunks   map[int64][]byte
+	content  map[string][]byte // file ID -> content
+	failOnce int64             // offset of a chunk to reject once, -1 for none
+}
+
+func newFakeServer(t *testing.T) (*fakeServer, *httptest.Server) {
+	f := &fakeServer{files: map[string]string{}, chunks: map[int64][]byte{}, content: map[string][]byte{}, failOnce: -1}
+	srv := httptest.NewServer(http.HandlerFunc(f.serve))
+	t.Cleanup(srv.Close)
+	return f, srv
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+func (f *fakeServer) serve(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if r.URL.Path != "/api/user/login" && r.Header.Get("Authorization") != "Bearer key-1" {
+		writeJSON(w, http.StatusUnauthorized, map[string]interface{}{"hasError": true, "error": map[string]interface{}{"code": "API_KEY_NOT_FOUND", "message": "Invalid API key"}})
+		return
+	}
+
+	switch {
+	case r.URL.Path == "/api/user/login":
+		writeJSON(w, http.StatusOK, map[string]interface{}{"hasError": false, "apiKey": "key-1", "user": map[string]interface{}{"_id": "user000000000001", "userName": "alice", "displayName": "Alice"}})
+	case r.URL.Path == "/api/bucket/list":
+		writeJSON(w, http.StatusOK, map[string]interface{}{"hasError": false, "bucketList": []interface{}{
+			map[string]interface{}{"_id": "bucket0000000001", "name": "docs", "rootDirectoryId": "dir0000000000001"},
+		}})
+	case r.URL.Path == "/api/directory/get":
+		var files []interface{}
+		for name, id := range f.files {
+			files = append(files, map[string]interface{}{"_id": id, "name": name, "sizeAfterEncryptionBytes": len(f.content[id])})
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"hasError": false, "directory": map[string]interface{}{"_id": "dir0000000000001"}, "childDirectoryList": []interface{}{}, "childFileList": files})
+	case r.URL.Path == "/api/file/create":
+		var req struct{ Name string }
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		id := "file00000000000" + strconv.Itoa(len(f.files)+1)
+		f.files[req.Name] = id
+		writeJSON(w, http.StatusOK, map[string]interface{}{"hasError": false, "fileId": id})
+	case strings.HasPrefix(r.URL.Path, "/api/blob/write-quantized/"):
+		parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/blob/write-quantized/"), "/")
+		offset, _ := strconv.ParseInt(parts[3], 10, 64)
+		if offset == f.failOnce {
+			f.failOnce = -1
+			writeJSON(w, http.StatusInternalServerError, map[string]interface{}{"hasError": true, "error": map[string]interface{}{"code": "GENERIC_SERVER_ERROR", "message": "boom"}})
+			return
+		}
+		data, _ := io.ReadAll(r.Body)
+		f.chunks[offset] = data
+		if parts[4] == "true" {
+			offsets := make([]int64, 0, len(f.chunks))
+			for o := range f.chunks {
+				offsets = append(offsets, o)
+			}
+			sort.Slice(offsets, func(i, j int) bool { return offsets[i] < offsets[j] })
+			var content []byte
+			for _, o := range offsets {
+				content = append(content, f.chunks[o]...)
+			}
+			f.content[parts[1]] = content
+			f.chunks = map[int64][]byte{}
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"hasError": false, "blobId": "blob000000000001", "bytesTransfered": len(data)})
+	case strings.HasPrefix(r.URL.Path, "/api/blob/read/"):
+		parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/blob/read/"), "/")
+		w.Header().Set("nk-crypto-meta", "meta")
+		_, _ = w.Write(f.content[parts[1]])
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// run executes the CLI and returns its exit code, stdout and stderr
+func run(t *testing.T, stdin string, args ...string) (int, string, string) {
+	t.Helper()
+	var stdout, stderr bytes.Buffer
+	code := Run(context.Background(), args, strings.NewReader(stdin), &stdout, &stderr)
+	return code, stdout.String(), stderr.String()
+}
+
+func TestUploadResumesAndDownloads(t *testing.T) {
+	fake, srv := newFakeServer(t)
+	dir := t.TempDir()
+	sessionFile := filepath.Join(dir, "session.json")
+
+	if code, _, stderr := run(t, "secret-password\n", "--server", srv.URL, "--session", sessionFile, "login", "alice"); code != 0 {
+		t.Fatalf("login failed: %s", stderr)
+	}
+	if info, err := os.Stat(sessionFile); err != nil || info.Mode().Perm() != 0o600 {
+		t.Fatalf("Expected a private session file, got %v, %v", info, err)
+	}
+	if data, _ := os.ReadFile(sessionFile); strings.Contains(string(data), "secret-password") {
+		t.Fatal("The password must not be stored")
+	}
+
+	localFile := filepath.Join(dir, "report.bin")
+	content := []byte(strings.Repeat("0123456789", 5))
+	if err := os.WriteFile(localFile, content, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	fake.failOnce = 20
+	args := []string{"--session", sessionFile, "--json", "upload", "--chunk-size", "10", "--parallel", "1", localFile, "docs:/"}
+	code, _, stderr := run(t, "", args...)
+	if code != 1 || !strings.Contains(stderr, "GENERIC_SERVER_ERROR") {
+		t.Fatalf("Expected the upload to fail at the third chunk, got %d: %s", code, stderr)
+	}
+
+	fake.mu.Lock()
+	if len(fake.chunks) != 2 {
+		t.Errorf("Expected two chunks before the failure, got %d", len(fake.chunks))
+	}
+	fake.chunks = map[int64][]byte{} // the resumed upload must not resend the first two chunks
+	fake.mu.Unlock()
+
+	code, stdout, stderr := run(t, "", args...)
+	if code != 0 {
+		t.Fatalf("Resumed upload failed: %s", stderr)
+	}
+	var result map[string]interface{}
+	if err := json.Unmarshal([]byte(stdout), &result); err != nil || result["resumed"] != true || result["path"] != "docs:/report.bin" {
+		t.Fatalf("Unexpected upload output %q: %v", stdout, err)
+	}
+	if entries, _ := os.ReadDir(filepath.Join(dir, "uploads")); len(entries) != 0 {
+		t.Errorf("Expected the upload state to be removed, found %d files", len(entries))
+	}
+
+	fake.mu.Lock()
+	stored := fake.content[fake.files["report.bin"]]
+	fake.mu.Unlock()
+	if want := content[20:]; !bytes.Equal(stored, want) {
+		t.Errorf("Expected only the remaining chunks to be sent, server assembled %q", stored)
+	}
+
+	// Serve the full content for the download
+	fake.mu.Lock()
+	fake.content[fake.files["report.bin"]] = content
+	fake.mu.Unlock()
+
+	downloaded := filepath.Join(dir, "copy.bin")
+	if code, _, stderr := run(t, "", "--session", sessionFile, "download", "docs:/report.bin", downloaded); code != 0 {
+		t.Fatalf("download failed: %s", stderr)
+	}
+	if data, _ := os.ReadFile(downloaded); !bytes.Equal(data, content) {
+		t.Errorf("Downloaded %q, want %q", data, content)
+	}
+}
+
+func TestErrorsAsJSON(t *testing.T) {
+	_, srv := newFakeServer(t)
+	sessionFile := filepath.Join(t.TempDir(), "session.json")
+	if err := saveSession(sessionFile, &session{Server: srv.URL, APIKey: "revoked"}); err != nil {
+		t.Fatal(err)
+	}
+
+	code, _, stderr := run(t, "", "--session", sessionFile, "--json", "buckets")
+	if code != 1 {
+		t.Fatalf("Expected exit code 1, got %d", code)
+	}
+	var out struct {
+		Error struct {
+			Code string `json:"code"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal([]byte(stderr), &out); err != nil || out.Error.Code != "API_KEY_NOT_FOUND" {
+		t.Errorf("Unexpected error output %q: %v", stderr, err)
+	}
+
+	if code, _, _ := run(t, "", "--session", sessionFile, "ls"); code != 2 {
+		t.Errorf("Expected exit code 2 for a usage error, got %d", code)
+	}
+}
@@ -0,0 +1,176 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/nkrypt-xyz/nkrypt-xyz-web-server/client"
+)
+
+// remotePath is a parsed bucketName:/a/b path. An empty Parts is the bucket's root directory.
+type remotePath struct {
+	Bucket string
+	Parts  []string
+}
+
+// parseRemotePath parses bucketName:/a/b. The leading slash is optional and empty segments are
+// ignored; "." and ".." are rejected because the server has no such entries.
+func parseRemotePath(s string) (remotePath, error) {
+	bucket, path, found := strings.Cut(s, ":")
+	if !found || bucket == "" {
+		return remotePath{}, fmt.Errorf("invalid remote path %q; expected bucketName:/path", s)
+	}
+
+	p := remotePath{Bucket: bucket}
+	for _, part := range strings.Split(path, "/") {
+		switch part {
+		case "":
+			continue
+		case ".", "..":
+			return remotePath{}, fmt.Errorf("invalid remote path %q; %q is not supported", s, part)
+		}
+		p.Parts = append(p.Parts, part)
+	}
+	return p, nil
+}
+
+func (p remotePath) String() string {
+	return p.Bucket + ":/" + strings.Join(p.Parts, "/")
+}
+
+// isRoot reports whether p is the bucket's root directory
+func (p remotePath) isRoot() bool {
+	return len(p.Parts) == 0
+}
+
+// name returns the last path segment
+func (p remotePath) name() string {
+	if p.isRoot() {
+		return ""
+	}
+	return p.Parts[len(p.Parts)-1]
+}
+
+// parent returns the path of the containing directory
+func (p remotePath) parent() remotePath {
+	if p.isRoot() {
+		return p
+	}
+	return remotePath{Bucket: p.Bucket, Parts: p.Parts[:len(p.Parts)-1]}
+}
+
+// child returns the path of the entry name inside p
+func (p remotePath) child(name string) remotePath {
+	parts := append(append([]string(nil), p.Parts...), name)
+	return remotePath{Bucket: p.Bucket, Parts: parts}
+}
+
+// errNotFound is returned by resolve when a path does not exist
+var errNotFound = errors.New("no such file or directory")
+
+// entry is a resolved remote path: either a directory with its listing or a file
+type entry struct {
+	Path   remotePath
+	Bucket *client.BucketResponse
+	// Directory is set for directories, together with Listing
+	Directory *client.DirectoryResponse
+	Listing   *client.GetDirectoryResponse
+	// File is set for files
+	File *client.FileResponse
+}
+
+func (e *entry) isDir() bool {
+	return e.Directory != nil
+}
+
+// findBucket returns the accessible bucket called name
+func (a *app) findBucket(c *client.Client, name string) (*client.BucketResponse, error) {
+	resp, err := c.ListBuckets(a.ctx)
+	if err != nil {
+		return nil, err
+	}
+	for i := range resp.BucketList {
+		if resp.BucketList[i].Name == name {
+			return &resp.BucketList[i], nil
+		}
+	}
+	return nil, fmt.Errorf("bucket %q not found", name)
+}
+
+// resolve walks p from the bucket's root directory. The error wraps errNotFound if an entry
+// along the path does not exist.
+func (a *app) resolve(c *client.Client, p remotePath) (*entry, error) {
+	bucket, err := a.findBucket(c, p.Bucket)
+	if err != nil {
+		return nil, err
+	}
+
+	listing, err := c.GetDirectory(a.ctx, &client.GetDirectoryRequest{BucketID: bucket.ID, DirectoryID: bucket.RootDirectoryID})
+	if err != nil {
+		return nil, err
+	}
+
+	for i, part := range p.Parts {
+		last := i == len(p.Parts)-1
+
+		var next *client.DirectoryResponse
+		for j := range listing.ChildDirectoryList {
+			if listing.ChildDirectoryList[j].Name == part {
+				next = &listing.ChildDirectoryList[j]
+				break
+			}
+		}
+		if next == nil {
+			if last {
+				for j := range listing.ChildFileList {
+					if listing.ChildFileList[j].Name == part {
+						return &entry{Path: p, Bucket: bucket, File: &listing.ChildFileList[j]}, nil
+					}
+				}
+			}
+			return nil, fmt.Errorf("%s: %w", remotePath{Bucket: p.Bucket, Parts: p.Parts[:i+1]}, errNotFound)
+		}
+
+		listing, err = c.GetDirectory(a.ctx, &client.GetDirectoryRequest{BucketID: bucket.ID, DirectoryID: next.ID})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &entry{Path: p, Bucket: bucket, Directory: &listing.Directory, Listing: listing}, nil
+}
+
+// resolveDir resolves p and fails unless it is a directory
+func (a *app) resolveDir(c *client.Client, p remotePath) (*entry, error) {
+	e, err := a.resolve(c, p)
+	if err != nil {
+		return nil, err
+	}
+	if !e.isDir() {
+		return nil, fmt.Errorf("%s: not a directory", p)
+	}
+	return e, nil
+}
+
+// resolveTarget resolves the destination of an upload or move: an existing directory means
+// "inside it, keeping the name", anything else names the new entry inside its parent directory.
+// It returns the destination directory and the entry name (which may be "" to keep the name).
+func (a *app) resolveTarget(c *client.Client, p remotePath) (*entry, string, error) {
+	e, err := a.resolve(c, p)
+	switch {
+	case err == nil && e.isDir():
+		return e, "", nil
+	case err != nil && !errors.Is(err, errNotFound):
+		return nil, "", err
+	}
+
+	if p.isRoot() {
+		return nil, "", fmt.Errorf("%s: not a directory", p)
+	}
+	dir, err := a.resolveDir(c, p.parent())
+	if err != nil {
+		return nil, "", err
+	}
+	return dir, p.name(), nil
+}
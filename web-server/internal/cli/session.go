@@ -0,0 +1,159 @@
+package cli
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/nkrypt-xyz/nkrypt-xyz-web-server/client"
+)
+
+// session is the stored login. The password is never stored; when the API key expires the user
+// has to log in again.
+type session struct {
+	Server   string `json:"server"`
+	UserID   string `json:"userId"`
+	UserName string `json:"userName"`
+	APIKey   string `json:"apiKey"`
+}
+
+// defaultSessionFile returns $NK_SESSION_FILE or ~/.config/nkrypt/session.json
+func defaultSessionFile() string {
+	if path := os.Getenv("NK_SESSION_FILE"); path != "" {
+		return path
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "nkrypt-session.json"
+	}
+	return filepath.Join(dir, "nkrypt", "session.json")
+}
+
+// loadSession reads the session file; it returns nil if the file does not exist
+func loadSession(path string) (*session, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read session: %w", err)
+	}
+	var sess session
+	if err := json.Unmarshal(data, &sess); err != nil {
+		return nil, fmt.Errorf("read session %s: %w", path, err)
+	}
+	return &sess, nil
+}
+
+// writeFileAtomic writes data readable only by the current user, replacing path in one step
+func writeFileAtomic(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func saveSession(path string, sess *session) error {
+	data, err := json.MarshalIndent(sess, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(path, data); err != nil {
+		return fmt.Errorf("write session: %w", err)
+	}
+	return nil
+}
+
+// login handles "nkrypt login"
+func (a *app) login(args []string) error {
+	fs := a.flags("login")
+	password := fs.String("password", os.Getenv("NK_PASSWORD"), "password (env NK_PASSWORD; read from stdin if empty)")
+	if err := a.parseArgs(fs, args, 1); err != nil {
+		return err
+	}
+	userName := fs.Arg(0)
+
+	server := a.server
+	if server == "" {
+		if sess, _ := loadSession(a.sessionFile); sess != nil {
+			server = sess.Server
+		}
+	}
+	if server == "" {
+		return errors.New("no server; pass --server or set NK_SERVER")
+	}
+
+	if *password == "" {
+		line, err := bufio.NewReader(a.stdin).ReadString('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return fmt.Errorf("read password: %w", err)
+		}
+		*password = strings.TrimRight(line, "\r\n")
+	}
+
+	c := client.New(server, nil)
+	resp, err := c.Login(a.ctx, userName, *password)
+	if err != nil {
+		return err
+	}
+
+	sess := &session{Server: server, UserID: resp.User.ID, UserName: resp.User.UserName, APIKey: resp.APIKey}
+	if err := saveSession(a.sessionFile, sess); err != nil {
+		return err
+	}
+
+	return a.output(map[string]interface{}{"server": server, "user": resp.User}, func(w io.Writer) {
+		fmt.Fprintf(w, "Logged in to %s as %s (%s)\n", server, resp.User.UserName, resp.User.DisplayName)
+	})
+}
+
+// logout handles "nkrypt logout"
+func (a *app) logout(args []string) error {
+	if err := a.parseArgs(a.flags("logout"), args, 0); err != nil {
+		return err
+	}
+	c, err := a.connect()
+	if err != nil {
+		return err
+	}
+
+	// An already expired session is as good as a logged out one
+	if err := c.Logout(a.ctx, "Logged out from the nkrypt CLI"); err != nil && !client.IsErrorCode(err, "API_KEY_EXPIRED") && !client.IsErrorCode(err, "API_KEY_NOT_FOUND") {
+		return err
+	}
+	if err := os.Remove(a.sessionFile); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("remove session: %w", err)
+	}
+
+	return a.output(map[string]interface{}{"loggedOut": true}, func(w io.Writer) {
+		fmt.Fprintln(w, "Logged out")
+	})
+}
+
+// whoami handles "nkrypt whoami"
+func (a *app) whoami(args []string) error {
+	if err := a.parseArgs(a.flags("whoami"), args, 0); err != nil {
+		return err
+	}
+	c, err := a.connect()
+	if err != nil {
+		return err
+	}
+	resp, err := c.Assert(a.ctx)
+	if err != nil {
+		return err
+	}
+
+	return a.output(map[string]interface{}{"server": a.session.Server, "user": resp.User}, func(w io.Writer) {
+		fmt.Fprintf(w, "%s (%s) on %s\n", resp.User.UserName, resp.User.DisplayName, a.session.Server)
+	})
+}
@@ -0,0 +1,238 @@
+package cli
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/nkrypt-xyz/nkrypt-xyz-web-server/client"
+)
+
+// upload handles "nkrypt upload". The progress of the upload is stored next to the session file
+// after every acknowledged chunk, so running the same command again after a failure sends only the
+// missing chunks.
+func (a *app) upload(args []string) error {
+	fs := a.flags("upload")
+	parallel := fs.Int("parallel", 4, "number of chunks uploaded concurrently")
+	chunkSize := fs.Int64("chunk-size", client.DefaultQuantizedChunkSize, "bytes per chunk")
+	cryptoMeta := fs.String("crypto-meta", "", "value of the nk-crypto-meta header stored with the blob")
+	metaData, encryptedMetaData := metaDataFlags(fs)
+	if err := a.parseArgs(fs, args, 2); err != nil {
+		return err
+	}
+	if *parallel < 1 || *chunkSize < 1 {
+		return errors.New("--parallel and --chunk-size must be positive")
+	}
+	localPath := fs.Arg(0)
+	p, err := parseRemotePath(fs.Arg(1))
+	if err != nil {
+		return err
+	}
+	meta, err := decodeMetaData(*metaData)
+	if err != nil {
+		return err
+	}
+
+	src, err := os.Open(localPath)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	info, err := src.Stat()
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return fmt.Errorf("%s: is a directory", localPath)
+	}
+
+	c, err := a.connect()
+	if err != nil {
+		return err
+	}
+	dir, name, err := a.resolveTarget(c, p)
+	if err != nil {
+		return err
+	}
+	if name == "" {
+		name = filepath.Base(localPath)
+	}
+	target := dir.Path.child(name)
+
+	// Upload into an existing file of that name, so a rerun after a failure finds the same file
+	fileID := ""
+	for _, f := range dir.Listing.ChildFileList {
+		if f.Name == name {
+			fileID = f.ID
+			break
+		}
+	}
+	if fileID == "" {
+		resp, err := c.CreateFile(a.ctx, &client.CreateFileRequest{
+			Name:              name,
+			BucketID:          dir.Bucket.ID,
+			ParentDirectoryID: dir.Directory.ID,
+			MetaData:          meta,
+			EncryptedMetaData: *encryptedMetaData,
+		})
+		if err != nil {
+			return err
+		}
+		fileID = resp.FileID
+	}
+
+	upload := &client.QuantizedUpload{
+		BucketID:   dir.Bucket.ID,
+		FileID:     fileID,
+		CryptoMeta: *cryptoMeta,
+		Size:       info.Size(),
+		ChunkSize:  *chunkSize,
+	}
+	absPath, err := filepath.Abs(localPath)
+	if err != nil {
+		return err
+	}
+	statePath := a.uploadStatePath(upload, absPath, info)
+	saved, err := loadUploadState(statePath)
+	if err != nil {
+		return err
+	}
+	if saved != nil {
+		upload = saved
+		if !a.jsonOutput {
+			fmt.Fprintf(a.stderr, "Resuming upload of %s at byte %d\n", localPath, upload.Offset)
+		}
+	}
+
+	var saveErr error
+	upload.Parallelism = *parallel
+	upload.Progress = func(u *client.QuantizedUpload) {
+		if err := saveUploadState(statePath, u); err != nil && saveErr == nil {
+			saveErr = err
+		}
+	}
+
+	if err := c.UploadQuantized(a.ctx, upload, src); err != nil {
+		if saveErr != nil {
+			return fmt.Errorf("%w (the upload cannot be resumed: %v)", err, saveErr)
+		}
+		return err
+	}
+	if err := os.Remove(statePath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	result := map[string]interface{}{
+		"path":     target.String(),
+		"fileId":   fileID,
+		"blobId":   upload.BlobID,
+		"bytes":    upload.Size,
+		"resumed":  saved != nil,
+		"bucketId": dir.Bucket.ID,
+	}
+	return a.output(result, func(w io.Writer) {
+		fmt.Fprintf(w, "Uploaded %s to %s (%d bytes)\n", localPath, target, upload.Size)
+	})
+}
+
+// uploadStatePath returns where the progress of uploading the local file to upload.FileID is kept.
+// The key includes the file's size and modification time, so a changed file starts over.
+func (a *app) uploadStatePath(upload *client.QuantizedUpload, absPath string, info os.FileInfo) string {
+	sum := sha256.Sum256([]byte(a.session.Server + "\x00" + upload.BucketID + "\x00" + upload.FileID + "\x00" + absPath +
+		"\x00" + strconv.FormatInt(info.Size(), 10) + "\x00" + strconv.FormatInt(info.ModTime().UnixNano(), 10) +
+		"\x00" + strconv.FormatInt(upload.ChunkSize, 10)))
+	return filepath.Join(filepath.Dir(a.sessionFile), "uploads", hex.EncodeToString(sum[:])+".json")
+}
+
+func loadUploadState(path string) (*client.QuantizedUpload, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read upload state: %w", err)
+	}
+	var upload client.QuantizedUpload
+	if err := json.Unmarshal(data, &upload); err != nil {
+		// A damaged state file only costs a fresh upload
+		return nil, nil
+	}
+	return &upload, nil
+}
+
+func saveUploadState(path string, upload *client.QuantizedUpload) error {
+	data, err := json.Marshal(upload)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, data)
+}
+
+// download handles "nkrypt download". The content is written to <local>.part and renamed once
+// complete, so an interrupted download never leaves a truncated file under the final name.
+func (a *app) download(args []string) error {
+	fs := a.flags("download")
+	if err := a.parseArgs(fs, args, 2); err != nil {
+		return err
+	}
+	p, err := parseRemotePath(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	localPath := fs.Arg(1)
+
+	c, err := a.connect()
+	if err != nil {
+		return err
+	}
+	e, err := a.resolve(c, p)
+	if err != nil {
+		return err
+	}
+	if e.isDir() {
+		return fmt.Errorf("%s: is a directory", p)
+	}
+	if info, err := os.Stat(localPath); err == nil && info.IsDir() {
+		localPath = filepath.Join(localPath, e.File.Name)
+	}
+
+	body, cryptoMeta, err := c.ReadBlob(a.ctx, e.Bucket.ID, e.File.ID)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	partPath := localPath + ".part"
+	out, err := os.Create(partPath)
+	if err != nil {
+		return err
+	}
+	n, err := io.Copy(out, body)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(partPath)
+		return fmt.Errorf("download %s: %w", p, err)
+	}
+	if err := os.Rename(partPath, localPath); err != nil {
+		return err
+	}
+
+	result := map[string]interface{}{
+		"path":       p.String(),
+		"fileId":     e.File.ID,
+		"localPath":  localPath,
+		"bytes":      n,
+		"cryptoMeta": cryptoMeta,
+	}
+	return a.output(result, func(w io.Writer) {
+		fmt.Fprintf(w, "Downloaded %s to %s (%d bytes)\n", p, localPath, n)
+	})
+}
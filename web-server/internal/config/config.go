@@ -2,10 +2,14 @@ package config
 
 import (
 	"fmt"
+	"reflect"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/spf13/viper"
+
+	"github.com/nkrypt-xyz/nkrypt-xyz-web-server/internal/pkg/redact"
 )
 
 type Config struct {
@@ -17,6 +21,11 @@ type Config struct {
 	IAM         IAMConfig         `mapstructure:"iam"`
 	Crypto      CryptoConfig      `mapstructure:"crypto"`
 	Log         LogConfig         `mapstructure:"log"`
+	Metrics     MetricsConfig     `mapstructure:"metrics"`
+	Tracing     TracingConfig     `mapstructure:"tracing"`
+	Backup      BackupConfig      `mapstructure:"backup"`
+	Replication ReplicationConfig `mapstructure:"replication"`
+	Tiering     TieringConfig     `mapstructure:"tiering"`
 }
 
 type ServerConfig struct {
@@ -42,6 +51,8 @@ type DatabaseConfig struct {
 	MaxOpenConns    int           `mapstructure:"max_open_conns"`
 	MaxIdleConns    int           `mapstructure:"max_idle_conns"`
 	ConnMaxLifetime time.Duration `mapstructure:"conn_max_lifetime"`
+	// AutoMigrate applies pending schema migrations at startup instead of refusing to start.
+	AutoMigrate bool `mapstructure:"auto_migrate"`
 }
 
 type RedisConfig struct {
@@ -60,6 +71,9 @@ type MinIOConfig struct {
 
 type BlobStorageConfig struct {
 	MaxFileSizeBytes int64 `mapstructure:"max_file_size_bytes"`
+	// Deduplicate stores identical blob content once, keyed by its SHA-256, and shares it
+	// between the blobs that have it.
+	Deduplicate bool `mapstructure:"deduplicate"`
 }
 
 type IAMConfig struct {
@@ -68,6 +82,9 @@ type IAMConfig struct {
 	DefaultAdminUsername    string        `mapstructure:"default_admin_username"`
 	DefaultAdminDisplayName string        `mapstructure:"default_admin_display_name"`
 	DefaultAdminPassword    string        `mapstructure:"default_admin_password"`
+	// OpenRegistration lets anyone create an account through /api/user/register.
+	OpenRegistration           bool          `mapstructure:"open_registration"`
+	InvitationValidityDuration time.Duration `mapstructure:"invitation_validity_duration"`
 }
 
 type CryptoConfig struct {
@@ -83,6 +100,125 @@ type LogConfig struct {
 	Format string `mapstructure:"format"`
 }
 
+type MetricsConfig struct {
+	// BearerToken, if set, must be sent as "Authorization: Bearer <token>" to read /metrics.
+	BearerToken string `mapstructure:"bearer_token"`
+	// UsageCacheTTL is how long the per-user and per-bucket usage in /api/metrics/get-summary is
+	// cached in Redis. Zero disables the cache.
+	UsageCacheTTL time.Duration `mapstructure:"usage_cache_ttl"`
+}
+
+type TracingConfig struct {
+	// Enabled turns on exporting spans over OTLP/HTTP.
+	Enabled bool `mapstructure:"enabled"`
+	// Endpoint is the host:port of the OTLP/HTTP collector.
+	Endpoint string `mapstructure:"endpoint"`
+	// Insecure sends spans over plain HTTP, as to a local collector.
+	Insecure bool `mapstructure:"insecure"`
+	// SampleRatio is the fraction of new traces that are recorded; requests that carry a sampled
+	// traceparent header are always recorded.
+	SampleRatio float64 `mapstructure:"sample_ratio"`
+	ServiceName string  `mapstructure:"service_name"`
+}
+
+// BackupConfig is the object store that the backup and restore commands use for s3:// locations.
+type BackupConfig struct {
+	// Endpoint is the host:port of the store; empty means the MinIO endpoint and credentials.
+	Endpoint  string `mapstructure:"endpoint"`
+	AccessKey string `mapstructure:"access_key"`
+	SecretKey string `mapstructure:"secret_key"`
+	UseSSL    bool   `mapstructure:"use_ssl"`
+}
+
+// ReplicationConfig is a second S3-compatible store that finished blobs are copied to in the
+// background, and read from when their object is missing from MinIO.
+type ReplicationConfig struct {
+	Enabled    bool   `mapstructure:"enabled"`
+	Endpoint   string `mapstructure:"endpoint"`
+	AccessKey  string `mapstructure:"access_key"`
+	SecretKey  string `mapstructure:"secret_key"`
+	BucketName string `mapstructure:"bucket_name"`
+	UseSSL     bool   `mapstructure:"use_ssl"`
+	// PollInterval is how often the queue is checked for changes to replicate. Failed changes are
+	// retried after twice as long for each failed attempt, up to an hour.
+	PollInterval time.Duration `mapstructure:"poll_interval"`
+	// BatchSize is how many changes a server takes from the queue at a time.
+	BatchSize int `mapstructure:"batch_size"`
+}
+
+// TieringConfig is a second S3-compatible store that blob objects matching the tiering rules are
+// moved to, and read from until a read promotes them back.
+type TieringConfig struct {
+	Enabled    bool   `mapstructure:"enabled"`
+	Endpoint   string `mapstructure:"endpoint"`
+	AccessKey  string `mapstructure:"access_key"`
+	SecretKey  string `mapstructure:"secret_key"`
+	BucketName string `mapstructure:"bucket_name"`
+	UseSSL     bool   `mapstructure:"use_ssl"`
+	// Rules selects the blobs to move, in the form ParseTieringRules reads. Without rules nothing is
+	// moved, but blobs moved before are still read from the store.
+	Rules string `mapstructure:"rules"`
+	// Interval is how often blobs are checked against the rules.
+	Interval time.Duration `mapstructure:"interval"`
+	// BatchSize is how many blobs each rule moves, and how many hot copies of moved blobs are
+	// deleted, per sweep.
+	BatchSize int `mapstructure:"batch_size"`
+}
+
+// TieringRule selects the blobs of files whose content is older than MinAge and, if set, that
+// are in the bucket BucketID and have at least MinSizeBytes.
+type TieringRule struct {
+	MinAge       time.Duration
+	BucketID     string
+	MinSizeBytes int64
+}
+
+// ParseTieringRules reads rules separated by ";", each a comma-separated list of conditions that
+// must all hold: min_age=<duration>, which every rule needs, bucket=<bucket ID> and
+// min_size=<bytes>. A blob is moved if any rule selects it. For example
+// "min_age=720h;min_age=168h,min_size=104857600" moves content unchanged for 30 days, and content
+// of at least 100 MiB unchanged for 7 days.
+func ParseTieringRules(rules string) ([]TieringRule, error) {
+	var out []TieringRule
+	for _, text := range strings.Split(rules, ";") {
+		text = strings.TrimSpace(text)
+		if text == "" {
+			continue
+		}
+		var rule TieringRule
+		for _, condition := range strings.Split(text, ",") {
+			key, value, ok := strings.Cut(strings.TrimSpace(condition), "=")
+			value = strings.TrimSpace(value)
+			if !ok || value == "" {
+				return nil, fmt.Errorf("tiering rule %q: expected key=value, got %q", text, condition)
+			}
+			switch strings.TrimSpace(key) {
+			case "min_age":
+				age, err := time.ParseDuration(value)
+				if err != nil || age <= 0 {
+					return nil, fmt.Errorf("tiering rule %q: min_age must be a positive duration", text)
+				}
+				rule.MinAge = age
+			case "bucket":
+				rule.BucketID = value
+			case "min_size":
+				size, err := strconv.ParseInt(value, 10, 64)
+				if err != nil || size < 0 {
+					return nil, fmt.Errorf("tiering rule %q: min_size must be a number of bytes", text)
+				}
+				rule.MinSizeBytes = size
+			default:
+				return nil, fmt.Errorf("tiering rule %q: unknown condition %q", text, key)
+			}
+		}
+		if rule.MinAge == 0 {
+			return nil, fmt.Errorf("tiering rule %q: min_age is required", text)
+		}
+		out = append(out, rule)
+	}
+	return out, nil
+}
+
 // Load loads configuration using Viper, following the precedence and defaults
 // from environment variables or a .env file.
 func Load() (*Config, error) {
@@ -96,15 +232,19 @@ func Load() (*Config, error) {
 	v.SetDefault("database.max_open_conns", 25)
 	v.SetDefault("database.max_idle_conns", 10)
 	v.SetDefault("database.conn_max_lifetime", "5m")
+	v.SetDefault("database.auto_migrate", false)
 	v.SetDefault("redis.password", "")
 	v.SetDefault("redis.db", 0)
 	v.SetDefault("minio.bucket_name", "nkrypt-blobs")
 	v.SetDefault("minio.use_ssl", false)
 	v.SetDefault("blob_storage.max_file_size_bytes", int64(5368709120))
+	v.SetDefault("blob_storage.deduplicate", false)
 	v.SetDefault("iam.api_key_length", 128)
 	v.SetDefault("iam.session_validity_duration", "168h")
 	v.SetDefault("iam.default_admin_username", "admin")
 	v.SetDefault("iam.default_admin_display_name", "Default Admin")
+	v.SetDefault("iam.open_registration", false)
+	v.SetDefault("iam.invitation_validity_duration", "72h")
 	// NOTE: No default for admin password - must be explicitly set!
 	v.SetDefault("crypto.argon2_memory", 65536)
 	v.SetDefault("crypto.argon2_iterations", 3)
@@ -113,6 +253,34 @@ func Load() (*Config, error) {
 	v.SetDefault("crypto.argon2_key_length", 32)
 	v.SetDefault("log.level", "info")
 	v.SetDefault("log.format", "json")
+	v.SetDefault("metrics.bearer_token", "")
+	v.SetDefault("metrics.usage_cache_ttl", "60s")
+	v.SetDefault("tracing.enabled", false)
+	v.SetDefault("tracing.endpoint", "localhost:4318")
+	v.SetDefault("tracing.insecure", true)
+	v.SetDefault("tracing.sample_ratio", 1.0)
+	v.SetDefault("tracing.service_name", "nkrypt-server")
+	v.SetDefault("backup.endpoint", "")
+	v.SetDefault("backup.access_key", "")
+	v.SetDefault("backup.secret_key", "")
+	v.SetDefault("backup.use_ssl", false)
+	v.SetDefault("replication.enabled", false)
+	v.SetDefault("replication.endpoint", "")
+	v.SetDefault("replication.access_key", "")
+	v.SetDefault("replication.secret_key", "")
+	v.SetDefault("replication.bucket_name", "nkrypt-blobs-replica")
+	v.SetDefault("replication.use_ssl", false)
+	v.SetDefault("replication.poll_interval", "5s")
+	v.SetDefault("replication.batch_size", 20)
+	v.SetDefault("tiering.enabled", false)
+	v.SetDefault("tiering.endpoint", "")
+	v.SetDefault("tiering.access_key", "")
+	v.SetDefault("tiering.secret_key", "")
+	v.SetDefault("tiering.bucket_name", "nkrypt-blobs-cold")
+	v.SetDefault("tiering.use_ssl", false)
+	v.SetDefault("tiering.rules", "")
+	v.SetDefault("tiering.interval", "1h")
+	v.SetDefault("tiering.batch_size", 100)
 
 	// NOTE: No defaults for external dependencies!
 	// Database URL, Redis address, and MinIO endpoint MUST be provided
@@ -189,6 +357,32 @@ func (c *Config) Validate() error {
 		missing = append(missing, "NK_MINIO_SECRET_KEY")
 	}
 
+	// Required with replication: the replica store
+	if c.Replication.Enabled {
+		if c.Replication.Endpoint == "" {
+			missing = append(missing, "NK_REPLICATION_ENDPOINT")
+		}
+		if c.Replication.AccessKey == "" {
+			missing = append(missing, "NK_REPLICATION_ACCESS_KEY")
+		}
+		if c.Replication.SecretKey == "" {
+			missing = append(missing, "NK_REPLICATION_SECRET_KEY")
+		}
+	}
+
+	// Required with tiering: the tiering store
+	if c.Tiering.Enabled {
+		if c.Tiering.Endpoint == "" {
+			missing = append(missing, "NK_TIERING_ENDPOINT")
+		}
+		if c.Tiering.AccessKey == "" {
+			missing = append(missing, "NK_TIERING_ACCESS_KEY")
+		}
+		if c.Tiering.SecretKey == "" {
+			missing = append(missing, "NK_TIERING_SECRET_KEY")
+		}
+	}
+
 	// Required: Default admin password (security - must be explicitly set)
 	if c.IAM.DefaultAdminPassword == "" {
 		missing = append(missing, "NK_IAM_DEFAULT_ADMIN_PASSWORD")
@@ -198,6 +392,43 @@ func (c *Config) Validate() error {
 		return fmt.Errorf("missing required configuration: %s\n\nExternal dependencies and security credentials must be explicitly configured.\nSee .env.example for required environment variables.", strings.Join(missing, ", "))
 	}
 
+	if _, err := ParseTieringRules(c.Tiering.Rules); err != nil {
+		return fmt.Errorf("invalid NK_TIERING_RULES: %w", err)
+	}
+
 	return nil
 }
 
+
+// Redacted returns the configuration keyed like the config file, with passwords, keys and the
+// password in the database URL replaced by a marker. It is meant for printing.
+func (c *Config) Redacted() map[string]interface{} {
+	values := toMap(reflect.ValueOf(*c))
+	if database, ok := values["database"].(map[string]interface{}); ok {
+		database["url"] = redact.RedactURL(c.Database.URL)
+	}
+	return redact.RedactJSON(values)
+}
+
+// toMap converts a config struct into nested maps keyed by the mapstructure tags
+func toMap(v reflect.Value) map[string]interface{} {
+	out := make(map[string]interface{}, v.NumField())
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		key := field.Tag.Get("mapstructure")
+		if key == "" {
+			continue
+		}
+		switch value := v.Field(i).Interface().(type) {
+		case time.Duration:
+			out[key] = value.String()
+		default:
+			if v.Field(i).Kind() == reflect.Struct {
+				out[key] = toMap(v.Field(i))
+			} else {
+				out[key] = value
+			}
+		}
+	}
+	return out
+}
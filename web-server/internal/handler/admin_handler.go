@@ -133,3 +133,34 @@ func (h *AdminHandler) OverwriteUserPassword(w http.ResponseWriter, r *http.Requ
 	SendSuccess(w, &model.EmptySuccessResponse{HasError: false})
 }
 
+// DeleteUser handles POST /api/admin/iam/delete-user
+func (h *AdminHandler) DeleteUser(w http.ResponseWriter, r *http.Request) {
+	authData := middleware.GetAuthData(r.Context())
+	if authData == nil {
+		SendErrorResponse(w, apperror.NewUserError("ACCESS_DENIED", "Authentication required"))
+		return
+	}
+
+	if err := service.RequireGlobalPermission(authData.User, "MANAGE_ALL_USER"); err != nil {
+		SendErrorResponse(w, err)
+		return
+	}
+
+	var req model.DeleteUserRequest
+	if err := ParseAndValidateBody(r, &req); err != nil {
+		SendErrorResponse(w, err)
+		return
+	}
+
+	if req.UserID == authData.UserID {
+		SendErrorResponse(w, apperror.NewUserError("CANNOT_DELETE_SELF", "You cannot delete your own account."))
+		return
+	}
+
+	if err := h.adminSvc.DeleteUser(r.Context(), req.UserID, req.TransferToUserID); err != nil {
+		SendErrorResponse(w, err)
+		return
+	}
+
+	SendSuccess(w, &model.EmptySuccessResponse{HasError: false})
+}
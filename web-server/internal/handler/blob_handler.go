@@ -1,25 +1,30 @@
 package handler
 
 import (
+	"io"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/go-chi/chi/v5"
 
 	"github.com/nkrypt-xyz/nkrypt-xyz-web-server/internal/middleware"
 	"github.com/nkrypt-xyz/nkrypt-xyz-web-server/internal/model"
 	"github.com/nkrypt-xyz/nkrypt-xyz-web-server/internal/pkg/apperror"
+	"github.com/nkrypt-xyz/nkrypt-xyz-web-server/internal/pkg/metrics"
 	"github.com/nkrypt-xyz/nkrypt-xyz-web-server/internal/service"
 )
 
 type BlobHandler struct {
-	bucketSvc *service.BucketService
-	fileSvc   *service.FileService
-	blobSvc   *service.BlobService
+	bucketSvc  *service.BucketService
+	fileSvc    *service.FileService
+	blobSvc    *service.BlobService
+	uploadSvc  *service.BlobUploadService
+	dirPermSvc *service.DirectoryPermissionService
 }
 
-func NewBlobHandler(bucketSvc *service.BucketService, fileSvc *service.FileService, blobSvc *service.BlobService) *BlobHandler {
-	return &BlobHandler{bucketSvc: bucketSvc, fileSvc: fileSvc, blobSvc: blobSvc}
+func NewBlobHandler(bucketSvc *service.BucketService, fileSvc *service.FileService, blobSvc *service.BlobService, uploadSvc *service.BlobUploadService, dirPermSvc *service.DirectoryPermissionService) *BlobHandler {
+	return &BlobHandler{bucketSvc: bucketSvc, fileSvc: fileSvc, blobSvc: blobSvc, uploadSvc: uploadSvc, dirPermSvc: dirPermSvc}
 }
 
 // Read handles POST /api/blob/read/:bucketId/:fileId
@@ -48,29 +53,40 @@ func (h *BlobHandler) Read(w http.ResponseWriter, r *http.Request) {
 		SendErrorResponse(w, apperror.NewUserError("FILE_NOT_IN_BUCKET", "The requested file could not be found in this bucket."))
 		return
 	}
+	if err := service.RequireDirectoryPermission(r.Context(), h.dirPermSvc, authData.UserID, bucketID, file.ParentDirectoryID, "VIEW_CONTENT"); err != nil {
+		SendErrorResponse(w, err)
+		return
+	}
 
-	blob, err := h.blobSvc.FindLatestFinishedBlob(r.Context(), bucketID, fileID)
-	if err != nil || blob == nil {
-		SendErrorResponse(w, apperror.NewUserError("BLOB_NOT_FOUND", "No finished blob found for this file."))
+	// The blob is kept until the read ends, even if a concurrent write supersedes it
+	blob, release, err := h.blobSvc.BeginRead(r.Context(), bucketID, fileID)
+	if err != nil {
+		SendErrorResponse(w, err)
 		return
 	}
+	defer release()
 
-	size, err := h.blobSvc.GetBlobSize(r.Context(), blob.ID)
+	content, size, err := h.blobSvc.OpenBlob(r.Context(), blob)
 	if err != nil {
 		SendErrorResponse(w, err)
 		return
 	}
+	defer content.Close()
 
 	w.Header().Set("Content-Type", "application/octet-stream")
 	w.Header().Set("Content-Length", strconv.FormatInt(size, 10))
 	w.Header().Set("nk-crypto-meta", blob.CryptoMetaHeaderContent)
-	w.Header().Set("Access-Control-Expose-Headers", "nk-crypto-meta")
+	w.Header().Set("ETag", `"`+blob.ID+`"`)
+	w.Header().Set("Access-Control-Expose-Headers", "nk-crypto-meta, ETag")
 	w.WriteHeader(http.StatusOK)
 
-	_, _ = h.blobSvc.StreamBlobToWriter(r.Context(), blob.ID, w)
+	written, _ := io.Copy(w, content)
+	metrics.BlobBytes.WithLabelValues("download").Add(float64(written))
 }
 
 // Write handles POST /api/blob/write/:bucketId/:fileId
+// With an If-Match header, the write fails with WRITE_CONFLICT unless the given blob is still the
+// file's current blob when the write finishes.
 func (h *BlobHandler) Write(w http.ResponseWriter, r *http.Request) {
 	authData := middleware.GetAuthData(r.Context())
 	if authData == nil {
@@ -102,12 +118,26 @@ func (h *BlobHandler) Write(w http.ResponseWriter, r *http.Request) {
 		SendErrorResponse(w, apperror.NewUserError("FILE_NOT_IN_BUCKET", "The requested file could not be found in this bucket."))
 		return
 	}
+	if err := service.RequireDirectoryPermission(r.Context(), h.dirPermSvc, authData.UserID, bucketID, file.ParentDirectoryID, "MANAGE_CONTENT"); err != nil {
+		SendErrorResponse(w, err)
+		return
+	}
+
+	expectedBlobID := expectedBlobID(r)
+	if err := h.blobSvc.CheckCurrentBlob(r.Context(), bucketID, fileID, expectedBlobID); err != nil {
+		SendErrorResponse(w, err)
+		return
+	}
 
 	blob, err := h.blobSvc.CreateInProgressBlob(r.Context(), bucketID, fileID, cryptoMeta, authData.UserID)
 	if err != nil {
 		SendErrorResponse(w, err)
 		return
 	}
+	if err := h.blobSvc.MarkBlobUploading(r.Context(), blob.ID); err != nil {
+		SendErrorResponse(w, err)
+		return
+	}
 
 	// Stream the request body to MinIO (size -1 means unknown, MinIO will handle streaming)
 	if err := h.blobSvc.UploadBlobFromReader(r.Context(), blob.ID, r.Body, -1); err != nil {
@@ -124,8 +154,10 @@ func (h *BlobHandler) Write(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Mark blob as finished
-	if err := h.blobSvc.MarkBlobFinished(r.Context(), blob.ID); err != nil {
+	metrics.BlobBytes.WithLabelValues("upload").Add(float64(size))
+
+	// Make the blob the file's content
+	if err := h.blobSvc.FinishBlob(r.Context(), bucketID, fileID, blob.ID, expectedBlobID); err != nil {
 		SendErrorResponse(w, err)
 		return
 	}
@@ -140,8 +172,8 @@ func (h *BlobHandler) Write(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Delete old blobs
-	_ = h.blobSvc.RemoveAllOtherBlobs(r.Context(), bucketID, fileID, blob.ID)
+	// Delete replaced blobs that are not being read
+	_ = h.blobSvc.RemoveReplacedBlobs(r.Context(), bucketID, fileID)
 
 	SendSuccess(w, &model.CreateBlobResponse{
 		HasError: false,
@@ -150,7 +182,7 @@ func (h *BlobHandler) Write(w http.ResponseWriter, r *http.Request) {
 }
 
 // WriteQuantized handles POST /api/blob/write-quantized/:bucketId/:fileId/:blobId/:offset/:shouldEnd
-// For chunked uploads
+// For chunked uploads. An If-Match header is checked when the blob starts and when it finishes.
 func (h *BlobHandler) WriteQuantized(w http.ResponseWriter, r *http.Request) {
 	authData := middleware.GetAuthData(r.Context())
 	if authData == nil {
@@ -192,11 +224,20 @@ func (h *BlobHandler) WriteQuantized(w http.ResponseWriter, r *http.Request) {
 		SendErrorResponse(w, apperror.NewUserError("FILE_NOT_IN_BUCKET", "The requested file could not be found in this bucket."))
 		return
 	}
+	if err := service.RequireDirectoryPermission(r.Context(), h.dirPermSvc, authData.UserID, bucketID, file.ParentDirectoryID, "MANAGE_CONTENT"); err != nil {
+		SendErrorResponse(w, err)
+		return
+	}
 
 	var blobID string
+	expectedBlobID := expectedBlobID(r)
 
 	// If blobId is "null", generate new blob
 	if blobIDParam == "null" || blobIDParam == "" {
+		if err := h.blobSvc.CheckCurrentBlob(r.Context(), bucketID, fileID, expectedBlobID); err != nil {
+			SendErrorResponse(w, err)
+			return
+		}
 		cryptoMeta := r.Header.Get("nk-crypto-meta")
 		blob, err := h.blobSvc.CreateInProgressBlob(r.Context(), bucketID, fileID, cryptoMeta, authData.UserID)
 		if err != nil {
@@ -214,40 +255,55 @@ func (h *BlobHandler) WriteQuantized(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	if err := h.blobSvc.MarkBlobUploading(r.Context(), blobID); err != nil {
+		SendErrorResponse(w, err)
+		return
+	}
+
 	// Upload chunk
-	bytesWritten, err := h.blobSvc.AppendChunkToBlob(r.Context(), blobID, offset, r.Body)
+	bytesWritten, nextOffset, err := h.blobSvc.AppendChunkToBlob(r.Context(), blobID, offset, r.Body, r.ContentLength)
 	if err != nil {
 		SendErrorResponse(w, err)
 		return
 	}
+	metrics.BlobBytes.WithLabelValues("upload").Add(float64(bytesWritten))
 
 	// If this is the final chunk, finalize the blob
 	if shouldEnd {
 		// Compose all chunks into final blob
-		if err := h.blobSvc.FinalizeChunkedBlob(r.Context(), blobID); err != nil {
+		if err := h.blobSvc.FinalizeChunkedBlob(r.Context(), blobID, offset); err != nil {
 			SendErrorResponse(w, err)
 			return
 		}
 
-		// Mark blob as finished
-		if err := h.blobSvc.MarkBlobFinished(r.Context(), blobID); err != nil {
+		// Read the size before finishing, which may move the blob's content elsewhere
+		blobSize, sizeErr := h.blobSvc.GetBlobSize(r.Context(), blobID)
+
+		// Make the blob the file's content
+		if err := h.blobSvc.FinishBlob(r.Context(), bucketID, fileID, blobID, expectedBlobID); err != nil {
 			SendErrorResponse(w, err)
 			return
 		}
 
 		// Update file size
-		blobSize, err := h.blobSvc.GetBlobSize(r.Context(), blobID)
-		if err == nil {
+		if sizeErr == nil {
 			_ = h.fileSvc.UpdateSize(r.Context(), bucketID, fileID, blobSize)
 		}
 
-		// Remove old blobs
-		_ = h.blobSvc.RemoveAllOtherBlobs(r.Context(), bucketID, fileID, blobID)
+		// Remove replaced blobs that are not being read
+		_ = h.blobSvc.RemoveReplacedBlobs(r.Context(), bucketID, fileID)
 	}
 
 	SendSuccess(w, &model.WriteQuantizedResponse{
-		HasError:         false,
-		BlobID:           blobID,
-		BytesTransferred: bytesWritten,
+		HasError:           false,
+		BlobID:             blobID,
+		BytesTransferred:   bytesWritten,
+		NextExpectedOffset: nextOffset,
 	})
 }
+
+// expectedBlobID returns the blob ID in the If-Match header, which a writer sets to the blob it
+// read (the ETag of the read response) to fail with WRITE_CONFLICT if the file changed since.
+func expectedBlobID(r *http.Request) string {
+	return strings.Trim(strings.TrimSpace(r.Header.Get("If-Match")), `"`)
+}
@@ -0,0 +1,259 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/nkrypt-xyz/nkrypt-xyz-web-server/internal/middleware"
+	"github.com/nkrypt-xyz/nkrypt-xyz-web-server/internal/model"
+	"github.com/nkrypt-xyz/nkrypt-xyz-web-server/internal/pkg/apperror"
+	"github.com/nkrypt-xyz/nkrypt-xyz-web-server/internal/pkg/metrics"
+	"github.com/nkrypt-xyz/nkrypt-xyz-web-server/internal/service"
+)
+
+// PartChecksumHeader optionally carries the hex SHA-256 of an uploaded part. A part that does not
+// match it is rejected.
+const PartChecksumHeader = "nk-part-sha256"
+
+// completeUploadBodyLimit fits the checksums of the maximum number of parts.
+const completeUploadBodyLimit = 1024 * 1024
+
+// InitiateUpload handles POST /api/blob/upload/initiate
+// An If-Match header is checked here and again by CompleteUpload.
+func (h *BlobHandler) InitiateUpload(w http.ResponseWriter, r *http.Request) {
+	authData := middleware.GetAuthData(r.Context())
+	if authData == nil {
+		SendErrorResponse(w, apperror.NewUserError("ACCESS_DENIED", "Authentication required"))
+		return
+	}
+
+	var req model.InitiateBlobUploadRequest
+	if err := ParseAndValidateBody(r, &req); err != nil {
+		SendErrorResponse(w, err)
+		return
+	}
+
+	if err := h.requireContentManagement(r, authData.UserID, req.BucketID, req.FileID); err != nil {
+		SendErrorResponse(w, err)
+		return
+	}
+
+	if err := h.blobSvc.CheckCurrentBlob(r.Context(), req.BucketID, req.FileID, expectedBlobID(r)); err != nil {
+		SendErrorResponse(w, err)
+		return
+	}
+
+	upload, err := h.uploadSvc.InitiateUpload(r.Context(), req.BucketID, req.FileID, req.CryptoMeta, authData.UserID, req.TotalSizeBytes, req.PartSizeBytes)
+	if err != nil {
+		SendErrorResponse(w, err)
+		return
+	}
+
+	SendSuccess(w, &model.InitiateBlobUploadResponse{
+		HasError:      false,
+		BlobID:        upload.BlobID,
+		PartSizeBytes: upload.PartSizeBytes,
+		PartCount:     upload.PartCount,
+		ExpiresAt:     upload.ExpiresAt.UnixMilli(),
+	})
+}
+
+// UploadPart handles POST /api/blob/upload/part/:bucketId/:fileId/:blobId/:partNumber
+// Parts can be uploaded in parallel and in any order.
+func (h *BlobHandler) UploadPart(w http.ResponseWriter, r *http.Request) {
+	authData := middleware.GetAuthData(r.Context())
+	if authData == nil {
+		SendErrorResponse(w, apperror.NewUserError("ACCESS_DENIED", "Authentication required"))
+		return
+	}
+
+	bucketID := chi.URLParam(r, "bucketId")
+	fileID := chi.URLParam(r, "fileId")
+	blobID := chi.URLParam(r, "blobId")
+
+	if len(bucketID) != 16 || len(fileID) != 16 || len(blobID) != 16 {
+		SendErrorResponse(w, apperror.NewUserError("INVALID_PATH_PARAMS", "Invalid bucket, file or blob ID"))
+		return
+	}
+
+	partNumber, err := strconv.Atoi(chi.URLParam(r, "partNumber"))
+	if err != nil {
+		SendErrorResponse(w, apperror.NewUserError("INVALID_PATH_PARAMS", "Invalid part number"))
+		return
+	}
+
+	if err := h.requireContentManagement(r, authData.UserID, bucketID, fileID); err != nil {
+		SendErrorResponse(w, err)
+		return
+	}
+
+	upload, err := h.uploadSvc.GetUpload(r.Context(), bucketID, fileID, blobID)
+	if err != nil {
+		SendErrorResponse(w, err)
+		return
+	}
+
+	part, err := h.uploadSvc.UploadPart(r.Context(), upload, partNumber, r.Body, r.ContentLength, r.Header.Get(PartChecksumHeader))
+	if err != nil {
+		SendErrorResponse(w, err)
+		return
+	}
+	metrics.BlobBytes.WithLabelValues("upload").Add(float64(part.SizeBytes))
+
+	SendSuccess(w, &model.UploadBlobPartResponse{
+		HasError:   false,
+		PartNumber: part.PartNumber,
+		SizeBytes:  part.SizeBytes,
+		SHA256:     part.SHA256,
+	})
+}
+
+// UploadStatus handles POST /api/blob/upload/status
+// It reports the stored parts, so an interrupted upload can resume with the missing ones.
+func (h *BlobHandler) UploadStatus(w http.ResponseWriter, r *http.Request) {
+	authData := middleware.GetAuthData(r.Context())
+	if authData == nil {
+		SendErrorResponse(w, apperror.NewUserError("ACCESS_DENIED", "Authentication required"))
+		return
+	}
+
+	var req model.BlobUploadRequest
+	if err := ParseAndValidateBody(r, &req); err != nil {
+		SendErrorResponse(w, err)
+		return
+	}
+
+	if err := h.requireContentManagement(r, authData.UserID, req.BucketID, req.FileID); err != nil {
+		SendErrorResponse(w, err)
+		return
+	}
+
+	upload, err := h.uploadSvc.GetUpload(r.Context(), req.BucketID, req.FileID, req.BlobID)
+	if err != nil {
+		SendErrorResponse(w, err)
+		return
+	}
+
+	parts, err := h.uploadSvc.ListParts(r.Context(), upload)
+	if err != nil {
+		SendErrorResponse(w, err)
+		return
+	}
+
+	resp := &model.BlobUploadStatusResponse{
+		HasError:           false,
+		BlobID:             upload.BlobID,
+		TotalSizeBytes:     upload.TotalSizeBytes,
+		PartSizeBytes:      upload.PartSizeBytes,
+		PartCount:          upload.PartCount,
+		ExpiresAt:          upload.ExpiresAt.UnixMilli(),
+		Parts:              make([]model.BlobUploadPartResponse, 0, len(parts)),
+		MissingPartNumbers: service.MissingParts(upload, parts),
+	}
+	for _, p := range parts {
+		resp.Parts = append(resp.Parts, model.BlobUploadPartResponse{
+			PartNumber: p.PartNumber,
+			SizeBytes:  p.SizeBytes,
+			SHA256:     p.SHA256,
+		})
+	}
+
+	SendSuccess(w, resp)
+}
+
+// CompleteUpload handles POST /api/blob/upload/complete
+func (h *BlobHandler) CompleteUpload(w http.ResponseWriter, r *http.Request) {
+	authData := middleware.GetAuthData(r.Context())
+	if authData == nil {
+		SendErrorResponse(w, apperror.NewUserError("ACCESS_DENIED", "Authentication required"))
+		return
+	}
+
+	var req model.CompleteBlobUploadRequest
+	if err := parseAndValidateBodyLimit(r, &req, completeUploadBodyLimit); err != nil {
+		SendErrorResponse(w, err)
+		return
+	}
+
+	if err := h.requireContentManagement(r, authData.UserID, req.BucketID, req.FileID); err != nil {
+		SendErrorResponse(w, err)
+		return
+	}
+
+	upload, err := h.uploadSvc.GetUpload(r.Context(), req.BucketID, req.FileID, req.BlobID)
+	if err != nil {
+		SendErrorResponse(w, err)
+		return
+	}
+
+	if err := h.uploadSvc.CompleteUpload(r.Context(), req.BucketID, req.FileID, upload, req.PartChecksums, expectedBlobID(r)); err != nil {
+		SendErrorResponse(w, err)
+		return
+	}
+
+	// Update file metadata
+	if err := h.fileSvc.UpdateSize(r.Context(), req.BucketID, req.FileID, upload.TotalSizeBytes); err != nil {
+		SendErrorResponse(w, err)
+		return
+	}
+	if err := h.fileSvc.SetContentUpdatedAt(r.Context(), req.BucketID, req.FileID); err != nil {
+		SendErrorResponse(w, err)
+		return
+	}
+
+	// Delete replaced blobs that are not being read
+	_ = h.blobSvc.RemoveReplacedBlobs(r.Context(), req.BucketID, req.FileID)
+
+	SendSuccess(w, &model.CreateBlobResponse{
+		HasError: false,
+		BlobID:   upload.BlobID,
+	})
+}
+
+// AbortUpload handles POST /api/blob/upload/abort
+func (h *BlobHandler) AbortUpload(w http.ResponseWriter, r *http.Request) {
+	authData := middleware.GetAuthData(r.Context())
+	if authData == nil {
+		SendErrorResponse(w, apperror.NewUserError("ACCESS_DENIED", "Authentication required"))
+		return
+	}
+
+	var req model.BlobUploadRequest
+	if err := ParseAndValidateBody(r, &req); err != nil {
+		SendErrorResponse(w, err)
+		return
+	}
+
+	if err := h.requireContentManagement(r, authData.UserID, req.BucketID, req.FileID); err != nil {
+		SendErrorResponse(w, err)
+		return
+	}
+
+	upload, err := h.uploadSvc.GetUpload(r.Context(), req.BucketID, req.FileID, req.BlobID)
+	if err != nil {
+		SendErrorResponse(w, err)
+		return
+	}
+
+	if err := h.uploadSvc.AbortUpload(r.Context(), upload); err != nil {
+		SendErrorResponse(w, err)
+		return
+	}
+
+	SendSuccess(w, &model.EmptySuccessResponse{HasError: false})
+}
+
+// requireContentManagement checks that the file exists and that the user may manage the content
+// of its bucket and directory.
+func (h *BlobHandler) requireContentManagement(r *http.Request, userID, bucketID, fileID string) error {
+	if err := service.RequireBucketPermission(r.Context(), h.bucketSvc, userID, bucketID, "MANAGE_CONTENT"); err != nil {
+		return err
+	}
+	file, err := h.fileSvc.FindFileByID(r.Context(), bucketID, fileID)
+	if err != nil || file == nil {
+		return apperror.NewUserError("FILE_NOT_IN_BUCKET", "The requested file could not be found in this bucket.")
+	}
+	return service.RequireDirectoryPermission(r.Context(), h.dirPermSvc, userID, bucketID, file.ParentDirectoryID, "MANAGE_CONTENT")
+}
@@ -0,0 +1,84 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/nkrypt-xyz/nkrypt-xyz-web-server/internal/middleware"
+	"github.com/nkrypt-xyz/nkrypt-xyz-web-server/internal/model"
+	"github.com/nkrypt-xyz/nkrypt-xyz-web-server/internal/pkg/apperror"
+	"github.com/nkrypt-xyz/nkrypt-xyz-web-server/internal/service"
+)
+
+// BucketNameHeader optionally names the bucket created by an import. By default it is named as
+// in the archive.
+const BucketNameHeader = "nk-bucket-name"
+
+// Export handles POST /api/bucket/export
+// Streams the bucket as a tar archive. Every directory must be viewable by the user.
+func (h *BucketHandler) Export(w http.ResponseWriter, r *http.Request) {
+	authData := middleware.GetAuthData(r.Context())
+	if authData == nil {
+		SendErrorResponse(w, apperror.NewUserError("ACCESS_DENIED", "Authentication required"))
+		return
+	}
+	var req model.ExportBucketRequest
+	if err := ParseAndValidateBody(r, &req); err != nil {
+		SendErrorResponse(w, err)
+		return
+	}
+	if err := service.RequireBucketPermission(r.Context(), h.bucketSvc, authData.UserID, req.BucketID, "VIEW_CONTENT"); err != nil {
+		SendErrorResponse(w, err)
+		return
+	}
+
+	export, err := h.archiveSvc.PrepareExport(r.Context(), req.BucketID, func(ctx context.Context, directoryID string) error {
+		return service.RequireDirectoryPermission(ctx, h.dirPermSvc, authData.UserID, req.BucketID, directoryID, "VIEW_CONTENT")
+	})
+	if err != nil {
+		SendErrorResponse(w, err)
+		return
+	}
+	defer export.Close()
+
+	w.Header().Set("Content-Type", "application/x-tar")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+req.BucketID+`.tar"`)
+	w.WriteHeader(http.StatusOK)
+
+	// The status is sent already; a failed export leaves the archive without its checksums
+	if err := h.archiveSvc.WriteExport(r.Context(), export, w); err != nil {
+		log.Warn().Err(err).Str("bucketId", req.BucketID).Msg("bucket export failed")
+	}
+}
+
+// Import handles POST /api/bucket/import
+// The body is an archive written by Export. The new bucket is owned by the user.
+func (h *BucketHandler) Import(w http.ResponseWriter, r *http.Request) {
+	authData := middleware.GetAuthData(r.Context())
+	if authData == nil {
+		SendErrorResponse(w, apperror.NewUserError("ACCESS_DENIED", "Authentication required"))
+		return
+	}
+	if err := service.RequireGlobalPermission(authData.User, "CREATE_BUCKET"); err != nil {
+		SendErrorResponse(w, err)
+		return
+	}
+	name := r.Header.Get(BucketNameHeader)
+	if len(name) > 64 {
+		SendErrorResponse(w, apperror.NewUserError("INVALID_BUCKET_NAME", "The bucket name must be at most 64 characters."))
+		return
+	}
+
+	bucket, rootDirID, err := h.archiveSvc.Import(r.Context(), r.Body, name, authData.UserID)
+	if err != nil {
+		SendErrorResponse(w, err)
+		return
+	}
+	SendSuccess(w, &model.CreateBucketResponse{
+		HasError:        false,
+		BucketID:        bucket.ID,
+		RootDirectoryID: rootDirID,
+	})
+}
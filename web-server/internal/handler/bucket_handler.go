@@ -11,11 +11,14 @@ import (
 )
 
 type BucketHandler struct {
-	bucketSvc *service.BucketService
+	bucketSvc  *service.BucketService
+	archiveSvc *service.BucketArchiveService
+	blobSvc    *service.BlobService
+	dirPermSvc *service.DirectoryPermissionService
 }
 
-func NewBucketHandler(bucketSvc *service.BucketService) *BucketHandler {
-	return &BucketHandler{bucketSvc: bucketSvc}
+func NewBucketHandler(bucketSvc *service.BucketService, archiveSvc *service.BucketArchiveService, blobSvc *service.BlobService, dirPermSvc *service.DirectoryPermissionService) *BucketHandler {
+	return &BucketHandler{bucketSvc: bucketSvc, archiveSvc: archiveSvc, blobSvc: blobSvc, dirPermSvc: dirPermSvc}
 }
 
 // Create handles POST /api/bucket/create
@@ -74,6 +77,14 @@ func (h *BucketHandler) List(w http.ResponseWriter, r *http.Request) {
 				Permissions: a.Permissions,
 			})
 		}
+		groupAuths := make([]model.BucketGroupAuthorizationResponse, 0, len(b.BucketGroupAuthorizations))
+		for _, a := range b.BucketGroupAuthorizations {
+			groupAuths = append(groupAuths, model.BucketGroupAuthorizationResponse{
+				GroupID:     a.GroupID,
+				Notes:       a.Notes,
+				Permissions: a.Permissions,
+			})
+		}
 		bucketList = append(bucketList, model.BucketResponse{
 			ID:                      b.ID,
 			Name:                    b.Name,
@@ -81,10 +92,13 @@ func (h *BucketHandler) List(w http.ResponseWriter, r *http.Request) {
 			CryptSpec:               b.CryptSpec,
 			CryptData:               b.CryptData,
 			MetaData:                metaData,
+			Compression:             b.Compression,
 			BucketAuthorizations:    auths,
+			BucketGroupAuthorizations: groupAuths,
 			CreatedByUserIdentifier: b.CreatedByUserID + "@.",
 			CreatedAt:               b.CreatedAt.UnixMilli(),
 			UpdatedAt:               b.UpdatedAt.UnixMilli(),
+			Version:                 b.Version,
 		})
 	}
 	SendSuccess(w, &model.BucketListResponse{
@@ -109,11 +123,12 @@ func (h *BucketHandler) Rename(w http.ResponseWriter, r *http.Request) {
 		SendErrorResponse(w, err)
 		return
 	}
-	if err := h.bucketSvc.RenameBucket(r.Context(), req.BucketID, req.Name); err != nil {
+	version, err := h.bucketSvc.RenameBucket(r.Context(), req.BucketID, req.Name, req.ExpectedVersion)
+	if err != nil {
 		SendErrorResponse(w, err)
 		return
 	}
-	SendSuccess(w, &model.EmptySuccessResponse{HasError: false})
+	SendSuccess(w, &model.VersionResponse{HasError: false, Version: version})
 }
 
 // SetMetaData handles POST /api/bucket/set-metadata
@@ -132,11 +147,39 @@ func (h *BucketHandler) SetMetaData(w http.ResponseWriter, r *http.Request) {
 		SendErrorResponse(w, err)
 		return
 	}
-	if err := h.bucketSvc.SetBucketMetaData(r.Context(), req.BucketID, req.MetaData); err != nil {
+	version, err := h.bucketSvc.SetBucketMetaData(r.Context(), req.BucketID, req.MetaData, req.ExpectedVersion)
+	if err != nil {
 		SendErrorResponse(w, err)
 		return
 	}
-	SendSuccess(w, &model.EmptySuccessResponse{HasError: false})
+	SendSuccess(w, &model.VersionResponse{HasError: false, Version: version})
+}
+
+// SetCompression handles POST /api/bucket/set-compression. It sets the codec, none or zstd, that
+// blobs written to the bucket from now on are stored with. Blobs already stored keep their codec,
+// so a bucket may hold both. Compression happens on the server, after encryption on the client,
+// so it only pays off for content that still compresses once encrypted.
+func (h *BucketHandler) SetCompression(w http.ResponseWriter, r *http.Request) {
+	authData := middleware.GetAuthData(r.Context())
+	if authData == nil {
+		SendErrorResponse(w, apperror.NewUserError("ACCESS_DENIED", "Authentication required"))
+		return
+	}
+	var req model.SetBucketCompressionRequest
+	if err := ParseAndValidateBody(r, &req); err != nil {
+		SendErrorResponse(w, err)
+		return
+	}
+	if err := service.RequireBucketPermission(r.Context(), h.bucketSvc, authData.UserID, req.BucketID, "MODIFY"); err != nil {
+		SendErrorResponse(w, err)
+		return
+	}
+	version, err := h.bucketSvc.SetBucketCompression(r.Context(), req.BucketID, req.Compression, req.ExpectedVersion)
+	if err != nil {
+		SendErrorResponse(w, err)
+		return
+	}
+	SendSuccess(w, &model.VersionResponse{HasError: false, Version: version})
 }
 
 // SetAuthorization handles POST /api/bucket/set-authorization
@@ -162,6 +205,124 @@ func (h *BucketHandler) SetAuthorization(w http.ResponseWriter, r *http.Request)
 	SendSuccess(w, &model.EmptySuccessResponse{HasError: false})
 }
 
+// SetGroupAuthorization handles POST /api/bucket/set-group-authorization
+func (h *BucketHandler) SetGroupAuthorization(w http.ResponseWriter, r *http.Request) {
+	authData := middleware.GetAuthData(r.Context())
+	if authData == nil {
+		SendErrorResponse(w, apperror.NewUserError("ACCESS_DENIED", "Authentication required"))
+		return
+	}
+	var req model.SetBucketGroupAuthorizationRequest
+	if err := ParseAndValidateBody(r, &req); err != nil {
+		SendErrorResponse(w, err)
+		return
+	}
+	if err := service.RequireBucketPermission(r.Context(), h.bucketSvc, authData.UserID, req.BucketID, "MANAGE_AUTHORIZATION"); err != nil {
+		SendErrorResponse(w, err)
+		return
+	}
+	if err := h.bucketSvc.SetBucketGroupAuthorization(r.Context(), req.BucketID, req.TargetGroupID, req.PermissionsToSet, authData.User.UserName); err != nil {
+		SendErrorResponse(w, err)
+		return
+	}
+	SendSuccess(w, &model.EmptySuccessResponse{HasError: false})
+}
+
+// RemoveMember handles POST /api/bucket/remove-member
+func (h *BucketHandler) RemoveMember(w http.ResponseWriter, r *http.Request) {
+	authData := middleware.GetAuthData(r.Context())
+	if authData == nil {
+		SendErrorResponse(w, apperror.NewUserError("ACCESS_DENIED", "Authentication required"))
+		return
+	}
+	var req model.RemoveBucketMemberRequest
+	if err := ParseAndValidateBody(r, &req); err != nil {
+		SendErrorResponse(w, err)
+		return
+	}
+	if err := service.RequireBucketPermission(r.Context(), h.bucketSvc, authData.UserID, req.BucketID, "MANAGE_AUTHORIZATION"); err != nil {
+		SendErrorResponse(w, err)
+		return
+	}
+	if err := h.bucketSvc.RemoveBucketMember(r.Context(), req.BucketID, req.TargetUserID); err != nil {
+		SendErrorResponse(w, err)
+		return
+	}
+	SendSuccess(w, &model.EmptySuccessResponse{HasError: false})
+}
+
+// TransferOwnership handles POST /api/bucket/transfer-ownership
+// Only the current owner may hand the bucket over.
+func (h *BucketHandler) TransferOwnership(w http.ResponseWriter, r *http.Request) {
+	authData := middleware.GetAuthData(r.Context())
+	if authData == nil {
+		SendErrorResponse(w, apperror.NewUserError("ACCESS_DENIED", "Authentication required"))
+		return
+	}
+	var req model.TransferBucketOwnershipRequest
+	if err := ParseAndValidateBody(r, &req); err != nil {
+		SendErrorResponse(w, err)
+		return
+	}
+	if err := service.RequireBucketPermission(r.Context(), h.bucketSvc, authData.UserID, req.BucketID, "MANAGE_AUTHORIZATION"); err != nil {
+		SendErrorResponse(w, err)
+		return
+	}
+	bucket, err := h.bucketSvc.FindBucketByID(r.Context(), req.BucketID)
+	if err != nil || bucket == nil {
+		SendErrorResponse(w, apperror.NewUserError("BUCKET_NOT_FOUND", "The requested bucket could not be found."))
+		return
+	}
+	if bucket.CreatedByUserID != authData.UserID {
+		SendErrorResponse(w, apperror.NewUserError("NOT_BUCKET_OWNER", "Only the bucket owner can transfer ownership."))
+		return
+	}
+	if err := h.bucketSvc.TransferBucketOwnership(r.Context(), req.BucketID, req.NewOwnerUserID, authData.User.UserName); err != nil {
+		SendErrorResponse(w, err)
+		return
+	}
+	SendSuccess(w, &model.EmptySuccessResponse{HasError: false})
+}
+
+// ListMembers handles POST /api/bucket/list-members
+func (h *BucketHandler) ListMembers(w http.ResponseWriter, r *http.Request) {
+	authData := middleware.GetAuthData(r.Context())
+	if authData == nil {
+		SendErrorResponse(w, apperror.NewUserError("ACCESS_DENIED", "Authentication required"))
+		return
+	}
+	var req model.ListBucketMembersRequest
+	if err := ParseAndValidateBody(r, &req); err != nil {
+		SendErrorResponse(w, err)
+		return
+	}
+	if err := service.RequireBucketPermission(r.Context(), h.bucketSvc, authData.UserID, req.BucketID); err != nil {
+		SendErrorResponse(w, err)
+		return
+	}
+	members, err := h.bucketSvc.ListBucketMembers(r.Context(), req.BucketID)
+	if err != nil {
+		SendErrorResponse(w, err)
+		return
+	}
+	memberList := make([]model.BucketMemberResponse, 0, len(members))
+	for _, m := range members {
+		memberList = append(memberList, model.BucketMemberResponse{
+			UserID:      m.UserID,
+			UserName:    m.UserName,
+			DisplayName: m.DisplayName,
+			Notes:       m.Notes,
+			Permissions: m.Permissions,
+			GroupIDs:    m.GroupIDs,
+			IsOwner:     m.IsOwner,
+		})
+	}
+	SendSuccess(w, &model.ListBucketMembersResponse{
+		HasError:   false,
+		MemberList: memberList,
+	})
+}
+
 // Destroy handles POST /api/bucket/destroy
 func (h *BucketHandler) Destroy(w http.ResponseWriter, r *http.Request) {
 	authData := middleware.GetAuthData(r.Context())
@@ -187,6 +348,11 @@ func (h *BucketHandler) Destroy(w http.ResponseWriter, r *http.Request) {
 		SendErrorResponse(w, apperror.NewUserError("BUCKET_NAME_MISMATCH", "The bucket name does not match."))
 		return
 	}
+	// Delete all blobs of this bucket
+	if err := h.blobSvc.RemoveAllBlobsOfBucket(r.Context(), req.BucketID); err != nil {
+		SendErrorResponse(w, err)
+		return
+	}
 	if err := h.bucketSvc.DestroyBucket(r.Context(), req.BucketID); err != nil {
 		SendErrorResponse(w, err)
 		return
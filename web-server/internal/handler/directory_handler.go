@@ -13,10 +13,12 @@ import (
 type DirectoryHandler struct {
 	bucketSvc    *service.BucketService
 	directorySvc *service.DirectoryService
+	blobSvc      *service.BlobService
+	dirPermSvc   *service.DirectoryPermissionService
 }
 
-func NewDirectoryHandler(bucketSvc *service.BucketService, directorySvc *service.DirectoryService) *DirectoryHandler {
-	return &DirectoryHandler{bucketSvc: bucketSvc, directorySvc: directorySvc}
+func NewDirectoryHandler(bucketSvc *service.BucketService, directorySvc *service.DirectoryService, blobSvc *service.BlobService, dirPermSvc *service.DirectoryPermissionService) *DirectoryHandler {
+	return &DirectoryHandler{bucketSvc: bucketSvc, directorySvc: directorySvc, blobSvc: blobSvc, dirPermSvc: dirPermSvc}
 }
 
 func directoryToResponse(d *model.Directory) model.DirectoryResponse {
@@ -36,6 +38,7 @@ func directoryToResponse(d *model.Directory) model.DirectoryResponse {
 		CreatedByUserIdentifier: d.CreatedByUserID + "@.",
 		CreatedAt:               d.CreatedAt.UnixMilli(),
 		UpdatedAt:               d.UpdatedAt.UnixMilli(),
+		Version:                 d.Version,
 	}
 	return resp
 }
@@ -59,6 +62,7 @@ func fileToResponse(f *model.File) model.FileResponse {
 		CreatedAt:                f.CreatedAt.UnixMilli(),
 		UpdatedAt:                f.UpdatedAt.UnixMilli(),
 		ContentUpdatedAt:         f.ContentUpdatedAt.UnixMilli(),
+		Version:                  f.Version,
 	}
 }
 
@@ -82,6 +86,10 @@ func (h *DirectoryHandler) Create(w http.ResponseWriter, r *http.Request) {
 		SendErrorResponse(w, err)
 		return
 	}
+	if err := service.RequireDirectoryPermission(r.Context(), h.dirPermSvc, authData.UserID, req.BucketID, req.ParentDirectoryID, "MANAGE_CONTENT"); err != nil {
+		SendErrorResponse(w, err)
+		return
+	}
 	dirID, err := h.directorySvc.CreateDirectory(r.Context(), req.Name, req.BucketID, req.MetaData, req.EncryptedMetaData, authData.UserID, req.ParentDirectoryID)
 	if err != nil {
 		SendErrorResponse(w, err)
@@ -114,6 +122,15 @@ func (h *DirectoryHandler) Get(w http.ResponseWriter, r *http.Request) {
 		SendErrorResponse(w, err)
 		return
 	}
+	if err := service.RequireDirectoryPermission(r.Context(), h.dirPermSvc, authData.UserID, req.BucketID, req.DirectoryID, "VIEW_CONTENT"); err != nil {
+		SendErrorResponse(w, err)
+		return
+	}
+	childDirs, err = h.dirPermSvc.FilterVisibleDirectories(r.Context(), req.BucketID, req.DirectoryID, authData.UserID, childDirs)
+	if err != nil {
+		SendErrorResponse(w, err)
+		return
+	}
 	childDirList := make([]model.DirectoryResponse, 0, len(childDirs))
 	for i := range childDirs {
 		childDirList = append(childDirList, directoryToResponse(&childDirs[i]))
@@ -150,11 +167,16 @@ func (h *DirectoryHandler) Rename(w http.ResponseWriter, r *http.Request) {
 		SendErrorResponse(w, err)
 		return
 	}
-	if err := h.directorySvc.RenameDirectory(r.Context(), req.BucketID, req.DirectoryID, req.Name); err != nil {
+	if err := service.RequireDirectoryPermission(r.Context(), h.dirPermSvc, authData.UserID, req.BucketID, req.DirectoryID, "MANAGE_CONTENT"); err != nil {
 		SendErrorResponse(w, err)
 		return
 	}
-	SendSuccess(w, &model.EmptySuccessResponse{HasError: false})
+	version, err := h.directorySvc.RenameDirectory(r.Context(), req.BucketID, req.DirectoryID, req.Name, req.ExpectedVersion)
+	if err != nil {
+		SendErrorResponse(w, err)
+		return
+	}
+	SendSuccess(w, &model.VersionResponse{HasError: false, Version: version})
 }
 
 // Move handles POST /api/directory/move
@@ -177,15 +199,24 @@ func (h *DirectoryHandler) Move(w http.ResponseWriter, r *http.Request) {
 		SendErrorResponse(w, err)
 		return
 	}
+	if err := service.RequireDirectoryPermission(r.Context(), h.dirPermSvc, authData.UserID, req.BucketID, req.DirectoryID, "MANAGE_CONTENT"); err != nil {
+		SendErrorResponse(w, err)
+		return
+	}
 	if err := service.EnsureDirectoryBelongsToBucket(r.Context(), h.directorySvc, req.BucketID, req.NewParentDirectoryID); err != nil {
 		SendErrorResponse(w, err)
 		return
 	}
-	if err := h.directorySvc.MoveDirectory(r.Context(), req.BucketID, req.DirectoryID, req.NewParentDirectoryID, req.NewName); err != nil {
+	if err := service.RequireDirectoryPermission(r.Context(), h.dirPermSvc, authData.UserID, req.BucketID, req.NewParentDirectoryID, "MANAGE_CONTENT"); err != nil {
 		SendErrorResponse(w, err)
 		return
 	}
-	SendSuccess(w, &model.EmptySuccessResponse{HasError: false})
+	version, err := h.directorySvc.MoveDirectory(r.Context(), req.BucketID, req.DirectoryID, req.NewParentDirectoryID, req.NewName, req.ExpectedVersion)
+	if err != nil {
+		SendErrorResponse(w, err)
+		return
+	}
+	SendSuccess(w, &model.VersionResponse{HasError: false, Version: version})
 }
 
 // Delete handles POST /api/directory/delete
@@ -208,6 +239,19 @@ func (h *DirectoryHandler) Delete(w http.ResponseWriter, r *http.Request) {
 		SendErrorResponse(w, err)
 		return
 	}
+	if err := service.RequireDirectoryPermission(r.Context(), h.dirPermSvc, authData.UserID, req.BucketID, req.DirectoryID, "MANAGE_CONTENT"); err != nil {
+		SendErrorResponse(w, err)
+		return
+	}
+	if err := h.dirPermSvc.EnsureSubtreeManageable(r.Context(), req.BucketID, req.DirectoryID, authData.UserID); err != nil {
+		SendErrorResponse(w, err)
+		return
+	}
+	// Delete all blobs below this directory
+	if err := h.blobSvc.RemoveAllBlobsInDirectory(r.Context(), req.BucketID, req.DirectoryID); err != nil {
+		SendErrorResponse(w, err)
+		return
+	}
 	if err := h.directorySvc.DeleteDirectory(r.Context(), req.BucketID, req.DirectoryID); err != nil {
 		SendErrorResponse(w, err)
 		return
@@ -235,11 +279,16 @@ func (h *DirectoryHandler) SetMetaData(w http.ResponseWriter, r *http.Request) {
 		SendErrorResponse(w, err)
 		return
 	}
-	if err := h.directorySvc.SetMetaData(r.Context(), req.BucketID, req.DirectoryID, req.MetaData); err != nil {
+	if err := service.RequireDirectoryPermission(r.Context(), h.dirPermSvc, authData.UserID, req.BucketID, req.DirectoryID, "MANAGE_CONTENT"); err != nil {
 		SendErrorResponse(w, err)
 		return
 	}
-	SendSuccess(w, &model.EmptySuccessResponse{HasError: false})
+	version, err := h.directorySvc.SetMetaData(r.Context(), req.BucketID, req.DirectoryID, req.MetaData, req.ExpectedVersion)
+	if err != nil {
+		SendErrorResponse(w, err)
+		return
+	}
+	SendSuccess(w, &model.VersionResponse{HasError: false, Version: version})
 }
 
 // SetEncryptedMetaData handles POST /api/directory/set-encrypted-metadata
@@ -262,9 +311,130 @@ func (h *DirectoryHandler) SetEncryptedMetaData(w http.ResponseWriter, r *http.R
 		SendErrorResponse(w, err)
 		return
 	}
-	if err := h.directorySvc.SetEncryptedMetaData(r.Context(), req.BucketID, req.DirectoryID, req.EncryptedMetaData); err != nil {
+	if err := service.RequireDirectoryPermission(r.Context(), h.dirPermSvc, authData.UserID, req.BucketID, req.DirectoryID, "MANAGE_CONTENT"); err != nil {
+		SendErrorResponse(w, err)
+		return
+	}
+	version, err := h.directorySvc.SetEncryptedMetaData(r.Context(), req.BucketID, req.DirectoryID, req.EncryptedMetaData, req.ExpectedVersion)
+	if err != nil {
+		SendErrorResponse(w, err)
+		return
+	}
+	SendSuccess(w, &model.VersionResponse{HasError: false, Version: version})
+}
+
+// SetPermissionOverride handles POST /api/directory/set-permission-override
+func (h *DirectoryHandler) SetPermissionOverride(w http.ResponseWriter, r *http.Request) {
+	authData := middleware.GetAuthData(r.Context())
+	if authData == nil {
+		SendErrorResponse(w, apperror.NewUserError("ACCESS_DENIED", "Authentication required"))
+		return
+	}
+	var req model.SetDirectoryPermissionOverrideRequest
+	if err := ParseAndValidateBody(r, &req); err != nil {
+		SendErrorResponse(w, err)
+		return
+	}
+	if err := service.RequireBucketPermission(r.Context(), h.bucketSvc, authData.UserID, req.BucketID, "MANAGE_AUTHORIZATION"); err != nil {
+		SendErrorResponse(w, err)
+		return
+	}
+	if err := service.EnsureDirectoryBelongsToBucket(r.Context(), h.directorySvc, req.BucketID, req.DirectoryID); err != nil {
+		SendErrorResponse(w, err)
+		return
+	}
+	if err := h.dirPermSvc.SetOverride(r.Context(), req.BucketID, req.DirectoryID, req.TargetUserID, req.TargetGroupID, req.PermissionsToSet, authData.User.UserName); err != nil {
 		SendErrorResponse(w, err)
 		return
 	}
 	SendSuccess(w, &model.EmptySuccessResponse{HasError: false})
 }
+
+// ListPermissionOverrides handles POST /api/directory/list-permission-overrides
+func (h *DirectoryHandler) ListPermissionOverrides(w http.ResponseWriter, r *http.Request) {
+	authData := middleware.GetAuthData(r.Context())
+	if authData == nil {
+		SendErrorResponse(w, apperror.NewUserError("ACCESS_DENIED", "Authentication required"))
+		return
+	}
+	var req model.ListDirectoryPermissionOverridesRequest
+	if err := ParseAndValidateBody(r, &req); err != nil {
+		SendErrorResponse(w, err)
+		return
+	}
+	if err := service.RequireBucketPermission(r.Context(), h.bucketSvc, authData.UserID, req.BucketID, "MANAGE_AUTHORIZATION"); err != nil {
+		SendErrorResponse(w, err)
+		return
+	}
+	if err := service.EnsureDirectoryBelongsToBucket(r.Context(), h.directorySvc, req.BucketID, req.DirectoryID); err != nil {
+		SendErrorResponse(w, err)
+		return
+	}
+	overrides, err := h.dirPermSvc.ListOverrides(r.Context(), req.BucketID, req.DirectoryID)
+	if err != nil {
+		SendErrorResponse(w, err)
+		return
+	}
+	overrideList := make([]model.DirectoryPermissionOverrideResponse, 0, len(overrides))
+	for _, o := range overrides {
+		perms := map[string]bool{}
+		if o.PermViewContent != nil {
+			perms["VIEW_CONTENT"] = *o.PermViewContent
+		}
+		if o.PermManageContent != nil {
+			perms["MANAGE_CONTENT"] = *o.PermManageContent
+		}
+		overrideList = append(overrideList, model.DirectoryPermissionOverrideResponse{
+			UserID:      o.UserID,
+			GroupID:     o.GroupID,
+			Notes:       o.Notes,
+			Permissions: perms,
+		})
+	}
+	SendSuccess(w, &model.ListDirectoryPermissionOverridesResponse{
+		HasError:     false,
+		OverrideList: overrideList,
+	})
+}
+
+// GetEffectivePermissions handles POST /api/directory/get-effective-permissions
+// Looking up another user's permissions requires MANAGE_AUTHORIZATION on the bucket.
+func (h *DirectoryHandler) GetEffectivePermissions(w http.ResponseWriter, r *http.Request) {
+	authData := middleware.GetAuthData(r.Context())
+	if authData == nil {
+		SendErrorResponse(w, apperror.NewUserError("ACCESS_DENIED", "Authentication required"))
+		return
+	}
+	var req model.GetEffectiveDirectoryPermissionsRequest
+	if err := ParseAndValidateBody(r, &req); err != nil {
+		SendErrorResponse(w, err)
+		return
+	}
+	targetUserID := authData.UserID
+	if req.UserID != "" && req.UserID != authData.UserID {
+		if err := service.RequireBucketPermission(r.Context(), h.bucketSvc, authData.UserID, req.BucketID, "MANAGE_AUTHORIZATION"); err != nil {
+			SendErrorResponse(w, err)
+			return
+		}
+		targetUserID = req.UserID
+	} else if err := service.RequireBucketPermission(r.Context(), h.bucketSvc, authData.UserID, req.BucketID); err != nil {
+		SendErrorResponse(w, err)
+		return
+	}
+	perm, err := h.dirPermSvc.GetEffectivePermissions(r.Context(), req.BucketID, req.DirectoryID, targetUserID)
+	if err != nil {
+		SendErrorResponse(w, err)
+		return
+	}
+	SendSuccess(w, &model.GetEffectiveDirectoryPermissionsResponse{
+		HasError: false,
+		UserID:   targetUserID,
+		Permissions: map[string]bool{
+			"MODIFY":               perm.PermModify,
+			"MANAGE_AUTHORIZATION": perm.PermManageAuthorization,
+			"DESTROY":              perm.PermDestroy,
+			"VIEW_CONTENT":         perm.PermViewContent,
+			"MANAGE_CONTENT":       perm.PermManageContent,
+		},
+	})
+}
@@ -14,10 +14,11 @@ type FileHandler struct {
 	directorySvc *service.DirectoryService
 	fileSvc      *service.FileService
 	blobSvc      *service.BlobService
+	dirPermSvc   *service.DirectoryPermissionService
 }
 
-func NewFileHandler(bucketSvc *service.BucketService, directorySvc *service.DirectoryService, fileSvc *service.FileService, blobSvc *service.BlobService) *FileHandler {
-	return &FileHandler{bucketSvc: bucketSvc, directorySvc: directorySvc, fileSvc: fileSvc, blobSvc: blobSvc}
+func NewFileHandler(bucketSvc *service.BucketService, directorySvc *service.DirectoryService, fileSvc *service.FileService, blobSvc *service.BlobService, dirPermSvc *service.DirectoryPermissionService) *FileHandler {
+	return &FileHandler{bucketSvc: bucketSvc, directorySvc: directorySvc, fileSvc: fileSvc, blobSvc: blobSvc, dirPermSvc: dirPermSvc}
 }
 
 // Create handles POST /api/file/create
@@ -40,6 +41,10 @@ func (h *FileHandler) Create(w http.ResponseWriter, r *http.Request) {
 		SendErrorResponse(w, err)
 		return
 	}
+	if err := service.RequireDirectoryPermission(r.Context(), h.dirPermSvc, authData.UserID, req.BucketID, req.ParentDirectoryID, "MANAGE_CONTENT"); err != nil {
+		SendErrorResponse(w, err)
+		return
+	}
 	fileID, err := h.fileSvc.CreateFile(r.Context(), req.Name, req.BucketID, req.MetaData, req.EncryptedMetaData, authData.UserID, req.ParentDirectoryID)
 	if err != nil {
 		SendErrorResponse(w, err)
@@ -72,6 +77,10 @@ func (h *FileHandler) Get(w http.ResponseWriter, r *http.Request) {
 		SendErrorResponse(w, apperror.NewUserError("FILE_NOT_IN_BUCKET", "The requested file could not be found in this bucket."))
 		return
 	}
+	if err := service.RequireDirectoryPermission(r.Context(), h.dirPermSvc, authData.UserID, req.BucketID, file.ParentDirectoryID, "VIEW_CONTENT"); err != nil {
+		SendErrorResponse(w, err)
+		return
+	}
 	SendSuccess(w, &model.GetFileResponse{
 		HasError: false,
 		File:     fileToResponse(file),
@@ -94,15 +103,16 @@ func (h *FileHandler) Rename(w http.ResponseWriter, r *http.Request) {
 		SendErrorResponse(w, err)
 		return
 	}
-	if err := service.EnsureFileBelongsToBucket(r.Context(), h.fileSvc, req.BucketID, req.FileID); err != nil {
+	if err := service.RequireFilePermission(r.Context(), h.dirPermSvc, h.fileSvc, authData.UserID, req.BucketID, req.FileID, "MANAGE_CONTENT"); err != nil {
 		SendErrorResponse(w, err)
 		return
 	}
-	if err := h.fileSvc.RenameFile(r.Context(), req.BucketID, req.FileID, req.Name); err != nil {
+	version, err := h.fileSvc.RenameFile(r.Context(), req.BucketID, req.FileID, req.Name, req.ExpectedVersion)
+	if err != nil {
 		SendErrorResponse(w, err)
 		return
 	}
-	SendSuccess(w, &model.EmptySuccessResponse{HasError: false})
+	SendSuccess(w, &model.VersionResponse{HasError: false, Version: version})
 }
 
 // Move handles POST /api/file/move
@@ -121,7 +131,7 @@ func (h *FileHandler) Move(w http.ResponseWriter, r *http.Request) {
 		SendErrorResponse(w, err)
 		return
 	}
-	if err := service.EnsureFileBelongsToBucket(r.Context(), h.fileSvc, req.BucketID, req.FileID); err != nil {
+	if err := service.RequireFilePermission(r.Context(), h.dirPermSvc, h.fileSvc, authData.UserID, req.BucketID, req.FileID, "MANAGE_CONTENT"); err != nil {
 		SendErrorResponse(w, err)
 		return
 	}
@@ -129,11 +139,16 @@ func (h *FileHandler) Move(w http.ResponseWriter, r *http.Request) {
 		SendErrorResponse(w, err)
 		return
 	}
-	if err := h.fileSvc.MoveFile(r.Context(), req.BucketID, req.FileID, req.NewParentDirectoryID, req.NewName); err != nil {
+	if err := service.RequireDirectoryPermission(r.Context(), h.dirPermSvc, authData.UserID, req.BucketID, req.NewParentDirectoryID, "MANAGE_CONTENT"); err != nil {
 		SendErrorResponse(w, err)
 		return
 	}
-	SendSuccess(w, &model.EmptySuccessResponse{HasError: false})
+	version, err := h.fileSvc.MoveFile(r.Context(), req.BucketID, req.FileID, req.NewParentDirectoryID, req.NewName, req.ExpectedVersion)
+	if err != nil {
+		SendErrorResponse(w, err)
+		return
+	}
+	SendSuccess(w, &model.VersionResponse{HasError: false, Version: version})
 }
 
 // Delete handles POST /api/file/delete
@@ -152,7 +167,7 @@ func (h *FileHandler) Delete(w http.ResponseWriter, r *http.Request) {
 		SendErrorResponse(w, err)
 		return
 	}
-	if err := service.EnsureFileBelongsToBucket(r.Context(), h.fileSvc, req.BucketID, req.FileID); err != nil {
+	if err := service.RequireFilePermission(r.Context(), h.dirPermSvc, h.fileSvc, authData.UserID, req.BucketID, req.FileID, "MANAGE_CONTENT"); err != nil {
 		SendErrorResponse(w, err)
 		return
 	}
@@ -184,15 +199,16 @@ func (h *FileHandler) SetMetaData(w http.ResponseWriter, r *http.Request) {
 		SendErrorResponse(w, err)
 		return
 	}
-	if err := service.EnsureFileBelongsToBucket(r.Context(), h.fileSvc, req.BucketID, req.FileID); err != nil {
+	if err := service.RequireFilePermission(r.Context(), h.dirPermSvc, h.fileSvc, authData.UserID, req.BucketID, req.FileID, "MANAGE_CONTENT"); err != nil {
 		SendErrorResponse(w, err)
 		return
 	}
-	if err := h.fileSvc.SetMetaData(r.Context(), req.BucketID, req.FileID, req.MetaData); err != nil {
+	version, err := h.fileSvc.SetMetaData(r.Context(), req.BucketID, req.FileID, req.MetaData, req.ExpectedVersion)
+	if err != nil {
 		SendErrorResponse(w, err)
 		return
 	}
-	SendSuccess(w, &model.EmptySuccessResponse{HasError: false})
+	SendSuccess(w, &model.VersionResponse{HasError: false, Version: version})
 }
 
 // SetEncryptedMetaData handles POST /api/file/set-encrypted-metadata
@@ -211,13 +227,14 @@ func (h *FileHandler) SetEncryptedMetaData(w http.ResponseWriter, r *http.Reques
 		SendErrorResponse(w, err)
 		return
 	}
-	if err := service.EnsureFileBelongsToBucket(r.Context(), h.fileSvc, req.BucketID, req.FileID); err != nil {
+	if err := service.RequireFilePermission(r.Context(), h.dirPermSvc, h.fileSvc, authData.UserID, req.BucketID, req.FileID, "MANAGE_CONTENT"); err != nil {
 		SendErrorResponse(w, err)
 		return
 	}
-	if err := h.fileSvc.SetEncryptedMetaData(r.Context(), req.BucketID, req.FileID, req.EncryptedMetaData); err != nil {
+	version, err := h.fileSvc.SetEncryptedMetaData(r.Context(), req.BucketID, req.FileID, req.EncryptedMetaData, req.ExpectedVersion)
+	if err != nil {
 		SendErrorResponse(w, err)
 		return
 	}
-	SendSuccess(w, &model.EmptySuccessResponse{HasError: false})
+	SendSuccess(w, &model.VersionResponse{HasError: false, Version: version})
 }
@@ -0,0 +1,158 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/nkrypt-xyz/nkrypt-xyz-web-server/internal/middleware"
+	"github.com/nkrypt-xyz/nkrypt-xyz-web-server/internal/model"
+	"github.com/nkrypt-xyz/nkrypt-xyz-web-server/internal/pkg/apperror"
+	"github.com/nkrypt-xyz/nkrypt-xyz-web-server/internal/service"
+)
+
+type GroupHandler struct {
+	groupSvc *service.GroupService
+}
+
+func NewGroupHandler(groupSvc *service.GroupService) *GroupHandler {
+	return &GroupHandler{groupSvc: groupSvc}
+}
+
+// Create handles POST /api/admin/iam/create-group
+func (h *GroupHandler) Create(w http.ResponseWriter, r *http.Request) {
+	authData := middleware.GetAuthData(r.Context())
+	if authData == nil {
+		SendErrorResponse(w, apperror.NewUserError("ACCESS_DENIED", "Authentication required"))
+		return
+	}
+
+	if err := service.RequireGlobalPermission(authData.User, "MANAGE_ALL_USER"); err != nil {
+		SendErrorResponse(w, err)
+		return
+	}
+
+	var req model.CreateGroupRequest
+	if err := ParseAndValidateBody(r, &req); err != nil {
+		SendErrorResponse(w, err)
+		return
+	}
+
+	groupID, err := h.groupSvc.CreateGroup(r.Context(), req.Name, req.Description, authData.UserID)
+	if err != nil {
+		SendErrorResponse(w, err)
+		return
+	}
+
+	SendSuccess(w, &model.CreateGroupResponse{
+		HasError: false,
+		GroupID:  groupID,
+	})
+}
+
+// Delete handles POST /api/admin/iam/delete-group
+func (h *GroupHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	authData := middleware.GetAuthData(r.Context())
+	if authData == nil {
+		SendErrorResponse(w, apperror.NewUserError("ACCESS_DENIED", "Authentication required"))
+		return
+	}
+
+	if err := service.RequireGlobalPermission(authData.User, "MANAGE_ALL_USER"); err != nil {
+		SendErrorResponse(w, err)
+		return
+	}
+
+	var req model.DeleteGroupRequest
+	if err := ParseAndValidateBody(r, &req); err != nil {
+		SendErrorResponse(w, err)
+		return
+	}
+
+	if err := h.groupSvc.DeleteGroup(r.Context(), req.GroupID); err != nil {
+		SendErrorResponse(w, err)
+		return
+	}
+
+	SendSuccess(w, &model.EmptySuccessResponse{HasError: false})
+}
+
+// AddMember handles POST /api/admin/iam/add-group-member
+func (h *GroupHandler) AddMember(w http.ResponseWriter, r *http.Request) {
+	authData := middleware.GetAuthData(r.Context())
+	if authData == nil {
+		SendErrorResponse(w, apperror.NewUserError("ACCESS_DENIED", "Authentication required"))
+		return
+	}
+
+	if err := service.RequireGlobalPermission(authData.User, "MANAGE_ALL_USER"); err != nil {
+		SendErrorResponse(w, err)
+		return
+	}
+
+	var req model.AddGroupMemberRequest
+	if err := ParseAndValidateBody(r, &req); err != nil {
+		SendErrorResponse(w, err)
+		return
+	}
+
+	if err := h.groupSvc.AddMember(r.Context(), req.GroupID, req.UserID); err != nil {
+		SendErrorResponse(w, err)
+		return
+	}
+
+	SendSuccess(w, &model.EmptySuccessResponse{HasError: false})
+}
+
+// RemoveMember handles POST /api/admin/iam/remove-group-member
+func (h *GroupHandler) RemoveMember(w http.ResponseWriter, r *http.Request) {
+	authData := middleware.GetAuthData(r.Context())
+	if authData == nil {
+		SendErrorResponse(w, apperror.NewUserError("ACCESS_DENIED", "Authentication required"))
+		return
+	}
+
+	if err := service.RequireGlobalPermission(authData.User, "MANAGE_ALL_USER"); err != nil {
+		SendErrorResponse(w, err)
+		return
+	}
+
+	var req model.RemoveGroupMemberRequest
+	if err := ParseAndValidateBody(r, &req); err != nil {
+		SendErrorResponse(w, err)
+		return
+	}
+
+	if err := h.groupSvc.RemoveMember(r.Context(), req.GroupID, req.UserID); err != nil {
+		SendErrorResponse(w, err)
+		return
+	}
+
+	SendSuccess(w, &model.EmptySuccessResponse{HasError: false})
+}
+
+// List handles POST /api/group/list
+// Any authenticated user may list groups so that bucket managers can grant them access.
+func (h *GroupHandler) List(w http.ResponseWriter, r *http.Request) {
+	groups, err := h.groupSvc.ListGroups(r.Context())
+	if err != nil {
+		SendErrorResponse(w, err)
+		return
+	}
+
+	groupList := make([]model.GroupResponse, 0, len(groups))
+	for _, item := range groups {
+		groupList = append(groupList, model.GroupResponse{
+			ID:                      item.Group.ID,
+			Name:                    item.Group.Name,
+			Description:             item.Group.Description,
+			MemberUserIDs:           item.MemberUserIDs,
+			CreatedByUserIdentifier: item.Group.CreatedByUserID + "@.",
+			CreatedAt:               item.Group.CreatedAt.UnixMilli(),
+			UpdatedAt:               item.Group.UpdatedAt.UnixMilli(),
+		})
+	}
+
+	SendSuccess(w, &model.GroupListResponse{
+		HasError:  false,
+		GroupList: groupList,
+	})
+}
@@ -47,8 +47,13 @@ func SendErrorResponse(w http.ResponseWriter, err error) {
 
 // ParseAndValidateBody reads JSON body and validates with struct tags.
 func ParseAndValidateBody(r *http.Request, dst interface{}) error {
-	// 1. Limit body size to 100KB
-	r.Body = http.MaxBytesReader(nil, r.Body, 100*1024)
+	return parseAndValidateBodyLimit(r, dst, 100*1024)
+}
+
+// parseAndValidateBodyLimit is ParseAndValidateBody for bodies that may exceed 100KB.
+func parseAndValidateBodyLimit(r *http.Request, dst interface{}, limit int64) error {
+	// 1. Limit body size
+	r.Body = http.MaxBytesReader(nil, r.Body, limit)
 
 	// 2. Decode JSON
 	decoder := json.NewDecoder(r.Body)
@@ -1,17 +1,47 @@
 package handler
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+	"sync"
+	"time"
 
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog/log"
+
+	"github.com/nkrypt-xyz/nkrypt-xyz-web-server/internal/pkg/metrics"
+	"github.com/nkrypt-xyz/nkrypt-xyz-web-server/internal/pkg/migrate"
+	"github.com/nkrypt-xyz/nkrypt-xyz-web-server/internal/pkg/storage"
 )
 
+// readyCheckTimeout bounds each dependency check, so one hanging dependency cannot stall the probe.
+const readyCheckTimeout = 2 * time.Second
+
 // HealthHandler holds dependencies needed for readiness checks.
 type HealthHandler struct {
-	DB    *pgxpool.Pool
-	Redis *redis.Client
+	DB       *pgxpool.Pool
+	Redis    *redis.Client
+	Storage  *storage.MinIOClient
+	Migrator *migrate.Migrator
+}
+
+// DependencyStatus is the result of checking one dependency.
+type DependencyStatus struct {
+	Status    string  `json:"status"`
+	Error     string  `json:"error,omitempty"`
+	LatencyMs float64 `json:"latencyMs"`
+}
+
+// dependencyCheck checks one dependency. error is the message shown publicly on failure; the
+// underlying error is only logged.
+type dependencyCheck struct {
+	name  string
+	error string
+	check func(ctx context.Context) error
 }
 
 // Healthz is a simple liveness probe: it only indicates the process is running.
@@ -20,32 +50,104 @@ func (h *HealthHandler) Healthz(w http.ResponseWriter, _ *http.Request) {
 	_, _ = w.Write([]byte("ok"))
 }
 
-// Readyz checks whether critical dependencies are reachable.
+// Readyz checks whether critical dependencies are reachable. All checks run concurrently and
+// each result is reported, along with the schema version when the database is reachable.
 func (h *HealthHandler) Readyz(w http.ResponseWriter, r *http.Request) {
 	type status struct {
-		Status string `json:"status"`
-		Error  string `json:"error,omitempty"`
+		Status        string                      `json:"status"`
+		SchemaVersion *int64                      `json:"schemaVersion,omitempty"`
+		Dependencies  map[string]DependencyStatus `json:"dependencies"`
 	}
 
+	var schemaVersion *int64
+	var checks []dependencyCheck
+
 	// Check PostgreSQL if configured.
 	if h.DB != nil {
-		if err := h.DB.Ping(r.Context()); err != nil {
-			w.WriteHeader(http.StatusServiceUnavailable)
-			_ = json.NewEncoder(w).Encode(status{Status: "not ready", Error: "database unavailable"})
-			return
-		}
+		checks = append(checks, dependencyCheck{name: "postgres", error: "database unavailable", check: h.DB.Ping})
 	}
 
 	// Check Redis if configured.
 	if h.Redis != nil {
-		if err := h.Redis.Ping(r.Context()).Err(); err != nil {
-			w.WriteHeader(http.StatusServiceUnavailable)
-			_ = json.NewEncoder(w).Encode(status{Status: "not ready", Error: "redis unavailable"})
-			return
+		checks = append(checks, dependencyCheck{name: "redis", error: "redis unavailable", check: func(ctx context.Context) error {
+			return h.Redis.Ping(ctx).Err()
+		}})
+	}
+
+	// Check object storage if configured.
+	if h.Storage != nil {
+		checks = append(checks, dependencyCheck{name: "minio", error: "object storage unavailable", check: h.Storage.Ping})
+	}
+
+	// Check the schema version if configured. The server refuses to start behind the latest
+	// migration, but a migration could be reverted while it runs.
+	if h.Migrator != nil {
+		checks = append(checks, dependencyCheck{name: "schema", error: "database schema is not up to date", check: func(ctx context.Context) error {
+			version, dirty, err := h.Migrator.Version(ctx)
+			if err != nil {
+				return err
+			}
+			schemaVersion = &version
+			if dirty || version < h.Migrator.Latest() {
+				return fmt.Errorf("schema version %d (dirty: %t), latest %d", version, dirty, h.Migrator.Latest())
+			}
+			return nil
+		}})
+	}
+
+	results := runDependencyChecks(r.Context(), checks, readyCheckTimeout)
+
+	resp := status{Status: "ok", SchemaVersion: schemaVersion, Dependencies: results}
+	code := http.StatusOK
+	for _, result := range results {
+		if result.Status != "ok" {
+			resp.Status = "not ready"
+			code = http.StatusServiceUnavailable
 		}
 	}
 
-	w.WriteHeader(http.StatusOK)
-	_, _ = w.Write([]byte("ok"))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(resp)
 }
 
+// runDependencyChecks runs the checks concurrently, each with its own timeout, and records the
+// results in the dependency gauges.
+func runDependencyChecks(ctx context.Context, checks []dependencyCheck, timeout time.Duration) map[string]DependencyStatus {
+	results := make(map[string]DependencyStatus, len(checks))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
+	for _, c := range checks {
+		wg.Add(1)
+		go func(c dependencyCheck) {
+			defer wg.Done()
+			checkCtx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+
+			start := time.Now()
+			err := c.check(checkCtx)
+			elapsed := time.Since(start)
+
+			result := DependencyStatus{Status: "ok", LatencyMs: float64(elapsed.Microseconds()) / 1000}
+			up := 1.0
+			if err != nil {
+				result.Status = "error"
+				result.Error = c.error
+				if errors.Is(err, context.DeadlineExceeded) {
+					result.Error = c.error + " (timeout)"
+				}
+				up = 0
+				log.Warn().Err(err).Str("dependency", c.name).Msg("readiness check failed")
+			}
+			metrics.DependencyUp.WithLabelValues(c.name).Set(up)
+			metrics.DependencyCheckDuration.WithLabelValues(c.name).Set(elapsed.Seconds())
+
+			mu.Lock()
+			results[c.name] = result
+			mu.Unlock()
+		}(c)
+	}
+	wg.Wait()
+	return results
+}
@@ -0,0 +1,35 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRunDependencyChecksReportsEachDependency(t *testing.T) {
+	checks := []dependencyCheck{
+		{name: "fast", error: "fast unavailable", check: func(ctx context.Context) error { return nil }},
+		{name: "broken", error: "broken unavailable", check: func(ctx context.Context) error { return errors.New("connection refused") }},
+		{name: "hanging", error: "hanging unavailable", check: func(ctx context.Context) error {
+			<-ctx.Done()
+			return ctx.Err()
+		}},
+	}
+
+	start := time.Now()
+	results := runDependencyChecks(context.Background(), checks, 50*time.Millisecond)
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("Expected the hanging check to time out, took %v", elapsed)
+	}
+
+	if results["fast"].Status != "ok" || results["fast"].Error != "" {
+		t.Errorf("fast: got %+v", results["fast"])
+	}
+	if results["broken"].Status != "error" || results["broken"].Error != "broken unavailable" {
+		t.Errorf("broken: got %+v, the underlying error must not be exposed", results["broken"])
+	}
+	if results["hanging"].Status != "error" || results["hanging"].Error != "hanging unavailable (timeout)" || results["hanging"].LatencyMs < 40 {
+		t.Errorf("hanging: got %+v", results["hanging"])
+	}
+}
@@ -0,0 +1,185 @@
+package handler
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/nkrypt-xyz/nkrypt-xyz-web-server/internal/middleware"
+	"github.com/nkrypt-xyz/nkrypt-xyz-web-server/internal/model"
+	"github.com/nkrypt-xyz/nkrypt-xyz-web-server/internal/pkg/apperror"
+	"github.com/nkrypt-xyz/nkrypt-xyz-web-server/internal/service"
+)
+
+type InvitationHandler struct {
+	invSvc *service.InvitationService
+}
+
+func NewInvitationHandler(invSvc *service.InvitationService) *InvitationHandler {
+	return &InvitationHandler{invSvc: invSvc}
+}
+
+// Create handles POST /api/admin/iam/create-invitation
+func (h *InvitationHandler) Create(w http.ResponseWriter, r *http.Request) {
+	authData := middleware.GetAuthData(r.Context())
+	if authData == nil {
+		SendErrorResponse(w, apperror.NewUserError("ACCESS_DENIED", "Authentication required"))
+		return
+	}
+
+	if err := service.RequireGlobalPermission(authData.User, "CREATE_USER"); err != nil {
+		SendErrorResponse(w, err)
+		return
+	}
+
+	var req model.CreateInvitationRequest
+	if err := ParseAndValidateBody(r, &req); err != nil {
+		SendErrorResponse(w, err)
+		return
+	}
+
+	validity := time.Duration(req.ValidForSeconds) * time.Second
+	inv, token, err := h.invSvc.CreateInvitation(r.Context(), authData.User, req.Notes, validity, req.GlobalPermissions, req.BucketGrants)
+	if err != nil {
+		SendErrorResponse(w, err)
+		return
+	}
+
+	SendSuccess(w, &model.CreateInvitationResponse{
+		HasError:     false,
+		InvitationID: inv.ID,
+		Token:        token,
+		ExpiresAt:    inv.ExpiresAt.UnixMilli(),
+	})
+}
+
+// List handles POST /api/admin/iam/list-invitations
+// Users holding MANAGE_ALL_USER see every invitation; others see only their own.
+func (h *InvitationHandler) List(w http.ResponseWriter, r *http.Request) {
+	authData := middleware.GetAuthData(r.Context())
+	if authData == nil {
+		SendErrorResponse(w, apperror.NewUserError("ACCESS_DENIED", "Authentication required"))
+		return
+	}
+
+	if err := service.RequireGlobalPermission(authData.User, "CREATE_USER"); err != nil {
+		SendErrorResponse(w, err)
+		return
+	}
+
+	createdBy := authData.UserID
+	if authData.User.PermManageAllUser {
+		createdBy = ""
+	}
+	items, err := h.invSvc.ListInvitations(r.Context(), createdBy)
+	if err != nil {
+		SendErrorResponse(w, err)
+		return
+	}
+
+	invitationList := make([]model.InvitationResponse, 0, len(items))
+	for _, item := range items {
+		inv := item.Invitation
+		grants := make([]model.InvitationBucketGrantResponse, 0, len(item.BucketGrants))
+		for _, g := range item.BucketGrants {
+			grants = append(grants, model.InvitationBucketGrantResponse{
+				BucketID: g.BucketID,
+				Permissions: map[string]bool{
+					"MODIFY":               g.PermModify,
+					"MANAGE_AUTHORIZATION": g.PermManageAuthorization,
+					"DESTROY":              g.PermDestroy,
+					"VIEW_CONTENT":         g.PermViewContent,
+					"MANAGE_CONTENT":       g.PermManageContent,
+				},
+			})
+		}
+		var redeemedAt *int64
+		if inv.RedeemedAt != nil {
+			ms := inv.RedeemedAt.UnixMilli()
+			redeemedAt = &ms
+		}
+		invitationList = append(invitationList, model.InvitationResponse{
+			ID:    inv.ID,
+			Notes: inv.Notes,
+			GlobalPermissions: map[string]bool{
+				"MANAGE_ALL_USER": inv.PermManageAllUser,
+				"CREATE_USER":     inv.PermCreateUser,
+				"CREATE_BUCKET":   inv.PermCreateBucket,
+			},
+			BucketGrants:            grants,
+			CreatedByUserIdentifier: inv.CreatedByUserID + "@.",
+			ExpiresAt:               inv.ExpiresAt.UnixMilli(),
+			RedeemedAt:              redeemedAt,
+			RedeemedByUserID:        inv.RedeemedByUserID,
+			CreatedAt:               inv.CreatedAt.UnixMilli(),
+		})
+	}
+
+	SendSuccess(w, &model.InvitationListResponse{
+		HasError:       false,
+		InvitationList: invitationList,
+	})
+}
+
+// Revoke handles POST /api/admin/iam/revoke-invitation
+func (h *InvitationHandler) Revoke(w http.ResponseWriter, r *http.Request) {
+	authData := middleware.GetAuthData(r.Context())
+	if authData == nil {
+		SendErrorResponse(w, apperror.NewUserError("ACCESS_DENIED", "Authentication required"))
+		return
+	}
+
+	var req model.RevokeInvitationRequest
+	if err := ParseAndValidateBody(r, &req); err != nil {
+		SendErrorResponse(w, err)
+		return
+	}
+
+	if err := h.invSvc.RevokeInvitation(r.Context(), authData.User, req.InvitationID); err != nil {
+		SendErrorResponse(w, err)
+		return
+	}
+
+	SendSuccess(w, &model.EmptySuccessResponse{HasError: false})
+}
+
+// Redeem handles POST /api/user/redeem-invitation
+// This endpoint is public: the invitation token is the credential.
+func (h *InvitationHandler) Redeem(w http.ResponseWriter, r *http.Request) {
+	var req model.RedeemInvitationRequest
+	if err := ParseAndValidateBody(r, &req); err != nil {
+		SendErrorResponse(w, err)
+		return
+	}
+
+	userID, err := h.invSvc.RedeemInvitation(r.Context(), req.Token, req.DisplayName, req.UserName, req.Password)
+	if err != nil {
+		SendErrorResponse(w, err)
+		return
+	}
+
+	SendSuccess(w, &model.RegisterResponse{
+		HasError: false,
+		UserID:   userID,
+	})
+}
+
+// Register handles POST /api/user/register
+// This endpoint is public and only works when open registration is enabled.
+func (h *InvitationHandler) Register(w http.ResponseWriter, r *http.Request) {
+	var req model.RegisterRequest
+	if err := ParseAndValidateBody(r, &req); err != nil {
+		SendErrorResponse(w, err)
+		return
+	}
+
+	userID, err := h.invSvc.Register(r.Context(), req.DisplayName, req.UserName, req.Password)
+	if err != nil {
+		SendErrorResponse(w, err)
+		return
+	}
+
+	SendSuccess(w, &model.RegisterResponse{
+		HasError: false,
+		UserID:   userID,
+	})
+}
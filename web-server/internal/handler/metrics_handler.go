@@ -25,17 +25,51 @@ func (h *MetricsHandler) GetSummary(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	diskUsage, err := h.metricsSvc.GetDiskUsage(r.Context())
+	userUsage, err := h.metricsSvc.GetUserUsage(r.Context(), authData.UserID)
 	if err != nil {
 		SendErrorResponse(w, err)
 		return
 	}
 
-	SendSuccess(w, &model.MetricsGetSummaryResponse{
+	bucketUsages, err := h.metricsSvc.ListBucketUsageForUser(r.Context(), authData.UserID)
+	if err != nil {
+		SendErrorResponse(w, err)
+		return
+	}
+
+	resp := &model.MetricsGetSummaryResponse{
 		HasError: false,
-		Disk: model.MetricsDiskResponse{
+		User: model.MetricsUsageResponse{
+			FileCount:      userUsage.FileCount,
+			DirectoryCount: userUsage.DirectoryCount,
+			EncryptedBytes: userUsage.EncryptedBytes,
+			StoredBytes:    userUsage.StoredBytes,
+		},
+		Buckets: make([]model.MetricsBucketUsageResponse, 0, len(bucketUsages)),
+	}
+	for _, b := range bucketUsages {
+		resp.Buckets = append(resp.Buckets, model.MetricsBucketUsageResponse{
+			BucketID:       b.BucketID,
+			Name:           b.Name,
+			FileCount:      b.Usage.FileCount,
+			DirectoryCount: b.Usage.DirectoryCount,
+			EncryptedBytes: b.Usage.EncryptedBytes,
+			StoredBytes:    b.Usage.StoredBytes,
+		})
+	}
+
+	// Cluster-wide disk figures describe the infrastructure, so only admins see them.
+	if service.RequireGlobalPermission(authData.User, "MANAGE_ALL_USER") == nil {
+		diskUsage, err := h.metricsSvc.GetDiskUsage(r.Context())
+		if err != nil {
+			SendErrorResponse(w, err)
+			return
+		}
+		resp.Disk = &model.MetricsDiskResponse{
 			UsedBytes:  diskUsage.UsedBytes,
 			TotalBytes: diskUsage.TotalBytes,
-		},
-	})
+		}
+	}
+
+	SendSuccess(w, resp)
 }
@@ -8,6 +8,7 @@ import (
 	"github.com/nkrypt-xyz/nkrypt-xyz-web-server/internal/model"
 	"github.com/nkrypt-xyz/nkrypt-xyz-web-server/internal/pkg/apperror"
 	"github.com/nkrypt-xyz/nkrypt-xyz-web-server/internal/pkg/crypto"
+	"github.com/nkrypt-xyz/nkrypt-xyz-web-server/internal/pkg/metrics"
 	"github.com/nkrypt-xyz/nkrypt-xyz-web-server/internal/service"
 )
 
@@ -38,10 +39,12 @@ func (h *UserHandler) Login(w http.ResponseWriter, r *http.Request) {
 
 	user, err := h.userSvc.FindUserByUserName(ctx, req.UserName)
 	if err != nil || user == nil {
+		metrics.Logins.WithLabelValues("failure").Inc()
 		SendErrorResponse(w, apperror.NewUserError("USER_NOT_FOUND", "User not found"))
 		return
 	}
 	if user.IsBanned {
+		metrics.Logins.WithLabelValues("failure").Inc()
 		SendErrorResponse(w, apperror.NewUserError("USER_BANNED", "User is banned"))
 		return
 	}
@@ -56,6 +59,7 @@ func (h *UserHandler) Login(w http.ResponseWriter, r *http.Request) {
 		h.cfg.Crypto.Argon2Parallelism,
 	)
 	if err != nil || !ok {
+		metrics.Logins.WithLabelValues("failure").Inc()
 		SendErrorResponse(w, apperror.NewUserError("PASSWORD_INVALID", "Invalid password"))
 		return
 	}
@@ -65,6 +69,7 @@ func (h *UserHandler) Login(w http.ResponseWriter, r *http.Request) {
 		SendErrorResponse(w, err)
 		return
 	}
+	metrics.Logins.WithLabelValues("success").Inc()
 
 	userResp := model.UserResponse{
 		ID:                user.ID,
@@ -7,7 +7,7 @@ func CORS(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
 		w.Header().Set("Access-Control-Allow-Headers",
-			"Origin, X-Requested-With, Content-Type, Accept, Authorization, nk-crypto-meta")
+			"Origin, X-Requested-With, Content-Type, Accept, Authorization, If-Match, nk-crypto-meta")
 		w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
 
 		if r.Method == http.MethodOptions {
@@ -4,11 +4,15 @@ import (
 	"bytes"
 	"io"
 	"net/http"
+	"strconv"
 	"time"
 
+	"github.com/go-chi/chi/v5"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/trace"
 
+	"github.com/nkrypt-xyz/nkrypt-xyz-web-server/internal/pkg/metrics"
 	"github.com/nkrypt-xyz/nkrypt-xyz-web-server/internal/pkg/redact"
 )
 
@@ -100,15 +104,19 @@ func Logging(next http.Handler) http.Handler {
 		next.ServeHTTP(ww, r)
 
 		duration := time.Since(start)
+		recordRequestMetrics(r, ww.statusCode, duration)
 
 		// Basic response logging (always at INFO level)
-		log.Info().
+		completed := log.Info().
 			Str("request_id", requestID).
 			Str("method", r.Method).
 			Str("path", r.URL.Path).
 			Int("status", ww.statusCode).
-			Dur("duration", duration).
-			Msg("request completed")
+			Dur("duration", duration)
+		if sc := trace.SpanContextFromContext(r.Context()); sc.IsValid() {
+			completed = completed.Str("trace_id", sc.TraceID().String())
+		}
+		completed.Msg("request completed")
 
 		// Detailed response logging at DEBUG/TRACE level
 		if logLevel <= zerolog.DebugLevel && ww.body != nil {
@@ -124,3 +132,14 @@ func Logging(next http.Handler) http.Handler {
 	})
 }
 
+// recordRequestMetrics updates the HTTP metrics. The route pattern is only known once chi has
+// routed the request, so this runs after the handler.
+func recordRequestMetrics(r *http.Request, statusCode int, duration time.Duration) {
+	route := "unmatched"
+	if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+		route = rctx.RoutePattern()
+	}
+	status := strconv.Itoa(statusCode)
+	metrics.HTTPRequests.WithLabelValues(r.Method, route, status).Inc()
+	metrics.HTTPRequestDuration.WithLabelValues(r.Method, route, status).Observe(duration.Seconds())
+}
@@ -0,0 +1,58 @@
+package model
+
+import "encoding/json"
+
+// Bucket archives are tar files holding, in order, the manifest, the content of each file with a
+// blob, and the checksums of both.
+const (
+	BucketArchiveFormat    = "nkrypt-bucket-archive"
+	BucketArchiveVersion   = 1
+	BucketArchiveManifest  = "manifest.json"
+	BucketArchiveChecksums = "checksums.json"
+	BucketArchiveBlobDir   = "blobs/"
+)
+
+// BucketManifest describes an exported bucket. IDs are those of the exporting instance; an import
+// assigns new ones. Directories are listed parents first, starting with the root directory.
+type BucketManifest struct {
+	Format      string              `json:"format"`
+	Version     int                 `json:"version"`
+	ExportedAt  int64               `json:"exportedAt"`
+	Bucket      ManifestBucket      `json:"bucket"`
+	Directories []ManifestDirectory `json:"directories"`
+	Files       []ManifestFile      `json:"files"`
+}
+
+// ManifestBucket is the bucket of a BucketManifest.
+type ManifestBucket struct {
+	Name            string          `json:"name"`
+	CryptSpec       string          `json:"cryptSpec"`
+	CryptData       string          `json:"cryptData"`
+	MetaData        json.RawMessage `json:"metaData"`
+	RootDirectoryID string          `json:"rootDirectoryId"`
+}
+
+// ManifestDirectory is a directory of a BucketManifest. The root directory has no parent.
+type ManifestDirectory struct {
+	ID                string          `json:"_id"`
+	ParentDirectoryID string          `json:"parentDirectoryId,omitempty"`
+	Name              string          `json:"name"`
+	MetaData          json.RawMessage `json:"metaData"`
+	EncryptedMetaData string          `json:"encryptedMetaData"`
+}
+
+// ManifestFile is a file of a BucketManifest. Files with content have a Blob, whose ciphertext is
+// stored in the archive as blobs/<file ID>.
+type ManifestFile struct {
+	ID                string          `json:"_id"`
+	ParentDirectoryID string          `json:"parentDirectoryId"`
+	Name              string          `json:"name"`
+	MetaData          json.RawMessage `json:"metaData"`
+	EncryptedMetaData string          `json:"encryptedMetaData"`
+	Blob              *ManifestBlob   `json:"blob,omitempty"`
+}
+
+// ManifestBlob is the current blob of a ManifestFile.
+type ManifestBlob struct {
+	CryptoMeta string `json:"cryptoMeta"`
+}
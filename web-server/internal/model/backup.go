@@ -0,0 +1,35 @@
+package model
+
+// Backups are a set of files: one CSV file per table under tables/, a copy of every object that
+// finished blobs reference under objects/, and the manifest, written last.
+const (
+	BackupFormat       = "nkrypt-backup"
+	BackupVersion      = 1
+	BackupManifestName = "manifest.json"
+	BackupTableDir     = "tables/"
+	BackupObjectDir    = "objects/"
+)
+
+// BackupManifest describes a backup. A backup without one is incomplete.
+type BackupManifest struct {
+	Format        string         `json:"format"`
+	Version       int            `json:"version"`
+	CreatedAt     int64          `json:"createdAt"`
+	SchemaVersion int64          `json:"schemaVersion"`
+	Tables        []BackupTable  `json:"tables"`
+	Objects       []BackupObject `json:"objects"`
+}
+
+// BackupTable is a table of a backup, listed after the tables it references.
+type BackupTable struct {
+	Name   string `json:"name"`
+	Rows   int64  `json:"rows"`
+	SHA256 string `json:"sha256"`
+}
+
+// BackupObject is a stored object of a backup, under the key it has in the object store.
+type BackupObject struct {
+	Key       string `json:"key"`
+	SizeBytes int64  `json:"sizeBytes"`
+	SHA256    string `json:"sha256"`
+}
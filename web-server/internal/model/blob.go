@@ -2,6 +2,32 @@ package model
 
 import "time"
 
+// Blob statuses. A blob is started when created, uploading once content arrives, then finished or
+// error. A finished blob becomes superseded when a newer blob of its file finishes, and is deleted
+// once no read of it is in flight.
+const (
+	BlobStatusStarted    = "started"
+	BlobStatusUploading  = "uploading"
+	BlobStatusFinished   = "finished"
+	BlobStatusError      = "error"
+	BlobStatusSuperseded = "superseded"
+)
+
+// Blob locations. A hot blob is stored in the MinIO bucket and a cold one in the tiering store. A
+// cooling blob was copied to the tiering store and is read from there, but its hot object is kept
+// until reads that began before the move have ended.
+const (
+	BlobLocationHot     = "hot"
+	BlobLocationCooling = "cooling"
+	BlobLocationCold    = "cold"
+)
+
+// Blob codecs: how the object of a blob is stored.
+const (
+	BlobCodecNone = "none"
+	BlobCodecZstd = "zstd"
+)
+
 // Blob represents the blobs table.
 type Blob struct {
 	ID                       string
@@ -10,8 +36,51 @@ type Blob struct {
 	CryptoMetaHeaderContent  string
 	StartedAt                time.Time
 	FinishedAt               *time.Time
-	Status                   string // 'started', 'finished', 'error'
+	SupersededAt             *time.Time
+	Status                   string // one of the BlobStatus constants
+	ContentSHA256            *string // set once the content is deduplicated into blob_contents
+	Location                 string  // one of the BlobLocation constants
+	LocationChangedAt        *time.Time
+	Codec                    string // one of the BlobCodec constants
+	SizeBytes                *int64 // size of the content; nil until stored, or if stored before sizes were recorded
+	StoredSizeBytes          *int64 // size of the object, smaller than SizeBytes if compressed
 	CreatedByUserID          string
 	CreatedAt                time.Time
 	UpdatedAt                time.Time
 }
+
+// InProgress reports whether content can still be written to the blob.
+func (b *Blob) InProgress() bool {
+	return b.Status == BlobStatusStarted || b.Status == BlobStatusUploading
+}
+
+// BlobContent represents the blob_contents table: deduplicated content shared by the blobs
+// referencing it.
+type BlobContent struct {
+	SHA256    string
+	SizeBytes int64
+	RefCount  int
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// BlobUpload represents the blob_uploads table: an upload session writing a blob in parts.
+type BlobUpload struct {
+	BlobID          string
+	StorageUploadID string
+	TotalSizeBytes  int64
+	PartSizeBytes   int64
+	PartCount       int
+	CreatedAt       time.Time
+	ExpiresAt       time.Time
+}
+
+// BlobUploadPart represents the blob_upload_parts table.
+type BlobUploadPart struct {
+	BlobID     string
+	PartNumber int
+	SizeBytes  int64
+	SHA256     string
+	ETag       string
+	UploadedAt time.Time
+}
@@ -9,9 +9,11 @@ type Bucket struct {
 	CryptSpec        string
 	CryptData        string
 	MetaData         []byte // JSONB
+	Compression      string // codec new blob objects are stored with, one of the BlobCodec constants
 	CreatedByUserID  string
 	CreatedAt        time.Time
 	UpdatedAt        time.Time
+	Version          int64 // incremented by renames and metadata updates
 }
 
 // BucketPermission represents a row in bucket_user_permissions.
@@ -37,10 +39,13 @@ type BucketListItem struct {
 	CryptSpec              string
 	CryptData              string
 	MetaData               []byte
+	Compression            string
 	CreatedByUserID        string
 	CreatedAt              time.Time
 	UpdatedAt              time.Time
+	Version                int64
 	BucketAuthorizations   []BucketAuthorizationItem
+	BucketGroupAuthorizations []BucketGroupAuthorizationItem
 }
 
 // BucketAuthorizationItem is one entry in bucketAuthorizations array (API response format).
@@ -49,3 +54,22 @@ type BucketAuthorizationItem struct {
 	Notes        string         `json:"notes"`
 	Permissions  map[string]bool `json:"permissions"`
 }
+
+// BucketGroupAuthorizationItem is one entry in bucketGroupAuthorizations array (API response format).
+type BucketGroupAuthorizationItem struct {
+	GroupID     string          `json:"groupId"`
+	Notes       string          `json:"notes"`
+	Permissions map[string]bool `json:"permissions"`
+}
+
+// BucketMember is a user with access to a bucket, directly or through groups.
+// Permissions holds the merged permissions; Notes comes from the direct grant, if any.
+type BucketMember struct {
+	UserID      string
+	UserName    string
+	DisplayName string
+	Notes       string
+	Permissions map[string]bool
+	GroupIDs    []string
+	IsOwner     bool
+}
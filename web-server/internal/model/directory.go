@@ -13,4 +13,20 @@ type Directory struct {
 	CreatedByUserID     string
 	CreatedAt           time.Time
 	UpdatedAt           time.Time
+	Version             int64 // incremented by renames, moves and metadata updates
+}
+
+// DirectoryPermissionOverride represents a row in directory_permission_overrides.
+// Exactly one of UserID and GroupID is set. A nil permission means "inherit".
+type DirectoryPermissionOverride struct {
+	ID                int64
+	BucketID          string
+	DirectoryID       string
+	UserID            *string
+	GroupID           *string
+	Notes             string
+	PermViewContent   *bool
+	PermManageContent *bool
+	CreatedAt         time.Time
+	UpdatedAt         time.Time
 }
@@ -15,4 +15,5 @@ type File struct {
 	CreatedAt                 time.Time
 	UpdatedAt                 time.Time
 	ContentUpdatedAt          time.Time
+	Version                   int64 // incremented by renames, moves and metadata updates
 }
@@ -0,0 +1,41 @@
+package model
+
+import "time"
+
+// UserGroup represents the user_groups table.
+type UserGroup struct {
+	ID              string
+	Name            string
+	Description     string
+	CreatedByUserID string
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
+}
+
+// UserGroupMember represents a row in user_group_members.
+type UserGroupMember struct {
+	GroupID   string
+	UserID    string
+	CreatedAt time.Time
+}
+
+// BucketGroupPermission represents a row in bucket_group_permissions.
+type BucketGroupPermission struct {
+	ID                      int64
+	BucketID                string
+	GroupID                 string
+	Notes                   string
+	PermModify              bool
+	PermManageAuthorization bool
+	PermDestroy             bool
+	PermViewContent         bool
+	PermManageContent       bool
+	CreatedAt               time.Time
+	UpdatedAt               time.Time
+}
+
+// UserGroupListItem is a group together with the IDs of its members.
+type UserGroupListItem struct {
+	Group         UserGroup
+	MemberUserIDs []string
+}
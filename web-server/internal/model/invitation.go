@@ -0,0 +1,36 @@
+package model
+
+import "time"
+
+// Invitation represents the invitations table.
+type Invitation struct {
+	ID                string
+	TokenHash         string
+	CreatedByUserID   string
+	Notes             string
+	PermManageAllUser bool
+	PermCreateUser    bool
+	PermCreateBucket  bool
+	ExpiresAt         time.Time
+	RedeemedAt        *time.Time
+	RedeemedByUserID  *string
+	CreatedAt         time.Time
+}
+
+// InvitationBucketGrant represents a row in invitation_bucket_grants: bucket permissions applied to
+// the invitee's account when the invitation is redeemed.
+type InvitationBucketGrant struct {
+	InvitationID            string
+	BucketID                string
+	PermModify              bool
+	PermManageAuthorization bool
+	PermDestroy             bool
+	PermViewContent         bool
+	PermManageContent       bool
+}
+
+// InvitationListItem is an invitation together with its bucket grants.
+type InvitationListItem struct {
+	Invitation   Invitation
+	BucketGrants []InvitationBucketGrant
+}
@@ -5,3 +5,19 @@ type DiskUsage struct {
 	UsedBytes  int64
 	TotalBytes int64
 }
+
+// UsageStats counts files and directories and the bytes stored for files. Root directories are
+// not counted. It is cached in Redis as JSON.
+type UsageStats struct {
+	FileCount      int64 `json:"fileCount"`
+	DirectoryCount int64 `json:"directoryCount"`
+	EncryptedBytes int64 `json:"encryptedBytes"`
+	StoredBytes    int64 `json:"storedBytes"` // EncryptedBytes after compression
+}
+
+// BucketUsage is the usage of one bucket.
+type BucketUsage struct {
+	BucketID string     `json:"bucketId"`
+	Name     string     `json:"name"`
+	Usage    UsageStats `json:"usage"`
+}
@@ -0,0 +1,31 @@
+package model
+
+import "time"
+
+// Replication operations: copy an object to the replica, or delete it there.
+const (
+	ReplicationOpPut    = "put"
+	ReplicationOpDelete = "delete"
+)
+
+// ReplicationTask represents the replication_queue table: the latest change to an object that is
+// not replicated yet.
+type ReplicationTask struct {
+	ObjectKey     string
+	Operation     string // one of the ReplicationOp constants
+	Version       int64
+	Attempts      int
+	LastError     *string
+	EnqueuedAt    time.Time
+	NextAttemptAt time.Time
+}
+
+// ReplicationStatus summarizes the replication queue.
+type ReplicationStatus struct {
+	// Queued counts the objects waiting to be replicated, Retrying those among them whose last
+	// attempt failed.
+	Queued   int64 `json:"queued"`
+	Retrying int64 `json:"retrying"`
+	// LagSeconds is how long the oldest queued change has waited, 0 if none is queued.
+	LagSeconds float64 `json:"lagSeconds"`
+}
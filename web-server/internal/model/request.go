@@ -44,14 +44,27 @@ type CreateBucketRequest struct {
 	MetaData  interface{} `json:"metaData" validate:"required"`
 }
 
+// RenameBucketRequest renames a bucket. In this and the other rename, move and metadata requests,
+// a non-zero expectedVersion rejects the change with VERSION_CONFLICT unless the entity is still
+// at that version.
 type RenameBucketRequest struct {
 	BucketID string `json:"bucketId" validate:"required,len=16,alphanum"`
 	Name     string `json:"name" validate:"required,min=1,max=64"`
+	ExpectedVersion int64 `json:"expectedVersion,omitempty" validate:"min=0"`
 }
 
 type SetBucketMetaDataRequest struct {
 	BucketID string      `json:"bucketId" validate:"required,len=16,alphanum"`
 	MetaData interface{} `json:"metaData" validate:"required"`
+	ExpectedVersion int64 `json:"expectedVersion,omitempty" validate:"min=0"`
+}
+
+// SetBucketCompressionRequest sets the codec that blobs written to the bucket from now on are
+// stored with. Blobs already stored keep their codec.
+type SetBucketCompressionRequest struct {
+	BucketID        string `json:"bucketId" validate:"required,len=16,alphanum"`
+	Compression     string `json:"compression" validate:"required,oneof=none zstd"`
+	ExpectedVersion int64  `json:"expectedVersion,omitempty" validate:"min=0"`
 }
 
 type SetBucketAuthorizationRequest struct {
@@ -60,6 +73,30 @@ type SetBucketAuthorizationRequest struct {
 	PermissionsToSet map[string]bool `json:"permissionsToSet" validate:"required"`
 }
 
+type SetBucketGroupAuthorizationRequest struct {
+	TargetGroupID    string          `json:"targetGroupId" validate:"required,len=16,alphanum"`
+	BucketID         string          `json:"bucketId" validate:"required,len=16,alphanum"`
+	PermissionsToSet map[string]bool `json:"permissionsToSet" validate:"required"`
+}
+
+type RemoveBucketMemberRequest struct {
+	BucketID     string `json:"bucketId" validate:"required,len=16,alphanum"`
+	TargetUserID string `json:"targetUserId" validate:"required,len=16,alphanum"`
+}
+
+type TransferBucketOwnershipRequest struct {
+	BucketID       string `json:"bucketId" validate:"required,len=16,alphanum"`
+	NewOwnerUserID string `json:"newOwnerUserId" validate:"required,len=16,alphanum"`
+}
+
+type ListBucketMembersRequest struct {
+	BucketID string `json:"bucketId" validate:"required,len=16,alphanum"`
+}
+
+type ExportBucketRequest struct {
+	BucketID string `json:"bucketId" validate:"required,len=16,alphanum"`
+}
+
 type DestroyBucketRequest struct {
 	BucketID string `json:"bucketId" validate:"required,len=16,alphanum"`
 	Name     string `json:"name" validate:"required,min=1,max=64"`
@@ -83,6 +120,7 @@ type RenameDirectoryRequest struct {
 	Name        string `json:"name" validate:"required,min=1,max=256"`
 	BucketID    string `json:"bucketId" validate:"required,len=16,alphanum"`
 	DirectoryID string `json:"directoryId" validate:"required,len=16,alphanum"`
+	ExpectedVersion int64 `json:"expectedVersion,omitempty" validate:"min=0"`
 }
 
 type MoveDirectoryRequest struct {
@@ -90,6 +128,7 @@ type MoveDirectoryRequest struct {
 	DirectoryID          string `json:"directoryId" validate:"required,len=16,alphanum"`
 	NewParentDirectoryID string `json:"newParentDirectoryId" validate:"required,len=16,alphanum"`
 	NewName              string `json:"newName" validate:"required,min=1,max=256"`
+	ExpectedVersion int64 `json:"expectedVersion,omitempty" validate:"min=0"`
 }
 
 type DeleteDirectoryRequest struct {
@@ -101,12 +140,36 @@ type SetDirectoryMetaDataRequest struct {
 	MetaData    interface{} `json:"metaData" validate:"required"`
 	BucketID    string      `json:"bucketId" validate:"required,len=16,alphanum"`
 	DirectoryID string      `json:"directoryId" validate:"required,len=16,alphanum"`
+	ExpectedVersion int64 `json:"expectedVersion,omitempty" validate:"min=0"`
 }
 
 type SetDirectoryEncryptedMetaDataRequest struct {
 	EncryptedMetaData string `json:"encryptedMetaData" validate:"required,min=1,max=1048576"`
 	BucketID          string `json:"bucketId" validate:"required,len=16,alphanum"`
 	DirectoryID       string `json:"directoryId" validate:"required,len=16,alphanum"`
+	ExpectedVersion int64 `json:"expectedVersion,omitempty" validate:"min=0"`
+}
+
+// SetDirectoryPermissionOverrideRequest sets a per-directory override for exactly one of
+// targetUserId and targetGroupId. A null permission value resets it to inherit.
+type SetDirectoryPermissionOverrideRequest struct {
+	BucketID         string           `json:"bucketId" validate:"required,len=16,alphanum"`
+	DirectoryID      string           `json:"directoryId" validate:"required,len=16,alphanum"`
+	TargetUserID     string           `json:"targetUserId,omitempty" validate:"omitempty,len=16,alphanum"`
+	TargetGroupID    string           `json:"targetGroupId,omitempty" validate:"omitempty,len=16,alphanum"`
+	PermissionsToSet map[string]*bool `json:"permissionsToSet" validate:"required"`
+}
+
+type ListDirectoryPermissionOverridesRequest struct {
+	BucketID    string `json:"bucketId" validate:"required,len=16,alphanum"`
+	DirectoryID string `json:"directoryId" validate:"required,len=16,alphanum"`
+}
+
+// GetEffectiveDirectoryPermissionsRequest defaults to the calling user when userId is omitted.
+type GetEffectiveDirectoryPermissionsRequest struct {
+	BucketID    string `json:"bucketId" validate:"required,len=16,alphanum"`
+	DirectoryID string `json:"directoryId" validate:"required,len=16,alphanum"`
+	UserID      string `json:"userId,omitempty" validate:"omitempty,len=16,alphanum"`
 }
 
 // File requests
@@ -127,6 +190,7 @@ type RenameFileRequest struct {
 	Name     string `json:"name" validate:"required,min=1,max=256"`
 	BucketID string `json:"bucketId" validate:"required,len=16,alphanum"`
 	FileID   string `json:"fileId" validate:"required,len=16,alphanum"`
+	ExpectedVersion int64 `json:"expectedVersion,omitempty" validate:"min=0"`
 }
 
 type MoveFileRequest struct {
@@ -134,6 +198,7 @@ type MoveFileRequest struct {
 	FileID               string `json:"fileId" validate:"required,len=16,alphanum"`
 	NewParentDirectoryID string `json:"newParentDirectoryId" validate:"required,len=16,alphanum"`
 	NewName              string `json:"newName" validate:"required,min=1,max=256"`
+	ExpectedVersion int64 `json:"expectedVersion,omitempty" validate:"min=0"`
 }
 
 type DeleteFileRequest struct {
@@ -145,12 +210,14 @@ type SetFileMetaDataRequest struct {
 	MetaData interface{} `json:"metaData" validate:"required"`
 	BucketID string      `json:"bucketId" validate:"required,len=16,alphanum"`
 	FileID   string      `json:"fileId" validate:"required,len=16,alphanum"`
+	ExpectedVersion int64 `json:"expectedVersion,omitempty" validate:"min=0"`
 }
 
 type SetFileEncryptedMetaDataRequest struct {
 	EncryptedMetaData string `json:"encryptedMetaData" validate:"required,min=1,max=1048576"`
 	BucketID          string `json:"bucketId" validate:"required,len=16,alphanum"`
 	FileID            string `json:"fileId" validate:"required,len=16,alphanum"`
+	ExpectedVersion int64 `json:"expectedVersion,omitempty" validate:"min=0"`
 }
 
 // Admin requests
@@ -175,3 +242,82 @@ type OverwriteUserPasswordRequest struct {
 	NewPassword string `json:"newPassword" validate:"required,min=8,max=32"`
 }
 
+// DeleteUserRequest names the user that takes over everything the deleted user created.
+type DeleteUserRequest struct {
+	UserID           string `json:"userId" validate:"required,len=16,alphanum"`
+	TransferToUserID string `json:"transferToUserId" validate:"required,len=16,alphanum"`
+}
+
+// Invitation requests
+type InvitationBucketGrantRequest struct {
+	BucketID         string          `json:"bucketId" validate:"required,len=16,alphanum"`
+	PermissionsToSet map[string]bool `json:"permissionsToSet" validate:"required"`
+}
+
+// CreateInvitationRequest omits validForSeconds to use the server's default validity.
+type CreateInvitationRequest struct {
+	Notes             string                         `json:"notes" validate:"max=256"`
+	ValidForSeconds   int64                          `json:"validForSeconds" validate:"omitempty,min=60,max=2592000"`
+	GlobalPermissions map[string]bool                `json:"globalPermissions"`
+	BucketGrants      []InvitationBucketGrantRequest `json:"bucketGrants" validate:"omitempty,max=64,unique=BucketID,dive"`
+}
+
+type RevokeInvitationRequest struct {
+	InvitationID string `json:"invitationId" validate:"required,len=16,alphanum"`
+}
+
+type RedeemInvitationRequest struct {
+	Token       string `json:"token" validate:"required,len=48,alphanum"`
+	DisplayName string `json:"displayName" validate:"required,min=4,max=128"`
+	UserName    string `json:"userName" validate:"required,min=4,max=32"`
+	Password    string `json:"password" validate:"required,min=8,max=32"`
+}
+
+type RegisterRequest struct {
+	DisplayName string `json:"displayName" validate:"required,min=4,max=128"`
+	UserName    string `json:"userName" validate:"required,min=4,max=32"`
+	Password    string `json:"password" validate:"required,min=8,max=32"`
+}
+
+// Group requests
+type CreateGroupRequest struct {
+	Name        string `json:"name" validate:"required,min=1,max=64"`
+	Description string `json:"description" validate:"max=256"`
+}
+
+type DeleteGroupRequest struct {
+	GroupID string `json:"groupId" validate:"required,len=16,alphanum"`
+}
+
+type AddGroupMemberRequest struct {
+	GroupID string `json:"groupId" validate:"required,len=16,alphanum"`
+	UserID  string `json:"userId" validate:"required,len=16,alphanum"`
+}
+
+type RemoveGroupMemberRequest struct {
+	GroupID string `json:"groupId" validate:"required,len=16,alphanum"`
+	UserID  string `json:"userId" validate:"required,len=16,alphanum"`
+}
+
+// Blob upload session requests
+type InitiateBlobUploadRequest struct {
+	BucketID       string `json:"bucketId" validate:"required,len=16,alphanum"`
+	FileID         string `json:"fileId" validate:"required,len=16,alphanum"`
+	TotalSizeBytes int64  `json:"totalSizeBytes" validate:"required,min=1"`
+	PartSizeBytes  int64  `json:"partSizeBytes" validate:"required,min=1"`
+	CryptoMeta     string `json:"cryptoMeta" validate:"required"`
+}
+
+type BlobUploadRequest struct {
+	BucketID string `json:"bucketId" validate:"required,len=16,alphanum"`
+	FileID   string `json:"fileId" validate:"required,len=16,alphanum"`
+	BlobID   string `json:"blobId" validate:"required,len=16,alphanum"`
+}
+
+type CompleteBlobUploadRequest struct {
+	BucketID string `json:"bucketId" validate:"required,len=16,alphanum"`
+	FileID   string `json:"fileId" validate:"required,len=16,alphanum"`
+	BlobID   string `json:"blobId" validate:"required,len=16,alphanum"`
+	// PartChecksums holds the hex SHA-256 of every part, in part order.
+	PartChecksums []string `json:"partChecksums" validate:"required,dive,len=64,hexadecimal"`
+}
@@ -25,6 +25,7 @@ type DirectoryResponse struct {
 	CreatedByUserIdentifier string     `json:"createdByUserIdentifier"`
 	CreatedAt              int64       `json:"createdAt"`
 	UpdatedAt              int64       `json:"updatedAt"`
+	Version                int64       `json:"version"`
 }
 
 // FileResponse is the API representation of a file.
@@ -40,6 +41,7 @@ type FileResponse struct {
 	CreatedAt                int64       `json:"createdAt"`
 	UpdatedAt                int64       `json:"updatedAt"`
 	ContentUpdatedAt         int64       `json:"contentUpdatedAt"`
+	Version                  int64       `json:"version"`
 }
 
 // BucketAuthorizationResponse is one entry in bucketAuthorizations.
@@ -49,6 +51,13 @@ type BucketAuthorizationResponse struct {
 	Permissions map[string]bool `json:"permissions"`
 }
 
+// BucketGroupAuthorizationResponse is one entry in bucketGroupAuthorizations.
+type BucketGroupAuthorizationResponse struct {
+	GroupID     string          `json:"groupId"`
+	Notes       string          `json:"notes"`
+	Permissions map[string]bool `json:"permissions"`
+}
+
 // BucketResponse is the API representation of a bucket in list responses.
 type BucketResponse struct {
 	ID                     string                        `json:"_id"`
@@ -57,10 +66,36 @@ type BucketResponse struct {
 	CryptSpec              string                        `json:"cryptSpec"`
 	CryptData              string                        `json:"cryptData"`
 	MetaData               interface{}                   `json:"metaData"`
+	Compression            string                        `json:"compression"`
 	BucketAuthorizations   []BucketAuthorizationResponse `json:"bucketAuthorizations"`
+	BucketGroupAuthorizations []BucketGroupAuthorizationResponse `json:"bucketGroupAuthorizations"`
 	CreatedByUserIdentifier string                       `json:"createdByUserIdentifier"`
 	CreatedAt              int64                         `json:"createdAt"`
 	UpdatedAt              int64                         `json:"updatedAt"`
+	Version                int64                         `json:"version"`
+}
+
+// BucketMemberResponse is one entry in memberList. Permissions are the user's effective bucket
+// permissions; groupIds lists the groups through which the user is also authorized.
+type BucketMemberResponse struct {
+	UserID      string          `json:"userId"`
+	UserName    string          `json:"userName"`
+	DisplayName string          `json:"displayName"`
+	Notes       string          `json:"notes"`
+	Permissions map[string]bool `json:"permissions"`
+	GroupIDs    []string        `json:"groupIds"`
+	IsOwner     bool            `json:"isOwner"`
+}
+
+// GroupResponse is the API representation of a user group.
+type GroupResponse struct {
+	ID                      string   `json:"_id"`
+	Name                    string   `json:"name"`
+	Description             string   `json:"description"`
+	MemberUserIDs           []string `json:"memberUserIds"`
+	CreatedByUserIdentifier string   `json:"createdByUserIdentifier"`
+	CreatedAt               int64    `json:"createdAt"`
+	UpdatedAt               int64    `json:"updatedAt"`
 }
 
 // UserListItemResponse is a minimal user in list responses.
@@ -87,6 +122,28 @@ type GetDirectoryResponse struct {
 	ChildFileList      []FileResponse     `json:"childFileList"`
 }
 
+// DirectoryPermissionOverrideResponse is the API representation of a directory permission override.
+// Permissions that inherit from the parent directory are omitted from the map.
+type DirectoryPermissionOverrideResponse struct {
+	UserID      *string         `json:"userId"`
+	GroupID     *string         `json:"groupId"`
+	Notes       string          `json:"notes"`
+	Permissions map[string]bool `json:"permissions"`
+}
+
+// ListDirectoryPermissionOverridesResponse is the response for POST /api/directory/list-permission-overrides
+type ListDirectoryPermissionOverridesResponse struct {
+	HasError     bool                                  `json:"hasError"`
+	OverrideList []DirectoryPermissionOverrideResponse `json:"overrideList"`
+}
+
+// GetEffectiveDirectoryPermissionsResponse is the response for POST /api/directory/get-effective-permissions
+type GetEffectiveDirectoryPermissionsResponse struct {
+	HasError    bool            `json:"hasError"`
+	UserID      string          `json:"userId"`
+	Permissions map[string]bool `json:"permissions"`
+}
+
 // CreateFileResponse is the response for POST /api/file/create
 type CreateFileResponse struct {
 	HasError bool   `json:"hasError"`
@@ -106,6 +163,12 @@ type CreateBucketResponse struct {
 	RootDirectoryID  string `json:"rootDirectoryId"`
 }
 
+// ListBucketMembersResponse is the response for POST /api/bucket/list-members
+type ListBucketMembersResponse struct {
+	HasError   bool                   `json:"hasError"`
+	MemberList []BucketMemberResponse `json:"memberList"`
+}
+
 // BucketListResponse is the response for POST /api/bucket/list
 type BucketListResponse struct {
 	HasError   bool             `json:"hasError"`
@@ -152,11 +215,49 @@ type CreateBlobResponse struct {
 	BlobID   string `json:"blobId"`
 }
 
-// WriteQuantizedResponse is the response for POST /api/blob/write-quantized
+// WriteQuantizedResponse is the response for POST /api/blob/write-quantized. NextExpectedOffset
+// is the offset of the first chunk not uploaded yet, where an interrupted upload resumes.
 type WriteQuantizedResponse struct {
-	HasError        bool   `json:"hasError"`
-	BlobID          string `json:"blobId"`
-	BytesTransferred int64 `json:"bytesTransfered"`
+	HasError           bool   `json:"hasError"`
+	BlobID             string `json:"blobId"`
+	BytesTransferred   int64  `json:"bytesTransfered"`
+	NextExpectedOffset int64  `json:"nextExpectedOffset"`
+}
+
+// InitiateBlobUploadResponse is the response for POST /api/blob/upload/initiate
+type InitiateBlobUploadResponse struct {
+	HasError      bool   `json:"hasError"`
+	BlobID        string `json:"blobId"`
+	PartSizeBytes int64  `json:"partSizeBytes"`
+	PartCount     int    `json:"partCount"`
+	ExpiresAt     int64  `json:"expiresAt"`
+}
+
+// BlobUploadPartResponse describes a stored part of an upload session.
+type BlobUploadPartResponse struct {
+	PartNumber int    `json:"partNumber"`
+	SizeBytes  int64  `json:"sizeBytes"`
+	SHA256     string `json:"sha256"`
+}
+
+// UploadBlobPartResponse is the response for POST /api/blob/upload/part
+type UploadBlobPartResponse struct {
+	HasError   bool   `json:"hasError"`
+	PartNumber int    `json:"partNumber"`
+	SizeBytes  int64  `json:"sizeBytes"`
+	SHA256     string `json:"sha256"`
+}
+
+// BlobUploadStatusResponse is the response for POST /api/blob/upload/status
+type BlobUploadStatusResponse struct {
+	HasError           bool                     `json:"hasError"`
+	BlobID             string                   `json:"blobId"`
+	TotalSizeBytes     int64                    `json:"totalSizeBytes"`
+	PartSizeBytes      int64                    `json:"partSizeBytes"`
+	PartCount          int                      `json:"partCount"`
+	ExpiresAt          int64                    `json:"expiresAt"`
+	Parts              []BlobUploadPartResponse `json:"parts"`
+	MissingPartNumbers []int                    `json:"missingPartNumbers"`
 }
 
 // AddUserResponse is the response for POST /api/admin/iam/add-user
@@ -165,20 +266,101 @@ type AddUserResponse struct {
 	UserID   string `json:"userId"`
 }
 
+// RegisterResponse is the response for POST /api/user/register and POST /api/user/redeem-invitation
+type RegisterResponse struct {
+	HasError bool   `json:"hasError"`
+	UserID   string `json:"userId"`
+}
+
+// CreateInvitationResponse is the response for POST /api/admin/iam/create-invitation.
+// The token is only ever returned here.
+type CreateInvitationResponse struct {
+	HasError     bool   `json:"hasError"`
+	InvitationID string `json:"invitationId"`
+	Token        string `json:"token"`
+	ExpiresAt    int64  `json:"expiresAt"`
+}
+
+// InvitationBucketGrantResponse is one entry in an invitation's bucketGrants.
+type InvitationBucketGrantResponse struct {
+	BucketID    string          `json:"bucketId"`
+	Permissions map[string]bool `json:"permissions"`
+}
+
+// InvitationResponse is the API representation of an invitation.
+type InvitationResponse struct {
+	ID                      string                          `json:"_id"`
+	Notes                   string                          `json:"notes"`
+	GlobalPermissions       map[string]bool                 `json:"globalPermissions"`
+	BucketGrants            []InvitationBucketGrantResponse `json:"bucketGrants"`
+	CreatedByUserIdentifier string                          `json:"createdByUserIdentifier"`
+	ExpiresAt               int64                           `json:"expiresAt"`
+	RedeemedAt              *int64                          `json:"redeemedAt"`
+	RedeemedByUserID        *string                         `json:"redeemedByUserId"`
+	CreatedAt               int64                           `json:"createdAt"`
+}
+
+// InvitationListResponse is the response for POST /api/admin/iam/list-invitations
+type InvitationListResponse struct {
+	HasError       bool                 `json:"hasError"`
+	InvitationList []InvitationResponse `json:"invitationList"`
+}
+
+// CreateGroupResponse is the response for POST /api/admin/iam/create-group
+type CreateGroupResponse struct {
+	HasError bool   `json:"hasError"`
+	GroupID  string `json:"groupId"`
+}
+
+// GroupListResponse is the response for POST /api/group/list
+type GroupListResponse struct {
+	HasError  bool            `json:"hasError"`
+	GroupList []GroupResponse `json:"groupList"`
+}
+
 // EmptySuccessResponse is used for endpoints that return only { hasError: false }
 type EmptySuccessResponse struct {
 	HasError bool `json:"hasError"`
 }
 
+// VersionResponse is returned by rename, move and metadata updates with the entity's new version.
+type VersionResponse struct {
+	HasError bool  `json:"hasError"`
+	Version  int64 `json:"version"`
+}
+
 // MetricsDiskResponse is the disk section of the metrics summary.
 type MetricsDiskResponse struct {
 	UsedBytes  int64 `json:"usedBytes"`
 	TotalBytes int64 `json:"totalBytes"`
 }
 
-// MetricsGetSummaryResponse is the response for POST /api/metrics/get-summary
+// MetricsUsageResponse counts files, directories and encrypted bytes. StoredBytes is
+// EncryptedBytes after compression.
+type MetricsUsageResponse struct {
+	FileCount      int64 `json:"fileCount"`
+	DirectoryCount int64 `json:"directoryCount"`
+	EncryptedBytes int64 `json:"encryptedBytes"`
+	StoredBytes    int64 `json:"storedBytes"`
+}
+
+// MetricsBucketUsageResponse is the usage of one bucket in the metrics summary.
+type MetricsBucketUsageResponse struct {
+	BucketID       string `json:"bucketId"`
+	Name           string `json:"name"`
+	FileCount      int64  `json:"fileCount"`
+	DirectoryCount int64  `json:"directoryCount"`
+	EncryptedBytes int64  `json:"encryptedBytes"`
+	StoredBytes    int64  `json:"storedBytes"`
+}
+
+// MetricsGetSummaryResponse is the response for POST /api/metrics/get-summary. User counts the
+// content the user created; Buckets covers every bucket the user can access. Disk is only
+// included for users with MANAGE_ALL_USER.
 type MetricsGetSummaryResponse struct {
-	HasError bool               `json:"hasError"`
-	Disk     MetricsDiskResponse `json:"disk"`
+	HasError bool                         `json:"hasError"`
+	User     MetricsUsageResponse         `json:"user"`
+	Buckets  []MetricsBucketUsageResponse `json:"buckets"`
+	Disk     *MetricsDiskResponse         `json:"disk,omitempty"`
 }
 
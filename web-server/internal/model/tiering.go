@@ -0,0 +1,10 @@
+package model
+
+// TieringSummary reports what a tiering sweep did.
+type TieringSummary struct {
+	// Demoted counts the blobs copied to the tiering store, Purged the demoted blobs whose hot
+	// copy was deleted, and Failed the blobs that could not be moved and are tried again next time.
+	Demoted int `json:"demoted"`
+	Purged  int `json:"purged"`
+	Failed  int `json:"failed"`
+}
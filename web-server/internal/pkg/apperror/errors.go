@@ -50,6 +50,8 @@ func DetectHTTPStatusCode(err error) int {
 			return 403
 		case "AUTHORIZATION_HEADER_MISSING", "AUTHORIZATION_HEADER_MALFORMATTED":
 			return 412
+		case "WRITE_CONFLICT", "VERSION_CONFLICT":
+			return 409
 		default:
 			return 400
 		}
@@ -15,6 +15,8 @@ func TestUserErrorHTTPStatus(t *testing.T) {
 		{"USER_BANNED", 403},
 		{"AUTHORIZATION_HEADER_MISSING", 412},
 		{"AUTHORIZATION_HEADER_MALFORMATTED", 412},
+		{"WRITE_CONFLICT", 409},
+		{"VERSION_CONFLICT", 409},
 		{"VALIDATION_ERROR", 400},
 		{"DUPLICATE_BUCKET_NAME", 400},
 		{"UNKNOWN_ERROR", 400}, // Default for UserError
@@ -0,0 +1,202 @@
+// Package metrics defines the application's Prometheus metrics. They are registered with the
+// default registry, which /metrics serves.
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	// HTTPRequests counts finished requests by chi route pattern, so IDs in paths do not create
+	// new series. Requests that match no route use the pattern "unmatched".
+	HTTPRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "nkrypt_http_requests_total",
+		Help: "HTTP requests by method, route pattern and status code.",
+	}, []string{"method", "route", "status"})
+	HTTPRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "nkrypt_http_request_duration_seconds",
+		Help:    "HTTP request latency by method, route pattern and status code.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	// BlobBytes counts blob content by direction: "upload" or "download".
+	BlobBytes = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "nkrypt_blob_bytes_total",
+		Help: "Blob bytes transferred by direction.",
+	}, []string{"direction"})
+
+	// Logins counts login attempts by result: "success" or "failure".
+	Logins = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "nkrypt_logins_total",
+		Help: "Login attempts by result.",
+	}, []string{"result"})
+
+	// ReplicationOperations counts attempts to replicate an object change by operation, "put" or
+	// "delete", and result, "success" or "failure".
+	ReplicationOperations = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "nkrypt_replication_operations_total",
+		Help: "Replication attempts by operation and result.",
+	}, []string{"operation", "result"})
+	ReplicationBytes = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "nkrypt_replication_bytes_total",
+		Help: "Bytes copied to the replica object store.",
+	})
+	// BlobReadFallbacks counts blob reads served by the replica because the primary object was
+	// missing.
+	BlobReadFallbacks = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "nkrypt_blob_read_fallbacks_total",
+		Help: "Blob reads served by the replica object store.",
+	})
+	// TieringOperations counts blob moves between storage tiers by operation, "demote" to the
+	// tiering store, "purge" of the hot copy of a demoted blob or "promote" back to hot storage,
+	// and result, "success" or "failure".
+	TieringOperations = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "nkrypt_tiering_operations_total",
+		Help: "Blob moves between storage tiers by operation and result.",
+	}, []string{"operation", "result"})
+
+	// DependencyUp and DependencyCheckDuration hold the results of the last /readyz check.
+	DependencyUp = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "nkrypt_dependency_up",
+		Help: "Whether a dependency passed its last readiness check (1) or not (0).",
+	}, []string{"dependency"})
+	DependencyCheckDuration = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "nkrypt_dependency_check_duration_seconds",
+		Help: "Duration of the last readiness check of a dependency.",
+	}, []string{"dependency"})
+)
+
+// stateQueryTimeout bounds the database queries run on each scrape.
+const stateQueryTimeout = 5 * time.Second
+
+// StateCollector reports gauges that are read when /metrics is scraped: active sessions, blobs
+// by status, and the PostgreSQL and Redis connection pool statistics.
+type StateCollector struct {
+	db             *pgxpool.Pool
+	redis          *redis.Client
+	activeSessions func(ctx context.Context) (int64, error)
+	blobStatuses   func(ctx context.Context) (map[string]int64, error)
+
+	activeSessionsDesc *prometheus.Desc
+	blobsDesc          *prometheus.Desc
+	dbConnsDesc        *prometheus.Desc
+	dbMaxConnsDesc     *prometheus.Desc
+	dbAcquiresDesc     *prometheus.Desc
+	dbAcquireWaitDesc  *prometheus.Desc
+	redisConnsDesc     *prometheus.Desc
+	redisRequestsDesc  *prometheus.Desc
+}
+
+func NewStateCollector(db *pgxpool.Pool, redisClient *redis.Client, activeSessions func(ctx context.Context) (int64, error), blobStatuses func(ctx context.Context) (map[string]int64, error)) *StateCollector {
+	return &StateCollector{
+		db:             db,
+		redis:          redisClient,
+		activeSessions: activeSessions,
+		blobStatuses:   blobStatuses,
+
+		activeSessionsDesc: prometheus.NewDesc("nkrypt_active_sessions", "Sessions that are neither expired nor logged out.", nil, nil),
+		blobsDesc:          prometheus.NewDesc("nkrypt_blobs", "Blobs by status.", []string{"status"}, nil),
+		dbConnsDesc:        prometheus.NewDesc("nkrypt_db_pool_conns", "PostgreSQL pool connections by state.", []string{"state"}, nil),
+		dbMaxConnsDesc:     prometheus.NewDesc("nkrypt_db_pool_max_conns", "Maximum size of the PostgreSQL pool.", nil, nil),
+		dbAcquiresDesc:     prometheus.NewDesc("nkrypt_db_pool_acquires_total", "PostgreSQL connection acquires; empty means the acquire had to wait.", []string{"kind"}, nil),
+		dbAcquireWaitDesc:  prometheus.NewDesc("nkrypt_db_pool_acquire_duration_seconds_total", "Total time spent acquiring PostgreSQL connections.", nil, nil),
+		redisConnsDesc:     prometheus.NewDesc("nkrypt_redis_pool_conns", "Redis pool connections by state.", []string{"state"}, nil),
+		redisRequestsDesc:  prometheus.NewDesc("nkrypt_redis_pool_requests_total", "Redis connection requests by outcome.", []string{"outcome"}, nil),
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (c *StateCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.activeSessionsDesc
+	ch <- c.blobsDesc
+	ch <- c.dbConnsDesc
+	ch <- c.dbMaxConnsDesc
+	ch <- c.dbAcquiresDesc
+	ch <- c.dbAcquireWaitDesc
+	ch <- c.redisConnsDesc
+	ch <- c.redisRequestsDesc
+}
+
+// Collect implements prometheus.Collector. A failed query is logged and its metric left out,
+// so the rest of the scrape still succeeds.
+func (c *StateCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), stateQueryTimeout)
+	defer cancel()
+
+	if count, err := c.activeSessions(ctx); err != nil {
+		log.Warn().Err(err).Msg("failed to count active sessions for metrics")
+	} else {
+		ch <- prometheus.MustNewConstMetric(c.activeSessionsDesc, prometheus.GaugeValue, float64(count))
+	}
+
+	if counts, err := c.blobStatuses(ctx); err != nil {
+		log.Warn().Err(err).Msg("failed to count blobs for metrics")
+	} else {
+		for status, count := range counts {
+			ch <- prometheus.MustNewConstMetric(c.blobsDesc, prometheus.GaugeValue, float64(count), status)
+		}
+	}
+
+	db := c.db.Stat()
+	ch <- prometheus.MustNewConstMetric(c.dbConnsDesc, prometheus.GaugeValue, float64(db.AcquiredConns()), "acquired")
+	ch <- prometheus.MustNewConstMetric(c.dbConnsDesc, prometheus.GaugeValue, float64(db.IdleConns()), "idle")
+	ch <- prometheus.MustNewConstMetric(c.dbConnsDesc, prometheus.GaugeValue, float64(db.ConstructingConns()), "constructing")
+	ch <- prometheus.MustNewConstMetric(c.dbMaxConnsDesc, prometheus.GaugeValue, float64(db.MaxConns()))
+	ch <- prometheus.MustNewConstMetric(c.dbAcquiresDesc, prometheus.CounterValue, float64(db.AcquireCount()), "all")
+	ch <- prometheus.MustNewConstMetric(c.dbAcquiresDesc, prometheus.CounterValue, float64(db.EmptyAcquireCount()), "empty")
+	ch <- prometheus.MustNewConstMetric(c.dbAcquiresDesc, prometheus.CounterValue, float64(db.CanceledAcquireCount()), "canceled")
+	ch <- prometheus.MustNewConstMetric(c.dbAcquireWaitDesc, prometheus.CounterValue, db.AcquireDuration().Seconds())
+
+	rs := c.redis.PoolStats()
+	ch <- prometheus.MustNewConstMetric(c.redisConnsDesc, prometheus.GaugeValue, float64(rs.TotalConns-rs.IdleConns), "active")
+	ch <- prometheus.MustNewConstMetric(c.redisConnsDesc, prometheus.GaugeValue, float64(rs.IdleConns), "idle")
+	ch <- prometheus.MustNewConstMetric(c.redisRequestsDesc, prometheus.CounterValue, float64(rs.Hits), "hit")
+	ch <- prometheus.MustNewConstMetric(c.redisRequestsDesc, prometheus.CounterValue, float64(rs.Misses), "miss")
+	ch <- prometheus.MustNewConstMetric(c.redisRequestsDesc, prometheus.CounterValue, float64(rs.Timeouts), "timeout")
+}
+
+// ReplicationCollector reports the replication queue when /metrics is scraped, so that the lag
+// keeps growing while no worker replicates.
+type ReplicationCollector struct {
+	queueStatus func(ctx context.Context) (queued, retrying int64, lag time.Duration, err error)
+
+	queuedDesc *prometheus.Desc
+	lagDesc    *prometheus.Desc
+}
+
+func NewReplicationCollector(queueStatus func(ctx context.Context) (queued, retrying int64, lag time.Duration, err error)) *ReplicationCollector {
+	return &ReplicationCollector{
+		queueStatus: queueStatus,
+
+		queuedDesc: prometheus.NewDesc("nkrypt_replication_queue", "Object changes waiting to be replicated, by state.", []string{"state"}, nil),
+		lagDesc:    prometheus.NewDesc("nkrypt_replication_lag_seconds", "How long the oldest unreplicated object change has waited.", nil, nil),
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (c *ReplicationCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.queuedDesc
+	ch <- c.lagDesc
+}
+
+// Collect implements prometheus.Collector. A failed query is logged and the metrics left out.
+func (c *ReplicationCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), stateQueryTimeout)
+	defer cancel()
+
+	queued, retrying, lag, err := c.queueStatus(ctx)
+	if err != nil {
+		log.Warn().Err(err).Msg("failed to read the replication queue for metrics")
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(c.queuedDesc, prometheus.GaugeValue, float64(queued-retrying), "pending")
+	ch <- prometheus.MustNewConstMetric(c.queuedDesc, prometheus.GaugeValue, float64(retrying), "retrying")
+	ch <- prometheus.MustNewConstMetric(c.lagDesc, prometheus.GaugeValue, lag.Seconds())
+}
@@ -0,0 +1,271 @@
+// Package migrate applies the SQL files in migrations/ to PostgreSQL.
+//
+// It keeps its state in the same schema_migrations table as the golang-migrate CLI used by the
+// Makefile, so both can be used on the same database. Each migration runs in its own transaction
+// together with the version update, and Up and Down hold a PostgreSQL advisory lock so that
+// server replicas starting at the same time apply each migration once.
+package migrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Migration is one numbered schema change, read from NNNNNN_name.up.sql and NNNNNN_name.down.sql.
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Status is the schema version of a database compared to the known migrations.
+type Status struct {
+	// Version is the applied version, 0 for an empty database.
+	Version int64 `json:"version"`
+	// Dirty is set when a migration failed halfway (only possible with golang-migrate).
+	Dirty bool `json:"dirty"`
+	// Latest is the version of the newest known migration.
+	Latest  int64       `json:"latest"`
+	Pending []Migration `json:"-"`
+}
+
+// lockID identifies the advisory lock held while migrating. It is arbitrary but must not change.
+const lockID int64 = 0x6e6b72797074 // "nkrypt"
+
+var fileNamePattern = regexp.MustCompile(`^(\d+)_(.+)\.(up|down)\.sql$`)
+
+// Load reads the migrations in the root of fsys, ordered by version.
+func Load(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, fmt.Errorf("read migrations: %w", err)
+	}
+
+	byVersion := make(map[int64]*Migration)
+	for _, entry := range entries {
+		match := fileNamePattern.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || match == nil {
+			continue
+		}
+		version, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("migration %s: %w", entry.Name(), err)
+		}
+		content, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, fmt.Errorf("read migration %s: %w", entry.Name(), err)
+		}
+
+		m, exists := byVersion[version]
+		if !exists {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		}
+		if m.Name != match[2] {
+			return nil, fmt.Errorf("migration version %d is used by both %q and %q", version, m.Name, match[2])
+		}
+		if match[3] == "up" {
+			m.Up = string(content)
+		} else {
+			m.Down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("migration %d_%s has no up file", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
+
+// Migrator applies a set of migrations to one database.
+type Migrator struct {
+	db         *pgxpool.Pool
+	migrations []Migration
+}
+
+func New(db *pgxpool.Pool, migrations []Migration) *Migrator {
+	return &Migrator{db: db, migrations: migrations}
+}
+
+// UpToDate reports whether every known migration is applied. A database that is ahead of the known
+// migrations counts as up to date, so an older binary keeps working during a rolling upgrade.
+func (s *Status) UpToDate() bool {
+	return !s.Dirty && len(s.Pending) == 0
+}
+
+// Latest returns the version of the newest known migration, 0 if there are none.
+func (m *Migrator) Latest() int64 {
+	if len(m.migrations) == 0 {
+		return 0
+	}
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+// Version returns the applied version without creating the schema_migrations table.
+func (m *Migrator) Version(ctx context.Context) (int64, bool, error) {
+	return currentVersion(ctx, m.db)
+}
+
+// Status returns the applied version and the migrations that are not yet applied.
+func (m *Migrator) Status(ctx context.Context) (*Status, error) {
+	if err := m.ensureTable(ctx); err != nil {
+		return nil, err
+	}
+	version, dirty, err := currentVersion(ctx, m.db)
+	if err != nil {
+		return nil, err
+	}
+
+	status := &Status{Version: version, Dirty: dirty, Latest: m.Latest()}
+	for _, migration := range m.migrations {
+		if migration.Version > version {
+			status.Pending = append(status.Pending, migration)
+		}
+	}
+	return status, nil
+}
+
+// Up applies every pending migration and returns the applied ones. If another process is
+// migrating, Up waits for it and then applies whatever is still pending.
+func (m *Migrator) Up(ctx context.Context) (applied []Migration, err error) {
+	return m.UpTo(ctx, m.Latest())
+}
+
+// UpTo is Up that stops after the migration with the given version.
+func (m *Migrator) UpTo(ctx context.Context, version int64) (applied []Migration, err error) {
+	err = m.withLock(ctx, func() error {
+		status, err := m.Status(ctx)
+		if err != nil {
+			return err
+		}
+		if status.Dirty {
+			return dirtyError(status.Version)
+		}
+
+		for _, migration := range status.Pending {
+			if migration.Version > version {
+				break
+			}
+			if err := m.apply(ctx, migration.Up, migration.Version); err != nil {
+				return fmt.Errorf("migration %d_%s: %w", migration.Version, migration.Name, err)
+			}
+			applied = append(applied, migration)
+		}
+		return nil
+	})
+	return applied, err
+}
+
+// Down reverts the last steps applied migrations and returns the reverted ones.
+func (m *Migrator) Down(ctx context.Context, steps int) (reverted []Migration, err error) {
+	err = m.withLock(ctx, func() error {
+		status, err := m.Status(ctx)
+		if err != nil {
+			return err
+		}
+		if status.Dirty {
+			return dirtyError(status.Version)
+		}
+
+		for i := len(m.migrations) - 1; i >= 0 && len(reverted) < steps; i-- {
+			migration := m.migrations[i]
+			if migration.Version > status.Version {
+				continue
+			}
+			if migration.Down == "" {
+				return fmt.Errorf("migration %d_%s has no down file", migration.Version, migration.Name)
+			}
+			var previous int64
+			if i > 0 {
+				previous = m.migrations[i-1].Version
+			}
+			if err := m.apply(ctx, migration.Down, previous); err != nil {
+				return fmt.Errorf("revert migration %d_%s: %w", migration.Version, migration.Name, err)
+			}
+			reverted = append(reverted, migration)
+		}
+		return nil
+	})
+	return reverted, err
+}
+
+// withLock runs fn while holding the migration advisory lock. The lock belongs to a connection,
+// so one is taken out of the pool for the duration.
+func (m *Migrator) withLock(ctx context.Context, fn func() error) error {
+	conn, err := m.db.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	if _, err := conn.Exec(ctx, `SELECT pg_advisory_lock($1)`, lockID); err != nil {
+		return fmt.Errorf("acquire migration lock: %w", err)
+	}
+	defer func() {
+		// Use a fresh context: the lock must be released even if ctx was cancelled
+		if _, err := conn.Exec(context.Background(), `SELECT pg_advisory_unlock($1)`, lockID); err != nil {
+			// A connection that still holds the lock must not go back to the pool
+			_ = conn.Conn().Close(context.Background())
+		}
+	}()
+
+	return fn()
+}
+
+// apply runs sql and records version in one transaction. Version 0 means no migration is applied.
+func (m *Migrator) apply(ctx context.Context, sql string, version int64) error {
+	return pgx.BeginFunc(ctx, m.db, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, sql); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(ctx, `DELETE FROM schema_migrations`); err != nil {
+			return err
+		}
+		if version == 0 {
+			return nil
+		}
+		_, err := tx.Exec(ctx, `INSERT INTO schema_migrations (version, dirty) VALUES ($1, false)`, version)
+		return err
+	})
+}
+
+func (m *Migrator) ensureTable(ctx context.Context) error {
+	_, err := m.db.Exec(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (version BIGINT NOT NULL PRIMARY KEY, dirty BOOLEAN NOT NULL)`)
+	if err != nil {
+		return fmt.Errorf("create schema_migrations: %w", err)
+	}
+	return nil
+}
+
+func currentVersion(ctx context.Context, db *pgxpool.Pool) (int64, bool, error) {
+	var version int64
+	var dirty bool
+	err := db.QueryRow(ctx, `SELECT version, dirty FROM schema_migrations LIMIT 1`).Scan(&version, &dirty)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, fmt.Errorf("read schema version: %w", err)
+	}
+	return version, dirty, nil
+}
+
+func dirtyError(version int64) error {
+	return fmt.Errorf("the database is marked dirty at version %d; fix the schema by hand and clear it with \"migrate force %d\"", version, version)
+}
@@ -0,0 +1,75 @@
+package migrate
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/nkrypt-xyz/nkrypt-xyz-web-server/migrations"
+)
+
+func TestLoadOrdersAndPairsFiles(t *testing.T) {
+	fsys := fstest.MapFS{
+		"000002_add_files.up.sql":    {Data: []byte("CREATE TABLE files ();")},
+		"000002_add_files.down.sql":  {Data: []byte("DROP TABLE files;")},
+		"000001_add_users.up.sql":    {Data: []byte("CREATE TABLE users ();")},
+		"000001_add_users.down.sql":  {Data: []byte("DROP TABLE users;")},
+		"README.md":                  {Data: []byte("not a migration")},
+		"000010_no_down_file.up.sql": {Data: []byte("SELECT 1;")},
+	}
+
+	migrations, err := Load(fsys)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if len(migrations) != 3 {
+		t.Fatalf("Expected 3 migrations, got %d", len(migrations))
+	}
+	for i, want := range []int64{1, 2, 10} {
+		if migrations[i].Version != want {
+			t.Errorf("migrations[%d].Version = %d, want %d", i, migrations[i].Version, want)
+		}
+	}
+	if migrations[0].Name != "add_users" || migrations[0].Down != "DROP TABLE users;" || migrations[2].Down != "" {
+		t.Errorf("Unexpected migrations: %+v", migrations)
+	}
+}
+
+func TestLoadRejectsMissingUpFile(t *testing.T) {
+	fsys := fstest.MapFS{"000001_add_users.down.sql": {Data: []byte("DROP TABLE users;")}}
+	if _, err := Load(fsys); err == nil {
+		t.Error("Expected an error for a migration without an up file")
+	}
+}
+
+func TestLoadEmbeddedMigrations(t *testing.T) {
+	all, err := Load(migrations.FS)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if len(all) == 0 {
+		t.Fatal("Expected the embedded migrations")
+	}
+	for i, m := range all {
+		if m.Version != int64(i+1) || m.Down == "" {
+			t.Errorf("Migration %d_%s is out of sequence or has no down file", m.Version, m.Name)
+		}
+	}
+}
+
+func TestStatusUpToDate(t *testing.T) {
+	tests := []struct {
+		name   string
+		status Status
+		want   bool
+	}{
+		{name: "current", status: Status{Version: 2, Latest: 2}, want: true},
+		{name: "ahead of this binary", status: Status{Version: 3, Latest: 2}, want: true},
+		{name: "behind", status: Status{Version: 1, Latest: 2, Pending: []Migration{{Version: 2}}}, want: false},
+		{name: "dirty", status: Status{Version: 2, Latest: 2, Dirty: true}, want: false},
+	}
+	for _, tt := range tests {
+		if got := tt.status.UpToDate(); got != tt.want {
+			t.Errorf("%s: UpToDate() = %t, want %t", tt.name, got, tt.want)
+		}
+	}
+}
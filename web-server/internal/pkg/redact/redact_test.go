@@ -226,3 +226,21 @@ func TestRedactHeaders(t *testing.T) {
 		})
 	}
 }
+
+func TestRedactURL(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"postgres://nkrypt:s3cret@db:5432/nkrypt?sslmode=disable", "postgres://nkrypt:[REDACTED]@db:5432/nkrypt?sslmode=disable"},
+		{"postgres://nkrypt@db:5432/nkrypt", "postgres://nkrypt@db:5432/nkrypt"},
+		{"redis:6379", "redis:6379"},
+		{"://bad", "[REDACTED]"},
+	}
+
+	for _, tt := range tests {
+		if result := RedactURL(tt.input); result != tt.expected {
+			t.Errorf("RedactURL(%q) = %q, want %q", tt.input, result, tt.expected)
+		}
+	}
+}
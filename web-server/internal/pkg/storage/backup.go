@@ -0,0 +1,152 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// GetObject returns a reader for the object at key and its size. An object missing from the
+// bucket is read from the tiering store, if there is one.
+func (m *MinIOClient) GetObject(ctx context.Context, key string) (io.ReadCloser, int64, error) {
+	reader, size, err := m.getObject(ctx, key)
+	if m.cold != nil && IsNotFound(err) {
+		return m.cold.getObject(ctx, key)
+	}
+	return reader, size, err
+}
+
+func (m *MinIOClient) getObject(ctx context.Context, key string) (io.ReadCloser, int64, error) {
+	obj, err := m.client.GetObject(ctx, m.bucketName, key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, 0, err
+	}
+	stat, err := obj.Stat()
+	if err != nil {
+		obj.Close()
+		return nil, 0, err
+	}
+	return obj, stat.Size, nil
+}
+
+// PutObject stores size bytes read from reader at key.
+func (m *MinIOClient) PutObject(ctx context.Context, key string, reader io.Reader, size int64) error {
+	_, err := m.client.PutObject(ctx, m.bucketName, key, reader, size, minio.PutObjectOptions{
+		ContentType: "application/octet-stream",
+	})
+	return err
+}
+
+// StatObject returns the size of the object at key.
+func (m *MinIOClient) StatObject(ctx context.Context, key string) (int64, error) {
+	stat, err := m.client.StatObject(ctx, m.bucketName, key, minio.StatObjectOptions{})
+	if err != nil {
+		return 0, err
+	}
+	return stat.Size, nil
+}
+
+// BackupTarget stores the files of a backup under slash-separated names.
+type BackupTarget interface {
+	// Put stores a file of size bytes, or of unknown size if size is -1. A file is either stored
+	// whole or not at all.
+	Put(ctx context.Context, name string, r io.Reader, size int64) error
+	// Get returns a reader for a stored file.
+	Get(ctx context.Context, name string) (io.ReadCloser, error)
+	// String describes where the backup is stored.
+	String() string
+}
+
+// dirBackupTarget stores a backup in a local directory.
+type dirBackupTarget struct {
+	dir string
+}
+
+// NewDirBackupTarget returns a target storing files below dir.
+func NewDirBackupTarget(dir string) BackupTarget {
+	return &dirBackupTarget{dir: dir}
+}
+
+func (t *dirBackupTarget) Put(_ context.Context, name string, r io.Reader, _ int64) error {
+	dest := filepath.Join(t.dir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(dest), 0o700); err != nil {
+		return err
+	}
+	// Write aside and rename, so a failed write leaves no partial file
+	f, err := os.CreateTemp(filepath.Dir(dest), ".partial-*")
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), dest)
+}
+
+func (t *dirBackupTarget) Get(_ context.Context, name string) (io.ReadCloser, error) {
+	return os.Open(filepath.Join(t.dir, filepath.FromSlash(name)))
+}
+
+func (t *dirBackupTarget) String() string {
+	return t.dir
+}
+
+// s3BackupTarget stores a backup below a prefix of a bucket in an S3-compatible object store.
+type s3BackupTarget struct {
+	client *minio.Client
+	bucket string
+	prefix string
+}
+
+// NewS3BackupTarget returns a target storing files below prefix in an existing bucket.
+func NewS3BackupTarget(endpoint, accessKey, secretKey string, useSSL bool, bucket, prefix string) (BackupTarget, error) {
+	client, err := minio.New(endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(accessKey, secretKey, ""),
+		Secure: useSSL,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &s3BackupTarget{client: client, bucket: bucket, prefix: strings.Trim(prefix, "/")}, nil
+}
+
+func (t *s3BackupTarget) key(name string) string {
+	return path.Join(t.prefix, name)
+}
+
+func (t *s3BackupTarget) Put(ctx context.Context, name string, r io.Reader, size int64) error {
+	_, err := t.client.PutObject(ctx, t.bucket, t.key(name), r, size, minio.PutObjectOptions{
+		ContentType: "application/octet-stream",
+	})
+	return err
+}
+
+func (t *s3BackupTarget) Get(ctx context.Context, name string) (io.ReadCloser, error) {
+	obj, err := t.client.GetObject(ctx, t.bucket, t.key(name), minio.GetObjectOptions{})
+	if err != nil {
+		return nil, err
+	}
+	// GetObject is lazy; stat to report a missing file here rather than on the first read
+	if _, err := obj.Stat(); err != nil {
+		obj.Close()
+		return nil, err
+	}
+	return obj, nil
+}
+
+func (t *s3BackupTarget) String() string {
+	return fmt.Sprintf("s3://%s/%s", t.bucket, t.prefix)
+}
@@ -0,0 +1,127 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ErrChunkOverlap is returned for a chunk that overlaps a chunk already stored, other than an
+// exact resend of the same offset and length.
+var ErrChunkOverlap = errors.New("chunk overlaps a stored chunk")
+
+// ErrChunkAfterEnd is returned when finalizing a blob with a chunk stored past the final chunk.
+var ErrChunkAfterEnd = errors.New("a chunk is stored past the final chunk")
+
+// ChunkGapError is returned when the stored chunks do not cover a blob contiguously from offset 0.
+type ChunkGapError struct {
+	// Offset is the first byte not covered by a chunk.
+	Offset int64
+}
+
+func (e *ChunkGapError) Error() string {
+	return fmt.Sprintf("chunks leave a gap at offset %d", e.Offset)
+}
+
+// ChunkRange is the position of a stored chunk within its blob.
+type ChunkRange struct {
+	Offset int64
+	Length int64
+}
+
+// End returns the offset just past the chunk.
+func (c ChunkRange) End() int64 {
+	return c.Offset + c.Length
+}
+
+// recordChunkScript records a chunk in the hash of offset -> length at KEYS[1], unless it
+// overlaps another chunk. Resending a chunk with the same offset and length is allowed. Returns 1
+// if recorded and 0 on overlap. Running as a script makes the check and the write atomic across
+// concurrent chunk uploads.
+var recordChunkScript = redis.NewScript(`
+local offset = tonumber(ARGV[1])
+local length = tonumber(ARGV[2])
+local chunks = redis.call('HGETALL', KEYS[1])
+for i = 1, #chunks, 2 do
+	local o = tonumber(chunks[i])
+	local l = tonumber(chunks[i + 1])
+	if o == offset then
+		if l ~= length then
+			return 0
+		end
+	elseif o < offset + length and offset < o + l then
+		return 0
+	end
+end
+redis.call('HSET', KEYS[1], ARGV[1], ARGV[2])
+redis.call('EXPIRE', KEYS[1], ARGV[3])
+return 1
+`)
+
+// chunksKey returns the Redis hash holding the offset and length of each uploaded chunk of a blob.
+// Earlier servers kept the offsets under other keys, in other types. Chunks an upload sent to them
+// are not found here, so finishing it reports them missing, instead of failing on WRONGTYPE.
+func chunksKey(blobID string) string {
+	return fmt.Sprintf("blob:chunk-ranges:%s", blobID)
+}
+
+// parseChunks converts the offset -> length hash into chunk ranges sorted by offset.
+func parseChunks(fields map[string]string) ([]ChunkRange, error) {
+	chunks := make([]ChunkRange, 0, len(fields))
+	for o, l := range fields {
+		offset, err := strconv.ParseInt(o, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse chunk offset %q: %w", o, err)
+		}
+		length, err := strconv.ParseInt(l, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse chunk length %q: %w", l, err)
+		}
+		chunks = append(chunks, ChunkRange{Offset: offset, Length: length})
+	}
+	sort.Slice(chunks, func(i, j int) bool { return chunks[i].Offset < chunks[j].Offset })
+	return chunks, nil
+}
+
+// overlaps reports whether c overlaps any of chunks, other than an exact resend.
+func overlaps(chunks []ChunkRange, c ChunkRange) bool {
+	for _, other := range chunks {
+		if other.Offset == c.Offset {
+			if other.Length != c.Length {
+				return true
+			}
+		} else if other.Offset < c.End() && c.Offset < other.End() {
+			return true
+		}
+	}
+	return false
+}
+
+// NextExpectedOffset returns the end of the chunks that cover the blob contiguously from offset
+// 0: the offset of the first chunk still missing. chunks must be sorted by offset.
+func NextExpectedOffset(chunks []ChunkRange) int64 {
+	var next int64
+	for _, c := range chunks {
+		if c.Offset != next {
+			break
+		}
+		next = c.End()
+	}
+	return next
+}
+
+// checkContiguous checks that chunks, sorted by offset, cover the blob from offset 0 up to the end
+// of the last chunk without gaps, and that last is the final chunk.
+func checkContiguous(chunks []ChunkRange, last ChunkRange) error {
+	next := NextExpectedOffset(chunks)
+	if len(chunks) == 0 || next != chunks[len(chunks)-1].End() {
+		return &ChunkGapError{Offset: next}
+	}
+	if last.End() != next {
+		return ErrChunkAfterEnd
+	}
+	return nil
+}
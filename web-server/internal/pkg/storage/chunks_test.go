@@ -0,0 +1,78 @@
+package storage
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestParseChunks(t *testing.T) {
+	chunks, err := parseChunks(map[string]string{"20": "5", "0": "10", "10": "10"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	want := []ChunkRange{{Offset: 0, Length: 10}, {Offset: 10, Length: 10}, {Offset: 20, Length: 5}}
+	if !reflect.DeepEqual(chunks, want) {
+		t.Errorf("Expected %v, got %v", want, chunks)
+	}
+
+	if _, err := parseChunks(map[string]string{"x": "10"}); err == nil {
+		t.Error("Expected an error for an invalid offset")
+	}
+}
+
+func TestOverlaps(t *testing.T) {
+	stored := []ChunkRange{{Offset: 0, Length: 10}, {Offset: 20, Length: 10}}
+	tests := []struct {
+		name  string
+		chunk ChunkRange
+		want  bool
+	}{
+		{name: "gap between chunks", chunk: ChunkRange{Offset: 10, Length: 10}, want: false},
+		{name: "after the last chunk", chunk: ChunkRange{Offset: 30, Length: 10}, want: false},
+		{name: "exact resend", chunk: ChunkRange{Offset: 20, Length: 10}, want: false},
+		{name: "resend with another length", chunk: ChunkRange{Offset: 20, Length: 5}, want: true},
+		{name: "overlaps the end of a chunk", chunk: ChunkRange{Offset: 5, Length: 10}, want: true},
+		{name: "overlaps the start of a chunk", chunk: ChunkRange{Offset: 15, Length: 10}, want: true},
+		{name: "spans a chunk", chunk: ChunkRange{Offset: 10, Length: 30}, want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := overlaps(stored, tt.chunk); got != tt.want {
+				t.Errorf("Expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestNextExpectedOffset(t *testing.T) {
+	if got := NextExpectedOffset(nil); got != 0 {
+		t.Errorf("Expected 0 without chunks, got %d", got)
+	}
+	chunks := []ChunkRange{{Offset: 0, Length: 10}, {Offset: 10, Length: 10}, {Offset: 30, Length: 10}}
+	if got := NextExpectedOffset(chunks); got != 20 {
+		t.Errorf("Expected 20, got %d", got)
+	}
+	if got := NextExpectedOffset(chunks[1:]); got != 0 {
+		t.Errorf("Expected 0 when the first chunk is missing, got %d", got)
+	}
+}
+
+func TestCheckContiguous(t *testing.T) {
+	chunks := []ChunkRange{{Offset: 0, Length: 10}, {Offset: 10, Length: 10}, {Offset: 20, Length: 5}}
+
+	if err := checkContiguous(chunks, chunks[2]); err != nil {
+		t.Errorf("Expected contiguous chunks to pass, got %v", err)
+	}
+
+	var gap *ChunkGapError
+	if err := checkContiguous([]ChunkRange{chunks[0], chunks[2]}, chunks[2]); !errors.As(err, &gap) || gap.Offset != 10 {
+		t.Errorf("Expected a gap at offset 10, got %v", err)
+	}
+	if err := checkContiguous(nil, ChunkRange{}); !errors.As(err, &gap) || gap.Offset != 0 {
+		t.Errorf("Expected a gap at offset 0, got %v", err)
+	}
+	if err := checkContiguous(chunks, chunks[1]); !errors.Is(err, ErrChunkAfterEnd) {
+		t.Errorf("Expected ErrChunkAfterEnd, got %v", err)
+	}
+}
@@ -0,0 +1,65 @@
+package storage
+
+import (
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// compressor compresses a reader with zstd as it is read.
+type compressor struct {
+	pr   *io.PipeReader
+	done chan struct{}
+	read int64
+}
+
+func newCompressor(r io.Reader) *compressor {
+	pr, pw := io.Pipe()
+	c := &compressor{pr: pr, done: make(chan struct{})}
+	go func() {
+		defer close(c.done)
+		enc, err := zstd.NewWriter(pw, zstd.WithEncoderConcurrency(1))
+		if err == nil {
+			c.read, err = io.Copy(enc, r)
+			if closeErr := enc.Close(); err == nil {
+				err = closeErr
+			}
+		}
+		pw.CloseWithError(err)
+	}()
+	return c
+}
+
+func (c *compressor) Read(p []byte) (int, error) {
+	return c.pr.Read(p)
+}
+
+// Close stops the compression if it is still running, and returns the number of uncompressed
+// bytes read.
+func (c *compressor) Close() int64 {
+	c.pr.CloseWithError(io.ErrClosedPipe)
+	<-c.done
+	return c.read
+}
+
+// decompressor reads a zstd-compressed object.
+type decompressor struct {
+	*zstd.Decoder
+	object io.Closer
+}
+
+// Decompress returns a reader for the uncompressed content of a zstd-compressed object. Closing it
+// closes the object.
+func Decompress(object io.ReadCloser) (io.ReadCloser, error) {
+	dec, err := zstd.NewReader(object, zstd.WithDecoderConcurrency(1))
+	if err != nil {
+		object.Close()
+		return nil, err
+	}
+	return &decompressor{Decoder: dec, object: object}, nil
+}
+
+func (d *decompressor) Close() error {
+	d.Decoder.Close()
+	return d.object.Close()
+}
@@ -0,0 +1,46 @@
+package storage
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestCompressRoundTrip(t *testing.T) {
+	content := []byte(strings.Repeat("nkrypt padding ", 10000))
+	c := newCompressor(bytes.NewReader(content))
+	compressed, err := io.ReadAll(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if read := c.Close(); read != int64(len(content)) {
+		t.Errorf("read %d bytes, want %d", read, len(content))
+	}
+	if len(compressed) >= len(content) {
+		t.Errorf("compressed to %d bytes, no smaller than %d", len(compressed), len(content))
+	}
+
+	reader, err := Decompress(io.NopCloser(bytes.NewReader(compressed)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	got, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, content) {
+		t.Errorf("decompressed %d bytes that differ from the %d compressed", len(got), len(content))
+	}
+}
+
+func TestCompressStopsWhenClosedEarly(t *testing.T) {
+	c := newCompressor(strings.NewReader(strings.Repeat("x", 1<<20)))
+	buf := make([]byte, 16)
+	if _, err := c.Read(buf); err != nil {
+		t.Fatal(err)
+	}
+	// Returns rather than blocking on the unread output
+	c.Close()
+}
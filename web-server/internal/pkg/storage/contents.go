@@ -0,0 +1,67 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"strings"
+
+	"github.com/minio/minio-go/v7"
+)
+
+// contentPrefix holds deduplicated content, keyed by its SHA-256 rather than by a blob ID.
+const contentPrefix = "contents/"
+
+// ContentKey returns the object key of deduplicated content.
+func ContentKey(sha256 string) string {
+	return contentPrefix + sha256
+}
+
+// CopyBlobToContent copies the object of a blob to the object of deduplicated content. The copy
+// happens within MinIO, and objects larger than a single copy allows are copied in parts.
+func (m *MinIOClient) CopyBlobToContent(ctx context.Context, blobID, sha256 string) error {
+	_, err := m.client.ComposeObject(ctx, minio.CopyDestOptions{
+		Bucket: m.bucketName,
+		Object: ContentKey(sha256),
+	}, minio.CopySrcOptions{
+		Bucket: m.bucketName,
+		Object: "blobs/" + blobID,
+	})
+	return err
+}
+
+// DownloadContent returns a reader for deduplicated content and its size.
+func (m *MinIOClient) DownloadContent(ctx context.Context, sha256 string) (io.ReadCloser, int64, error) {
+	obj, err := m.client.GetObject(ctx, m.bucketName, ContentKey(sha256), minio.GetObjectOptions{})
+	if err != nil {
+		return nil, 0, err
+	}
+	stat, err := obj.Stat()
+	if err != nil {
+		obj.Close()
+		return nil, 0, err
+	}
+	return obj, stat.Size, nil
+}
+
+// DeleteContent removes the object of deduplicated content.
+func (m *MinIOClient) DeleteContent(ctx context.Context, sha256 string) error {
+	return m.client.RemoveObject(ctx, m.bucketName, ContentKey(sha256), minio.RemoveObjectOptions{})
+}
+
+// ListContentObjects lists every object of deduplicated content. Their ContentSHA256 is set
+// instead of their BlobID.
+func (m *MinIOClient) ListContentObjects(ctx context.Context) ([]ObjectInfo, error) {
+	var out []ObjectInfo
+	for object := range m.client.ListObjects(ctx, m.bucketName, minio.ListObjectsOptions{Prefix: contentPrefix, Recursive: true}) {
+		if object.Err != nil {
+			return nil, object.Err
+		}
+		out = append(out, ObjectInfo{
+			Key:           object.Key,
+			ContentSHA256: strings.TrimPrefix(object.Key, contentPrefix),
+			Size:          object.Size,
+			LastModified:  object.LastModified,
+		})
+	}
+	return out, nil
+}
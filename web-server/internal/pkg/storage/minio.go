@@ -2,16 +2,18 @@ package storage
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"io"
-	"sort"
+	"strings"
 	"time"
 
 	"github.com/minio/madmin-go/v4"
 	"github.com/minio/minio-go/v7"
 	"github.com/minio/minio-go/v7/pkg/credentials"
 	"github.com/redis/go-redis/v9"
+
+	"github.com/nkrypt-xyz/nkrypt-xyz-web-server/internal/pkg/randstr"
+	"github.com/nkrypt-xyz/nkrypt-xyz-web-server/internal/pkg/tracing"
 )
 
 type MinIOClient struct {
@@ -19,6 +21,7 @@ type MinIOClient struct {
 	adminClient *madmin.AdminClient
 	bucketName  string
 	redisClient *redis.Client
+	cold        *MinIOClient // tiering store of cold blob objects, or nil
 }
 
 type RedisClientInterface interface {
@@ -28,9 +31,14 @@ type RedisClientInterface interface {
 }
 
 func NewMinIOClient(endpoint, accessKey, secretKey, bucketName string, useSSL bool, redisClient *redis.Client) (*MinIOClient, error) {
+	transport, err := minio.DefaultTransport(useSSL)
+	if err != nil {
+		return nil, err
+	}
 	client, err := minio.New(endpoint, &minio.Options{
-		Creds:  credentials.NewStaticV4(accessKey, secretKey, ""),
-		Secure: useSSL,
+		Creds:     credentials.NewStaticV4(accessKey, secretKey, ""),
+		Secure:    useSSL,
+		Transport: &tracing.Transport{Base: transport, System: "minio"},
 	})
 	if err != nil {
 		return nil, err
@@ -61,22 +69,48 @@ func (m *MinIOClient) EnsureBucket(ctx context.Context) error {
 	return nil
 }
 
-// UploadBlob streams a full blob upload
-func (m *MinIOClient) UploadBlob(ctx context.Context, blobID string, reader io.Reader, size int64) (int64, error) {
-	objectKey := "blobs/" + blobID
+// UploadBlob streams a full blob upload, compressed with zstd if compress is set. Returns the
+// size of the content and of the stored object.
+func (m *MinIOClient) UploadBlob(ctx context.Context, blobID string, reader io.Reader, size int64, compress bool) (int64, int64, error) {
+	return m.putBlob(ctx, "blobs/"+blobID, reader, size, compress)
+}
 
-	info, err := m.client.PutObject(ctx, m.bucketName, objectKey, reader, size, minio.PutObjectOptions{
-		ContentType: "application/octet-stream",
-	})
-	if err != nil {
-		return 0, err
+// putBlob stores size bytes read from reader at key, compressed with zstd if compress is set.
+// Returns the size of the content and of the stored object.
+func (m *MinIOClient) putBlob(ctx context.Context, key string, reader io.Reader, size int64, compress bool) (int64, int64, error) {
+	opts := minio.PutObjectOptions{ContentType: "application/octet-stream"}
+	if !compress {
+		info, err := m.client.PutObject(ctx, m.bucketName, key, reader, size, opts)
+		if err != nil {
+			return 0, 0, err
+		}
+		return info.Size, info.Size, nil
 	}
 
-	return info.Size, nil
+	c := newCompressor(reader)
+	info, err := m.client.PutObject(ctx, m.bucketName, key, c, -1, opts)
+	read := c.Close()
+	if err != nil {
+		return 0, 0, err
+	}
+	if size >= 0 && read != size {
+		_ = m.client.RemoveObject(ctx, m.bucketName, key, minio.RemoveObjectOptions{})
+		return 0, 0, fmt.Errorf("read %d bytes of a %d-byte blob", read, size)
+	}
+	return read, info.Size, nil
 }
 
-// DownloadBlob returns a reader for the blob and its size
+// DownloadBlob returns a reader for the blob and its size. A blob missing from the bucket is read
+// from the tiering store, if there is one.
 func (m *MinIOClient) DownloadBlob(ctx context.Context, blobID string) (io.ReadCloser, int64, error) {
+	reader, size, err := m.downloadBlob(ctx, blobID)
+	if m.cold != nil && IsNotFound(err) {
+		return m.cold.downloadBlob(ctx, blobID)
+	}
+	return reader, size, err
+}
+
+func (m *MinIOClient) downloadBlob(ctx context.Context, blobID string) (io.ReadCloser, int64, error) {
 	objectKey := "blobs/" + blobID
 
 	obj, err := m.client.GetObject(ctx, m.bucketName, objectKey, minio.GetObjectOptions{})
@@ -103,99 +137,306 @@ func (m *MinIOClient) GetBlobSize(ctx context.Context, blobID string) (int64, er
 	return stat.Size, nil
 }
 
-// DeleteBlob removes a blob from storage
+// DeleteBlob removes a blob from storage, including the tiering store
 func (m *MinIOClient) DeleteBlob(ctx context.Context, blobID string) error {
 	objectKey := "blobs/" + blobID
+	if m.cold != nil {
+		if err := m.cold.DeleteObject(ctx, objectKey); err != nil {
+			return err
+		}
+	}
 	return m.client.RemoveObject(ctx, m.bucketName, objectKey, minio.RemoveObjectOptions{})
 }
 
-// AppendBlobChunk appends a chunk to a blob using temporary chunk storage.
-// Chunks are stored as separate objects and tracked in Redis.
-func (m *MinIOClient) AppendBlobChunk(ctx context.Context, blobID string, offset int64, reader io.Reader) (int64, error) {
+// AppendBlobChunk stores a chunk of a blob as a temporary object and records its offset and
+// length in Redis. contentLength, if not -1, lets a conflicting chunk be rejected before it is
+// written; without it the chunk is written under a key of its own and moved into place once
+// recorded. A chunk overlapping one already stored fails with ErrChunkOverlap. Returns the chunk's
+// length and the offset of the first chunk still missing.
+func (m *MinIOClient) AppendBlobChunk(ctx context.Context, blobID string, offset int64, reader io.Reader, contentLength int64) (int64, int64, error) {
+	if m.redisClient == nil {
+		return 0, 0, fmt.Errorf("chunked uploads require Redis")
+	}
+	redisKey := chunksKey(blobID)
+
+	// Check before writing, so a conflicting resend does not replace the stored chunk
+	if contentLength >= 0 {
+		chunks, err := m.listChunks(ctx, blobID)
+		if err != nil {
+			return 0, 0, err
+		}
+		if overlaps(chunks, ChunkRange{Offset: offset, Length: contentLength}) {
+			return 0, 0, ErrChunkOverlap
+		}
+	}
+
 	// Store chunk as temporary object with offset in the key
 	chunkKey := m.getChunkKey(blobID, offset)
-	
-	info, err := m.client.PutObject(ctx, m.bucketName, chunkKey, reader, -1, minio.PutObjectOptions{
+	putKey := chunkKey
+	if contentLength < 0 {
+		// Rejected unchecked chunks must neither linger nor replace the chunk stored at their offset
+		suffix, err := randstr.GenerateID(16)
+		if err != nil {
+			return 0, 0, err
+		}
+		putKey = chunkKey + "." + suffix
+		defer func() {
+			_ = m.client.RemoveObject(context.WithoutCancel(ctx), m.bucketName, putKey, minio.RemoveObjectOptions{})
+		}()
+	}
+	info, err := m.client.PutObject(ctx, m.bucketName, putKey, reader, -1, minio.PutObjectOptions{
 		ContentType: "application/octet-stream",
 	})
 	if err != nil {
-		return 0, err
+		return 0, 0, err
 	}
-	
-	// Track this chunk offset in Redis
-	if m.redisClient != nil {
-		redisKey := fmt.Sprintf("blob:chunks:%s", blobID)
-		
-		// Get existing offsets
-		var offsets []int64
-		data, err := m.redisClient.Get(ctx, redisKey).Result()
-		if err == nil {
-			_ = json.Unmarshal([]byte(data), &offsets)
+
+	recorded, err := recordChunkScript.Run(ctx, m.redisClient, []string{redisKey}, offset, info.Size, int64((24 * time.Hour).Seconds())).Int()
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to track chunk in Redis: %w", err)
+	}
+	if recorded == 0 {
+		return 0, 0, ErrChunkOverlap
+	}
+	if putKey != chunkKey {
+		// Resending the same chunk records it again, so it can be retried if this fails
+		_, err := m.client.ComposeObject(ctx, minio.CopyDestOptions{
+			Bucket: m.bucketName,
+			Object: chunkKey,
+		}, minio.CopySrcOptions{
+			Bucket: m.bucketName,
+			Object: putKey,
+		})
+		if err != nil {
+			return 0, 0, err
 		}
-		
-		// Add new offset
-		offsets = append(offsets, offset)
-		
-		// Save back to Redis (24 hour TTL)
-		offsetsJSON, _ := json.Marshal(offsets)
-		_ = m.redisClient.Set(ctx, redisKey, offsetsJSON, 24*time.Hour).Err()
 	}
-	
-	return info.Size, nil
+
+	chunks, err := m.listChunks(ctx, blobID)
+	if err != nil {
+		return 0, 0, err
+	}
+	return info.Size, NextExpectedOffset(chunks), nil
 }
 
-// ComposeChunksToBlob composes all chunks into the final blob object.
-// Retrieves chunk offsets from Redis and composes them in order.
-func (m *MinIOClient) ComposeChunksToBlob(ctx context.Context, blobID string) error {
+// ComposeChunksToBlob composes all chunks into the final blob object. The chunks must cover the
+// blob without gaps and end with the final chunk at finalOffset, and each chunk object must still
+// have its recorded length; otherwise nothing is composed and the chunks are kept. Chunks are
+// stored as sent, as their lengths back the offset checks; with compress set, they are compressed
+// with zstd while composed, through the server rather than within MinIO. Returns the size of the
+// content and of the stored object.
+func (m *MinIOClient) ComposeChunksToBlob(ctx context.Context, blobID string, finalOffset int64, compress bool) (int64, int64, error) {
+	if m.redisClient == nil {
+		return 0, 0, fmt.Errorf("chunked uploads require Redis")
+	}
 	finalKey := "blobs/" + blobID
-	redisKey := fmt.Sprintf("blob:chunks:%s", blobID)
-	
-	// Get chunk offsets from Redis
-	var offsets []int64
-	if m.redisClient != nil {
-		data, err := m.redisClient.Get(ctx, redisKey).Result()
-		if err != nil {
-			return fmt.Errorf("failed to get chunk offsets from Redis: %w", err)
-		}
-		if err := json.Unmarshal([]byte(data), &offsets); err != nil {
-			return fmt.Errorf("failed to parse chunk offsets: %w", err)
+
+	chunks, err := m.listChunks(ctx, blobID)
+	if err != nil {
+		return 0, 0, err
+	}
+	var final ChunkRange
+	for _, c := range chunks {
+		if c.Offset == finalOffset {
+			final = c
 		}
 	}
-	
-	// Sort offsets to ensure correct order
-	sort.Slice(offsets, func(i, j int) bool { return offsets[i] < offsets[j] })
-	
+	if err := checkContiguous(chunks, final); err != nil {
+		return 0, 0, err
+	}
+
 	// Build list of source objects (chunks in order)
-	sources := make([]minio.CopySrcOptions, len(offsets))
-	for i, offset := range offsets {
-		chunkKey := m.getChunkKey(blobID, offset)
+	sources := make([]minio.CopySrcOptions, len(chunks))
+	for i, c := range chunks {
+		chunkKey := m.getChunkKey(blobID, c.Offset)
+		stat, err := m.client.StatObject(ctx, m.bucketName, chunkKey, minio.StatObjectOptions{})
+		if err != nil {
+			return 0, 0, fmt.Errorf("failed to stat chunk at offset %d: %w", c.Offset, err)
+		}
+		if stat.Size != c.Length {
+			return 0, 0, &ChunkGapError{Offset: c.Offset}
+		}
 		sources[i] = minio.CopySrcOptions{
 			Bucket: m.bucketName,
 			Object: chunkKey,
 		}
 	}
-	
+
 	// Compose chunks into final object
-	_, err := m.client.ComposeObject(ctx, minio.CopyDestOptions{
+	size, storedSize := final.End(), final.End()
+	if compress {
+		size, storedSize, err = m.compressChunks(ctx, finalKey, sources, final.End())
+	} else {
+		_, err = m.client.ComposeObject(ctx, minio.CopyDestOptions{
+			Bucket: m.bucketName,
+			Object: finalKey,
+		}, sources...)
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+
+	// Clean up chunk files and Redis tracking
+	for _, c := range chunks {
+		_ = m.client.RemoveObject(ctx, m.bucketName, m.getChunkKey(blobID, c.Offset), minio.RemoveObjectOptions{})
+	}
+	_ = m.redisClient.Del(ctx, chunksKey(blobID)).Err()
+
+	return size, storedSize, nil
+}
+
+// compressChunks reads the chunk objects, or other sources, in order and stores them compressed as
+// one object at key.
+func (m *MinIOClient) compressChunks(ctx context.Context, key string, sources []minio.CopySrcOptions, size int64) (int64, int64, error) {
+	readers := make([]io.Reader, len(sources))
+	for i, src := range sources {
+		// Objects are fetched on their first read
+		obj, err := m.client.GetObject(ctx, src.Bucket, src.Object, minio.GetObjectOptions{})
+		if err != nil {
+			return 0, 0, err
+		}
+		defer obj.Close()
+		readers[i] = obj
+	}
+	return m.putBlob(ctx, key, io.MultiReader(readers...), size, true)
+}
+
+// listChunks returns the recorded chunks of a blob, sorted by offset.
+func (m *MinIOClient) listChunks(ctx context.Context, blobID string) ([]ChunkRange, error) {
+	fields, err := m.redisClient.HGetAll(ctx, chunksKey(blobID)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get chunks from Redis: %w", err)
+	}
+	return parseChunks(fields)
+}
+
+// BlobPart identifies an uploaded part of a multipart blob upload.
+type BlobPart struct {
+	Number int
+	ETag   string
+}
+
+// NewMultipartBlobUpload starts a multipart upload of a blob and returns its upload ID.
+func (m *MinIOClient) NewMultipartBlobUpload(ctx context.Context, blobID string) (string, error) {
+	core := minio.Core{Client: m.client}
+	return core.NewMultipartUpload(ctx, m.bucketName, "blobs/"+blobID, minio.PutObjectOptions{
+		ContentType: "application/octet-stream",
+	})
+}
+
+// PutBlobPart stores one part of a multipart blob upload and returns its ETag. Uploading the same
+// part number again replaces the part.
+func (m *MinIOClient) PutBlobPart(ctx context.Context, blobID, uploadID string, partNumber int, reader io.Reader, size int64) (string, error) {
+	core := minio.Core{Client: m.client}
+	part, err := core.PutObjectPart(ctx, m.bucketName, "blobs/"+blobID, uploadID, partNumber, reader, size, minio.PutObjectPartOptions{})
+	if err != nil {
+		return "", err
+	}
+	return part.ETag, nil
+}
+
+// CompleteMultipartBlobUpload assembles the parts, in the order given, into the blob object.
+func (m *MinIOClient) CompleteMultipartBlobUpload(ctx context.Context, blobID, uploadID string, parts []BlobPart) error {
+	core := minio.Core{Client: m.client}
+	completeParts := make([]minio.CompletePart, len(parts))
+	for i, p := range parts {
+		completeParts[i] = minio.CompletePart{PartNumber: p.Number, ETag: p.ETag}
+	}
+	_, err := core.CompleteMultipartUpload(ctx, m.bucketName, "blobs/"+blobID, uploadID, completeParts, minio.PutObjectOptions{})
+	return err
+}
+
+// CompressBlob compresses the stored object of a blob with zstd. The compressed object is written
+// aside and copied over the blob's within MinIO, so the blob's object is only replaced once it is
+// complete. size is the blob's size. Returns the size of the stored object.
+func (m *MinIOClient) CompressBlob(ctx context.Context, blobID string, size int64) (int64, error) {
+	key := "blobs/" + blobID
+	compressedKey := key + ".compressed"
+	defer func() {
+		_ = m.client.RemoveObject(context.WithoutCancel(ctx), m.bucketName, compressedKey, minio.RemoveObjectOptions{})
+	}()
+
+	_, storedSize, err := m.compressChunks(ctx, compressedKey, []minio.CopySrcOptions{{Bucket: m.bucketName, Object: key}}, size)
+	if err != nil {
+		return 0, err
+	}
+	_, err = m.client.ComposeObject(ctx, minio.CopyDestOptions{
 		Bucket: m.bucketName,
-		Object: finalKey,
-	}, sources...)
+		Object: key,
+	}, minio.CopySrcOptions{
+		Bucket: m.bucketName,
+		Object: compressedKey,
+	})
 	if err != nil {
+		return 0, err
+	}
+	return storedSize, nil
+}
+
+// AbortMultipartBlobUpload discards a multipart upload and its parts. An upload that no longer
+// exists counts as aborted.
+func (m *MinIOClient) AbortMultipartBlobUpload(ctx context.Context, blobID, uploadID string) error {
+	core := minio.Core{Client: m.client}
+	err := core.AbortMultipartUpload(ctx, m.bucketName, "blobs/"+blobID, uploadID)
+	if err != nil && minio.ToErrorResponse(err).Code != "NoSuchUpload" {
 		return err
 	}
-	
-	// Clean up chunk files and Redis tracking
-	for _, offset := range offsets {
-		chunkKey := m.getChunkKey(blobID, offset)
-		_ = m.client.RemoveObject(ctx, m.bucketName, chunkKey, minio.RemoveObjectOptions{})
+	return nil
+}
+
+// ObjectInfo describes a stored blob, chunk or content object.
+type ObjectInfo struct {
+	Key           string
+	BlobID        string
+	ContentSHA256 string
+	IsChunk       bool
+	Cold          bool // stored in the tiering store
+	Size          int64
+	LastModified  time.Time
+}
+
+// ListBlobObjects lists every blob and chunk object in the bucket.
+func (m *MinIOClient) ListBlobObjects(ctx context.Context) ([]ObjectInfo, error) {
+	var out []ObjectInfo
+	for object := range m.client.ListObjects(ctx, m.bucketName, minio.ListObjectsOptions{Prefix: "blobs/", Recursive: true}) {
+		if object.Err != nil {
+			return nil, object.Err
+		}
+		name := strings.TrimPrefix(object.Key, "blobs/")
+		blobID, _, isChunk := strings.Cut(name, ".chunk.")
+		out = append(out, ObjectInfo{
+			Key:          object.Key,
+			BlobID:       blobID,
+			IsChunk:      isChunk,
+			Size:         object.Size,
+			LastModified: object.LastModified,
+		})
+	}
+	return out, nil
+}
+
+// Ping checks that the bucket exists and that objects in it can be read. It stats a key that is
+// never written, so a NoSuchKey answer means success.
+func (m *MinIOClient) Ping(ctx context.Context) error {
+	exists, err := m.client.BucketExists(ctx, m.bucketName)
+	if err != nil {
+		return err
 	}
-	if m.redisClient != nil {
-		_ = m.redisClient.Del(ctx, redisKey).Err()
+	if !exists {
+		return fmt.Errorf("bucket %q does not exist", m.bucketName)
+	}
+	_, err = m.client.StatObject(ctx, m.bucketName, "readyz-probe", minio.StatObjectOptions{})
+	if err != nil && minio.ToErrorResponse(err).Code != "NoSuchKey" {
+		return err
 	}
-	
 	return nil
 }
 
+// DeleteObject removes a blob or chunk object by its key.
+func (m *MinIOClient) DeleteObject(ctx context.Context, key string) error {
+	return m.client.RemoveObject(ctx, m.bucketName, key, minio.RemoveObjectOptions{})
+}
+
 // getChunkKey returns the MinIO object key for a chunk
 func (m *MinIOClient) getChunkKey(blobID string, offset int64) string {
 	return fmt.Sprintf("blobs/%s.chunk.%d", blobID, offset)
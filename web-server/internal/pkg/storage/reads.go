@@ -0,0 +1,94 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ReadLeaseTTL bounds how long a read keeps a blob from being deleted if the server reading it
+// never releases the lease, e.g. because it crashed. Every new read renews it.
+const ReadLeaseTTL = time.Hour
+
+// acquireReadScript counts a read of the blob at KEYS[1], unless KEYS[2] marks the blob as being
+// deleted. Returns 1 if the read was counted and 0 otherwise.
+var acquireReadScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[2]) == 1 then
+	return 0
+end
+redis.call('INCR', KEYS[1])
+redis.call('EXPIRE', KEYS[1], ARGV[1])
+return 1
+`)
+
+// releaseReadScript uncounts a read of the blob at KEYS[1] and returns the reads left.
+var releaseReadScript = redis.NewScript(`
+local n = redis.call('DECR', KEYS[1])
+if n <= 0 then
+	redis.call('DEL', KEYS[1])
+	return 0
+end
+return n
+`)
+
+// claimDeletionScript marks the blob as being deleted at KEYS[2], unless KEYS[1] counts reads of
+// it. Returns 1 if claimed and 0 otherwise.
+var claimDeletionScript = redis.NewScript(`
+local n = tonumber(redis.call('GET', KEYS[1]) or '0')
+if n > 0 then
+	return 0
+end
+redis.call('SET', KEYS[2], '1', 'EX', ARGV[1])
+return 1
+`)
+
+// readsKey returns the Redis counter of the reads in flight of a blob
+func readsKey(blobID string) string {
+	return fmt.Sprintf("blob:reads:%s", blobID)
+}
+
+// deletingKey returns the Redis flag set while a blob is being deleted
+func deletingKey(blobID string) string {
+	return fmt.Sprintf("blob:deleting:%s", blobID)
+}
+
+// AcquireBlobRead registers a read of a blob, which keeps ClaimBlobDeletion from succeeding until
+// the read is released. Returns false if the blob is already being deleted.
+func (m *MinIOClient) AcquireBlobRead(ctx context.Context, blobID string) (bool, error) {
+	if m.redisClient == nil {
+		return false, fmt.Errorf("read tracking requires Redis")
+	}
+	ok, err := acquireReadScript.Run(ctx, m.redisClient, []string{readsKey(blobID), deletingKey(blobID)}, int(ReadLeaseTTL.Seconds())).Int()
+	if err != nil {
+		return false, fmt.Errorf("failed to register blob read: %w", err)
+	}
+	return ok == 1, nil
+}
+
+// ReleaseBlobRead ends a read registered by AcquireBlobRead and returns the number of reads of the
+// blob still in flight.
+func (m *MinIOClient) ReleaseBlobRead(ctx context.Context, blobID string) (int64, error) {
+	if m.redisClient == nil {
+		return 0, fmt.Errorf("read tracking requires Redis")
+	}
+	n, err := releaseReadScript.Run(ctx, m.redisClient, []string{readsKey(blobID)}).Int64()
+	if err != nil {
+		return 0, fmt.Errorf("failed to release blob read: %w", err)
+	}
+	return n, nil
+}
+
+// ClaimBlobDeletion reports whether a blob can be deleted because no read of it is in flight.
+// Once claimed, AcquireBlobRead refuses new reads of the blob.
+func (m *MinIOClient) ClaimBlobDeletion(ctx context.Context, blobID string) (bool, error) {
+	if m.redisClient == nil {
+		return false, fmt.Errorf("read tracking requires Redis")
+	}
+	ok, err := claimDeletionScript.Run(ctx, m.redisClient, []string{readsKey(blobID), deletingKey(blobID)}, int(ReadLeaseTTL.Seconds())).Int()
+	if err != nil {
+		return false, fmt.Errorf("failed to claim blob deletion: %w", err)
+	}
+	return ok == 1, nil
+}
@@ -0,0 +1,30 @@
+package storage
+
+import (
+	"context"
+
+	"github.com/minio/minio-go/v7"
+)
+
+// IsNotFound reports whether err says that an object does not exist.
+func IsNotFound(err error) bool {
+	return err != nil && minio.ToErrorResponse(err).Code == "NoSuchKey"
+}
+
+// CopyObjectTo copies the object at key to the same key in dest, unless dest already has an
+// object of the same size there, and returns the number of bytes copied. Objects are never
+// rewritten under the same key, so equal sizes mean equal content.
+func (m *MinIOClient) CopyObjectTo(ctx context.Context, dest *MinIOClient, key string) (int64, error) {
+	reader, size, err := m.GetObject(ctx, key)
+	if err != nil {
+		return 0, err
+	}
+	defer reader.Close()
+	if existing, err := dest.StatObject(ctx, key); err == nil && existing == size {
+		return 0, nil
+	}
+	if err := dest.PutObject(ctx, key, reader, size); err != nil {
+		return 0, err
+	}
+	return size, nil
+}
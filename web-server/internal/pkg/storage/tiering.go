@@ -0,0 +1,45 @@
+package storage
+
+import (
+	"context"
+	"io"
+)
+
+// SetColdTier makes cold the tiering store of the client. Blob objects missing from the bucket are
+// read from cold instead, and deleting a blob deletes its cold object too.
+func (m *MinIOClient) SetColdTier(cold *MinIOClient) {
+	m.cold = cold
+}
+
+// ColdTier returns the tiering store of the client, or nil if there is none.
+func (m *MinIOClient) ColdTier() *MinIOClient {
+	return m.cold
+}
+
+// DownloadColdBlob is DownloadBlob for a blob moved to the tiering store: it is read from there
+// first, and from the bucket if the tiering store does not have it.
+func (m *MinIOClient) DownloadColdBlob(ctx context.Context, blobID string) (io.ReadCloser, int64, error) {
+	if m.cold == nil {
+		return m.DownloadBlob(ctx, blobID)
+	}
+	reader, size, err := m.cold.downloadBlob(ctx, blobID)
+	if IsNotFound(err) {
+		return m.downloadBlob(ctx, blobID)
+	}
+	return reader, size, err
+}
+
+// ListColdBlobObjects lists every blob object in the tiering store.
+func (m *MinIOClient) ListColdBlobObjects(ctx context.Context) ([]ObjectInfo, error) {
+	if m.cold == nil {
+		return nil, nil
+	}
+	objects, err := m.cold.ListBlobObjects(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for i := range objects {
+		objects[i].Cold = true
+	}
+	return objects, nil
+}
@@ -0,0 +1,60 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/redis/go-redis/v9"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// RedisHook is a redis.Hook that creates a span for every command and pipeline. Only command
+// names are recorded: keys contain API keys, as in nk:session:<apiKey>.
+type RedisHook struct{}
+
+func (RedisHook) DialHook(next redis.DialHook) redis.DialHook {
+	return next
+}
+
+func (RedisHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		ctx, span := Tracer().Start(ctx, "redis "+strings.ToUpper(cmd.Name()), trace.WithSpanKind(trace.SpanKindClient))
+		span.SetAttributes(
+			attribute.String("db.system.name", "redis"),
+			attribute.String("db.operation.name", strings.ToUpper(cmd.Name())),
+		)
+		err := next(ctx, cmd)
+		End(span, redisError(err))
+		return err
+	}
+}
+
+func (RedisHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		ctx, span := Tracer().Start(ctx, "redis pipeline", trace.WithSpanKind(trace.SpanKindClient))
+		if span.IsRecording() {
+			names := make([]string, len(cmds))
+			for i, cmd := range cmds {
+				names[i] = strings.ToUpper(cmd.Name())
+			}
+			span.SetAttributes(
+				attribute.String("db.system.name", "redis"),
+				attribute.String("db.operation.name", "PIPELINE "+strings.Join(names, " ")),
+				attribute.Int("db.operation.batch.size", len(cmds)),
+			)
+		}
+		err := next(ctx, cmds)
+		End(span, redisError(err))
+		return err
+	}
+}
+
+// redisError drops redis.Nil, which only means that a key does not exist.
+func redisError(err error) error {
+	if errors.Is(err, redis.Nil) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,75 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// recordSpans installs a tracer provider that keeps finished spans in memory
+func recordSpans(t *testing.T) *tracetest.SpanRecorder {
+	recorder := tracetest.NewSpanRecorder()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+	return recorder
+}
+
+func TestTransportCreatesClientSpans(t *testing.T) {
+	recorder := recordSpans(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/bucket/missing" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	client := &http.Client{Transport: &Transport{Base: http.DefaultTransport, System: "minio"}}
+	ctx, parent := Tracer().Start(context.Background(), "parent")
+	for _, path := range []string{"/bucket/missing", "/bucket/blobs/x"} {
+		req, _ := http.NewRequestWithContext(ctx, http.MethodHead, srv.URL+path, nil)
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+	parent.End()
+
+	spans := recorder.Ended()
+	if len(spans) != 3 {
+		t.Fatalf("Expected 3 spans, got %d", len(spans))
+	}
+	for _, span := range spans[:2] {
+		if span.Name() != "minio HEAD" || span.Parent().SpanID() != parent.SpanContext().SpanID() {
+			t.Errorf("Unexpected span %q with parent %v", span.Name(), span.Parent().SpanID())
+		}
+	}
+	if spans[0].Status().Code == codes.Error {
+		t.Error("A 404 must not mark the span as failed")
+	}
+	if spans[1].Status().Code != codes.Error {
+		t.Error("A 503 must mark the span as failed")
+	}
+}
+
+func TestQueryOperation(t *testing.T) {
+	tests := map[string]string{
+		"\n\t\tSELECT id FROM users":    "SELECT",
+		"update users SET is_banned=$1": "UPDATE",
+		"":                              "QUERY",
+	}
+	for sql, want := range tests {
+		if got := queryOperation(sql); got != want {
+			t.Errorf("queryOperation(%q) = %q, want %q", sql, got, want)
+		}
+	}
+}
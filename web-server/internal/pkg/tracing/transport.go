@@ -0,0 +1,46 @@
+package tracing
+
+import (
+	"net/http"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Transport wraps an http.RoundTripper so that every request gets a client span. It is used for
+// MinIO, where one storage operation is one or more S3 requests. The span ends when the response
+// headers arrive, so the time spent streaming a download body is not included.
+type Transport struct {
+	Base   http.RoundTripper
+	System string
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx, span := Tracer().Start(req.Context(), t.System+" "+req.Method, trace.WithSpanKind(trace.SpanKindClient))
+	span.SetAttributes(
+		attribute.String("http.request.method", req.Method),
+		attribute.String("server.address", req.URL.Host),
+		attribute.String("url.path", req.URL.Path),
+	)
+
+	resp, err := t.Base.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		End(span, err)
+		return nil, err
+	}
+	span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
+	// S3 answers expected misses, such as a stat of a missing key, with 404; only server errors
+	// mark the span as failed.
+	if resp.StatusCode >= 500 {
+		End(span, &statusError{code: resp.StatusCode})
+	} else {
+		span.End()
+	}
+	return resp, nil
+}
+
+type statusError struct{ code int }
+
+func (e *statusError) Error() string {
+	return http.StatusText(e.code)
+}
@@ -0,0 +1,177 @@
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/nkrypt-xyz/nkrypt-xyz-web-server/internal/model"
+)
+
+// contentLockClass is the first key of the advisory locks taken on deduplicated content, the
+// second being the hash of its SHA-256. It is arbitrary but must not change.
+const contentLockClass = 0x6e6b63
+
+// lockContent takes a transaction-level advisory lock on the content with the given SHA-256. It
+// serializes storing a content object with deleting the object of content released earlier.
+func lockContent(ctx context.Context, tx pgx.Tx, sha256 string) error {
+	_, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock($1, hashtext($2))`, contentLockClass, sha256)
+	return err
+}
+
+// AttachContent makes an in-progress blob reference the deduplicated content with the given
+// SHA-256, adding the content with the blob's size if it is new. New content is locked until
+// storeContent, which stores its object, returns; if that fails nothing is changed. Returns
+// ErrBlobTransition if the blob is not in progress or already references content.
+func (r *BlobRepository) AttachContent(ctx context.Context, blobID, sha256 string, sizeBytes int64, storeContent func(ctx context.Context) error) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	if err := lockContent(ctx, tx, sha256); err != nil {
+		return err
+	}
+
+	// xmax is 0 for a row this statement inserted rather than updated
+	var created bool
+	err = tx.QueryRow(ctx, `
+		INSERT INTO blob_contents (sha256, size_bytes, ref_count) VALUES ($1, $2, 1)
+		ON CONFLICT (sha256) DO UPDATE SET ref_count = blob_contents.ref_count + 1, updated_at = NOW()
+		RETURNING xmax = 0
+	`, sha256, sizeBytes).Scan(&created)
+	if err != nil {
+		return err
+	}
+
+	tag, err := tx.Exec(ctx, `
+		UPDATE blobs SET content_sha256=$2, updated_at=NOW()
+		WHERE id=$1 AND content_sha256 IS NULL AND status::text = ANY($3)
+	`, blobID, sha256, []string{model.BlobStatusStarted, model.BlobStatusUploading})
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrBlobTransition
+	}
+
+	if created {
+		if err := storeContent(ctx); err != nil {
+			return err
+		}
+	}
+	return tx.Commit(ctx)
+}
+
+// releaseContent drops a reference to deduplicated content within tx. When that was the last
+// reference, the content row is deleted and true is returned; its object is left for
+// DeleteUnusedContent to delete once tx is committed.
+func releaseContent(ctx context.Context, tx pgx.Tx, sha256 string) (bool, error) {
+	var refCount int
+	err := tx.QueryRow(ctx, `
+		UPDATE blob_contents SET ref_count = ref_count - 1, updated_at = NOW()
+		WHERE sha256=$1
+		RETURNING ref_count
+	`, sha256).Scan(&refCount)
+	if err != nil {
+		return false, err
+	}
+	if refCount > 0 {
+		return false, nil
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM blob_contents WHERE sha256=$1`, sha256); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// DeleteUnusedContent calls deleteContent to delete the object of deduplicated content that has
+// no row, as after its last reference was released. Content added again meanwhile keeps its
+// object. An object left behind when this fails is reported as an orphan by consistency checks.
+func (r *BlobRepository) DeleteUnusedContent(ctx context.Context, sha256 string, deleteContent func(ctx context.Context, sha256 string) error) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	if err := lockContent(ctx, tx, sha256); err != nil {
+		return err
+	}
+	var exists bool
+	if err := tx.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM blob_contents WHERE sha256=$1)`, sha256).Scan(&exists); err != nil {
+		return err
+	}
+	if !exists {
+		if err := deleteContent(ctx, sha256); err != nil {
+			return err
+		}
+	}
+	return tx.Commit(ctx)
+}
+
+// ListAllContents lists every deduplicated content, for consistency checks.
+func (r *BlobRepository) ListAllContents(ctx context.Context) ([]model.BlobContent, error) {
+	rows, err := r.db.Query(ctx, `
+		SELECT sha256, size_bytes, ref_count, created_at, updated_at
+		FROM blob_contents
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []model.BlobContent
+	for rows.Next() {
+		var c model.BlobContent
+		if err := rows.Scan(&c.SHA256, &c.SizeBytes, &c.RefCount, &c.CreatedAt, &c.UpdatedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, c)
+	}
+	return out, rows.Err()
+}
+
+// RecountContentReferences sets the reference count of deduplicated content to the number of
+// blobs referencing it. Content no blob references is deleted, calling deleteContent to delete its
+// object once the row is gone. Returns the new reference count.
+func (r *BlobRepository) RecountContentReferences(ctx context.Context, sha256 string, deleteContent func(ctx context.Context, sha256 string) error) (int, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	// Lock before counting, so that the count sees every reference added until the lock was taken
+	if _, err := tx.Exec(ctx, `SELECT sha256 FROM blob_contents WHERE sha256=$1 FOR UPDATE`, sha256); err != nil {
+		return 0, err
+	}
+	var refCount int
+	err = tx.QueryRow(ctx, `
+		UPDATE blob_contents
+		SET ref_count = (SELECT COUNT(*) FROM blobs WHERE content_sha256=$1), updated_at = NOW()
+		WHERE sha256=$1
+		RETURNING ref_count
+	`, sha256).Scan(&refCount)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	if refCount == 0 {
+		if _, err := tx.Exec(ctx, `DELETE FROM blob_contents WHERE sha256=$1`, sha256); err != nil {
+			return 0, err
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return 0, err
+	}
+	if refCount == 0 {
+		if err := r.DeleteUnusedContent(ctx, sha256, deleteContent); err != nil {
+			return 0, err
+		}
+	}
+	return refCount, nil
+}
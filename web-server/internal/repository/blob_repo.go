@@ -2,12 +2,32 @@ package repository
 
 import (
 	"context"
+	"errors"
+	"time"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 
 	"github.com/nkrypt-xyz/nkrypt-xyz-web-server/internal/model"
 )
 
+// ErrBlobTransition is returned when a blob is not in a status it may leave for the requested one.
+var ErrBlobTransition = errors.New("blob status does not allow this transition")
+
+// ErrWriteConflict is returned when finishing a blob while the current blob of the file is not
+// the one the writer expected.
+var ErrWriteConflict = errors.New("the current blob of the file changed")
+
+// blobTransitionSources lists, for each blob status, the statuses a blob may enter it from. Blobs
+// start as started; error is reachable from every other status so that consistency repairs can
+// flag a finished blob whose object is lost.
+var blobTransitionSources = map[string][]string{
+	model.BlobStatusUploading:  {model.BlobStatusStarted, model.BlobStatusUploading},
+	model.BlobStatusFinished:   {model.BlobStatusStarted, model.BlobStatusUploading},
+	model.BlobStatusSuperseded: {model.BlobStatusFinished},
+	model.BlobStatusError:      {model.BlobStatusStarted, model.BlobStatusUploading, model.BlobStatusFinished, model.BlobStatusSuperseded},
+}
+
 type BlobRepository struct {
 	db *pgxpool.Pool
 }
@@ -16,55 +36,63 @@ func NewBlobRepository(db *pgxpool.Pool) *BlobRepository {
 	return &BlobRepository{db: db}
 }
 
-func (r *BlobRepository) FindByID(ctx context.Context, blobID string) (*model.Blob, error) {
-	row := r.db.QueryRow(ctx, `
-		SELECT id, bucket_id, file_id, crypto_meta_header_content, started_at, finished_at,
-		       status, created_by_user_id, created_at, updated_at
-		FROM blobs WHERE id=$1
-	`, blobID)
+const blobColumns = `
+	id, bucket_id, file_id, crypto_meta_header_content, started_at, finished_at, superseded_at,
+	status, content_sha256, location, location_changed_at, codec, size_bytes, stored_size_bytes,
+	created_by_user_id, created_at, updated_at`
+
+type blobScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanBlob(row blobScanner) (*model.Blob, error) {
 	var b model.Blob
 	if err := row.Scan(
-		&b.ID, &b.BucketID, &b.FileID, &b.CryptoMetaHeaderContent, &b.StartedAt, &b.FinishedAt,
-		&b.Status, &b.CreatedByUserID, &b.CreatedAt, &b.UpdatedAt,
+		&b.ID, &b.BucketID, &b.FileID, &b.CryptoMetaHeaderContent, &b.StartedAt, &b.FinishedAt, &b.SupersededAt,
+		&b.Status, &b.ContentSHA256, &b.Location, &b.LocationChangedAt, &b.Codec, &b.SizeBytes, &b.StoredSizeBytes, &b.CreatedByUserID, &b.CreatedAt, &b.UpdatedAt,
 	); err != nil {
 		return nil, err
 	}
 	return &b, nil
 }
 
-func (r *BlobRepository) FindInProgressBlob(ctx context.Context, bucketID, fileID, blobID string) (*model.Blob, error) {
-	row := r.db.QueryRow(ctx, `
-		SELECT id, bucket_id, file_id, crypto_meta_header_content, started_at, finished_at,
-		       status, created_by_user_id, created_at, updated_at
-		FROM blobs
-		WHERE bucket_id=$1 AND file_id=$2 AND id=$3 AND status='started'
-	`, bucketID, fileID, blobID)
-	var b model.Blob
-	if err := row.Scan(
-		&b.ID, &b.BucketID, &b.FileID, &b.CryptoMetaHeaderContent, &b.StartedAt, &b.FinishedAt,
-		&b.Status, &b.CreatedByUserID, &b.CreatedAt, &b.UpdatedAt,
-	); err != nil {
+func (r *BlobRepository) queryBlobs(ctx context.Context, sql string, args ...any) ([]model.Blob, error) {
+	rows, err := r.db.Query(ctx, sql, args...)
+	if err != nil {
 		return nil, err
 	}
-	return &b, nil
+	defer rows.Close()
+	var out []model.Blob
+	for rows.Next() {
+		b, err := scanBlob(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, *b)
+	}
+	return out, rows.Err()
+}
+
+func (r *BlobRepository) FindByID(ctx context.Context, blobID string) (*model.Blob, error) {
+	return scanBlob(r.db.QueryRow(ctx, `SELECT `+blobColumns+` FROM blobs WHERE id=$1`, blobID))
+}
+
+// FindInProgressBlob returns a started or uploading blob of the file.
+func (r *BlobRepository) FindInProgressBlob(ctx context.Context, bucketID, fileID, blobID string) (*model.Blob, error) {
+	return scanBlob(r.db.QueryRow(ctx, `
+		SELECT `+blobColumns+`
+		FROM blobs
+		WHERE bucket_id=$1 AND file_id=$2 AND id=$3 AND status IN ('started', 'uploading')
+	`, bucketID, fileID, blobID))
 }
 
 func (r *BlobRepository) FindLatestFinishedBlob(ctx context.Context, bucketID, fileID string) (*model.Blob, error) {
-	row := r.db.QueryRow(ctx, `
-		SELECT id, bucket_id, file_id, crypto_meta_header_content, started_at, finished_at,
-		       status, created_by_user_id, created_at, updated_at
+	return scanBlob(r.db.QueryRow(ctx, `
+		SELECT `+blobColumns+`
 		FROM blobs
 		WHERE bucket_id=$1 AND file_id=$2 AND status='finished'
 		ORDER BY finished_at DESC LIMIT 1
-	`, bucketID, fileID)
-	var b model.Blob
-	if err := row.Scan(
-		&b.ID, &b.BucketID, &b.FileID, &b.CryptoMetaHeaderContent, &b.StartedAt, &b.FinishedAt,
-		&b.Status, &b.CreatedByUserID, &b.CreatedAt, &b.UpdatedAt,
-	); err != nil {
-		return nil, err
-	}
-	return &b, nil
+	`, bucketID, fileID))
 }
 
 func (r *BlobRepository) Create(ctx context.Context, b *model.Blob) error {
@@ -75,77 +103,263 @@ func (r *BlobRepository) Create(ctx context.Context, b *model.Blob) error {
 	return err
 }
 
-func (r *BlobRepository) MarkFinished(ctx context.Context, blobID string) error {
-	_, err := r.db.Exec(ctx, `UPDATE blobs SET status='finished', finished_at=NOW(), updated_at=NOW() WHERE id=$1`, blobID)
-	return err
+// SetStoredObject records the codec and sizes of the object of an in-progress blob.
+func (r *BlobRepository) SetStoredObject(ctx context.Context, blobID, codec string, sizeBytes, storedSizeBytes int64) error {
+	tag, err := r.db.Exec(ctx, `
+		UPDATE blobs SET codec=$2, size_bytes=$3, stored_size_bytes=$4, updated_at=NOW()
+		WHERE id=$1 AND status::text = ANY($5)
+	`, blobID, codec, sizeBytes, storedSizeBytes, []string{model.BlobStatusStarted, model.BlobStatusUploading})
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrBlobTransition
+	}
+	return nil
+}
+
+// FindBucketCompression returns the compression setting of the bucket of a blob.
+func (r *BlobRepository) FindBucketCompression(ctx context.Context, blobID string) (string, error) {
+	var compression string
+	err := r.db.QueryRow(ctx, `
+		SELECT k.compression FROM blobs b JOIN buckets k ON k.id = b.bucket_id WHERE b.id=$1
+	`, blobID).Scan(&compression)
+	return compression, err
+}
+
+// MarkUploading records that content of an in-progress blob is arriving.
+func (r *BlobRepository) MarkUploading(ctx context.Context, blobID string) error {
+	return r.transition(ctx, blobID, model.BlobStatusUploading)
 }
 
 func (r *BlobRepository) MarkErroneous(ctx context.Context, blobID string) error {
-	_, err := r.db.Exec(ctx, `UPDATE blobs SET status='error', updated_at=NOW() WHERE id=$1`, blobID)
-	return err
+	return r.transition(ctx, blobID, model.BlobStatusError)
+}
+
+// transition moves a blob to status, or returns ErrBlobTransition if its current status does not
+// allow it.
+func (r *BlobRepository) transition(ctx context.Context, blobID, status string) error {
+	tag, err := r.db.Exec(ctx, `
+		UPDATE blobs SET status=$2, updated_at=NOW()
+		WHERE id=$1 AND status::text = ANY($3)
+	`, blobID, status, blobTransitionSources[status])
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrBlobTransition
+	}
+	return nil
+}
+
+// FinishAndSupersede marks an in-progress blob finished and the blob it replaces superseded, in
+// one transaction that holds the file row so that concurrent writers of the file finish one at a
+// time. If expectedCurrentBlobID is set and the file's current finished blob is another one, the
+// blob is left in progress and ErrWriteConflict is returned. Returns the IDs of superseded blobs.
+func (r *BlobRepository) FinishAndSupersede(ctx context.Context, bucketID, fileID, blobID, expectedCurrentBlobID string) ([]string, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	if _, err := tx.Exec(ctx, `SELECT id FROM files WHERE bucket_id=$1 AND id=$2 FOR UPDATE`, bucketID, fileID); err != nil {
+		return nil, err
+	}
+
+	if expectedCurrentBlobID != "" {
+		var currentID string
+		err := tx.QueryRow(ctx, `
+			SELECT id FROM blobs
+			WHERE bucket_id=$1 AND file_id=$2 AND status='finished'
+			ORDER BY finished_at DESC LIMIT 1
+		`, bucketID, fileID).Scan(&currentID)
+		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			return nil, err
+		}
+		if currentID != expectedCurrentBlobID {
+			return nil, ErrWriteConflict
+		}
+	}
+
+	tag, err := tx.Exec(ctx, `
+		UPDATE blobs SET status='finished', finished_at=NOW(), updated_at=NOW()
+		WHERE id=$1 AND bucket_id=$2 AND file_id=$3 AND status::text = ANY($4)
+	`, blobID, bucketID, fileID, blobTransitionSources[model.BlobStatusFinished])
+	if err != nil {
+		return nil, err
+	}
+	if tag.RowsAffected() == 0 {
+		return nil, ErrBlobTransition
+	}
+
+	rows, err := tx.Query(ctx, `
+		UPDATE blobs SET status='superseded', superseded_at=NOW(), updated_at=NOW()
+		WHERE bucket_id=$1 AND file_id=$2 AND id != $3 AND status='finished'
+		RETURNING id
+	`, bucketID, fileID, blobID)
+	if err != nil {
+		return nil, err
+	}
+	superseded, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return nil, err
+	}
+	return superseded, tx.Commit(ctx)
 }
 
 func (r *BlobRepository) ListBlobsForFile(ctx context.Context, bucketID, fileID string) ([]model.Blob, error) {
-	rows, err := r.db.Query(ctx, `
-		SELECT id, bucket_id, file_id, crypto_meta_header_content, started_at, finished_at,
-		       status, created_by_user_id, created_at, updated_at
+	return r.queryBlobs(ctx, `
+		SELECT `+blobColumns+`
 		FROM blobs
 		WHERE bucket_id=$1 AND file_id=$2
 	`, bucketID, fileID)
+}
+
+// ListBlobsInDirectoryTree lists the blobs of the files in a directory and in all directories
+// below it.
+func (r *BlobRepository) ListBlobsInDirectoryTree(ctx context.Context, bucketID, directoryID string) ([]model.Blob, error) {
+	return r.queryBlobs(ctx, `
+		WITH RECURSIVE tree AS (
+			SELECT id FROM directories WHERE bucket_id=$1 AND id=$2
+			UNION ALL
+			SELECT d.id FROM directories d JOIN tree t ON d.parent_directory_id = t.id
+		)
+		SELECT `+blobColumns+`
+		FROM blobs
+		WHERE bucket_id=$1 AND file_id IN (SELECT f.id FROM files f JOIN tree t ON f.parent_directory_id = t.id)
+	`, bucketID, directoryID)
+}
+
+// ListBlobsForBucket lists the blobs of every file in a bucket.
+func (r *BlobRepository) ListBlobsForBucket(ctx context.Context, bucketID string) ([]model.Blob, error) {
+	return r.queryBlobs(ctx, `SELECT `+blobColumns+` FROM blobs WHERE bucket_id=$1`, bucketID)
+}
+
+// ListBlobsForFileWithStatus lists the blobs of a file in any of the given statuses.
+func (r *BlobRepository) ListBlobsForFileWithStatus(ctx context.Context, bucketID, fileID string, statuses ...string) ([]model.Blob, error) {
+	return r.queryBlobs(ctx, `
+		SELECT `+blobColumns+`
+		FROM blobs
+		WHERE bucket_id=$1 AND file_id=$2 AND status::text = ANY($3)
+	`, bucketID, fileID, statuses)
+}
+
+// DeleteBlob deletes a blob and releases its reference to deduplicated content. When that was the
+// last reference, the content row is deleted and deleteContent is called to delete its object
+// once the deletion is committed.
+func (r *BlobRepository) DeleteBlob(ctx context.Context, blobID string, deleteContent func(ctx context.Context, sha256 string) error) error {
+	tx, err := r.db.Begin(ctx)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	defer rows.Close()
-	var out []model.Blob
-	for rows.Next() {
-		var b model.Blob
-		if err := rows.Scan(
-			&b.ID, &b.BucketID, &b.FileID, &b.CryptoMetaHeaderContent, &b.StartedAt, &b.FinishedAt,
-			&b.Status, &b.CreatedByUserID, &b.CreatedAt, &b.UpdatedAt,
-		); err != nil {
-			return nil, err
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	var sha256 *string
+	err = tx.QueryRow(ctx, `DELETE FROM blobs WHERE id=$1 RETURNING content_sha256`, blobID).Scan(&sha256)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	released := false
+	if sha256 != nil {
+		if released, err = releaseContent(ctx, tx, *sha256); err != nil {
+			return err
 		}
-		out = append(out, b)
 	}
-	return out, nil
+	if err := tx.Commit(ctx); err != nil {
+		return err
+	}
+	if released {
+		return r.DeleteUnusedContent(ctx, *sha256, deleteContent)
+	}
+	return nil
 }
 
-func (r *BlobRepository) ListBlobsForFileExcluding(ctx context.Context, bucketID, fileID, excludeBlobID string) ([]model.Blob, error) {
-	rows, err := r.db.Query(ctx, `
-		SELECT id, bucket_id, file_id, crypto_meta_header_content, started_at, finished_at,
-		       status, created_by_user_id, created_at, updated_at
-		FROM blobs
-		WHERE bucket_id=$1 AND file_id=$2 AND id != $3
-	`, bucketID, fileID, excludeBlobID)
+// ListAllBlobs lists every blob of every file, for consistency checks.
+func (r *BlobRepository) ListAllBlobs(ctx context.Context) ([]model.Blob, error) {
+	return r.queryBlobs(ctx, `SELECT `+blobColumns+` FROM blobs`)
+}
+
+// CountBlobsByStatus returns the number of blobs per status.
+func (r *BlobRepository) CountBlobsByStatus(ctx context.Context) (map[string]int64, error) {
+	rows, err := r.db.Query(ctx, `SELECT status, COUNT(*) FROM blobs GROUP BY status`)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	var out []model.Blob
+
+	out := make(map[string]int64)
 	for rows.Next() {
-		var b model.Blob
-		if err := rows.Scan(
-			&b.ID, &b.BucketID, &b.FileID, &b.CryptoMetaHeaderContent, &b.StartedAt, &b.FinishedAt,
-			&b.Status, &b.CreatedByUserID, &b.CreatedAt, &b.UpdatedAt,
-		); err != nil {
+		var status string
+		var count int64
+		if err := rows.Scan(&status, &count); err != nil {
 			return nil, err
 		}
-		out = append(out, b)
+		out[status] = count
 	}
 	return out, nil
 }
 
-func (r *BlobRepository) DeleteBlob(ctx context.Context, blobID string) error {
-	_, err := r.db.Exec(ctx, `DELETE FROM blobs WHERE id=$1`, blobID)
-	return err
+// ListTieringCandidates returns up to limit finished hot blobs whose file content has not changed
+// for minAge, nor the blob been promoted back to hot storage, and that are in bucketID and have
+// at least minSizeBytes if those are set. Deduplicated content is shared and never moved.
+func (r *BlobRepository) ListTieringCandidates(ctx context.Context, minAge time.Duration, bucketID string, minSizeBytes int64, limit int) ([]model.Blob, error) {
+	return r.queryBlobs(ctx, `
+		SELECT `+blobColumns+` FROM blobs WHERE id IN (
+			SELECT b.id FROM blobs b
+			JOIN files f ON f.id = b.file_id
+			WHERE b.status = $1 AND b.location = $2 AND b.content_sha256 IS NULL
+				AND GREATEST(f.content_updated_at, b.location_changed_at) < NOW() - make_interval(secs => $3)
+				AND ($4 = '' OR b.bucket_id = $4)
+				AND f.size_after_encryption_bytes >= $5
+			ORDER BY f.content_updated_at
+			LIMIT $6
+		)
+	`, model.BlobStatusFinished, model.BlobLocationHot, minAge.Seconds(), bucketID, minSizeBytes, limit)
 }
 
-func (r *BlobRepository) DeleteBlobsForFileExcluding(ctx context.Context, bucketID, fileID, keepBlobID string) error {
-	_, err := r.db.Exec(ctx, `DELETE FROM blobs WHERE bucket_id=$1 AND file_id=$2 AND id != $3`, bucketID, fileID, keepBlobID)
-	return err
+// ListCoolingBlobs returns up to limit blobs that have been cooling for longer than minAge.
+func (r *BlobRepository) ListCoolingBlobs(ctx context.Context, minAge time.Duration, limit int) ([]model.Blob, error) {
+	return r.queryBlobs(ctx, `
+		SELECT `+blobColumns+` FROM blobs
+		WHERE location = $1 AND location_changed_at < NOW() - make_interval(secs => $2)
+		ORDER BY location_changed_at
+		LIMIT $3
+	`, model.BlobLocationCooling, minAge.Seconds(), limit)
 }
 
-func (r *BlobRepository) DeleteAllBlobsForFile(ctx context.Context, bucketID, fileID string) error {
-	_, err := r.db.Exec(ctx, `DELETE FROM blobs WHERE bucket_id=$1 AND file_id=$2`, bucketID, fileID)
-	return err
+// SetLocation moves a blob to location to if it is at one of the from locations. It reports false
+// if the blob no longer exists or is elsewhere, e.g. because it was promoted meanwhile.
+func (r *BlobRepository) SetLocation(ctx context.Context, blobID, to string, from ...string) (bool, error) {
+	tag, err := r.db.Exec(ctx, `
+		UPDATE blobs SET location=$2, location_changed_at=NOW(), updated_at=NOW()
+		WHERE id=$1 AND location = ANY($3)
+	`, blobID, to, from)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// CountBlobsByLocation returns the number of finished blobs per location.
+func (r *BlobRepository) CountBlobsByLocation(ctx context.Context) (map[string]int64, error) {
+	rows, err := r.db.Query(ctx, `SELECT location, COUNT(*) FROM blobs WHERE status = $1 GROUP BY location`, model.BlobStatusFinished)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make(map[string]int64)
+	for rows.Next() {
+		var location string
+		var count int64
+		if err := rows.Scan(&location, &count); err != nil {
+			return nil, err
+		}
+		out[location] = count
+	}
+	return out, nil
 }
@@ -0,0 +1,81 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/nkrypt-xyz/nkrypt-xyz-web-server/internal/model"
+)
+
+type BlobUploadRepository struct {
+	db *pgxpool.Pool
+}
+
+func NewBlobUploadRepository(db *pgxpool.Pool) *BlobUploadRepository {
+	return &BlobUploadRepository{db: db}
+}
+
+func (r *BlobUploadRepository) Create(ctx context.Context, u *model.BlobUpload) error {
+	_, err := r.db.Exec(ctx, `
+		INSERT INTO blob_uploads (blob_id, storage_upload_id, total_size_bytes, part_size_bytes, part_count, expires_at)
+		VALUES ($1,$2,$3,$4,$5,$6)
+	`, u.BlobID, u.StorageUploadID, u.TotalSizeBytes, u.PartSizeBytes, u.PartCount, u.ExpiresAt)
+	return err
+}
+
+func (r *BlobUploadRepository) FindByBlobID(ctx context.Context, blobID string) (*model.BlobUpload, error) {
+	row := r.db.QueryRow(ctx, `
+		SELECT blob_id, storage_upload_id, total_size_bytes, part_size_bytes, part_count, created_at, expires_at
+		FROM blob_uploads WHERE blob_id=$1
+	`, blobID)
+	var u model.BlobUpload
+	if err := row.Scan(&u.BlobID, &u.StorageUploadID, &u.TotalSizeBytes, &u.PartSizeBytes, &u.PartCount, &u.CreatedAt, &u.ExpiresAt); err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+// Delete removes an upload session along with its parts.
+func (r *BlobUploadRepository) Delete(ctx context.Context, blobID string) error {
+	_, err := r.db.Exec(ctx, `DELETE FROM blob_uploads WHERE blob_id=$1`, blobID)
+	return err
+}
+
+// UpsertPart records an uploaded part, replacing an earlier upload of the same part number.
+func (r *BlobUploadRepository) UpsertPart(ctx context.Context, p *model.BlobUploadPart) error {
+	_, err := r.db.Exec(ctx, `
+		INSERT INTO blob_upload_parts (blob_id, part_number, size_bytes, sha256, etag)
+		VALUES ($1,$2,$3,$4,$5)
+		ON CONFLICT (blob_id, part_number) DO UPDATE
+		SET size_bytes=EXCLUDED.size_bytes, sha256=EXCLUDED.sha256, etag=EXCLUDED.etag, uploaded_at=NOW()
+	`, p.BlobID, p.PartNumber, p.SizeBytes, p.SHA256, p.ETag)
+	return err
+}
+
+func (r *BlobUploadRepository) DeletePart(ctx context.Context, blobID string, partNumber int) error {
+	_, err := r.db.Exec(ctx, `DELETE FROM blob_upload_parts WHERE blob_id=$1 AND part_number=$2`, blobID, partNumber)
+	return err
+}
+
+// ListParts returns the recorded parts of an upload in part number order.
+func (r *BlobUploadRepository) ListParts(ctx context.Context, blobID string) ([]model.BlobUploadPart, error) {
+	rows, err := r.db.Query(ctx, `
+		SELECT blob_id, part_number, size_bytes, sha256, etag, uploaded_at
+		FROM blob_upload_parts WHERE blob_id=$1
+		ORDER BY part_number
+	`, blobID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []model.BlobUploadPart
+	for rows.Next() {
+		var p model.BlobUploadPart
+		if err := rows.Scan(&p.BlobID, &p.PartNumber, &p.SizeBytes, &p.SHA256, &p.ETag, &p.UploadedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, p)
+	}
+	return out, nil
+}
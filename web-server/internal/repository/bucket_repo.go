@@ -3,6 +3,7 @@ package repository
 import (
 	"context"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 
 	"github.com/nkrypt-xyz/nkrypt-xyz-web-server/internal/model"
@@ -18,14 +19,14 @@ func NewBucketRepository(db *pgxpool.Pool) *BucketRepository {
 
 func (r *BucketRepository) FindByID(ctx context.Context, id string) (*model.Bucket, error) {
 	row := r.db.QueryRow(ctx, `
-		SELECT id, name, crypt_spec, crypt_data, meta_data,
-		       created_by_user_id, created_at, updated_at
+		SELECT id, name, crypt_spec, crypt_data, meta_data, compression,
+		       created_by_user_id, created_at, updated_at, version
 		FROM buckets WHERE id=$1
 	`, id)
 	var b model.Bucket
 	if err := row.Scan(
-		&b.ID, &b.Name, &b.CryptSpec, &b.CryptData, &b.MetaData,
-		&b.CreatedByUserID, &b.CreatedAt, &b.UpdatedAt,
+		&b.ID, &b.Name, &b.CryptSpec, &b.CryptData, &b.MetaData, &b.Compression,
+		&b.CreatedByUserID, &b.CreatedAt, &b.UpdatedAt, &b.Version,
 	); err != nil {
 		return nil, err
 	}
@@ -34,14 +35,14 @@ func (r *BucketRepository) FindByID(ctx context.Context, id string) (*model.Buck
 
 func (r *BucketRepository) FindByName(ctx context.Context, name string) (*model.Bucket, error) {
 	row := r.db.QueryRow(ctx, `
-		SELECT id, name, crypt_spec, crypt_data, meta_data,
-		       created_by_user_id, created_at, updated_at
+		SELECT id, name, crypt_spec, crypt_data, meta_data, compression,
+		       created_by_user_id, created_at, updated_at, version
 		FROM buckets WHERE name=$1
 	`, name)
 	var b model.Bucket
 	if err := row.Scan(
-		&b.ID, &b.Name, &b.CryptSpec, &b.CryptData, &b.MetaData,
-		&b.CreatedByUserID, &b.CreatedAt, &b.UpdatedAt,
+		&b.ID, &b.Name, &b.CryptSpec, &b.CryptData, &b.MetaData, &b.Compression,
+		&b.CreatedByUserID, &b.CreatedAt, &b.UpdatedAt, &b.Version,
 	); err != nil {
 		return nil, err
 	}
@@ -56,14 +57,34 @@ func (r *BucketRepository) Create(ctx context.Context, b *model.Bucket) error {
 	return err
 }
 
-func (r *BucketRepository) UpdateName(ctx context.Context, id, name string) error {
-	_, err := r.db.Exec(ctx, `UPDATE buckets SET name=$2, updated_at=NOW() WHERE id=$1`, id, name)
-	return err
+// UpdateName renames the bucket if its version is expectedVersion (0 for any) and returns the new
+// version. Fails with ErrVersionConflict otherwise.
+func (r *BucketRepository) UpdateName(ctx context.Context, id, name string, expectedVersion int64) (int64, error) {
+	return updateVersioned(ctx, r.db, `
+		UPDATE buckets SET name=$2, version=version+1, updated_at=NOW()
+		WHERE id=$1 AND `+versionCondition("$3")+`
+		RETURNING version
+	`, id, name, expectedVersion)
 }
 
-func (r *BucketRepository) UpdateMetaData(ctx context.Context, id string, metaData []byte) error {
-	_, err := r.db.Exec(ctx, `UPDATE buckets SET meta_data=$2, updated_at=NOW() WHERE id=$1`, id, metaData)
-	return err
+// UpdateMetaData replaces the bucket's metadata if its version is expectedVersion (0 for any) and
+// returns the new version. Fails with ErrVersionConflict otherwise.
+func (r *BucketRepository) UpdateMetaData(ctx context.Context, id string, metaData []byte, expectedVersion int64) (int64, error) {
+	return updateVersioned(ctx, r.db, `
+		UPDATE buckets SET meta_data=$2, version=version+1, updated_at=NOW()
+		WHERE id=$1 AND `+versionCondition("$3")+`
+		RETURNING version
+	`, id, metaData, expectedVersion)
+}
+
+// UpdateCompression sets the bucket's compression if its version is expectedVersion (0 for any)
+// and returns the new version. Fails with ErrVersionConflict otherwise.
+func (r *BucketRepository) UpdateCompression(ctx context.Context, id, compression string, expectedVersion int64) (int64, error) {
+	return updateVersioned(ctx, r.db, `
+		UPDATE buckets SET compression=$2, version=version+1, updated_at=NOW()
+		WHERE id=$1 AND `+versionCondition("$3")+`
+		RETURNING version
+	`, id, compression, expectedVersion)
 }
 
 func (r *BucketRepository) Delete(ctx context.Context, id string) error {
@@ -123,9 +144,17 @@ func (r *BucketRepository) ListPermissionsByBucketID(ctx context.Context, bucket
 	return out, nil
 }
 
-// ListBucketIDsByUserID returns bucket IDs for which the user has any permission.
+// ListBucketIDsByUserID returns bucket IDs for which the user has any permission,
+// either directly or through membership of a group that has been granted access.
 func (r *BucketRepository) ListBucketIDsByUserID(ctx context.Context, userID string) ([]string, error) {
-	rows, err := r.db.Query(ctx, `SELECT bucket_id FROM bucket_user_permissions WHERE user_id=$1`, userID)
+	rows, err := r.db.Query(ctx, `
+		SELECT bucket_id FROM bucket_user_permissions WHERE user_id=$1
+		UNION
+		SELECT bgp.bucket_id
+		FROM bucket_group_permissions bgp
+		JOIN user_group_members ugm ON ugm.group_id = bgp.group_id
+		WHERE ugm.user_id=$1
+	`, userID)
 	if err != nil {
 		return nil, err
 	}
@@ -173,3 +202,252 @@ func (r *BucketRepository) DeletePermission(ctx context.Context, bucketID, userI
 	_, err := r.db.Exec(ctx, `DELETE FROM bucket_user_permissions WHERE bucket_id=$1 AND user_id=$2`, bucketID, userID)
 	return err
 }
+
+// ListGroupPermissionsByBucketID returns all group permission rows for a bucket.
+func (r *BucketRepository) ListGroupPermissionsByBucketID(ctx context.Context, bucketID string) ([]model.BucketGroupPermission, error) {
+	rows, err := r.db.Query(ctx, `
+		SELECT id, bucket_id, group_id, notes,
+		       perm_modify, perm_manage_authorization, perm_destroy,
+		       perm_view_content, perm_manage_content,
+		       created_at, updated_at
+		FROM bucket_group_permissions
+		WHERE bucket_id=$1
+	`, bucketID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []model.BucketGroupPermission
+	for rows.Next() {
+		var p model.BucketGroupPermission
+		if err := rows.Scan(
+			&p.ID, &p.BucketID, &p.GroupID, &p.Notes,
+			&p.PermModify, &p.PermManageAuthorization, &p.PermDestroy,
+			&p.PermViewContent, &p.PermManageContent,
+			&p.CreatedAt, &p.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		out = append(out, p)
+	}
+	return out, nil
+}
+
+// ListGroupPermissionsForUser returns the group permission rows on a bucket that apply to the
+// user through any of their group memberships.
+func (r *BucketRepository) ListGroupPermissionsForUser(ctx context.Context, bucketID, userID string) ([]model.BucketGroupPermission, error) {
+	rows, err := r.db.Query(ctx, `
+		SELECT bgp.id, bgp.bucket_id, bgp.group_id, bgp.notes,
+		       bgp.perm_modify, bgp.perm_manage_authorization, bgp.perm_destroy,
+		       bgp.perm_view_content, bgp.perm_manage_content,
+		       bgp.created_at, bgp.updated_at
+		FROM bucket_group_permissions bgp
+		JOIN user_group_members ugm ON ugm.group_id = bgp.group_id
+		WHERE bgp.bucket_id=$1 AND ugm.user_id=$2
+	`, bucketID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []model.BucketGroupPermission
+	for rows.Next() {
+		var p model.BucketGroupPermission
+		if err := rows.Scan(
+			&p.ID, &p.BucketID, &p.GroupID, &p.Notes,
+			&p.PermModify, &p.PermManageAuthorization, &p.PermDestroy,
+			&p.PermViewContent, &p.PermManageContent,
+			&p.CreatedAt, &p.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		out = append(out, p)
+	}
+	return out, nil
+}
+
+// FindGroupPermission returns the bucket_group_permissions row for (bucketID, groupID).
+func (r *BucketRepository) FindGroupPermission(ctx context.Context, bucketID, groupID string) (*model.BucketGroupPermission, error) {
+	row := r.db.QueryRow(ctx, `
+		SELECT id, bucket_id, group_id, notes,
+		       perm_modify, perm_manage_authorization, perm_destroy,
+		       perm_view_content, perm_manage_content,
+		       created_at, updated_at
+		FROM bucket_group_permissions
+		WHERE bucket_id=$1 AND group_id=$2
+	`, bucketID, groupID)
+	var p model.BucketGroupPermission
+	if err := row.Scan(
+		&p.ID, &p.BucketID, &p.GroupID, &p.Notes,
+		&p.PermModify, &p.PermManageAuthorization, &p.PermDestroy,
+		&p.PermViewContent, &p.PermManageContent,
+		&p.CreatedAt, &p.UpdatedAt,
+	); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// CreateGroupPermission inserts a new bucket_group_permissions row.
+func (r *BucketRepository) CreateGroupPermission(ctx context.Context, p *model.BucketGroupPermission) error {
+	_, err := r.db.Exec(ctx, `
+		INSERT INTO bucket_group_permissions (
+			bucket_id, group_id, notes,
+			perm_modify, perm_manage_authorization, perm_destroy,
+			perm_view_content, perm_manage_content
+		) VALUES ($1,$2,$3,$4,$5,$6,$7,$8)
+	`, p.BucketID, p.GroupID, p.Notes,
+		p.PermModify, p.PermManageAuthorization, p.PermDestroy,
+		p.PermViewContent, p.PermManageContent)
+	return err
+}
+
+// UpdateGroupPermission overwrites the five permission flags for the given bucket/group.
+func (r *BucketRepository) UpdateGroupPermission(ctx context.Context, p *model.BucketGroupPermission) error {
+	_, err := r.db.Exec(ctx, `
+		UPDATE bucket_group_permissions SET
+			perm_modify=$3, perm_manage_authorization=$4, perm_destroy=$5,
+			perm_view_content=$6, perm_manage_content=$7,
+			updated_at=NOW()
+		WHERE bucket_id=$1 AND group_id=$2
+	`, p.BucketID, p.GroupID,
+		p.PermModify, p.PermManageAuthorization, p.PermDestroy,
+		p.PermViewContent, p.PermManageContent)
+	return err
+}
+
+func (r *BucketRepository) DeleteGroupPermission(ctx context.Context, bucketID, groupID string) error {
+	_, err := r.db.Exec(ctx, `DELETE FROM bucket_group_permissions WHERE bucket_id=$1 AND group_id=$2`, bucketID, groupID)
+	return err
+}
+
+// UpdateOwner sets the bucket's created_by_user_id, which identifies its owner.
+func (r *BucketRepository) UpdateOwner(ctx context.Context, id, ownerUserID string) error {
+	_, err := r.db.Exec(ctx, `UPDATE buckets SET created_by_user_id=$2, updated_at=NOW() WHERE id=$1`, id, ownerUserID)
+	return err
+}
+
+// CountAuthorizationManagers returns the number of distinct users holding MANAGE_AUTHORIZATION on
+// the bucket, directly or through a group, ignoring the direct grant of excludeUserID and the grant
+// of excludeGroupID. Pass empty strings to exclude nothing.
+func (r *BucketRepository) CountAuthorizationManagers(ctx context.Context, bucketID, excludeUserID, excludeGroupID string) (int, error) {
+	var count int
+	err := r.db.QueryRow(ctx, `
+		SELECT COUNT(DISTINCT user_id) FROM (
+			SELECT user_id
+			FROM bucket_user_permissions
+			WHERE bucket_id=$1 AND perm_manage_authorization AND user_id <> $2
+			UNION
+			SELECT ugm.user_id
+			FROM bucket_group_permissions bgp
+			JOIN user_group_members ugm ON ugm.group_id = bgp.group_id
+			WHERE bgp.bucket_id=$1 AND bgp.perm_manage_authorization AND bgp.group_id <> $3
+		) managers
+	`, bucketID, excludeUserID, excludeGroupID).Scan(&count)
+	return count, err
+}
+
+// CountAuthorizationManagersWithoutMembership is CountAuthorizationManagers, ignoring only what
+// the user holds through its membership of the group.
+func (r *BucketRepository) CountAuthorizationManagersWithoutMembership(ctx context.Context, bucketID, groupID, userID string) (int, error) {
+	var count int
+	err := r.db.QueryRow(ctx, `
+		SELECT COUNT(DISTINCT user_id) FROM (
+			SELECT user_id
+			FROM bucket_user_permissions
+			WHERE bucket_id=$1 AND perm_manage_authorization
+			UNION
+			SELECT ugm.user_id
+			FROM bucket_group_permissions bgp
+			JOIN user_group_members ugm ON ugm.group_id = bgp.group_id
+			WHERE bgp.bucket_id=$1 AND bgp.perm_manage_authorization
+			  AND NOT (bgp.group_id = $2 AND ugm.user_id = $3)
+		) managers
+	`, bucketID, groupID, userID).Scan(&count)
+	return count, err
+}
+
+// ListBucketIDsManagedByGroup returns the buckets on which the group grants MANAGE_AUTHORIZATION.
+func (r *BucketRepository) ListBucketIDsManagedByGroup(ctx context.Context, groupID string) ([]string, error) {
+	rows, err := r.db.Query(ctx, `
+		SELECT bucket_id FROM bucket_group_permissions
+		WHERE group_id=$1 AND perm_manage_authorization
+		ORDER BY bucket_id
+	`, groupID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// lockBucketIDsManagedSolelyBy returns the buckets, other than those the user owns, on which the
+// user is the only holder of MANAGE_AUTHORIZATION, directly or through a group. The grants of
+// MANAGE_AUTHORIZATION on every bucket the user manages, and the memberships of the groups holding
+// them, are locked first, so that the answer holds until tx ends.
+func lockBucketIDsManagedSolelyBy(ctx context.Context, tx pgx.Tx, userID string) ([]string, error) {
+	const managed = `
+		WITH managed AS (
+			SELECT bucket_id FROM bucket_user_permissions WHERE user_id=$1 AND perm_manage_authorization
+			UNION
+			SELECT bgp.bucket_id
+			FROM bucket_group_permissions bgp
+			JOIN user_group_members ugm ON ugm.group_id = bgp.group_id
+			WHERE ugm.user_id=$1 AND bgp.perm_manage_authorization
+		)`
+	if _, err := tx.Exec(ctx, managed+`
+		SELECT 1 FROM bucket_user_permissions
+		WHERE perm_manage_authorization AND bucket_id IN (SELECT bucket_id FROM managed)
+		FOR UPDATE
+	`, userID); err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec(ctx, managed+`
+		SELECT 1
+		FROM bucket_group_permissions bgp
+		JOIN user_group_members ugm ON ugm.group_id = bgp.group_id
+		WHERE bgp.perm_manage_authorization AND bgp.bucket_id IN (SELECT bucket_id FROM managed)
+		FOR UPDATE
+	`, userID); err != nil {
+		return nil, err
+	}
+
+	rows, err := tx.Query(ctx, `
+		WITH managers AS (
+			SELECT bucket_id, user_id
+			FROM bucket_user_permissions
+			WHERE perm_manage_authorization
+			UNION
+			SELECT bgp.bucket_id, ugm.user_id
+			FROM bucket_group_permissions bgp
+			JOIN user_group_members ugm ON ugm.group_id = bgp.group_id
+			WHERE bgp.perm_manage_authorization
+		)
+		SELECT m.bucket_id
+		FROM managers m
+		JOIN buckets b ON b.id = m.bucket_id
+		WHERE b.created_by_user_id <> $1
+		GROUP BY m.bucket_id
+		HAVING bool_and(m.user_id = $1)
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
@@ -0,0 +1,120 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/nkrypt-xyz/nkrypt-xyz-web-server/internal/model"
+)
+
+type DirectoryPermissionRepository struct {
+	db *pgxpool.Pool
+}
+
+func NewDirectoryPermissionRepository(db *pgxpool.Pool) *DirectoryPermissionRepository {
+	return &DirectoryPermissionRepository{db: db}
+}
+
+// ListByDirectory returns every override set on a single directory.
+func (r *DirectoryPermissionRepository) ListByDirectory(ctx context.Context, bucketID, directoryID string) ([]model.DirectoryPermissionOverride, error) {
+	rows, err := r.db.Query(ctx, `
+		SELECT id, bucket_id, directory_id, user_id, group_id, notes,
+		       perm_view_content, perm_manage_content, created_at, updated_at
+		FROM directory_permission_overrides
+		WHERE bucket_id=$1 AND directory_id=$2
+		ORDER BY id
+	`, bucketID, directoryID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []model.DirectoryPermissionOverride
+	for rows.Next() {
+		var o model.DirectoryPermissionOverride
+		if err := rows.Scan(
+			&o.ID, &o.BucketID, &o.DirectoryID, &o.UserID, &o.GroupID, &o.Notes,
+			&o.PermViewContent, &o.PermManageContent, &o.CreatedAt, &o.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		out = append(out, o)
+	}
+	return out, nil
+}
+
+// ListForSubjects returns every override in the bucket that applies to the user directly or to
+// any of the given groups.
+func (r *DirectoryPermissionRepository) ListForSubjects(ctx context.Context, bucketID, userID string, groupIDs []string) ([]model.DirectoryPermissionOverride, error) {
+	if groupIDs == nil {
+		groupIDs = []string{}
+	}
+	rows, err := r.db.Query(ctx, `
+		SELECT id, bucket_id, directory_id, user_id, group_id, notes,
+		       perm_view_content, perm_manage_content, created_at, updated_at
+		FROM directory_permission_overrides
+		WHERE bucket_id=$1 AND (user_id=$2 OR group_id = ANY($3))
+	`, bucketID, userID, groupIDs)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []model.DirectoryPermissionOverride
+	for rows.Next() {
+		var o model.DirectoryPermissionOverride
+		if err := rows.Scan(
+			&o.ID, &o.BucketID, &o.DirectoryID, &o.UserID, &o.GroupID, &o.Notes,
+			&o.PermViewContent, &o.PermManageContent, &o.CreatedAt, &o.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		out = append(out, o)
+	}
+	return out, nil
+}
+
+// FindForSubject returns the override on a directory for the given user or group (pass nil for the other).
+func (r *DirectoryPermissionRepository) FindForSubject(ctx context.Context, bucketID, directoryID string, userID, groupID *string) (*model.DirectoryPermissionOverride, error) {
+	row := r.db.QueryRow(ctx, `
+		SELECT id, bucket_id, directory_id, user_id, group_id, notes,
+		       perm_view_content, perm_manage_content, created_at, updated_at
+		FROM directory_permission_overrides
+		WHERE bucket_id=$1 AND directory_id=$2
+		  AND user_id IS NOT DISTINCT FROM $3::char(16)
+		  AND group_id IS NOT DISTINCT FROM $4::char(16)
+	`, bucketID, directoryID, userID, groupID)
+	var o model.DirectoryPermissionOverride
+	if err := row.Scan(
+		&o.ID, &o.BucketID, &o.DirectoryID, &o.UserID, &o.GroupID, &o.Notes,
+		&o.PermViewContent, &o.PermManageContent, &o.CreatedAt, &o.UpdatedAt,
+	); err != nil {
+		return nil, err
+	}
+	return &o, nil
+}
+
+func (r *DirectoryPermissionRepository) Create(ctx context.Context, o *model.DirectoryPermissionOverride) error {
+	_, err := r.db.Exec(ctx, `
+		INSERT INTO directory_permission_overrides (
+			bucket_id, directory_id, user_id, group_id, notes,
+			perm_view_content, perm_manage_content
+		) VALUES ($1,$2,$3,$4,$5,$6,$7)
+	`, o.BucketID, o.DirectoryID, o.UserID, o.GroupID, o.Notes,
+		o.PermViewContent, o.PermManageContent)
+	return err
+}
+
+// Update overwrites the permission columns of an existing override.
+func (r *DirectoryPermissionRepository) Update(ctx context.Context, o *model.DirectoryPermissionOverride) error {
+	_, err := r.db.Exec(ctx, `
+		UPDATE directory_permission_overrides SET
+			perm_view_content=$2, perm_manage_content=$3, updated_at=NOW()
+		WHERE id=$1
+	`, o.ID, o.PermViewContent, o.PermManageContent)
+	return err
+}
+
+func (r *DirectoryPermissionRepository) Delete(ctx context.Context, id int64) error {
+	_, err := r.db.Exec(ctx, `DELETE FROM directory_permission_overrides WHERE id=$1`, id)
+	return err
+}
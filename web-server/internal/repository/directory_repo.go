@@ -19,13 +19,13 @@ func NewDirectoryRepository(db *pgxpool.Pool) *DirectoryRepository {
 func (r *DirectoryRepository) FindByID(ctx context.Context, bucketID, id string) (*model.Directory, error) {
 	row := r.db.QueryRow(ctx, `
 		SELECT id, bucket_id, parent_directory_id, name, meta_data, encrypted_meta_data,
-		       created_by_user_id, created_at, updated_at
+		       created_by_user_id, created_at, updated_at, version
 		FROM directories WHERE bucket_id=$1 AND id=$2
 	`, bucketID, id)
 	var d model.Directory
 	if err := row.Scan(
 		&d.ID, &d.BucketID, &d.ParentDirectoryID, &d.Name, &d.MetaData, &d.EncryptedMetaData,
-		&d.CreatedByUserID, &d.CreatedAt, &d.UpdatedAt,
+		&d.CreatedByUserID, &d.CreatedAt, &d.UpdatedAt, &d.Version,
 	); err != nil {
 		return nil, err
 	}
@@ -35,14 +35,14 @@ func (r *DirectoryRepository) FindByID(ctx context.Context, bucketID, id string)
 func (r *DirectoryRepository) FindByNameAndParent(ctx context.Context, name, bucketID string, parentDirID *string) (*model.Directory, error) {
 	row := r.db.QueryRow(ctx, `
 		SELECT id, bucket_id, parent_directory_id, name, meta_data, encrypted_meta_data,
-		       created_by_user_id, created_at, updated_at
+		       created_by_user_id, created_at, updated_at, version
 		FROM directories
 		WHERE bucket_id=$1 AND name=$2 AND (($3::char(16) IS NULL AND parent_directory_id IS NULL) OR (parent_directory_id = $3))
 	`, bucketID, name, parentDirID)
 	var d model.Directory
 	if err := row.Scan(
 		&d.ID, &d.BucketID, &d.ParentDirectoryID, &d.Name, &d.MetaData, &d.EncryptedMetaData,
-		&d.CreatedByUserID, &d.CreatedAt, &d.UpdatedAt,
+		&d.CreatedByUserID, &d.CreatedAt, &d.UpdatedAt, &d.Version,
 	); err != nil {
 		return nil, err
 	}
@@ -52,14 +52,14 @@ func (r *DirectoryRepository) FindByNameAndParent(ctx context.Context, name, buc
 func (r *DirectoryRepository) FindRootByBucketID(ctx context.Context, bucketID string) (*model.Directory, error) {
 	row := r.db.QueryRow(ctx, `
 		SELECT id, bucket_id, parent_directory_id, name, meta_data, encrypted_meta_data,
-		       created_by_user_id, created_at, updated_at
+		       created_by_user_id, created_at, updated_at, version
 		FROM directories
 		WHERE bucket_id=$1 AND parent_directory_id IS NULL
 	`, bucketID)
 	var d model.Directory
 	if err := row.Scan(
 		&d.ID, &d.BucketID, &d.ParentDirectoryID, &d.Name, &d.MetaData, &d.EncryptedMetaData,
-		&d.CreatedByUserID, &d.CreatedAt, &d.UpdatedAt,
+		&d.CreatedByUserID, &d.CreatedAt, &d.UpdatedAt, &d.Version,
 	); err != nil {
 		return nil, err
 	}
@@ -72,7 +72,7 @@ func (r *DirectoryRepository) ListRootsByBucketIDs(ctx context.Context, bucketID
 	}
 	rows, err := r.db.Query(ctx, `
 		SELECT id, bucket_id, parent_directory_id, name, meta_data, encrypted_meta_data,
-		       created_by_user_id, created_at, updated_at
+		       created_by_user_id, created_at, updated_at, version
 		FROM directories
 		WHERE bucket_id = ANY($1) AND parent_directory_id IS NULL
 	`, bucketIDs)
@@ -85,7 +85,7 @@ func (r *DirectoryRepository) ListRootsByBucketIDs(ctx context.Context, bucketID
 		var d model.Directory
 		if err := rows.Scan(
 			&d.ID, &d.BucketID, &d.ParentDirectoryID, &d.Name, &d.MetaData, &d.EncryptedMetaData,
-			&d.CreatedByUserID, &d.CreatedAt, &d.UpdatedAt,
+			&d.CreatedByUserID, &d.CreatedAt, &d.UpdatedAt, &d.Version,
 		); err != nil {
 			return nil, err
 		}
@@ -97,7 +97,7 @@ func (r *DirectoryRepository) ListRootsByBucketIDs(ctx context.Context, bucketID
 func (r *DirectoryRepository) ListChildDirectories(ctx context.Context, bucketID, parentDirID string) ([]model.Directory, error) {
 	rows, err := r.db.Query(ctx, `
 		SELECT id, bucket_id, parent_directory_id, name, meta_data, encrypted_meta_data,
-		       created_by_user_id, created_at, updated_at
+		       created_by_user_id, created_at, updated_at, version
 		FROM directories
 		WHERE bucket_id=$1 AND parent_directory_id=$2
 		ORDER BY name
@@ -111,7 +111,7 @@ func (r *DirectoryRepository) ListChildDirectories(ctx context.Context, bucketID
 		var d model.Directory
 		if err := rows.Scan(
 			&d.ID, &d.BucketID, &d.ParentDirectoryID, &d.Name, &d.MetaData, &d.EncryptedMetaData,
-			&d.CreatedByUserID, &d.CreatedAt, &d.UpdatedAt,
+			&d.CreatedByUserID, &d.CreatedAt, &d.UpdatedAt, &d.Version,
 		); err != nil {
 			return nil, err
 		}
@@ -120,6 +120,57 @@ func (r *DirectoryRepository) ListChildDirectories(ctx context.Context, bucketID
 	return out, nil
 }
 
+// ListParentIDs maps the ID of every directory in the bucket to that of its parent, or to "" for
+// the root directory.
+func (r *DirectoryRepository) ListParentIDs(ctx context.Context, bucketID string) (map[string]string, error) {
+	rows, err := r.db.Query(ctx, `
+		SELECT id, COALESCE(parent_directory_id, '') FROM directories WHERE bucket_id=$1
+	`, bucketID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	parents := make(map[string]string)
+	for rows.Next() {
+		var id, parentID string
+		if err := rows.Scan(&id, &parentID); err != nil {
+			return nil, err
+		}
+		parents[id] = parentID
+	}
+	return parents, nil
+}
+
+// ListAncestorIDs returns the IDs on the path from the bucket's root directory down to and
+// including the given directory. Returns an empty slice when the directory is not in the bucket.
+func (r *DirectoryRepository) ListAncestorIDs(ctx context.Context, bucketID, id string) ([]string, error) {
+	rows, err := r.db.Query(ctx, `
+		WITH RECURSIVE chain AS (
+			SELECT id, parent_directory_id, 0 AS depth
+			FROM directories WHERE bucket_id=$1 AND id=$2
+			UNION ALL
+			SELECT d.id, d.parent_directory_id, c.depth + 1
+			FROM directories d
+			JOIN chain c ON d.id = c.parent_directory_id
+			WHERE d.bucket_id=$1
+		)
+		SELECT id FROM chain ORDER BY depth DESC
+	`, bucketID, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var ids []string
+	for rows.Next() {
+		var dirID string
+		if err := rows.Scan(&dirID); err != nil {
+			return nil, err
+		}
+		ids = append(ids, dirID)
+	}
+	return ids, nil
+}
+
 func (r *DirectoryRepository) Create(ctx context.Context, d *model.Directory) error {
 	_, err := r.db.Exec(ctx, `
 		INSERT INTO directories (id, bucket_id, parent_directory_id, name, meta_data, encrypted_meta_data, created_by_user_id)
@@ -128,27 +179,44 @@ func (r *DirectoryRepository) Create(ctx context.Context, d *model.Directory) er
 	return err
 }
 
-func (r *DirectoryRepository) UpdateName(ctx context.Context, bucketID, id, name string) error {
-	_, err := r.db.Exec(ctx, `UPDATE directories SET name=$3, updated_at=NOW() WHERE bucket_id=$1 AND id=$2`, bucketID, id, name)
-	return err
+// UpdateName renames the directory if its version is expectedVersion (0 for any) and returns the
+// new version. Fails with ErrVersionConflict otherwise.
+func (r *DirectoryRepository) UpdateName(ctx context.Context, bucketID, id, name string, expectedVersion int64) (int64, error) {
+	return updateVersioned(ctx, r.db, `
+		UPDATE directories SET name=$3, version=version+1, updated_at=NOW()
+		WHERE bucket_id=$1 AND id=$2 AND `+versionCondition("$4")+`
+		RETURNING version
+	`, bucketID, id, name, expectedVersion)
 }
 
-func (r *DirectoryRepository) UpdateMetaData(ctx context.Context, bucketID, id string, metaData []byte) error {
-	_, err := r.db.Exec(ctx, `UPDATE directories SET meta_data=$3, updated_at=NOW() WHERE bucket_id=$1 AND id=$2`, bucketID, id, metaData)
-	return err
+// UpdateMetaData replaces the directory's metadata if its version is expectedVersion (0 for any)
+// and returns the new version. Fails with ErrVersionConflict otherwise.
+func (r *DirectoryRepository) UpdateMetaData(ctx context.Context, bucketID, id string, metaData []byte, expectedVersion int64) (int64, error) {
+	return updateVersioned(ctx, r.db, `
+		UPDATE directories SET meta_data=$3, version=version+1, updated_at=NOW()
+		WHERE bucket_id=$1 AND id=$2 AND `+versionCondition("$4")+`
+		RETURNING version
+	`, bucketID, id, metaData, expectedVersion)
 }
 
-func (r *DirectoryRepository) UpdateEncryptedMetaData(ctx context.Context, bucketID, id, encryptedMetaData string) error {
-	_, err := r.db.Exec(ctx, `UPDATE directories SET encrypted_meta_data=$3, updated_at=NOW() WHERE bucket_id=$1 AND id=$2`, bucketID, id, encryptedMetaData)
-	return err
+// UpdateEncryptedMetaData replaces the directory's encrypted metadata if its version is
+// expectedVersion (0 for any) and returns the new version. Fails with ErrVersionConflict otherwise.
+func (r *DirectoryRepository) UpdateEncryptedMetaData(ctx context.Context, bucketID, id, encryptedMetaData string, expectedVersion int64) (int64, error) {
+	return updateVersioned(ctx, r.db, `
+		UPDATE directories SET encrypted_meta_data=$3, version=version+1, updated_at=NOW()
+		WHERE bucket_id=$1 AND id=$2 AND `+versionCondition("$4")+`
+		RETURNING version
+	`, bucketID, id, encryptedMetaData, expectedVersion)
 }
 
-func (r *DirectoryRepository) Move(ctx context.Context, bucketID, id string, newParentID *string, newName string) error {
-	_, err := r.db.Exec(ctx, `
-		UPDATE directories SET parent_directory_id=$3, name=$4, updated_at=NOW()
-		WHERE bucket_id=$1 AND id=$2
-	`, bucketID, id, newParentID, newName)
-	return err
+// Move moves and renames the directory if its version is expectedVersion (0 for any) and returns
+// the new version. Fails with ErrVersionConflict otherwise.
+func (r *DirectoryRepository) Move(ctx context.Context, bucketID, id string, newParentID *string, newName string, expectedVersion int64) (int64, error) {
+	return updateVersioned(ctx, r.db, `
+		UPDATE directories SET parent_directory_id=$3, name=$4, version=version+1, updated_at=NOW()
+		WHERE bucket_id=$1 AND id=$2 AND `+versionCondition("$5")+`
+		RETURNING version
+	`, bucketID, id, newParentID, newName, expectedVersion)
 }
 
 func (r *DirectoryRepository) Delete(ctx context.Context, bucketID, id string) error {
@@ -19,13 +19,13 @@ func NewFileRepository(db *pgxpool.Pool) *FileRepository {
 func (r *FileRepository) FindByID(ctx context.Context, bucketID, fileID string) (*model.File, error) {
 	row := r.db.QueryRow(ctx, `
 		SELECT id, bucket_id, parent_directory_id, name, meta_data, encrypted_meta_data,
-		       size_after_encryption_bytes, created_by_user_id, created_at, updated_at, content_updated_at
+		       size_after_encryption_bytes, created_by_user_id, created_at, updated_at, content_updated_at, version
 		FROM files WHERE bucket_id=$1 AND id=$2
 	`, bucketID, fileID)
 	var f model.File
 	if err := row.Scan(
 		&f.ID, &f.BucketID, &f.ParentDirectoryID, &f.Name, &f.MetaData, &f.EncryptedMetaData,
-		&f.SizeAfterEncryptionBytes, &f.CreatedByUserID, &f.CreatedAt, &f.UpdatedAt, &f.ContentUpdatedAt,
+		&f.SizeAfterEncryptionBytes, &f.CreatedByUserID, &f.CreatedAt, &f.UpdatedAt, &f.ContentUpdatedAt, &f.Version,
 	); err != nil {
 		return nil, err
 	}
@@ -35,7 +35,7 @@ func (r *FileRepository) FindByID(ctx context.Context, bucketID, fileID string)
 func (r *FileRepository) ListByDirectory(ctx context.Context, bucketID, parentDirID string) ([]model.File, error) {
 	rows, err := r.db.Query(ctx, `
 		SELECT id, bucket_id, parent_directory_id, name, meta_data, encrypted_meta_data,
-		       size_after_encryption_bytes, created_by_user_id, created_at, updated_at, content_updated_at
+		       size_after_encryption_bytes, created_by_user_id, created_at, updated_at, content_updated_at, version
 		FROM files
 		WHERE bucket_id=$1 AND parent_directory_id=$2
 		ORDER BY name
@@ -49,7 +49,7 @@ func (r *FileRepository) ListByDirectory(ctx context.Context, bucketID, parentDi
 		var f model.File
 		if err := rows.Scan(
 			&f.ID, &f.BucketID, &f.ParentDirectoryID, &f.Name, &f.MetaData, &f.EncryptedMetaData,
-			&f.SizeAfterEncryptionBytes, &f.CreatedByUserID, &f.CreatedAt, &f.UpdatedAt, &f.ContentUpdatedAt,
+			&f.SizeAfterEncryptionBytes, &f.CreatedByUserID, &f.CreatedAt, &f.UpdatedAt, &f.ContentUpdatedAt, &f.Version,
 		); err != nil {
 			return nil, err
 		}
@@ -61,14 +61,14 @@ func (r *FileRepository) ListByDirectory(ctx context.Context, bucketID, parentDi
 func (r *FileRepository) FindByNameAndParent(ctx context.Context, name, bucketID, parentDirID string) (*model.File, error) {
 	row := r.db.QueryRow(ctx, `
 		SELECT id, bucket_id, parent_directory_id, name, meta_data, encrypted_meta_data,
-		       size_after_encryption_bytes, created_by_user_id, created_at, updated_at, content_updated_at
+		       size_after_encryption_bytes, created_by_user_id, created_at, updated_at, content_updated_at, version
 		FROM files
 		WHERE bucket_id=$1 AND parent_directory_id=$2 AND name=$3
 	`, bucketID, parentDirID, name)
 	var f model.File
 	if err := row.Scan(
 		&f.ID, &f.BucketID, &f.ParentDirectoryID, &f.Name, &f.MetaData, &f.EncryptedMetaData,
-		&f.SizeAfterEncryptionBytes, &f.CreatedByUserID, &f.CreatedAt, &f.UpdatedAt, &f.ContentUpdatedAt,
+		&f.SizeAfterEncryptionBytes, &f.CreatedByUserID, &f.CreatedAt, &f.UpdatedAt, &f.ContentUpdatedAt, &f.Version,
 	); err != nil {
 		return nil, err
 	}
@@ -85,19 +85,34 @@ func (r *FileRepository) Create(ctx context.Context, f *model.File) error {
 	return err
 }
 
-func (r *FileRepository) UpdateName(ctx context.Context, bucketID, fileID, name string) error {
-	_, err := r.db.Exec(ctx, `UPDATE files SET name=$3, updated_at=NOW() WHERE bucket_id=$1 AND id=$2`, bucketID, fileID, name)
-	return err
+// UpdateName renames the file if its version is expectedVersion (0 for any) and returns the new
+// version. Fails with ErrVersionConflict otherwise.
+func (r *FileRepository) UpdateName(ctx context.Context, bucketID, fileID, name string, expectedVersion int64) (int64, error) {
+	return updateVersioned(ctx, r.db, `
+		UPDATE files SET name=$3, version=version+1, updated_at=NOW()
+		WHERE bucket_id=$1 AND id=$2 AND `+versionCondition("$4")+`
+		RETURNING version
+	`, bucketID, fileID, name, expectedVersion)
 }
 
-func (r *FileRepository) UpdateMetaData(ctx context.Context, bucketID, fileID string, metaData []byte) error {
-	_, err := r.db.Exec(ctx, `UPDATE files SET meta_data=$3, updated_at=NOW() WHERE bucket_id=$1 AND id=$2`, bucketID, fileID, metaData)
-	return err
+// UpdateMetaData replaces the file's metadata if its version is expectedVersion (0 for any) and
+// returns the new version. Fails with ErrVersionConflict otherwise.
+func (r *FileRepository) UpdateMetaData(ctx context.Context, bucketID, fileID string, metaData []byte, expectedVersion int64) (int64, error) {
+	return updateVersioned(ctx, r.db, `
+		UPDATE files SET meta_data=$3, version=version+1, updated_at=NOW()
+		WHERE bucket_id=$1 AND id=$2 AND `+versionCondition("$4")+`
+		RETURNING version
+	`, bucketID, fileID, metaData, expectedVersion)
 }
 
-func (r *FileRepository) UpdateEncryptedMetaData(ctx context.Context, bucketID, fileID, encryptedMetaData string) error {
-	_, err := r.db.Exec(ctx, `UPDATE files SET encrypted_meta_data=$3, updated_at=NOW() WHERE bucket_id=$1 AND id=$2`, bucketID, fileID, encryptedMetaData)
-	return err
+// UpdateEncryptedMetaData replaces the file's encrypted metadata if its version is expectedVersion
+// (0 for any) and returns the new version. Fails with ErrVersionConflict otherwise.
+func (r *FileRepository) UpdateEncryptedMetaData(ctx context.Context, bucketID, fileID, encryptedMetaData string, expectedVersion int64) (int64, error) {
+	return updateVersioned(ctx, r.db, `
+		UPDATE files SET encrypted_meta_data=$3, version=version+1, updated_at=NOW()
+		WHERE bucket_id=$1 AND id=$2 AND `+versionCondition("$4")+`
+		RETURNING version
+	`, bucketID, fileID, encryptedMetaData, expectedVersion)
 }
 
 func (r *FileRepository) UpdateSize(ctx context.Context, bucketID, fileID string, size int64) error {
@@ -110,12 +125,14 @@ func (r *FileRepository) UpdateContentUpdatedAt(ctx context.Context, bucketID, f
 	return err
 }
 
-func (r *FileRepository) Move(ctx context.Context, bucketID, fileID, newParentDirID, newName string) error {
-	_, err := r.db.Exec(ctx, `
-		UPDATE files SET parent_directory_id=$3, name=$4, updated_at=NOW()
-		WHERE bucket_id=$1 AND id=$2
-	`, bucketID, fileID, newParentDirID, newName)
-	return err
+// Move moves and renames the file if its version is expectedVersion (0 for any) and returns the
+// new version. Fails with ErrVersionConflict otherwise.
+func (r *FileRepository) Move(ctx context.Context, bucketID, fileID, newParentDirID, newName string, expectedVersion int64) (int64, error) {
+	return updateVersioned(ctx, r.db, `
+		UPDATE files SET parent_directory_id=$3, name=$4, version=version+1, updated_at=NOW()
+		WHERE bucket_id=$1 AND id=$2 AND `+versionCondition("$5")+`
+		RETURNING version
+	`, bucketID, fileID, newParentDirID, newName, expectedVersion)
 }
 
 func (r *FileRepository) Delete(ctx context.Context, bucketID, fileID string) error {
@@ -0,0 +1,131 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/nkrypt-xyz/nkrypt-xyz-web-server/internal/model"
+)
+
+type GroupRepository struct {
+	db *pgxpool.Pool
+}
+
+func NewGroupRepository(db *pgxpool.Pool) *GroupRepository {
+	return &GroupRepository{db: db}
+}
+
+func (r *GroupRepository) FindByID(ctx context.Context, id string) (*model.UserGroup, error) {
+	row := r.db.QueryRow(ctx, `
+		SELECT id, name, description, created_by_user_id, created_at, updated_at
+		FROM user_groups WHERE id=$1
+	`, id)
+	var g model.UserGroup
+	if err := row.Scan(&g.ID, &g.Name, &g.Description, &g.CreatedByUserID, &g.CreatedAt, &g.UpdatedAt); err != nil {
+		return nil, err
+	}
+	return &g, nil
+}
+
+func (r *GroupRepository) FindByName(ctx context.Context, name string) (*model.UserGroup, error) {
+	row := r.db.QueryRow(ctx, `
+		SELECT id, name, description, created_by_user_id, created_at, updated_at
+		FROM user_groups WHERE name=$1
+	`, name)
+	var g model.UserGroup
+	if err := row.Scan(&g.ID, &g.Name, &g.Description, &g.CreatedByUserID, &g.CreatedAt, &g.UpdatedAt); err != nil {
+		return nil, err
+	}
+	return &g, nil
+}
+
+func (r *GroupRepository) ListAll(ctx context.Context) ([]model.UserGroup, error) {
+	rows, err := r.db.Query(ctx, `
+		SELECT id, name, description, created_by_user_id, created_at, updated_at
+		FROM user_groups
+		ORDER BY name ASC
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []model.UserGroup
+	for rows.Next() {
+		var g model.UserGroup
+		if err := rows.Scan(&g.ID, &g.Name, &g.Description, &g.CreatedByUserID, &g.CreatedAt, &g.UpdatedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, g)
+	}
+	return out, nil
+}
+
+func (r *GroupRepository) Create(ctx context.Context, g *model.UserGroup) error {
+	_, err := r.db.Exec(ctx, `
+		INSERT INTO user_groups (id, name, description, created_by_user_id)
+		VALUES ($1,$2,$3,$4)
+	`, g.ID, g.Name, g.Description, g.CreatedByUserID)
+	return err
+}
+
+func (r *GroupRepository) Delete(ctx context.Context, id string) error {
+	_, err := r.db.Exec(ctx, `DELETE FROM user_groups WHERE id=$1`, id)
+	return err
+}
+
+// AddMember inserts a user_group_members row; adding an existing member is a no-op.
+func (r *GroupRepository) AddMember(ctx context.Context, groupID, userID string) error {
+	_, err := r.db.Exec(ctx, `
+		INSERT INTO user_group_members (group_id, user_id)
+		VALUES ($1,$2)
+		ON CONFLICT (group_id, user_id) DO NOTHING
+	`, groupID, userID)
+	return err
+}
+
+func (r *GroupRepository) RemoveMember(ctx context.Context, groupID, userID string) error {
+	_, err := r.db.Exec(ctx, `DELETE FROM user_group_members WHERE group_id=$1 AND user_id=$2`, groupID, userID)
+	return err
+}
+
+// ListMembers returns all membership rows for a group.
+func (r *GroupRepository) ListMembers(ctx context.Context, groupID string) ([]model.UserGroupMember, error) {
+	rows, err := r.db.Query(ctx, `
+		SELECT group_id, user_id, created_at
+		FROM user_group_members
+		WHERE group_id=$1
+		ORDER BY created_at ASC
+	`, groupID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []model.UserGroupMember
+	for rows.Next() {
+		var m model.UserGroupMember
+		if err := rows.Scan(&m.GroupID, &m.UserID, &m.CreatedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, m)
+	}
+	return out, nil
+}
+
+// ListGroupIDsByUserID returns the IDs of all groups the user is a member of.
+func (r *GroupRepository) ListGroupIDsByUserID(ctx context.Context, userID string) ([]string, error) {
+	rows, err := r.db.Query(ctx, `SELECT group_id FROM user_group_members WHERE user_id=$1`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
@@ -0,0 +1,187 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/nkrypt-xyz/nkrypt-xyz-web-server/internal/model"
+)
+
+type InvitationRepository struct {
+	db *pgxpool.Pool
+}
+
+func NewInvitationRepository(db *pgxpool.Pool) *InvitationRepository {
+	return &InvitationRepository{db: db}
+}
+
+const invitationColumns = `
+	id, token_hash, created_by_user_id, notes,
+	perm_manage_all_user, perm_create_user, perm_create_bucket,
+	expires_at, redeemed_at, redeemed_by_user_id, created_at`
+
+type invitationScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanInvitation(row invitationScanner) (*model.Invitation, error) {
+	var inv model.Invitation
+	if err := row.Scan(
+		&inv.ID, &inv.TokenHash, &inv.CreatedByUserID, &inv.Notes,
+		&inv.PermManageAllUser, &inv.PermCreateUser, &inv.PermCreateBucket,
+		&inv.ExpiresAt, &inv.RedeemedAt, &inv.RedeemedByUserID, &inv.CreatedAt,
+	); err != nil {
+		return nil, err
+	}
+	return &inv, nil
+}
+
+func (r *InvitationRepository) FindByID(ctx context.Context, id string) (*model.Invitation, error) {
+	return scanInvitation(r.db.QueryRow(ctx, `SELECT `+invitationColumns+` FROM invitations WHERE id=$1`, id))
+}
+
+func (r *InvitationRepository) FindByTokenHash(ctx context.Context, tokenHash string) (*model.Invitation, error) {
+	return scanInvitation(r.db.QueryRow(ctx, `SELECT `+invitationColumns+` FROM invitations WHERE token_hash=$1`, tokenHash))
+}
+
+// List returns invitations newest first. An empty createdByUserID lists every invitation.
+func (r *InvitationRepository) List(ctx context.Context, createdByUserID string) ([]model.Invitation, error) {
+	rows, err := r.db.Query(ctx, `
+		SELECT `+invitationColumns+`
+		FROM invitations
+		WHERE $1::text = '' OR created_by_user_id = $1
+		ORDER BY created_at DESC
+	`, createdByUserID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []model.Invitation
+	for rows.Next() {
+		inv, err := scanInvitation(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, *inv)
+	}
+	return out, nil
+}
+
+// Create inserts an invitation along with its bucket grants, in a single transaction.
+func (r *InvitationRepository) Create(ctx context.Context, inv *model.Invitation, grants []model.InvitationBucketGrant) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	if _, err := tx.Exec(ctx, `
+		INSERT INTO invitations (
+			id, token_hash, created_by_user_id, notes,
+			perm_manage_all_user, perm_create_user, perm_create_bucket,
+			expires_at
+		) VALUES ($1,$2,$3,$4,$5,$6,$7,$8)
+	`, inv.ID, inv.TokenHash, inv.CreatedByUserID, inv.Notes,
+		inv.PermManageAllUser, inv.PermCreateUser, inv.PermCreateBucket,
+		inv.ExpiresAt); err != nil {
+		return err
+	}
+	for _, g := range grants {
+		if _, err := tx.Exec(ctx, `
+			INSERT INTO invitation_bucket_grants (
+				invitation_id, bucket_id,
+				perm_modify, perm_manage_authorization, perm_destroy,
+				perm_view_content, perm_manage_content
+			) VALUES ($1,$2,$3,$4,$5,$6,$7)
+		`, inv.ID, g.BucketID,
+			g.PermModify, g.PermManageAuthorization, g.PermDestroy,
+			g.PermViewContent, g.PermManageContent); err != nil {
+			return err
+		}
+	}
+	return tx.Commit(ctx)
+}
+
+func (r *InvitationRepository) Delete(ctx context.Context, id string) error {
+	_, err := r.db.Exec(ctx, `DELETE FROM invitations WHERE id=$1`, id)
+	return err
+}
+
+// Redeem creates the invitee's account, marks the invitation as redeemed by it and grants the
+// account the given bucket permissions, in a single transaction. It returns false, creating
+// nothing, if the invitation was already redeemed or has expired, so that concurrent redemptions
+// cannot both succeed.
+func (r *InvitationRepository) Redeem(ctx context.Context, id string, u *model.User, grants []model.BucketPermission) (bool, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	tag, err := tx.Exec(ctx, `
+		UPDATE invitations SET redeemed_at=NOW()
+		WHERE id=$1 AND redeemed_at IS NULL AND expires_at > NOW()
+	`, id)
+	if err != nil {
+		return false, err
+	}
+	if tag.RowsAffected() != 1 {
+		return false, nil
+	}
+	if _, err := tx.Exec(ctx, `
+		INSERT INTO users (
+			id, display_name, user_name, password_hash, password_salt,
+			is_banned, perm_manage_all_user, perm_create_user, perm_create_bucket
+		) VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9)
+	`,
+		u.ID, u.DisplayName, u.UserName, u.PasswordHash, u.PasswordSalt,
+		u.IsBanned, u.PermManageAllUser, u.PermCreateUser, u.PermCreateBucket,
+	); err != nil {
+		return false, err
+	}
+	if _, err := tx.Exec(ctx, `UPDATE invitations SET redeemed_by_user_id=$2 WHERE id=$1`, id, u.ID); err != nil {
+		return false, err
+	}
+	for _, p := range grants {
+		if _, err := tx.Exec(ctx, `
+			INSERT INTO bucket_user_permissions (
+				bucket_id, user_id, notes,
+				perm_modify, perm_manage_authorization, perm_destroy,
+				perm_view_content, perm_manage_content
+			) VALUES ($1,$2,$3,$4,$5,$6,$7,$8)
+		`, p.BucketID, u.ID, p.Notes,
+			p.PermModify, p.PermManageAuthorization, p.PermDestroy,
+			p.PermViewContent, p.PermManageContent); err != nil {
+			return false, err
+		}
+	}
+	return true, tx.Commit(ctx)
+}
+
+func (r *InvitationRepository) ListBucketGrants(ctx context.Context, invitationID string) ([]model.InvitationBucketGrant, error) {
+	rows, err := r.db.Query(ctx, `
+		SELECT invitation_id, bucket_id,
+		       perm_modify, perm_manage_authorization, perm_destroy,
+		       perm_view_content, perm_manage_content
+		FROM invitation_bucket_grants
+		WHERE invitation_id=$1
+	`, invitationID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []model.InvitationBucketGrant
+	for rows.Next() {
+		var g model.InvitationBucketGrant
+		if err := rows.Scan(
+			&g.InvitationID, &g.BucketID,
+			&g.PermModify, &g.PermManageAuthorization, &g.PermDestroy,
+			&g.PermViewContent, &g.PermManageContent,
+		); err != nil {
+			return nil, err
+		}
+		out = append(out, g)
+	}
+	return out, nil
+}
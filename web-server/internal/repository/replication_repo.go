@@ -0,0 +1,98 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/nkrypt-xyz/nkrypt-xyz-web-server/internal/model"
+)
+
+type ReplicationRepository struct {
+	db *pgxpool.Pool
+}
+
+func NewReplicationRepository(db *pgxpool.Pool) *ReplicationRepository {
+	return &ReplicationRepository{db: db}
+}
+
+// Enqueue queues an operation for each object key, replacing a queued operation on the same key.
+// A replaced operation keeps its enqueued_at, so that the lag covers the oldest unreplicated change.
+func (r *ReplicationRepository) Enqueue(ctx context.Context, operation string, keys []string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	_, err := r.db.Exec(ctx, `
+		INSERT INTO replication_queue (object_key, operation)
+		SELECT DISTINCT unnest($1::text[]), $2
+		ON CONFLICT (object_key) DO UPDATE
+		SET operation=EXCLUDED.operation, version=replication_queue.version + 1,
+			attempts=0, last_error=NULL, next_attempt_at=NOW()
+	`, keys, operation)
+	return err
+}
+
+// Claim takes up to limit due operations, oldest first, and keeps other workers from taking them
+// for claimTTL. Operations claimed by a worker that stopped are taken again once the claim ends.
+func (r *ReplicationRepository) Claim(ctx context.Context, limit int, claimTTL time.Duration) ([]model.ReplicationTask, error) {
+	rows, err := r.db.Query(ctx, `
+		UPDATE replication_queue
+		SET claimed_until=NOW() + make_interval(secs => $2), attempts=attempts + 1
+		WHERE object_key IN (
+			SELECT object_key FROM replication_queue
+			WHERE next_attempt_at <= NOW() AND (claimed_until IS NULL OR claimed_until < NOW())
+			ORDER BY enqueued_at
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING object_key, operation, version, attempts, last_error, enqueued_at, next_attempt_at
+	`, limit, claimTTL.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (model.ReplicationTask, error) {
+		var t model.ReplicationTask
+		err := row.Scan(&t.ObjectKey, &t.Operation, &t.Version, &t.Attempts, &t.LastError, &t.EnqueuedAt, &t.NextAttemptAt)
+		return t, err
+	})
+}
+
+// Complete removes a replicated operation. If a newer operation replaced it meanwhile, that one is
+// kept and only the claim is released.
+func (r *ReplicationRepository) Complete(ctx context.Context, task *model.ReplicationTask) error {
+	tag, err := r.db.Exec(ctx, `DELETE FROM replication_queue WHERE object_key=$1 AND version=$2`, task.ObjectKey, task.Version)
+	if err != nil || tag.RowsAffected() > 0 {
+		return err
+	}
+	_, err = r.db.Exec(ctx, `UPDATE replication_queue SET claimed_until=NULL WHERE object_key=$1`, task.ObjectKey)
+	return err
+}
+
+// Fail records a failed attempt and schedules the next one after retryAfter. If a newer operation
+// replaced it meanwhile, that one is due at once instead.
+func (r *ReplicationRepository) Fail(ctx context.Context, task *model.ReplicationTask, message string, retryAfter time.Duration) error {
+	_, err := r.db.Exec(ctx, `
+		UPDATE replication_queue
+		SET claimed_until=NULL,
+			last_error=CASE WHEN version=$2 THEN $3 ELSE last_error END,
+			next_attempt_at=CASE WHEN version=$2 THEN NOW() + make_interval(secs => $4) ELSE next_attempt_at END
+		WHERE object_key=$1
+	`, task.ObjectKey, task.Version, message, retryAfter.Seconds())
+	return err
+}
+
+// Status counts the queued operations and measures how long the oldest has waited.
+func (r *ReplicationRepository) Status(ctx context.Context) (*model.ReplicationStatus, error) {
+	var s model.ReplicationStatus
+	err := r.db.QueryRow(ctx, `
+		SELECT COUNT(*), COUNT(*) FILTER (WHERE last_error IS NOT NULL),
+			COALESCE(EXTRACT(EPOCH FROM NOW() - MIN(enqueued_at)), 0)::float8
+		FROM replication_queue
+	`).Scan(&s.Queued, &s.Retrying, &s.LagSeconds)
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
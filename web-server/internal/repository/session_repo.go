@@ -2,6 +2,7 @@ package repository
 
 import (
 	"context"
+	"time"
 
 	"github.com/jackc/pgx/v5/pgxpool"
 
@@ -97,3 +98,42 @@ func (r *SessionRepository) ExpireAllSessionsByUserID(ctx context.Context, userI
 	return err
 }
 
+
+// ListSessions lists the newest sessions, of one user if userID is set, optionally including
+// expired ones.
+func (r *SessionRepository) ListSessions(ctx context.Context, userID string, includeExpired bool, limit int32) ([]model.Session, error) {
+	rows, err := r.db.Query(ctx, `
+		SELECT id, user_id, api_key_hash, has_expired, expired_at, expire_reason,
+		       created_at, updated_at
+		FROM sessions
+		WHERE ($1 = '' OR user_id=$1) AND ($2 OR has_expired=false)
+		ORDER BY created_at DESC
+		LIMIT $3
+	`, userID, includeExpired, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []model.Session
+	for rows.Next() {
+		var s model.Session
+		if err := rows.Scan(
+			&s.ID, &s.UserID, &s.APIKeyHash, &s.HasExpired, &s.ExpiredAt, &s.ExpireReason,
+			&s.CreatedAt, &s.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		out = append(out, s)
+	}
+	return out, nil
+}
+
+// CountActiveSessions counts the sessions created after since that have not been expired.
+func (r *SessionRepository) CountActiveSessions(ctx context.Context, since time.Time) (int64, error) {
+	var count int64
+	err := r.db.QueryRow(ctx, `
+		SELECT COUNT(*) FROM sessions WHERE has_expired=false AND created_at > $1
+	`, since).Scan(&count)
+	return count, err
+}
@@ -0,0 +1,283 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/nkrypt-xyz/nkrypt-xyz-web-server/internal/model"
+)
+
+// snapshotTables lists the tables of a snapshot, each after the tables it references. A table
+// without a query is copied whole.
+var snapshotTables = []struct {
+	name  string
+	query string
+}{
+	{name: "users"},
+	{name: "sessions"},
+	{name: "buckets"},
+	{name: "bucket_user_permissions"},
+	// Parents before children, as the foreign key is checked row by row
+	{name: "directories", query: `
+		WITH RECURSIVE tree AS (
+			SELECT id, 0 AS depth FROM directories WHERE parent_directory_id IS NULL
+			UNION ALL
+			SELECT d.id, t.depth + 1 FROM directories d JOIN tree t ON d.parent_directory_id = t.id
+		)
+		SELECT d.* FROM directories d JOIN tree t ON t.id = d.id ORDER BY t.depth, d.id`},
+	{name: "files"},
+	// Only finished blobs, the current content of files, are restored
+	{name: "blob_contents", query: `
+		SELECT * FROM blob_contents
+		WHERE sha256 IN (SELECT content_sha256 FROM blobs WHERE status = 'finished')`},
+	{name: "blobs", query: `SELECT * FROM blobs WHERE status = 'finished'`},
+	{name: "user_groups"},
+	{name: "user_group_members"},
+	{name: "bucket_group_permissions"},
+	{name: "directory_permission_overrides"},
+	{name: "invitations"},
+	{name: "invitation_bucket_grants"},
+}
+
+// unsnapshottedTables are left out of snapshots: the migration state, which is restored by
+// migrating, upload sessions, whose blobs are not finished, and the replication queue, which
+// belongs to the replica of the instance the snapshot was taken from.
+var unsnapshottedTables = []string{"schema_migrations", "blob_uploads", "blob_upload_parts", "replication_queue"}
+
+// SnapshotTables returns the tables of a snapshot in the order they must be restored.
+func SnapshotTables() []string {
+	names := make([]string, 0, len(snapshotTables))
+	for _, t := range snapshotTables {
+		names = append(names, t.name)
+	}
+	return names
+}
+
+type SnapshotRepository struct {
+	db *pgxpool.Pool
+}
+
+func NewSnapshotRepository(db *pgxpool.Pool) *SnapshotRepository {
+	return &SnapshotRepository{db: db}
+}
+
+// Snapshot reads the database as it was when the snapshot began.
+type Snapshot struct {
+	tx pgx.Tx
+}
+
+// BeginSnapshot starts a read-only repeatable-read transaction. Close must be called.
+func (r *SnapshotRepository) BeginSnapshot(ctx context.Context) (*Snapshot, error) {
+	tx, err := r.db.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.RepeatableRead, AccessMode: pgx.ReadOnly})
+	if err != nil {
+		return nil, err
+	}
+	return &Snapshot{tx: tx}, nil
+}
+
+func (s *Snapshot) Close() {
+	// The transaction only read, and the context may be cancelled by now
+	_ = s.tx.Rollback(context.Background())
+}
+
+// SchemaVersion returns the migration version of the snapshot.
+func (s *Snapshot) SchemaVersion(ctx context.Context) (int64, error) {
+	var version int64
+	var dirty bool
+	if err := s.tx.QueryRow(ctx, `SELECT version, dirty FROM schema_migrations LIMIT 1`).Scan(&version, &dirty); err != nil {
+		return 0, fmt.Errorf("read schema version: %w", err)
+	}
+	if dirty {
+		return 0, fmt.Errorf("the database is marked dirty at version %d", version)
+	}
+	return version, nil
+}
+
+// CheckTables fails if the database has a table that snapshots neither include nor leave out on
+// purpose, as one added by a migration would be.
+func (s *Snapshot) CheckTables(ctx context.Context) error {
+	rows, err := s.tx.Query(ctx, `SELECT table_name FROM information_schema.tables WHERE table_schema = 'public' AND table_type = 'BASE TABLE'`)
+	if err != nil {
+		return err
+	}
+	tables, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return err
+	}
+	known := append(SnapshotTables(), unsnapshottedTables...)
+	for _, table := range tables {
+		if !containsTable(known, table) {
+			return fmt.Errorf("table %s is not covered by snapshots", table)
+		}
+	}
+	return nil
+}
+
+// CopyTable writes the rows of a snapshot table to w as CSV with a header line, and returns the
+// number of rows.
+func (s *Snapshot) CopyTable(ctx context.Context, table string, w io.Writer) (int64, error) {
+	query := ""
+	for _, t := range snapshotTables {
+		if t.name == table {
+			query = t.query
+			if query == "" {
+				query = `SELECT * FROM ` + pgx.Identifier{t.name}.Sanitize()
+			}
+		}
+	}
+	if query == "" {
+		return 0, fmt.Errorf("table %s is not part of snapshots", table)
+	}
+	tag, err := s.tx.Conn().PgConn().CopyTo(ctx, w, `COPY (`+query+`) TO STDOUT WITH (FORMAT csv, HEADER)`)
+	if err != nil {
+		return 0, fmt.Errorf("copy table %s: %w", table, err)
+	}
+	return tag.RowsAffected(), nil
+}
+
+// ListFinishedBlobs returns the finished blobs of the snapshot.
+func (s *Snapshot) ListFinishedBlobs(ctx context.Context) ([]model.Blob, error) {
+	return listFinishedBlobs(ctx, s.tx)
+}
+
+// ListFinishedBlobs returns every finished blob.
+func (r *SnapshotRepository) ListFinishedBlobs(ctx context.Context) ([]model.Blob, error) {
+	return listFinishedBlobs(ctx, r.db)
+}
+
+func listFinishedBlobs(ctx context.Context, db interface {
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+}) ([]model.Blob, error) {
+	rows, err := db.Query(ctx, `SELECT `+blobColumns+` FROM blobs WHERE status = $1 ORDER BY id`, model.BlobStatusFinished)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []model.Blob
+	for rows.Next() {
+		b, err := scanBlob(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, *b)
+	}
+	return out, rows.Err()
+}
+
+// IsEmpty reports whether every snapshot table is empty. Tables that an older schema version
+// does not have yet are skipped.
+func (r *SnapshotRepository) IsEmpty(ctx context.Context) (bool, error) {
+	for _, table := range SnapshotTables() {
+		var exists bool
+		if err := r.db.QueryRow(ctx, `SELECT to_regclass($1) IS NOT NULL`, table).Scan(&exists); err != nil {
+			return false, err
+		}
+		if !exists {
+			continue
+		}
+		if err := r.db.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM `+pgx.Identifier{table}.Sanitize()+`)`).Scan(&exists); err != nil {
+			return false, err
+		}
+		if exists {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// ResetBlobLocations marks every blob as hot. A restore puts every object into the hot bucket,
+// whatever tier it was backed up from.
+func (r *SnapshotRepository) ResetBlobLocations(ctx context.Context) error {
+	_, err := r.db.Exec(ctx, `UPDATE blobs SET location=$1, location_changed_at=NULL WHERE location <> $1`, model.BlobLocationHot)
+	return err
+}
+
+// SnapshotRestore loads snapshot tables in one transaction.
+type SnapshotRestore struct {
+	tx pgx.Tx
+}
+
+// BeginRestore starts loading snapshot tables. Nothing is visible until Commit.
+func (r *SnapshotRepository) BeginRestore(ctx context.Context) (*SnapshotRestore, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &SnapshotRestore{tx: tx}, nil
+}
+
+// CopyIntoTable loads CSV rows, without a header line, into the given columns of a snapshot
+// table and returns the number of rows.
+func (s *SnapshotRestore) CopyIntoTable(ctx context.Context, table string, columns []string, r io.Reader) (int64, error) {
+	if !containsTable(SnapshotTables(), table) {
+		return 0, fmt.Errorf("table %s is not part of snapshots", table)
+	}
+	quoted := make([]string, len(columns))
+	for i, column := range columns {
+		quoted[i] = pgx.Identifier{column}.Sanitize()
+	}
+	sql := `COPY ` + pgx.Identifier{table}.Sanitize() + ` (` + strings.Join(quoted, ", ") + `) FROM STDIN WITH (FORMAT csv)`
+	tag, err := s.tx.Conn().PgConn().CopyFrom(ctx, r, sql)
+	if err != nil {
+		return 0, fmt.Errorf("load table %s: %w", table, err)
+	}
+	return tag.RowsAffected(), nil
+}
+
+// Commit makes the loaded tables visible. Content reference counts are recounted, since only
+// finished blobs were loaded, and sequences continue after the loaded IDs. The loaded sessions
+// are expired: their API keys were kept in Redis, not in the snapshot.
+func (s *SnapshotRestore) Commit(ctx context.Context) error {
+	statements := []string{
+		`UPDATE blob_contents c SET ref_count = (SELECT COUNT(*) FROM blobs b WHERE b.content_sha256 = c.sha256)`,
+		`UPDATE sessions SET has_expired = TRUE, expired_at = NOW(), expire_reason = 'Restored from a backup' WHERE NOT has_expired`,
+	}
+	for _, sql := range statements {
+		if _, err := s.tx.Exec(ctx, sql); err != nil {
+			return err
+		}
+	}
+
+	rows, err := s.tx.Query(ctx, `
+		SELECT table_name, column_name FROM information_schema.columns
+		WHERE table_schema = 'public' AND column_default LIKE 'nextval(%'`)
+	if err != nil {
+		return err
+	}
+	type serialColumn struct{ table, column string }
+	columns, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (serialColumn, error) {
+		var c serialColumn
+		err := row.Scan(&c.table, &c.column)
+		return c, err
+	})
+	if err != nil {
+		return err
+	}
+	for _, c := range columns {
+		table, column := pgx.Identifier{c.table}.Sanitize(), pgx.Identifier{c.column}.Sanitize()
+		_, err := s.tx.Exec(ctx, `SELECT setval(pg_get_serial_sequence($1, $2), COALESCE(MAX(`+column+`), 1), MAX(`+column+`) IS NOT NULL) FROM `+table, c.table, c.column)
+		if err != nil {
+			return fmt.Errorf("reset sequence of %s.%s: %w", c.table, c.column, err)
+		}
+	}
+	return s.tx.Commit(ctx)
+}
+
+// Rollback discards the loaded tables unless Commit succeeded.
+func (s *SnapshotRestore) Rollback() {
+	_ = s.tx.Rollback(context.Background())
+}
+
+func containsTable(tables []string, table string) bool {
+	for _, t := range tables {
+		if t == table {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,97 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/nkrypt-xyz/nkrypt-xyz-web-server/internal/model"
+)
+
+// UsageRepository aggregates file and directory counts and encrypted sizes.
+//
+// The stored size of a file is that of the object of its current blob, which is smaller than its
+// encrypted size if compressed. Files whose blob predates compression count at their encrypted
+// size.
+type UsageRepository struct {
+	db *pgxpool.Pool
+}
+
+func NewUsageRepository(db *pgxpool.Pool) *UsageRepository {
+	return &UsageRepository{db: db}
+}
+
+// UsageByUserID returns the usage of the files and directories the user created, across all
+// buckets. Root directories are not counted.
+func (r *UsageRepository) UsageByUserID(ctx context.Context, userID string) (*model.UsageStats, error) {
+	var u model.UsageStats
+	err := r.db.QueryRow(ctx, `
+		SELECT
+			(SELECT COUNT(*) FROM files WHERE created_by_user_id=$1),
+			(SELECT COUNT(*) FROM directories WHERE created_by_user_id=$1 AND parent_directory_id IS NOT NULL),
+			(SELECT COALESCE(SUM(size_after_encryption_bytes), 0) FROM files WHERE created_by_user_id=$1),
+			(SELECT COALESCE(SUM(COALESCE(b.stored_size_bytes, f.size_after_encryption_bytes)), 0)
+			 FROM files f LEFT JOIN blobs b ON b.file_id = f.id AND b.status = 'finished'
+			 WHERE f.created_by_user_id=$1)
+	`, userID).Scan(&u.FileCount, &u.DirectoryCount, &u.EncryptedBytes, &u.StoredBytes)
+	if err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+// ListBucketUsage returns the usage of each of the given buckets that exists. Root directories
+// are not counted.
+func (r *UsageRepository) ListBucketUsage(ctx context.Context, bucketIDs []string) ([]model.BucketUsage, error) {
+	rows, err := r.db.Query(ctx, `
+		SELECT b.id, b.name,
+		       COALESCE(f.file_count, 0), COALESCE(d.directory_count, 0), COALESCE(f.encrypted_bytes, 0),
+		       COALESCE(f.stored_bytes, 0)
+		FROM buckets b
+		LEFT JOIN (
+			SELECT fi.bucket_id, COUNT(*) AS file_count, SUM(fi.size_after_encryption_bytes) AS encrypted_bytes,
+			       SUM(COALESCE(bl.stored_size_bytes, fi.size_after_encryption_bytes)) AS stored_bytes
+			FROM files fi LEFT JOIN blobs bl ON bl.file_id = fi.id AND bl.status = 'finished'
+			WHERE fi.bucket_id = ANY($1)
+			GROUP BY fi.bucket_id
+		) f ON f.bucket_id = b.id
+		LEFT JOIN (
+			SELECT bucket_id, COUNT(*) AS directory_count
+			FROM directories WHERE bucket_id = ANY($1) AND parent_directory_id IS NOT NULL
+			GROUP BY bucket_id
+		) d ON d.bucket_id = b.id
+		WHERE b.id = ANY($1)
+	`, bucketIDs)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []model.BucketUsage
+	for rows.Next() {
+		var u model.BucketUsage
+		if err := rows.Scan(&u.BucketID, &u.Name, &u.Usage.FileCount, &u.Usage.DirectoryCount, &u.Usage.EncryptedBytes, &u.Usage.StoredBytes); err != nil {
+			return nil, err
+		}
+		out = append(out, u)
+	}
+	return out, nil
+}
+
+// DirectoryUsage returns the usage of the given directories of a bucket and of the files directly
+// in them. Root directories are not counted.
+func (r *UsageRepository) DirectoryUsage(ctx context.Context, bucketID string, directoryIDs []string) (*model.UsageStats, error) {
+	var u model.UsageStats
+	err := r.db.QueryRow(ctx, `
+		SELECT
+			(SELECT COUNT(*) FROM files WHERE bucket_id=$1 AND parent_directory_id = ANY($2)),
+			(SELECT COUNT(*) FROM directories WHERE bucket_id=$1 AND id = ANY($2) AND parent_directory_id IS NOT NULL),
+			(SELECT COALESCE(SUM(size_after_encryption_bytes), 0) FROM files WHERE bucket_id=$1 AND parent_directory_id = ANY($2)),
+			(SELECT COALESCE(SUM(COALESCE(b.stored_size_bytes, f.size_after_encryption_bytes)), 0)
+			 FROM files f LEFT JOIN blobs b ON b.file_id = f.id AND b.status = 'finished'
+			 WHERE f.bucket_id=$1 AND f.parent_directory_id = ANY($2))
+	`, bucketID, directoryIDs).Scan(&u.FileCount, &u.DirectoryCount, &u.EncryptedBytes, &u.StoredBytes)
+	if err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
@@ -181,3 +181,46 @@ func (r *UserRepository) QueryUsersByUserNames(ctx context.Context, names []stri
 }
 
 
+
+// DeleteUserTransferringOwnership deletes a user in a single transaction. Every created_by_user_id
+// reference is reassigned to transferToUserID, who is also granted every permission on the buckets
+// they now own. Sessions, bucket permissions, group memberships and invitations created by the
+// user are removed by the cascading foreign keys. Nothing is deleted if the user is the only
+// holder of MANAGE_AUTHORIZATION on buckets they do not own; the IDs of those are returned.
+func (r *UserRepository) DeleteUserTransferringOwnership(ctx context.Context, userID, transferToUserID string) ([]string, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	orphaned, err := lockBucketIDsManagedSolelyBy(ctx, tx, userID)
+	if err != nil || len(orphaned) > 0 {
+		return orphaned, err
+	}
+
+	if _, err := tx.Exec(ctx, `
+		INSERT INTO bucket_user_permissions (
+			bucket_id, user_id, notes,
+			perm_modify, perm_manage_authorization, perm_destroy,
+			perm_view_content, perm_manage_content
+		)
+		SELECT id, $2, 'Inherited ownership from a deleted user', TRUE, TRUE, TRUE, TRUE, TRUE
+		FROM buckets WHERE created_by_user_id=$1
+		ON CONFLICT (bucket_id, user_id) DO UPDATE SET
+			perm_modify=TRUE, perm_manage_authorization=TRUE, perm_destroy=TRUE,
+			perm_view_content=TRUE, perm_manage_content=TRUE,
+			updated_at=NOW()
+	`, userID, transferToUserID); err != nil {
+		return nil, err
+	}
+	for _, table := range []string{"buckets", "directories", "files", "blobs", "user_groups"} {
+		if _, err := tx.Exec(ctx, `UPDATE `+table+` SET created_by_user_id=$2 WHERE created_by_user_id=$1`, userID, transferToUserID); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM users WHERE id=$1`, userID); err != nil {
+		return nil, err
+	}
+	return nil, tx.Commit(ctx)
+}
@@ -0,0 +1,30 @@
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// ErrVersionConflict is returned by an update whose expected version is no longer the row's
+// version, because the row was changed or deleted since it was read.
+var ErrVersionConflict = errors.New("the row was changed since the expected version")
+
+// versionCondition restricts an UPDATE to the expected version held by the given parameter; an
+// expected version of 0 matches any version.
+func versionCondition(param string) string {
+	return `(` + param + `::bigint = 0 OR version = ` + param + `)`
+}
+
+// updateVersioned runs an UPDATE that increments the version and returns it, guarded by
+// versionCondition. An update matching no row fails with ErrVersionConflict.
+func updateVersioned(ctx context.Context, db *pgxpool.Pool, sql string, args ...any) (int64, error) {
+	var version int64
+	err := db.QueryRow(ctx, sql, args...).Scan(&version)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, ErrVersionConflict
+	}
+	return version, err
+}
@@ -11,22 +11,27 @@ import (
 	"github.com/nkrypt-xyz/nkrypt-xyz-web-server/internal/config"
 	"github.com/nkrypt-xyz/nkrypt-xyz-web-server/internal/handler"
 	"github.com/nkrypt-xyz/nkrypt-xyz-web-server/internal/middleware"
+	"github.com/nkrypt-xyz/nkrypt-xyz-web-server/internal/pkg/migrate"
+	"github.com/nkrypt-xyz/nkrypt-xyz-web-server/internal/pkg/storage"
 	"github.com/nkrypt-xyz/nkrypt-xyz-web-server/internal/service"
 )
 
 // New constructs the chi router with middleware and routes.
-func New(cfg *config.Config, db *pgxpool.Pool, redisClient *redis.Client, authSvc *service.AuthService, userHandler *handler.UserHandler, adminHandler *handler.AdminHandler, bucketHandler *handler.BucketHandler, directoryHandler *handler.DirectoryHandler, fileHandler *handler.FileHandler, blobHandler *handler.BlobHandler, metricsHandler *handler.MetricsHandler) http.Handler {
+func New(cfg *config.Config, db *pgxpool.Pool, redisClient *redis.Client, storageClient *storage.MinIOClient, migrator *migrate.Migrator, authSvc *service.AuthService, userHandler *handler.UserHandler, adminHandler *handler.AdminHandler, groupHandler *handler.GroupHandler, invitationHandler *handler.InvitationHandler, bucketHandler *handler.BucketHandler, directoryHandler *handler.DirectoryHandler, fileHandler *handler.FileHandler, blobHandler *handler.BlobHandler, metricsHandler *handler.MetricsHandler) http.Handler {
 	r := chi.NewRouter()
 
 	// Core middleware stack
 	r.Use(middleware.Recovery)
 	r.Use(middleware.RequestID)
+	r.Use(middleware.Tracing)
 	r.Use(middleware.Logging)
 	r.Use(middleware.CORS)
 
 	healthHandler := &handler.HealthHandler{
-		DB:    db,
-		Redis: redisClient,
+		DB:       db,
+		Redis:    redisClient,
+		Storage:  storageClient,
+		Migrator: migrator,
 	}
 
 	// Health probes
@@ -34,12 +39,14 @@ func New(cfg *config.Config, db *pgxpool.Pool, redisClient *redis.Client, authSv
 	r.Get("/readyz", healthHandler.Readyz)
 
 	// Prometheus metrics
-	r.Get("/metrics", promhttp.Handler().ServeHTTP)
+	r.With(middleware.BearerToken(cfg.Metrics.BearerToken)).Get("/metrics", promhttp.Handler().ServeHTTP)
 
 	// API routes
 	r.Route("/api", func(r chi.Router) {
 		// Public routes
 		r.Post("/user/login", userHandler.Login)
+		r.Post("/user/register", invitationHandler.Register)
+		r.Post("/user/redeem-invitation", invitationHandler.Redeem)
 
 		// Authenticated routes
 		r.Group(func(r chi.Router) {
@@ -60,14 +67,32 @@ func New(cfg *config.Config, db *pgxpool.Pool, redisClient *redis.Client, authSv
 			r.Post("/admin/iam/set-global-permissions", adminHandler.SetGlobalPermissions)
 			r.Post("/admin/iam/set-banning-status", adminHandler.SetBanningStatus)
 			r.Post("/admin/iam/overwrite-user-password", adminHandler.OverwriteUserPassword)
+			r.Post("/admin/iam/delete-user", adminHandler.DeleteUser)
+			r.Post("/admin/iam/create-group", groupHandler.Create)
+			r.Post("/admin/iam/delete-group", groupHandler.Delete)
+			r.Post("/admin/iam/add-group-member", groupHandler.AddMember)
+			r.Post("/admin/iam/remove-group-member", groupHandler.RemoveMember)
+			r.Post("/admin/iam/create-invitation", invitationHandler.Create)
+			r.Post("/admin/iam/list-invitations", invitationHandler.List)
+			r.Post("/admin/iam/revoke-invitation", invitationHandler.Revoke)
+
+			// Group endpoints
+			r.Post("/group/list", groupHandler.List)
 
 			// Bucket endpoints
 			r.Post("/bucket/create", bucketHandler.Create)
 			r.Post("/bucket/list", bucketHandler.List)
 			r.Post("/bucket/rename", bucketHandler.Rename)
 			r.Post("/bucket/set-metadata", bucketHandler.SetMetaData)
+			r.Post("/bucket/set-compression", bucketHandler.SetCompression)
 			r.Post("/bucket/set-authorization", bucketHandler.SetAuthorization)
+			r.Post("/bucket/set-group-authorization", bucketHandler.SetGroupAuthorization)
+			r.Post("/bucket/remove-member", bucketHandler.RemoveMember)
+			r.Post("/bucket/transfer-ownership", bucketHandler.TransferOwnership)
+			r.Post("/bucket/list-members", bucketHandler.ListMembers)
 			r.Post("/bucket/destroy", bucketHandler.Destroy)
+			r.Post("/bucket/export", bucketHandler.Export)
+			r.Post("/bucket/import", bucketHandler.Import)
 
 			// Directory endpoints
 			r.Post("/directory/create", directoryHandler.Create)
@@ -77,6 +102,9 @@ func New(cfg *config.Config, db *pgxpool.Pool, redisClient *redis.Client, authSv
 			r.Post("/directory/delete", directoryHandler.Delete)
 			r.Post("/directory/set-metadata", directoryHandler.SetMetaData)
 			r.Post("/directory/set-encrypted-metadata", directoryHandler.SetEncryptedMetaData)
+			r.Post("/directory/set-permission-override", directoryHandler.SetPermissionOverride)
+			r.Post("/directory/list-permission-overrides", directoryHandler.ListPermissionOverrides)
+			r.Post("/directory/get-effective-permissions", directoryHandler.GetEffectivePermissions)
 
 			// File endpoints
 			r.Post("/file/create", fileHandler.Create)
@@ -91,6 +119,11 @@ func New(cfg *config.Config, db *pgxpool.Pool, redisClient *redis.Client, authSv
 			r.Post("/blob/read/{bucketId}/{fileId}", blobHandler.Read)
 			r.Post("/blob/write/{bucketId}/{fileId}", blobHandler.Write)
 			r.Post("/blob/write-quantized/{bucketId}/{fileId}/{blobId}/{offset}/{shouldEnd}", blobHandler.WriteQuantized)
+			r.Post("/blob/upload/initiate", blobHandler.InitiateUpload)
+			r.Post("/blob/upload/part/{bucketId}/{fileId}/{blobId}/{partNumber}", blobHandler.UploadPart)
+			r.Post("/blob/upload/status", blobHandler.UploadStatus)
+			r.Post("/blob/upload/complete", blobHandler.CompleteUpload)
+			r.Post("/blob/upload/abort", blobHandler.AbortUpload)
 
 			// Metrics endpoints
 			r.Post("/metrics/get-summary", metricsHandler.GetSummary)
@@ -2,6 +2,7 @@ package service
 
 import (
 	"context"
+	"strconv"
 	"time"
 
 	"github.com/nkrypt-xyz/nkrypt-xyz-web-server/internal/config"
@@ -67,11 +68,47 @@ func (a *AdminService) CreateDefaultAdminIfNotExists(ctx context.Context) error
 	return a.userRepo.CreateUser(ctx, admin)
 }
 
+// ResetDefaultAdmin creates the default admin user, or restores an existing one: it sets the
+// password, lifts a ban, grants every global permission and expires all of its sessions. It
+// reports whether the user was created.
+func (a *AdminService) ResetDefaultAdmin(ctx context.Context, password string) (bool, error) {
+	u, err := a.userRepo.FindUserByUserName(ctx, a.cfg.IAM.DefaultAdminUsername)
+	if err != nil || u == nil {
+		_, err := a.CreateUser(ctx, a.cfg.IAM.DefaultAdminDisplayName, a.cfg.IAM.DefaultAdminUsername, password, true, true, true)
+		return err == nil, err
+	}
+
+	if err := a.userRepo.UpdateUserBanStatus(ctx, u.ID, false); err != nil {
+		return false, err
+	}
+	if err := a.userRepo.UpdateUserGlobalPermissions(ctx, u.ID, true, true, true); err != nil {
+		return false, err
+	}
+	return false, a.OverwriteUserPassword(ctx, u.ID, password)
+}
+
 // AddUser creates a new user with default permissions.
 func (a *AdminService) AddUser(ctx context.Context, displayName, userName, password string) (string, error) {
+	return a.CreateUser(ctx, displayName, userName, password, false, false, true)
+}
+
+// CreateUser creates a new user with the given global permissions.
+func (a *AdminService) CreateUser(ctx context.Context, displayName, userName, password string, manageAllUser, createUser, createBucket bool) (string, error) {
+	user, err := a.newUser(ctx, displayName, userName, password, manageAllUser, createUser, createBucket)
+	if err != nil {
+		return "", err
+	}
+	if err := a.userRepo.CreateUser(ctx, user); err != nil {
+		return "", err
+	}
+	return user.ID, nil
+}
+
+// newUser prepares a user with the given global permissions, without storing it.
+func (a *AdminService) newUser(ctx context.Context, displayName, userName, password string, manageAllUser, createUser, createBucket bool) (*model.User, error) {
 	// Check username uniqueness
 	if existing, _ := a.userRepo.FindUserByUserName(ctx, userName); existing != nil {
-		return "", apperror.NewUserError("DUPLICATE_USERNAME", "User name is already taken")
+		return nil, apperror.NewUserError("DUPLICATE_USERNAME", "User name is already taken")
 	}
 
 	hash, salt, err := crypto.HashPassword(
@@ -82,12 +119,12 @@ func (a *AdminService) AddUser(ctx context.Context, displayName, userName, passw
 		a.cfg.Crypto.Argon2Parallelism,
 	)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
 	id, err := randstr.GenerateID(16)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
 	now := time.Now()
@@ -98,17 +135,13 @@ func (a *AdminService) AddUser(ctx context.Context, displayName, userName, passw
 		PasswordHash:      hash,
 		PasswordSalt:      salt,
 		IsBanned:          false,
-		PermManageAllUser: false,
-		PermCreateUser:    false,
-		PermCreateBucket:  true,
+		PermManageAllUser: manageAllUser,
+		PermCreateUser:    createUser,
+		PermCreateBucket:  createBucket,
 		CreatedAt:         now,
 		UpdatedAt:         now,
 	}
-
-	if err := a.userRepo.CreateUser(ctx, user); err != nil {
-		return "", err
-	}
-	return id, nil
+	return user, nil
 }
 
 func (a *AdminService) SetGlobalPermissions(ctx context.Context, userID string, perms map[string]bool) error {
@@ -147,4 +180,32 @@ func (a *AdminService) OverwriteUserPassword(ctx context.Context, userID, newPas
 	return a.sessSvc.ExpireAllSessionsByUserID(ctx, userID, "Password overwritten by admin")
 }
 
+// DeleteUser removes a user and then expires all of their sessions. Everything the user created is
+// reassigned to transferToUserID, who also takes over the user's buckets. The deletion is refused
+// if it would leave any other bucket without a user holding MANAGE_AUTHORIZATION.
+func (a *AdminService) DeleteUser(ctx context.Context, userID, transferToUserID string) error {
+	if userID == transferToUserID {
+		return apperror.NewUserError("INVALID_TRANSFER_TARGET", "Ownership cannot be transferred to the user being deleted.")
+	}
+	if _, err := a.userRepo.FindUserByID(ctx, userID); err != nil {
+		return apperror.NewUserError("USER_NOT_FOUND", "The requested user could not be found.")
+	}
+	target, err := a.userRepo.FindUserByID(ctx, transferToUserID)
+	if err != nil {
+		return apperror.NewUserError("USER_NOT_FOUND", "The user to transfer ownership to could not be found.")
+	}
+	if target.IsBanned {
+		return apperror.NewUserError("USER_BANNED", "Ownership cannot be transferred to a banned user.")
+	}
 
+	orphaned, err := a.userRepo.DeleteUserTransferringOwnership(ctx, userID, transferToUserID)
+	if err != nil {
+		return err
+	}
+	if len(orphaned) > 0 {
+		return apperror.NewUserError("LAST_AUTHORIZATION_MANAGER",
+			"The user is the only holder of \"MANAGE_AUTHORIZATION\" on "+strconv.Itoa(len(orphaned))+
+				" bucket(s). Grant the permission to another user first.")
+	}
+	return a.sessSvc.ExpireAllSessionsByUserID(ctx, userID, "User deleted by admin")
+}
@@ -0,0 +1,330 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/nkrypt-xyz/nkrypt-xyz-web-server/internal/model"
+	"github.com/nkrypt-xyz/nkrypt-xyz-web-server/internal/pkg/migrate"
+	"github.com/nkrypt-xyz/nkrypt-xyz-web-server/internal/pkg/storage"
+	"github.com/nkrypt-xyz/nkrypt-xyz-web-server/internal/repository"
+)
+
+// BackupService writes snapshots of the whole instance and restores them into an empty one.
+type BackupService struct {
+	snapshotRepo  *repository.SnapshotRepository
+	blobSvc       *BlobService
+	storageClient *storage.MinIOClient
+	migrator      *migrate.Migrator
+}
+
+func NewBackupService(snapshotRepo *repository.SnapshotRepository, blobSvc *BlobService, storageClient *storage.MinIOClient, migrator *migrate.Migrator) *BackupService {
+	return &BackupService{snapshotRepo: snapshotRepo, blobSvc: blobSvc, storageClient: storageClient, migrator: migrator}
+}
+
+// Backup writes the database as of one moment to target, along with every object referenced by
+// the finished blobs of that moment. Blobs superseded meanwhile are kept until their objects are
+// copied; if a file is deleted meanwhile, the backup fails and must be run again.
+func (s *BackupService) Backup(ctx context.Context, target storage.BackupTarget) (*model.BackupManifest, error) {
+	snapshot, err := s.snapshotRepo.BeginSnapshot(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer snapshot.Close()
+	if err := snapshot.CheckTables(ctx); err != nil {
+		return nil, err
+	}
+	version, err := snapshot.SchemaVersion(ctx)
+	if err != nil {
+		return nil, err
+	}
+	blobs, err := snapshot.ListFinishedBlobs(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var releases []func()
+	defer func() {
+		for _, release := range releases {
+			release()
+		}
+	}()
+	keys := map[string]bool{}
+	for i := range blobs {
+		release, ok, err := s.blobSvc.HoldBlob(ctx, &blobs[i])
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			releases = append(releases, release)
+		}
+		keys[blobObjectKey(&blobs[i])] = true
+	}
+
+	manifest := &model.BackupManifest{
+		Format:        model.BackupFormat,
+		Version:       model.BackupVersion,
+		CreatedAt:     time.Now().UnixMilli(),
+		SchemaVersion: version,
+	}
+	for _, table := range repository.SnapshotTables() {
+		entry, err := s.backupTable(ctx, snapshot, table, target)
+		if err != nil {
+			return nil, err
+		}
+		manifest.Tables = append(manifest.Tables, entry)
+	}
+	snapshot.Close()
+
+	sortedKeys := make([]string, 0, len(keys))
+	for key := range keys {
+		sortedKeys = append(sortedKeys, key)
+	}
+	sort.Strings(sortedKeys)
+	for _, key := range sortedKeys {
+		entry, err := s.backupObject(ctx, key, target)
+		if err != nil {
+			return nil, fmt.Errorf("copy object %s: %w; if files were deleted during the backup, run it again", key, err)
+		}
+		manifest.Objects = append(manifest.Objects, entry)
+	}
+
+	// Written last: its presence marks the backup as complete
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := target.Put(ctx, model.BackupManifestName, bytes.NewReader(data), int64(len(data))); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// backupTable streams a table of the snapshot to the target.
+func (s *BackupService) backupTable(ctx context.Context, snapshot *repository.Snapshot, table string, target storage.BackupTarget) (model.BackupTable, error) {
+	pr, pw := io.Pipe()
+	rowCount := make(chan int64, 1)
+	go func() {
+		rows, err := snapshot.CopyTable(ctx, table, pw)
+		rowCount <- rows
+		pw.CloseWithError(err)
+	}()
+
+	hash := sha256.New()
+	err := target.Put(ctx, model.BackupTableDir+table+".csv", io.TeeReader(pr, hash), -1)
+	// Stops the copy if the target failed first
+	pr.CloseWithError(io.ErrClosedPipe)
+	rows := <-rowCount
+	if err != nil {
+		return model.BackupTable{}, fmt.Errorf("write table %s: %w", table, err)
+	}
+	return model.BackupTable{Name: table, Rows: rows, SHA256: hex.EncodeToString(hash.Sum(nil))}, nil
+}
+
+// backupObject copies a stored object to the target.
+func (s *BackupService) backupObject(ctx context.Context, key string, target storage.BackupTarget) (model.BackupObject, error) {
+	reader, size, err := s.storageClient.GetObject(ctx, key)
+	if err != nil {
+		return model.BackupObject{}, err
+	}
+	defer reader.Close()
+	hash := sha256.New()
+	if err := target.Put(ctx, model.BackupObjectDir+key, io.TeeReader(reader, hash), size); err != nil {
+		return model.BackupObject{}, err
+	}
+	return model.BackupObject{Key: key, SizeBytes: size, SHA256: hex.EncodeToString(hash.Sum(nil))}, nil
+}
+
+// Restore loads a backup into an instance whose database is empty, migrating it to the schema
+// version of the backup first and to the latest version after. Objects are restored and checked
+// first; the tables are loaded in one transaction, committed only if all match the manifest.
+// Finally every finished blob is checked to reference a restored object. Objects are restored to
+// the hot bucket, so every blob is hot afterwards.
+func (s *BackupService) Restore(ctx context.Context, target storage.BackupTarget) (*model.BackupManifest, error) {
+	manifest, err := readBackupManifest(ctx, target)
+	if err != nil {
+		return nil, err
+	}
+	if manifest.SchemaVersion > s.migrator.Latest() {
+		return nil, fmt.Errorf("the backup has schema version %d, newer than the %d this server knows", manifest.SchemaVersion, s.migrator.Latest())
+	}
+	status, err := s.migrator.Status(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if status.Version > manifest.SchemaVersion {
+		return nil, fmt.Errorf("the database is at schema version %d, past the backup's %d; restore into an empty database", status.Version, manifest.SchemaVersion)
+	}
+	if _, err := s.migrator.UpTo(ctx, manifest.SchemaVersion); err != nil {
+		return nil, err
+	}
+	empty, err := s.snapshotRepo.IsEmpty(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !empty {
+		return nil, fmt.Errorf("the database is not empty; restore into an empty database")
+	}
+
+	for _, object := range manifest.Objects {
+		if err := s.restoreObject(ctx, object, target); err != nil {
+			return nil, err
+		}
+	}
+
+	restore, err := s.snapshotRepo.BeginRestore(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer restore.Rollback()
+	for _, table := range manifest.Tables {
+		if err := restoreTable(ctx, restore, table, target); err != nil {
+			return nil, err
+		}
+	}
+	if err := restore.Commit(ctx); err != nil {
+		return nil, err
+	}
+
+	if _, err := s.migrator.Up(ctx); err != nil {
+		return nil, err
+	}
+	if err := s.snapshotRepo.ResetBlobLocations(ctx); err != nil {
+		return nil, err
+	}
+	if err := s.verifyRestoredBlobs(ctx, manifest); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// restoreObject copies an object of the backup to the object store and checks its checksum.
+func (s *BackupService) restoreObject(ctx context.Context, object model.BackupObject, target storage.BackupTarget) error {
+	reader, err := target.Get(ctx, model.BackupObjectDir+object.Key)
+	if err != nil {
+		return fmt.Errorf("read object %s: %w", object.Key, err)
+	}
+	defer reader.Close()
+	hash := sha256.New()
+	if err := s.storageClient.PutObject(ctx, object.Key, io.TeeReader(reader, hash), object.SizeBytes); err != nil {
+		return fmt.Errorf("restore object %s: %w", object.Key, err)
+	}
+	if hex.EncodeToString(hash.Sum(nil)) != object.SHA256 {
+		_ = s.storageClient.DeleteObject(ctx, object.Key)
+		return fmt.Errorf("object %s does not match its checksum", object.Key)
+	}
+	return nil
+}
+
+// restoreTable loads a table of the backup and checks it against the manifest.
+func restoreTable(ctx context.Context, restore *repository.SnapshotRestore, table model.BackupTable, target storage.BackupTarget) error {
+	reader, err := target.Get(ctx, model.BackupTableDir+table.Name+".csv")
+	if err != nil {
+		return fmt.Errorf("read table %s: %w", table.Name, err)
+	}
+	defer reader.Close()
+
+	hash := sha256.New()
+	rows := bufio.NewReader(io.TeeReader(reader, hash))
+	header, err := rows.ReadString('\n')
+	if err != nil {
+		return fmt.Errorf("read table %s: %w", table.Name, err)
+	}
+	columns, err := csv.NewReader(strings.NewReader(header)).Read()
+	if err != nil {
+		return fmt.Errorf("read the columns of table %s: %w", table.Name, err)
+	}
+	count, err := restore.CopyIntoTable(ctx, table.Name, columns, rows)
+	if err != nil {
+		return err
+	}
+	if hex.EncodeToString(hash.Sum(nil)) != table.SHA256 || count != table.Rows {
+		return fmt.Errorf("table %s does not match its checksum", table.Name)
+	}
+	return nil
+}
+
+// verifyRestoredBlobs checks that the object of every finished blob was restored whole.
+func (s *BackupService) verifyRestoredBlobs(ctx context.Context, manifest *model.BackupManifest) error {
+	sizes := make(map[string]int64, len(manifest.Objects))
+	for _, object := range manifest.Objects {
+		sizes[object.Key] = object.SizeBytes
+	}
+	blobs, err := s.snapshotRepo.ListFinishedBlobs(ctx)
+	if err != nil {
+		return err
+	}
+	var missing []string
+	for i := range blobs {
+		key := blobObjectKey(&blobs[i])
+		expected, ok := sizes[key]
+		size, err := s.storageClient.StatObject(ctx, key)
+		if !ok || err != nil || size != expected {
+			missing = append(missing, key)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("%d blobs reference objects that were not restored, starting with %s", len(missing), missing[0])
+	}
+	return nil
+}
+
+// readBackupManifest reads and checks the manifest of a backup.
+func readBackupManifest(ctx context.Context, target storage.BackupTarget) (*model.BackupManifest, error) {
+	reader, err := target.Get(ctx, model.BackupManifestName)
+	if err != nil {
+		return nil, fmt.Errorf("read the manifest of %s, which is missing if the backup did not complete: %w", target, err)
+	}
+	defer reader.Close()
+	var manifest model.BackupManifest
+	if err := json.NewDecoder(reader).Decode(&manifest); err != nil {
+		return nil, fmt.Errorf("read the manifest of %s: %w", target, err)
+	}
+	if err := validateBackupManifest(&manifest); err != nil {
+		return nil, err
+	}
+	return &manifest, nil
+}
+
+// validateBackupManifest checks that a manifest has a known format and only lists snapshot tables
+// and blob or content objects with checksums, since their names become file names and object keys.
+func validateBackupManifest(m *model.BackupManifest) error {
+	if m.Format != model.BackupFormat || m.Version != model.BackupVersion {
+		return fmt.Errorf("unsupported backup format %q version %d", m.Format, m.Version)
+	}
+	known := repository.SnapshotTables()
+	seen := map[string]bool{}
+	for _, table := range m.Tables {
+		found := false
+		for _, name := range known {
+			found = found || name == table.Name
+		}
+		if !found || seen[table.Name] || !isSHA256Hex(table.SHA256) {
+			return fmt.Errorf("the backup lists unknown or repeated table %q", table.Name)
+		}
+		seen[table.Name] = true
+	}
+	for _, object := range m.Objects {
+		valid := strings.HasPrefix(object.Key, "blobs/") || strings.HasPrefix(object.Key, "contents/")
+		if !valid || strings.Contains(object.Key, "..") || seen[object.Key] || !isSHA256Hex(object.SHA256) {
+			return fmt.Errorf("the backup lists invalid or repeated object %q", object.Key)
+		}
+		seen[object.Key] = true
+	}
+	return nil
+}
+
+func isSHA256Hex(s string) bool {
+	decoded, err := hex.DecodeString(s)
+	return err == nil && len(decoded) == sha256.Size
+}
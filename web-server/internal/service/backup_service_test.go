@@ -0,0 +1,56 @@
+package service
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/nkrypt-xyz/nkrypt-xyz-web-server/internal/model"
+)
+
+func testBackupManifest() *model.BackupManifest {
+	sum := strings.Repeat("ab", 32)
+	return &model.BackupManifest{
+		Format:        model.BackupFormat,
+		Version:       model.BackupVersion,
+		SchemaVersion: 15,
+		Tables: []model.BackupTable{
+			{Name: "users", Rows: 2, SHA256: sum},
+			{Name: "blobs", Rows: 1, SHA256: sum},
+		},
+		Objects: []model.BackupObject{
+			{Key: "blobs/blob000000000001", SizeBytes: 10, SHA256: sum},
+			{Key: "contents/" + sum, SizeBytes: 10, SHA256: sum},
+		},
+	}
+}
+
+func TestValidateBackupManifest(t *testing.T) {
+	if err := validateBackupManifest(testBackupManifest()); err != nil {
+		t.Fatalf("Expected a valid manifest, got %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		modify func(m *model.BackupManifest)
+	}{
+		{name: "unknown format", modify: func(m *model.BackupManifest) { m.Format = model.BucketArchiveFormat }},
+		{name: "unknown version", modify: func(m *model.BackupManifest) { m.Version = 2 }},
+		{name: "unknown table", modify: func(m *model.BackupManifest) { m.Tables[0].Name = "schema_migrations" }},
+		{name: "table outside the backup", modify: func(m *model.BackupManifest) { m.Tables[0].Name = "../users" }},
+		{name: "duplicate table", modify: func(m *model.BackupManifest) { m.Tables[1].Name = "users" }},
+		{name: "malformed table checksum", modify: func(m *model.BackupManifest) { m.Tables[0].SHA256 = "abab" }},
+		{name: "object outside the store layout", modify: func(m *model.BackupManifest) { m.Objects[0].Key = "other/blob000000000001" }},
+		{name: "object path traversal", modify: func(m *model.BackupManifest) { m.Objects[0].Key = "blobs/../../etc/passwd" }},
+		{name: "duplicate object", modify: func(m *model.BackupManifest) { m.Objects[1].Key = m.Objects[0].Key }},
+		{name: "missing object checksum", modify: func(m *model.BackupManifest) { m.Objects[0].SHA256 = "" }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := testBackupManifest()
+			tt.modify(m)
+			if err := validateBackupManifest(m); err == nil {
+				t.Error("Expected the manifest to be rejected")
+			}
+		})
+	}
+}
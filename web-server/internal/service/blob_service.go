@@ -2,10 +2,20 @@ package service
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
 	"io"
+	"sync"
 
+	"github.com/jackc/pgx/v5"
+	"github.com/rs/zerolog/log"
+
+	"github.com/nkrypt-xyz/nkrypt-xyz-web-server/internal/config"
 	"github.com/nkrypt-xyz/nkrypt-xyz-web-server/internal/model"
 	"github.com/nkrypt-xyz/nkrypt-xyz-web-server/internal/pkg/apperror"
+	"github.com/nkrypt-xyz/nkrypt-xyz-web-server/internal/pkg/metrics"
 	"github.com/nkrypt-xyz/nkrypt-xyz-web-server/internal/pkg/randstr"
 	"github.com/nkrypt-xyz/nkrypt-xyz-web-server/internal/pkg/storage"
 	"github.com/nkrypt-xyz/nkrypt-xyz-web-server/internal/repository"
@@ -14,10 +24,18 @@ import (
 type BlobService struct {
 	blobRepo      *repository.BlobRepository
 	storageClient *storage.MinIOClient
+	replication   *ReplicationService // nil unless replication is on
+	deduplicate   bool
+	promoting     sync.Map // IDs of blobs being promoted to hot storage
 }
 
-func NewBlobService(blobRepo *repository.BlobRepository, storageClient *storage.MinIOClient) *BlobService {
-	return &BlobService{blobRepo: blobRepo, storageClient: storageClient}
+func NewBlobService(blobRepo *repository.BlobRepository, storageClient *storage.MinIOClient, replication *ReplicationService, cfg *config.Config) *BlobService {
+	return &BlobService{
+		blobRepo:      blobRepo,
+		storageClient: storageClient,
+		replication:   replication,
+		deduplicate:   cfg.BlobStorage.Deduplicate,
+	}
 }
 
 func (s *BlobService) CreateInProgressBlob(ctx context.Context, bucketID, fileID, cryptoMetaHeaderContent, createdByUserID string) (*model.Blob, error) {
@@ -30,7 +48,7 @@ func (s *BlobService) CreateInProgressBlob(ctx context.Context, bucketID, fileID
 		BucketID:                bucketID,
 		FileID:                  fileID,
 		CryptoMetaHeaderContent: cryptoMetaHeaderContent,
-		Status:                  "started",
+		Status:                  model.BlobStatusStarted,
 		CreatedByUserID:         createdByUserID,
 	}
 	if err := s.blobRepo.Create(ctx, blob); err != nil {
@@ -47,45 +65,309 @@ func (s *BlobService) GetInProgressBlob(ctx context.Context, bucketID, fileID, b
 	return blob, nil
 }
 
-func (s *BlobService) MarkBlobFinished(ctx context.Context, blobID string) error {
-	return s.blobRepo.MarkFinished(ctx, blobID)
+// MarkBlobUploading records that content of an in-progress blob is arriving.
+func (s *BlobService) MarkBlobUploading(ctx context.Context, blobID string) error {
+	err := s.blobRepo.MarkUploading(ctx, blobID)
+	if errors.Is(err, repository.ErrBlobTransition) {
+		return apperror.NewUserError("BLOB_INVALID", "No in-progress blob found with the given ID")
+	}
+	return err
+}
+
+// CheckCurrentBlob fails with WRITE_CONFLICT if expectedBlobID is set and is not the current
+// finished blob of the file. It lets writers fail before sending content; FinishBlob checks again.
+func (s *BlobService) CheckCurrentBlob(ctx context.Context, bucketID, fileID, expectedBlobID string) error {
+	if expectedBlobID == "" {
+		return nil
+	}
+	current, err := s.blobRepo.FindLatestFinishedBlob(ctx, bucketID, fileID)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return err
+	}
+	if current == nil || current.ID != expectedBlobID {
+		return writeConflict()
+	}
+	return nil
+}
+
+// FinishBlob makes an in-progress blob the current content of its file and supersedes the blob
+// it replaces. If expectedBlobID is set and another blob became current in the meantime, the new
+// blob is discarded and WRITE_CONFLICT is returned. With deduplication on, the content of the
+// blob is first moved to, or found in, the deduplicated content.
+func (s *BlobService) FinishBlob(ctx context.Context, bucketID, fileID, blobID, expectedBlobID string) error {
+	if s.deduplicate {
+		if err := s.deduplicateBlob(ctx, blobID); err != nil {
+			// The blob keeps its own object, which is just as readable
+			log.Warn().Err(err).Str("blobId", blobID).Msg("failed to deduplicate blob")
+		}
+	}
+
+	_, err := s.blobRepo.FinishAndSupersede(ctx, bucketID, fileID, blobID, expectedBlobID)
+	switch {
+	case errors.Is(err, repository.ErrWriteConflict):
+		_ = removeBlob(ctx, s.blobRepo, s.storageClient, s.replication, blobID)
+		return writeConflict()
+	case errors.Is(err, repository.ErrBlobTransition):
+		return apperror.NewUserError("BLOB_INVALID", "No in-progress blob found with the given ID")
+	case err != nil:
+		return err
+	}
+
+	if s.replication != nil {
+		// Look the blob up again, as deduplication may have moved its content
+		blob, err := s.blobRepo.FindByID(ctx, blobID)
+		if err != nil {
+			log.Error().Err(err).Str("blobId", blobID).Msg("failed to queue replication of finished blob")
+			return nil
+		}
+		s.replication.Enqueue(ctx, model.ReplicationOpPut, blobObjectKey(blob))
+	}
+	return nil
+}
+
+// deduplicateBlob hashes the object of an in-progress blob and makes the blob reference the
+// deduplicated content with that hash. New content is copied from the blob's object; either way
+// the blob's own object is deleted. Compressed blobs keep their own object.
+func (s *BlobService) deduplicateBlob(ctx context.Context, blobID string) error {
+	blob, err := s.blobRepo.FindByID(ctx, blobID)
+	if err != nil {
+		return err
+	}
+	if blob.Codec != model.BlobCodecNone {
+		return nil
+	}
+	reader, _, err := s.storageClient.DownloadBlob(ctx, blobID)
+	if err != nil {
+		return err
+	}
+	hash := sha256.New()
+	size, err := io.Copy(hash, reader)
+	reader.Close()
+	if err != nil {
+		return err
+	}
+	sum := hex.EncodeToString(hash.Sum(nil))
+
+	err = s.blobRepo.AttachContent(ctx, blobID, sum, size, func(ctx context.Context) error {
+		return s.storageClient.CopyBlobToContent(ctx, blobID, sum)
+	})
+	if err != nil {
+		return err
+	}
+	_ = s.storageClient.DeleteBlob(ctx, blobID) // Ignore errors; a leftover object is an orphan
+	return nil
 }
 
 func (s *BlobService) MarkBlobErroneous(ctx context.Context, blobID string) error {
 	return s.blobRepo.MarkErroneous(ctx, blobID)
 }
 
+// CountBlobsByStatus returns the number of blobs per status.
+func (s *BlobService) CountBlobsByStatus(ctx context.Context) (map[string]int64, error) {
+	return s.blobRepo.CountBlobsByStatus(ctx)
+}
+
 func (s *BlobService) FindLatestFinishedBlob(ctx context.Context, bucketID, fileID string) (*model.Blob, error) {
 	return s.blobRepo.FindLatestFinishedBlob(ctx, bucketID, fileID)
 }
 
-func (s *BlobService) StreamBlobToWriter(ctx context.Context, blobID string, w io.Writer) (int64, error) {
-	reader, _, err := s.storageClient.DownloadBlob(ctx, blobID)
+// BeginRead returns the current blob of the file and keeps it from being deleted until release is
+// called, even if a newer blob supersedes it in the meantime.
+func (s *BlobService) BeginRead(ctx context.Context, bucketID, fileID string) (blob *model.Blob, release func(), err error) {
+	// A blob being deleted has been superseded, so looking again finds the newer one
+	for attempt := 0; attempt < 3; attempt++ {
+		blob, err = s.blobRepo.FindLatestFinishedBlob(ctx, bucketID, fileID)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil, apperror.NewUserError("BLOB_NOT_FOUND", "No finished blob found for this file.")
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		ok, err := s.storageClient.AcquireBlobRead(ctx, blob.ID)
+		if err != nil {
+			return nil, nil, err
+		}
+		if ok {
+			return blob, func() { s.endRead(blob) }, nil
+		}
+	}
+	return nil, nil, apperror.NewUserError("BLOB_NOT_FOUND", "The content of the file is being replaced. Try again.")
+}
+
+// HoldBlob keeps a blob from being deleted, as a read of it does, until release is called.
+// Returns false if the blob is already being deleted.
+func (s *BlobService) HoldBlob(ctx context.Context, blob *model.Blob) (release func(), ok bool, err error) {
+	ok, err = s.storageClient.AcquireBlobRead(ctx, blob.ID)
+	if err != nil || !ok {
+		return nil, false, err
+	}
+	return func() { s.endRead(blob) }, true, nil
+}
+
+// endRead releases a read and deletes the blob if it was superseded and this was its last read.
+func (s *BlobService) endRead(blob *model.Blob) {
+	// The request may be cancelled by now
+	ctx := context.Background()
+	remaining, err := s.storageClient.ReleaseBlobRead(ctx, blob.ID)
 	if err != nil {
-		return 0, err
+		log.Warn().Err(err).Str("blobId", blob.ID).Msg("failed to release blob read")
+		return
+	}
+	if remaining > 0 {
+		return
+	}
+	current, err := s.blobRepo.FindByID(ctx, blob.ID)
+	if err != nil || current.Status != model.BlobStatusSuperseded {
+		return
+	}
+	if err := s.removeBlobIfUnread(ctx, current.ID); err != nil {
+		log.Warn().Err(err).Str("blobId", blob.ID).Msg("failed to remove superseded blob")
+	}
+}
+
+// OpenBlob returns a reader for the content of a blob, whether deduplicated or not, and its size.
+// A blob moved to the tiering store is read from there and promoted back to hot storage. With
+// replication on, a blob whose object is missing is read from the replica.
+func (s *BlobService) OpenBlob(ctx context.Context, blob *model.Blob) (io.ReadCloser, int64, error) {
+	return s.openBlob(ctx, blob, true)
+}
+
+// OpenBlobForExport is OpenBlob, except that a blob read from the tiering store stays there: an
+// export reads every blob of a bucket once, which says nothing about how often they are used.
+func (s *BlobService) OpenBlobForExport(ctx context.Context, blob *model.Blob) (io.ReadCloser, int64, error) {
+	return s.openBlob(ctx, blob, false)
+}
+
+func (s *BlobService) openBlob(ctx context.Context, blob *model.Blob, promote bool) (io.ReadCloser, int64, error) {
+	var reader io.ReadCloser
+	var size int64
+	var err error
+	switch {
+	case blob.ContentSHA256 != nil:
+		reader, size, err = s.storageClient.DownloadContent(ctx, *blob.ContentSHA256)
+	case blob.Location != model.BlobLocationHot && s.storageClient.ColdTier() != nil:
+		reader, size, err = s.storageClient.DownloadColdBlob(ctx, blob.ID)
+		if err == nil && promote {
+			s.promote(ctx, blob)
+		}
+	default:
+		reader, size, err = s.storageClient.DownloadBlob(ctx, blob.ID)
+	}
+	if err != nil {
+		if s.replication == nil || !storage.IsNotFound(err) {
+			return nil, 0, err
+		}
+		var replicaErr error
+		reader, size, replicaErr = s.replication.OpenReplica(ctx, blobObjectKey(blob))
+		if replicaErr != nil {
+			return nil, 0, err
+		}
+		metrics.BlobReadFallbacks.Inc()
+		log.Warn().Str("blobId", blob.ID).Str("objectKey", blobObjectKey(blob)).Msg("blob object missing, reading it from the replica")
+	}
+	return decompressBlob(blob, reader, size)
+}
+
+// decompressBlob wraps the object of a compressed blob in a decompressing reader, and returns
+// the size of the content in place of that of the object.
+func decompressBlob(blob *model.Blob, object io.ReadCloser, size int64) (io.ReadCloser, int64, error) {
+	if blob.Codec == "" || blob.Codec == model.BlobCodecNone {
+		return object, size, nil
+	}
+	if blob.Codec != model.BlobCodecZstd || blob.SizeBytes == nil {
+		object.Close()
+		return nil, 0, fmt.Errorf("blob %s: unsupported codec %q", blob.ID, blob.Codec)
+	}
+	reader, err := storage.Decompress(object)
+	if err != nil {
+		return nil, 0, err
+	}
+	return reader, *blob.SizeBytes, nil
+}
+
+// promote moves a blob that was read from the tiering store back to hot storage, in the
+// background. The blob is marked hot before its object is copied, so that a concurrent purge of
+// its hot copy restores that copy; reads find the object in the tiering store until the copy is
+// done. The copy in the tiering store is kept, and deleted with the blob.
+func (s *BlobService) promote(ctx context.Context, blob *model.Blob) {
+	if _, busy := s.promoting.LoadOrStore(blob.ID, true); busy {
+		return
+	}
+	ctx = context.WithoutCancel(ctx)
+	go func() {
+		defer s.promoting.Delete(blob.ID)
+		recordTiering("promote", blob.ID, s.promoteBlob(ctx, blob.ID))
+	}()
+}
+
+func (s *BlobService) promoteBlob(ctx context.Context, blobID string) error {
+	ok, err := s.blobRepo.SetLocation(ctx, blobID, model.BlobLocationHot, model.BlobLocationCooling, model.BlobLocationCold)
+	if err != nil || !ok {
+		return err
 	}
-	defer reader.Close()
-	return io.Copy(w, reader)
+	_, err = s.storageClient.ColdTier().CopyObjectTo(ctx, s.storageClient, "blobs/"+blobID)
+	if storage.IsNotFound(err) {
+		// Deleted meanwhile, or only the hot copy is left
+		return nil
+	}
+	return err
 }
 
+// GetBlobSize returns the size of the content of an in-progress blob, which differs from that
+// of its object if it is compressed. Use OpenBlob for finished blobs, whose content may be
+// deduplicated.
 func (s *BlobService) GetBlobSize(ctx context.Context, blobID string) (int64, error) {
+	blob, err := s.blobRepo.FindByID(ctx, blobID)
+	if err != nil {
+		return 0, err
+	}
+	if blob != nil && blob.SizeBytes != nil {
+		return *blob.SizeBytes, nil
+	}
 	return s.storageClient.GetBlobSize(ctx, blobID)
 }
 
+// UploadBlobFromReader stores the content of an in-progress blob, compressed if its bucket says
+// so.
 func (s *BlobService) UploadBlobFromReader(ctx context.Context, blobID string, reader io.Reader, size int64) error {
-	_, err := s.storageClient.UploadBlob(ctx, blobID, reader, size)
-	return err
+	codec, err := s.blobRepo.FindBucketCompression(ctx, blobID)
+	if err != nil {
+		return err
+	}
+	size, storedSize, err := s.storageClient.UploadBlob(ctx, blobID, reader, size, codec == model.BlobCodecZstd)
+	if err != nil {
+		return err
+	}
+	return s.blobRepo.SetStoredObject(ctx, blobID, codec, size, storedSize)
 }
 
-func (s *BlobService) RemoveAllOtherBlobs(ctx context.Context, bucketID, fileID, keepBlobID string) error {
-	blobs, err := s.blobRepo.ListBlobsForFileExcluding(ctx, bucketID, fileID, keepBlobID)
+// RemoveReplacedBlobs deletes the erroneous blobs of a file, and its superseded blobs that no read
+// is using. The others are deleted when their last read ends.
+func (s *BlobService) RemoveReplacedBlobs(ctx context.Context, bucketID, fileID string) error {
+	blobs, err := s.blobRepo.ListBlobsForFileWithStatus(ctx, bucketID, fileID, model.BlobStatusError, model.BlobStatusSuperseded)
 	if err != nil {
 		return err
 	}
 	for _, blob := range blobs {
-		_ = s.storageClient.DeleteBlob(ctx, blob.ID) // Ignore errors (ENOENT is ok)
+		if blob.Status == model.BlobStatusSuperseded {
+			err = s.removeBlobIfUnread(ctx, blob.ID)
+		} else {
+			err = removeBlob(ctx, s.blobRepo, s.storageClient, s.replication, blob.ID)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// removeBlobIfUnread deletes a blob unless a read of it is in flight.
+func (s *BlobService) removeBlobIfUnread(ctx context.Context, blobID string) error {
+	ok, err := s.storageClient.ClaimBlobDeletion(ctx, blobID)
+	if err != nil || !ok {
+		return err
 	}
-	return s.blobRepo.DeleteBlobsForFileExcluding(ctx, bucketID, fileID, keepBlobID)
+	return removeBlob(ctx, s.blobRepo, s.storageClient, s.replication, blobID)
 }
 
 func (s *BlobService) RemoveAllBlobsOfFile(ctx context.Context, bucketID, fileID string) error {
@@ -93,20 +375,91 @@ func (s *BlobService) RemoveAllBlobsOfFile(ctx context.Context, bucketID, fileID
 	if err != nil {
 		return err
 	}
+	return s.removeBlobs(ctx, blobs)
+}
+
+// RemoveAllBlobsInDirectory removes the blobs of every file in a directory and in the directories
+// below it, so that deleting the directory does not leave their deduplicated content referenced.
+func (s *BlobService) RemoveAllBlobsInDirectory(ctx context.Context, bucketID, directoryID string) error {
+	blobs, err := s.blobRepo.ListBlobsInDirectoryTree(ctx, bucketID, directoryID)
+	if err != nil {
+		return err
+	}
+	return s.removeBlobs(ctx, blobs)
+}
+
+// RemoveAllBlobsOfBucket removes the blobs of every file in a bucket, so that destroying the
+// bucket does not leave their deduplicated content referenced.
+func (s *BlobService) RemoveAllBlobsOfBucket(ctx context.Context, bucketID string) error {
+	blobs, err := s.blobRepo.ListBlobsForBucket(ctx, bucketID)
+	if err != nil {
+		return err
+	}
+	return s.removeBlobs(ctx, blobs)
+}
+
+func (s *BlobService) removeBlobs(ctx context.Context, blobs []model.Blob) error {
 	for _, blob := range blobs {
-		_ = s.storageClient.DeleteBlob(ctx, blob.ID)
+		if err := removeBlob(ctx, s.blobRepo, s.storageClient, s.replication, blob.ID); err != nil {
+			return err
+		}
 	}
-	return s.blobRepo.DeleteAllBlobsForFile(ctx, bucketID, fileID)
+	return nil
+}
+
+// removeBlob deletes a blob along with its object, or with its deduplicated content if it held
+// the last reference to it. Deleted objects are queued for deletion from the replica.
+func removeBlob(ctx context.Context, blobRepo *repository.BlobRepository, storageClient *storage.MinIOClient, replication *ReplicationService, blobID string) error {
+	_ = storageClient.DeleteBlob(ctx, blobID) // Ignore errors (ENOENT is ok)
+	replication.Enqueue(ctx, model.ReplicationOpDelete, "blobs/"+blobID)
+	return blobRepo.DeleteBlob(ctx, blobID, deleteContentFunc(storageClient, replication))
 }
 
-// AppendChunkToBlob appends a chunk to an in-progress blob at the specified offset.
-// Returns the number of bytes written.
-func (s *BlobService) AppendChunkToBlob(ctx context.Context, blobID string, offset int64, reader io.Reader) (int64, error) {
-	return s.storageClient.AppendBlobChunk(ctx, blobID, offset, reader)
+// deleteContentFunc returns a function deleting the object of deduplicated content and queueing
+// its deletion from the replica.
+func deleteContentFunc(storageClient *storage.MinIOClient, replication *ReplicationService) func(ctx context.Context, sha256 string) error {
+	return func(ctx context.Context, sha256 string) error {
+		if err := storageClient.DeleteContent(ctx, sha256); err != nil {
+			return err
+		}
+		replication.Enqueue(ctx, model.ReplicationOpDelete, storage.ContentKey(sha256))
+		return nil
+	}
+}
+
+// AppendChunkToBlob appends a chunk to an in-progress blob at the specified offset. contentLength
+// is the chunk's length if known, or -1. Returns the number of bytes written and the offset of the
+// first chunk still missing.
+func (s *BlobService) AppendChunkToBlob(ctx context.Context, blobID string, offset int64, reader io.Reader, contentLength int64) (int64, int64, error) {
+	written, next, err := s.storageClient.AppendBlobChunk(ctx, blobID, offset, reader, contentLength)
+	if errors.Is(err, storage.ErrChunkOverlap) {
+		return 0, 0, apperror.NewUserError("CHUNK_OVERLAP", fmt.Sprintf("The chunk at offset %d overlaps a chunk already uploaded.", offset))
+	}
+	return written, next, err
 }
 
 // FinalizeChunkedBlob composes all uploaded chunks into the final blob.
-// This should be called after the last chunk is uploaded.
-func (s *BlobService) FinalizeChunkedBlob(ctx context.Context, blobID string) error {
-	return s.storageClient.ComposeChunksToBlob(ctx, blobID)
+// This should be called after the last chunk, at finalOffset, is uploaded. The blob stays in
+// progress if chunks are missing, so they can still be uploaded. Chunks are stored as uploaded,
+// and compressed here if the blob's bucket says so.
+func (s *BlobService) FinalizeChunkedBlob(ctx context.Context, blobID string, finalOffset int64) error {
+	codec, err := s.blobRepo.FindBucketCompression(ctx, blobID)
+	if err != nil {
+		return err
+	}
+	size, storedSize, err := s.storageClient.ComposeChunksToBlob(ctx, blobID, finalOffset, codec == model.BlobCodecZstd)
+	var gap *storage.ChunkGapError
+	switch {
+	case errors.As(err, &gap):
+		return apperror.NewUserError("CHUNK_MISSING", fmt.Sprintf("The chunk at offset %d is missing. Upload it and resend the final chunk.", gap.Offset))
+	case errors.Is(err, storage.ErrChunkAfterEnd):
+		return apperror.NewUserError("CHUNK_OUT_OF_SEQUENCE", "A chunk was uploaded past the final chunk.")
+	case err != nil:
+		return err
+	}
+	return s.blobRepo.SetStoredObject(ctx, blobID, codec, size, storedSize)
+}
+
+func writeConflict() error {
+	return apperror.NewUserError("WRITE_CONFLICT", "The file was written by someone else since the expected blob. Read it again before writing.")
 }
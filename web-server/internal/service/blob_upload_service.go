@@ -0,0 +1,288 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/nkrypt-xyz/nkrypt-xyz-web-server/internal/config"
+	"github.com/nkrypt-xyz/nkrypt-xyz-web-server/internal/model"
+	"github.com/nkrypt-xyz/nkrypt-xyz-web-server/internal/pkg/apperror"
+	"github.com/nkrypt-xyz/nkrypt-xyz-web-server/internal/pkg/storage"
+	"github.com/nkrypt-xyz/nkrypt-xyz-web-server/internal/repository"
+)
+
+// Limits of S3 multipart uploads. Every part but the last must be at least minUploadPartSize.
+const (
+	minUploadPartSize = 5 * 1024 * 1024
+	maxUploadPartSize = 5 * 1024 * 1024 * 1024
+	maxUploadParts    = 10000
+)
+
+// uploadSessionValidity matches staleUploadAge, after which the consistency check marks the
+// blob erroneous, and MinIO's default expiry of incomplete multipart uploads.
+const uploadSessionValidity = staleUploadAge
+
+type BlobUploadService struct {
+	blobSvc       *BlobService
+	blobRepo      *repository.BlobRepository
+	uploadRepo    *repository.BlobUploadRepository
+	storageClient *storage.MinIOClient
+	maxFileSize   int64
+}
+
+func NewBlobUploadService(blobSvc *BlobService, blobRepo *repository.BlobRepository, uploadRepo *repository.BlobUploadRepository, storageClient *storage.MinIOClient, cfg *config.Config) *BlobUploadService {
+	return &BlobUploadService{
+		blobSvc:       blobSvc,
+		blobRepo:      blobRepo,
+		uploadRepo:    uploadRepo,
+		storageClient: storageClient,
+		maxFileSize:   cfg.BlobStorage.MaxFileSizeBytes,
+	}
+}
+
+// InitiateUpload starts a new blob of the file and an upload session for it, after checking the
+// declared sizes against the multipart upload limits.
+func (s *BlobUploadService) InitiateUpload(ctx context.Context, bucketID, fileID, cryptoMeta, createdByUserID string, totalSize, partSize int64) (*model.BlobUpload, error) {
+	partCount, err := planUpload(totalSize, partSize, s.maxFileSize)
+	if err != nil {
+		return nil, err
+	}
+
+	blob, err := s.blobSvc.CreateInProgressBlob(ctx, bucketID, fileID, cryptoMeta, createdByUserID)
+	if err != nil {
+		return nil, err
+	}
+
+	uploadID, err := s.storageClient.NewMultipartBlobUpload(ctx, blob.ID)
+	if err != nil {
+		_ = s.blobRepo.MarkErroneous(ctx, blob.ID)
+		return nil, err
+	}
+
+	upload := &model.BlobUpload{
+		BlobID:          blob.ID,
+		StorageUploadID: uploadID,
+		TotalSizeBytes:  totalSize,
+		PartSizeBytes:   partSize,
+		PartCount:       partCount,
+		ExpiresAt:       time.Now().Add(uploadSessionValidity),
+	}
+	if err := s.uploadRepo.Create(ctx, upload); err != nil {
+		_ = s.storageClient.AbortMultipartBlobUpload(ctx, blob.ID, uploadID)
+		_ = s.blobRepo.MarkErroneous(ctx, blob.ID)
+		return nil, err
+	}
+	return upload, nil
+}
+
+// GetUpload returns the upload session of an in-progress blob of the file.
+func (s *BlobUploadService) GetUpload(ctx context.Context, bucketID, fileID, blobID string) (*model.BlobUpload, error) {
+	if _, err := s.blobSvc.GetInProgressBlob(ctx, bucketID, fileID, blobID); err != nil {
+		return nil, err
+	}
+	upload, err := s.uploadRepo.FindByBlobID(ctx, blobID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, apperror.NewUserError("UPLOAD_NOT_FOUND", "The blob is not being written through an upload session.")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if time.Now().After(upload.ExpiresAt) {
+		return nil, apperror.NewUserError("UPLOAD_EXPIRED", "The upload session has expired. Start a new one.")
+	}
+	return upload, nil
+}
+
+// ListParts returns the parts stored so far, in part number order.
+func (s *BlobUploadService) ListParts(ctx context.Context, upload *model.BlobUpload) ([]model.BlobUploadPart, error) {
+	return s.uploadRepo.ListParts(ctx, upload.BlobID)
+}
+
+// UploadPart stores one part. The body must be exactly as long as the part; contentLength is the
+// request's Content-Length, or -1 if unknown. If expectedSHA256 is set, the part is only recorded
+// when its content matches. A failed part is no longer reported as uploaded and must be resent.
+func (s *BlobUploadService) UploadPart(ctx context.Context, upload *model.BlobUpload, partNumber int, body io.Reader, contentLength int64, expectedSHA256 string) (*model.BlobUploadPart, error) {
+	if partNumber < 1 || partNumber > upload.PartCount {
+		return nil, apperror.NewUserError("INVALID_PART_NUMBER", fmt.Sprintf("Part numbers of this upload range from 1 to %d.", upload.PartCount))
+	}
+	size := partSize(upload, partNumber)
+	if contentLength >= 0 && contentLength != size {
+		return nil, partSizeMismatch(partNumber, size)
+	}
+
+	if err := s.blobSvc.MarkBlobUploading(ctx, upload.BlobID); err != nil {
+		return nil, err
+	}
+
+	// Until the new content is verified, the part recorded earlier may have been replaced
+	if err := s.uploadRepo.DeletePart(ctx, upload.BlobID, partNumber); err != nil {
+		return nil, err
+	}
+
+	content := &hashingReader{r: io.LimitReader(body, size), hash: sha256.New()}
+	etag, err := s.storageClient.PutBlobPart(ctx, upload.BlobID, upload.StorageUploadID, partNumber, content, size)
+	if err != nil {
+		if content.n < size {
+			return nil, partSizeMismatch(partNumber, size)
+		}
+		return nil, err
+	}
+	if n, _ := body.Read(make([]byte, 1)); n > 0 {
+		return nil, partSizeMismatch(partNumber, size)
+	}
+
+	sum := hex.EncodeToString(content.hash.Sum(nil))
+	if expectedSHA256 != "" && !strings.EqualFold(expectedSHA256, sum) {
+		return nil, apperror.NewUserError("PART_CHECKSUM_MISMATCH", fmt.Sprintf("The content of part %d does not match its SHA-256 checksum.", partNumber))
+	}
+
+	part := &model.BlobUploadPart{
+		BlobID:     upload.BlobID,
+		PartNumber: partNumber,
+		SizeBytes:  size,
+		SHA256:     sum,
+		ETag:       etag,
+	}
+	if err := s.uploadRepo.UpsertPart(ctx, part); err != nil {
+		return nil, err
+	}
+	return part, nil
+}
+
+// CompleteUpload assembles the parts into the blob and makes it the file's content. partChecksums
+// holds the SHA-256 of every part, in part order, as computed by the client. expectedBlobID is
+// passed on to BlobService.FinishBlob.
+func (s *BlobUploadService) CompleteUpload(ctx context.Context, bucketID, fileID string, upload *model.BlobUpload, partChecksums []string, expectedBlobID string) error {
+	parts, err := s.uploadRepo.ListParts(ctx, upload.BlobID)
+	if err != nil {
+		return err
+	}
+	if err := verifyParts(upload, parts, partChecksums); err != nil {
+		return err
+	}
+
+	blobParts := make([]storage.BlobPart, len(parts))
+	for i, p := range parts {
+		blobParts[i] = storage.BlobPart{Number: p.PartNumber, ETag: p.ETag}
+	}
+	if err := s.storageClient.CompleteMultipartBlobUpload(ctx, upload.BlobID, upload.StorageUploadID, blobParts); err != nil {
+		return err
+	}
+	// Parts are stored as uploaded, as S3 gives no way to compress them in place, and the assembled
+	// object is compressed here if the blob's bucket says so
+	codec, err := s.blobRepo.FindBucketCompression(ctx, upload.BlobID)
+	if err != nil {
+		return err
+	}
+	storedSize := upload.TotalSizeBytes
+	if codec == model.BlobCodecZstd {
+		if storedSize, err = s.storageClient.CompressBlob(ctx, upload.BlobID, upload.TotalSizeBytes); err != nil {
+			return err
+		}
+	}
+	if err := s.blobRepo.SetStoredObject(ctx, upload.BlobID, codec, upload.TotalSizeBytes, storedSize); err != nil {
+		return err
+	}
+
+	// On a write conflict the session goes along with the discarded blob
+	if err := s.blobSvc.FinishBlob(ctx, bucketID, fileID, upload.BlobID, expectedBlobID); err != nil {
+		return err
+	}
+	return s.uploadRepo.Delete(ctx, upload.BlobID)
+}
+
+// AbortUpload discards the stored parts and deletes the blob along with its upload session.
+func (s *BlobUploadService) AbortUpload(ctx context.Context, upload *model.BlobUpload) error {
+	if err := s.storageClient.AbortMultipartBlobUpload(ctx, upload.BlobID, upload.StorageUploadID); err != nil {
+		return err
+	}
+	return removeBlob(ctx, s.blobRepo, s.storageClient, s.blobSvc.replication, upload.BlobID)
+}
+
+// MissingParts returns the numbers of the parts not stored yet, in ascending order.
+func MissingParts(upload *model.BlobUpload, parts []model.BlobUploadPart) []int {
+	stored := make(map[int]bool, len(parts))
+	for _, p := range parts {
+		stored[p.PartNumber] = true
+	}
+	missing := []int{}
+	for n := 1; n <= upload.PartCount; n++ {
+		if !stored[n] {
+			missing = append(missing, n)
+		}
+	}
+	return missing
+}
+
+// planUpload checks the declared sizes of an upload and returns its number of parts.
+func planUpload(totalSize, partSize, maxFileSize int64) (int, error) {
+	if totalSize < 1 {
+		return 0, apperror.NewUserError("INVALID_UPLOAD_SIZE", "The total size must be at least 1 byte.")
+	}
+	if maxFileSize > 0 && totalSize > maxFileSize {
+		return 0, apperror.NewUserError("FILE_TOO_LARGE", fmt.Sprintf("The total size exceeds the limit of %d bytes.", maxFileSize))
+	}
+	if partSize > maxUploadPartSize {
+		return 0, apperror.NewUserError("INVALID_UPLOAD_SIZE", fmt.Sprintf("The part size must not exceed %d bytes.", int64(maxUploadPartSize)))
+	}
+	// A single part may be smaller than the minimum, since it is also the last part
+	if partSize < minUploadPartSize && partSize < totalSize {
+		return 0, apperror.NewUserError("INVALID_UPLOAD_SIZE", fmt.Sprintf("The part size must be at least %d bytes.", minUploadPartSize))
+	}
+	partCount := (totalSize + partSize - 1) / partSize
+	if partCount > maxUploadParts {
+		return 0, apperror.NewUserError("INVALID_UPLOAD_SIZE", fmt.Sprintf("An upload can have at most %d parts; use larger parts.", maxUploadParts))
+	}
+	return int(partCount), nil
+}
+
+// partSize returns the size of a part: the part size, except for a shorter last part.
+func partSize(upload *model.BlobUpload, partNumber int) int64 {
+	if partNumber == upload.PartCount {
+		return upload.TotalSizeBytes - int64(upload.PartCount-1)*upload.PartSizeBytes
+	}
+	return upload.PartSizeBytes
+}
+
+// verifyParts checks that every part is stored and matches the client's checksum.
+func verifyParts(upload *model.BlobUpload, parts []model.BlobUploadPart, partChecksums []string) error {
+	if len(partChecksums) != upload.PartCount {
+		return apperror.NewUserError("INVALID_PART_CHECKSUMS", fmt.Sprintf("Expected checksums of %d parts, got %d.", upload.PartCount, len(partChecksums)))
+	}
+	if missing := MissingParts(upload, parts); len(missing) > 0 {
+		return apperror.NewUserError("UPLOAD_INCOMPLETE", fmt.Sprintf("%d of %d parts have not been uploaded, starting with part %d.", len(missing), upload.PartCount, missing[0]))
+	}
+	for _, p := range parts {
+		if !strings.EqualFold(partChecksums[p.PartNumber-1], p.SHA256) {
+			return apperror.NewUserError("PART_CHECKSUM_MISMATCH", fmt.Sprintf("The stored content of part %d does not match its SHA-256 checksum.", p.PartNumber))
+		}
+	}
+	return nil
+}
+
+func partSizeMismatch(partNumber int, size int64) error {
+	return apperror.NewUserError("PART_SIZE_MISMATCH", fmt.Sprintf("Part %d must be exactly %d bytes long.", partNumber, size))
+}
+
+// hashingReader hashes and counts the bytes read through it.
+type hashingReader struct {
+	r    io.Reader
+	hash hash.Hash
+	n    int64
+}
+
+func (h *hashingReader) Read(p []byte) (int, error) {
+	n, err := h.r.Read(p)
+	h.hash.Write(p[:n])
+	h.n += int64(n)
+	return n, err
+}
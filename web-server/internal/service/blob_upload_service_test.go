@@ -0,0 +1,95 @@
+package service
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/nkrypt-xyz/nkrypt-xyz-web-server/internal/model"
+	"github.com/nkrypt-xyz/nkrypt-xyz-web-server/internal/pkg/apperror"
+)
+
+func errorCode(err error) string {
+	if e, ok := err.(*apperror.UserError); ok {
+		return e.Code
+	}
+	return ""
+}
+
+func TestPlanUpload(t *testing.T) {
+	const mib = 1024 * 1024
+	tests := []struct {
+		name      string
+		totalSize int64
+		partSize  int64
+		maxSize   int64
+		wantParts int
+		wantCode  string
+	}{
+		{name: "exact parts", totalSize: 20 * mib, partSize: 5 * mib, wantParts: 4},
+		{name: "short last part", totalSize: 20*mib + 1, partSize: 5 * mib, wantParts: 5},
+		{name: "single small part", totalSize: 100, partSize: 1024, wantParts: 1},
+		{name: "small parts", totalSize: 10 * mib, partSize: mib, wantCode: "INVALID_UPLOAD_SIZE"},
+		{name: "empty", totalSize: 0, partSize: 5 * mib, wantCode: "INVALID_UPLOAD_SIZE"},
+		{name: "too many parts", totalSize: 10001 * 5 * mib, partSize: 5 * mib, wantCode: "INVALID_UPLOAD_SIZE"},
+		{name: "over the file size limit", totalSize: 20 * mib, partSize: 5 * mib, maxSize: 10 * mib, wantCode: "FILE_TOO_LARGE"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parts, err := planUpload(tt.totalSize, tt.partSize, tt.maxSize)
+			if tt.wantCode != "" {
+				if errorCode(err) != tt.wantCode {
+					t.Fatalf("Expected %s, got %v", tt.wantCode, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if parts != tt.wantParts {
+				t.Errorf("Expected %d parts, got %d", tt.wantParts, parts)
+			}
+		})
+	}
+}
+
+func TestPartSize(t *testing.T) {
+	upload := &model.BlobUpload{TotalSizeBytes: 25, PartSizeBytes: 10, PartCount: 3}
+	for partNumber, want := range map[int]int64{1: 10, 2: 10, 3: 5} {
+		if got := partSize(upload, partNumber); got != want {
+			t.Errorf("Part %d: expected %d bytes, got %d", partNumber, want, got)
+		}
+	}
+}
+
+func TestMissingParts(t *testing.T) {
+	upload := &model.BlobUpload{PartCount: 4}
+	parts := []model.BlobUploadPart{{PartNumber: 1}, {PartNumber: 3}}
+	if got := MissingParts(upload, parts); !reflect.DeepEqual(got, []int{2, 4}) {
+		t.Errorf("Expected parts 2 and 4 to be missing, got %v", got)
+	}
+	parts = append(parts, model.BlobUploadPart{PartNumber: 2}, model.BlobUploadPart{PartNumber: 4})
+	if got := MissingParts(upload, parts); len(got) != 0 {
+		t.Errorf("Expected no missing parts, got %v", got)
+	}
+}
+
+func TestVerifyParts(t *testing.T) {
+	sumA := strings.Repeat("a", 64)
+	sumB := strings.Repeat("b", 64)
+	upload := &model.BlobUpload{PartCount: 2}
+	parts := []model.BlobUploadPart{{PartNumber: 1, SHA256: sumA}, {PartNumber: 2, SHA256: sumB}}
+
+	if err := verifyParts(upload, parts, []string{sumA, strings.ToUpper(sumB)}); err != nil {
+		t.Errorf("Expected matching checksums to pass, got %v", err)
+	}
+	if err := verifyParts(upload, parts, []string{sumA}); errorCode(err) != "INVALID_PART_CHECKSUMS" {
+		t.Errorf("Expected INVALID_PART_CHECKSUMS, got %v", err)
+	}
+	if err := verifyParts(upload, parts[:1], []string{sumA, sumB}); errorCode(err) != "UPLOAD_INCOMPLETE" {
+		t.Errorf("Expected UPLOAD_INCOMPLETE, got %v", err)
+	}
+	if err := verifyParts(upload, parts, []string{sumB, sumA}); errorCode(err) != "PART_CHECKSUM_MISMATCH" {
+		t.Errorf("Expected PART_CHECKSUM_MISMATCH, got %v", err)
+	}
+}
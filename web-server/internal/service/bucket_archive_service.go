@@ -0,0 +1,524 @@
+package service
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/rs/zerolog/log"
+
+	"github.com/nkrypt-xyz/nkrypt-xyz-web-server/internal/model"
+	"github.com/nkrypt-xyz/nkrypt-xyz-web-server/internal/pkg/apperror"
+	"github.com/nkrypt-xyz/nkrypt-xyz-web-server/internal/pkg/randstr"
+	"github.com/nkrypt-xyz/nkrypt-xyz-web-server/internal/repository"
+)
+
+// maxArchiveJSONBytes bounds the manifest and checksums read from an archive.
+const maxArchiveJSONBytes = 64 << 20
+
+// BucketArchiveService exports buckets to tar archives and imports them into new buckets.
+type BucketArchiveService struct {
+	bucketSvc *BucketService
+	dirRepo   *repository.DirectoryRepository
+	fileRepo  *repository.FileRepository
+	blobSvc   *BlobService
+}
+
+func NewBucketArchiveService(bucketSvc *BucketService, dirRepo *repository.DirectoryRepository, fileRepo *repository.FileRepository, blobSvc *BlobService) *BucketArchiveService {
+	return &BucketArchiveService{bucketSvc: bucketSvc, dirRepo: dirRepo, fileRepo: fileRepo, blobSvc: blobSvc}
+}
+
+// BucketExport is a snapshot of a bucket to write as an archive. The blobs it lists are kept from
+// being deleted until Close is called, so files written in the meantime are exported as they were.
+type BucketExport struct {
+	Manifest *model.BucketManifest
+	blobs    map[string]*model.Blob // by file ID
+	releases []func()
+}
+
+// Close releases the blobs of the export.
+func (e *BucketExport) Close() {
+	for _, release := range e.releases {
+		release()
+	}
+	e.releases = nil
+}
+
+// PrepareExport takes a snapshot of a bucket. If checkDirectory is set, it is called for every
+// directory and its error fails the export, before anything is written.
+func (s *BucketArchiveService) PrepareExport(ctx context.Context, bucketID string, checkDirectory func(ctx context.Context, directoryID string) error) (*BucketExport, error) {
+	bucket, err := s.bucketSvc.FindBucketByID(ctx, bucketID)
+	if err != nil || bucket == nil {
+		return nil, apperror.NewUserError("BUCKET_NOT_FOUND", "The requested bucket could not be found.")
+	}
+	root, err := s.dirRepo.FindRootByBucketID(ctx, bucketID)
+	if err != nil {
+		return nil, err
+	}
+
+	export := &BucketExport{
+		Manifest: &model.BucketManifest{
+			Format:     model.BucketArchiveFormat,
+			Version:    model.BucketArchiveVersion,
+			ExportedAt: time.Now().UnixMilli(),
+			Bucket: model.ManifestBucket{
+				Name:            bucket.Name,
+				CryptSpec:       bucket.CryptSpec,
+				CryptData:       bucket.CryptData,
+				MetaData:        bucket.MetaData,
+				RootDirectoryID: root.ID,
+			},
+		},
+		blobs: map[string]*model.Blob{},
+	}
+	if err := s.addDirectoryTree(ctx, export, root, checkDirectory); err != nil {
+		export.Close()
+		return nil, err
+	}
+	return export, nil
+}
+
+// addDirectoryTree adds root and everything below it to the export, parents first.
+func (s *BucketArchiveService) addDirectoryTree(ctx context.Context, export *BucketExport, root *model.Directory, checkDirectory func(ctx context.Context, directoryID string) error) error {
+	manifest := export.Manifest
+	queue := []model.Directory{*root}
+	for len(queue) > 0 {
+		dir := queue[0]
+		queue = queue[1:]
+		if checkDirectory != nil {
+			if err := checkDirectory(ctx, dir.ID); err != nil {
+				return err
+			}
+		}
+
+		item := model.ManifestDirectory{
+			ID:                dir.ID,
+			Name:              dir.Name,
+			MetaData:          dir.MetaData,
+			EncryptedMetaData: dir.EncryptedMetaData,
+		}
+		if dir.ParentDirectoryID != nil {
+			item.ParentDirectoryID = *dir.ParentDirectoryID
+		}
+		manifest.Directories = append(manifest.Directories, item)
+
+		children, err := s.dirRepo.ListChildDirectories(ctx, dir.BucketID, dir.ID)
+		if err != nil {
+			return err
+		}
+		queue = append(queue, children...)
+
+		files, err := s.fileRepo.ListByDirectory(ctx, dir.BucketID, dir.ID)
+		if err != nil {
+			return err
+		}
+		for _, f := range files {
+			file := model.ManifestFile{
+				ID:                f.ID,
+				ParentDirectoryID: f.ParentDirectoryID,
+				Name:              f.Name,
+				MetaData:          f.MetaData,
+				EncryptedMetaData: f.EncryptedMetaData,
+			}
+			// Files without a finished blob have no content to export
+			_, err := s.blobSvc.FindLatestFinishedBlob(ctx, f.BucketID, f.ID)
+			switch {
+			case err == nil:
+				blob, release, err := s.blobSvc.BeginRead(ctx, f.BucketID, f.ID)
+				if err != nil {
+					return err
+				}
+				export.releases = append(export.releases, release)
+				export.blobs[f.ID] = blob
+				file.Blob = &model.ManifestBlob{CryptoMeta: blob.CryptoMetaHeaderContent}
+			case !errors.Is(err, pgx.ErrNoRows):
+				return err
+			}
+			manifest.Files = append(manifest.Files, file)
+		}
+	}
+	return nil
+}
+
+// WriteExport writes the archive of an export to w.
+func (s *BucketArchiveService) WriteExport(ctx context.Context, export *BucketExport, w io.Writer) error {
+	modTime := time.UnixMilli(export.Manifest.ExportedAt)
+	tw := tar.NewWriter(w)
+	checksums := map[string]string{}
+
+	manifest, err := json.Marshal(export.Manifest)
+	if err != nil {
+		return err
+	}
+	if err := writeArchiveEntry(tw, model.BucketArchiveManifest, bytes.NewReader(manifest), int64(len(manifest)), modTime, checksums); err != nil {
+		return err
+	}
+
+	for _, file := range export.Manifest.Files {
+		blob := export.blobs[file.ID]
+		if blob == nil {
+			continue
+		}
+		content, size, err := s.blobSvc.OpenBlobForExport(ctx, blob)
+		if err != nil {
+			return err
+		}
+		err = writeArchiveEntry(tw, model.BucketArchiveBlobDir+file.ID, content, size, modTime, checksums)
+		content.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	data, err := json.Marshal(checksums)
+	if err != nil {
+		return err
+	}
+	if err := writeArchiveEntry(tw, model.BucketArchiveChecksums, bytes.NewReader(data), int64(len(data)), modTime, nil); err != nil {
+		return err
+	}
+	return tw.Close()
+}
+
+// writeArchiveEntry writes a file of size bytes read from r to the archive, and records its
+// SHA-256 in checksums unless checksums is nil.
+func writeArchiveEntry(tw *tar.Writer, name string, r io.Reader, size int64, modTime time.Time, checksums map[string]string) error {
+	header := &tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Mode:     0o600,
+		Size:     size,
+		ModTime:  modTime,
+	}
+	if err := tw.WriteHeader(header); err != nil {
+		return err
+	}
+	hash := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(tw, hash), r); err != nil {
+		return fmt.Errorf("failed to write %s to the archive: %w", name, err)
+	}
+	if checksums != nil {
+		checksums[name] = hex.EncodeToString(hash.Sum(nil))
+	}
+	return nil
+}
+
+// bucketImport tracks what an import has created so far, by the IDs of the archive.
+type bucketImport struct {
+	bucketID     string
+	ownerUserID  string
+	directoryIDs map[string]string
+	fileIDs      map[string]string
+	blobs        map[string]*importedBlob
+}
+
+// importedBlob is a blob written by an import, not yet finished.
+type importedBlob struct {
+	blobID string
+	size   int64
+	sha256 string
+}
+
+// Import creates a bucket owned by ownerUserID from an archive written by WriteExport, with new
+// IDs throughout. The bucket is named name, or as in the archive if name is empty. The bucket is
+// removed again unless the whole archive is read and matches its checksums.
+func (s *BucketArchiveService) Import(ctx context.Context, r io.Reader, name, ownerUserID string) (*model.Bucket, string, error) {
+	tr := tar.NewReader(r)
+	header, err := tr.Next()
+	if err != nil {
+		return nil, "", invalidArchive("The archive could not be read.")
+	}
+	if header.Name != model.BucketArchiveManifest {
+		return nil, "", invalidArchive("The archive does not start with " + model.BucketArchiveManifest + ".")
+	}
+	data, err := readArchiveJSON(tr)
+	if err != nil {
+		return nil, "", err
+	}
+	var manifest model.BucketManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, "", invalidArchive("The manifest is not valid JSON.")
+	}
+	if err := validateManifest(&manifest); err != nil {
+		return nil, "", err
+	}
+	manifestSum := sha256.Sum256(data)
+
+	if name == "" {
+		name = manifest.Bucket.Name
+	}
+	bucket, rootDirID, err := s.bucketSvc.CreateBucketWithRootID(ctx, name, manifest.Bucket.CryptSpec, manifest.Bucket.CryptData, manifest.Bucket.MetaData, ownerUserID)
+	if err != nil {
+		return nil, "", err
+	}
+
+	imp := &bucketImport{
+		bucketID:     bucket.ID,
+		ownerUserID:  ownerUserID,
+		directoryIDs: map[string]string{manifest.Bucket.RootDirectoryID: rootDirID},
+		fileIDs:      map[string]string{},
+		blobs:        map[string]*importedBlob{},
+	}
+	if err := s.importContent(ctx, tr, &manifest, hex.EncodeToString(manifestSum[:]), imp); err != nil {
+		s.discardImport(imp)
+		return nil, "", err
+	}
+	return bucket, rootDirID, nil
+}
+
+// importContent creates the directories and files of the manifest, then writes and verifies their
+// blobs, and finishes them once all are verified.
+func (s *BucketArchiveService) importContent(ctx context.Context, tr *tar.Reader, manifest *model.BucketManifest, manifestSum string, imp *bucketImport) error {
+	root := manifest.Directories[0]
+	rootDirID := imp.directoryIDs[root.ID]
+	if _, err := s.dirRepo.UpdateMetaData(ctx, imp.bucketID, rootDirID, root.MetaData, 0); err != nil {
+		return err
+	}
+	if _, err := s.dirRepo.UpdateEncryptedMetaData(ctx, imp.bucketID, rootDirID, root.EncryptedMetaData, 0); err != nil {
+		return err
+	}
+	for _, d := range manifest.Directories[1:] {
+		id, err := randstr.GenerateID(16)
+		if err != nil {
+			return apperror.NewDeveloperError("ID_GENERATION_FAILED", "Failed to generate directory ID.")
+		}
+		parentID := imp.directoryIDs[d.ParentDirectoryID]
+		err = s.dirRepo.Create(ctx, &model.Directory{
+			ID:                id,
+			BucketID:          imp.bucketID,
+			ParentDirectoryID: &parentID,
+			Name:              d.Name,
+			MetaData:          d.MetaData,
+			EncryptedMetaData: d.EncryptedMetaData,
+			CreatedByUserID:   imp.ownerUserID,
+		})
+		if err != nil {
+			return err
+		}
+		imp.directoryIDs[d.ID] = id
+	}
+
+	files := make(map[string]*model.ManifestFile, len(manifest.Files))
+	for i := range manifest.Files {
+		f := &manifest.Files[i]
+		id, err := randstr.GenerateID(16)
+		if err != nil {
+			return apperror.NewDeveloperError("ID_GENERATION_FAILED", "Failed to generate file ID.")
+		}
+		err = s.fileRepo.Create(ctx, &model.File{
+			ID:                id,
+			BucketID:          imp.bucketID,
+			ParentDirectoryID: imp.directoryIDs[f.ParentDirectoryID],
+			Name:              f.Name,
+			MetaData:          f.MetaData,
+			EncryptedMetaData: f.EncryptedMetaData,
+			CreatedByUserID:   imp.ownerUserID,
+		})
+		if err != nil {
+			return err
+		}
+		imp.fileIDs[f.ID] = id
+		files[f.ID] = f
+	}
+
+	checksums, err := s.importBlobs(ctx, tr, files, imp)
+	if err != nil {
+		return err
+	}
+	if err := verifyChecksums(checksums, manifestSum, manifest, imp.blobs); err != nil {
+		return err
+	}
+
+	for _, f := range manifest.Files {
+		blob := imp.blobs[f.ID]
+		if blob == nil {
+			continue
+		}
+		fileID := imp.fileIDs[f.ID]
+		if err := s.blobSvc.FinishBlob(ctx, imp.bucketID, fileID, blob.blobID, ""); err != nil {
+			return err
+		}
+		if err := s.fileRepo.UpdateSize(ctx, imp.bucketID, fileID, blob.size); err != nil {
+			return err
+		}
+		if err := s.fileRepo.UpdateContentUpdatedAt(ctx, imp.bucketID, fileID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// importBlobs writes the blob entries of the archive to in-progress blobs, hashing them on the
+// way, and returns the checksums that end the archive.
+func (s *BucketArchiveService) importBlobs(ctx context.Context, tr *tar.Reader, files map[string]*model.ManifestFile, imp *bucketImport) (map[string]string, error) {
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil, invalidArchive("The archive ends without " + model.BucketArchiveChecksums + ".")
+		}
+		if err != nil {
+			return nil, invalidArchive("The archive is truncated or corrupt.")
+		}
+
+		if header.Name == model.BucketArchiveChecksums {
+			data, err := readArchiveJSON(tr)
+			if err != nil {
+				return nil, err
+			}
+			var checksums map[string]string
+			if err := json.Unmarshal(data, &checksums); err != nil {
+				return nil, invalidArchive("The checksums are not valid JSON.")
+			}
+			if _, err := tr.Next(); !errors.Is(err, io.EOF) {
+				return nil, invalidArchive(model.BucketArchiveChecksums + " must be the last entry of the archive.")
+			}
+			return checksums, nil
+		}
+
+		oldFileID := strings.TrimPrefix(header.Name, model.BucketArchiveBlobDir)
+		file := files[oldFileID]
+		if oldFileID == header.Name || file == nil || file.Blob == nil || imp.blobs[oldFileID] != nil {
+			return nil, invalidArchive(fmt.Sprintf("Unexpected archive entry %q.", header.Name))
+		}
+
+		blob, err := s.blobSvc.CreateInProgressBlob(ctx, imp.bucketID, imp.fileIDs[oldFileID], file.Blob.CryptoMeta, imp.ownerUserID)
+		if err != nil {
+			return nil, err
+		}
+		imported := &importedBlob{blobID: blob.ID, size: header.Size}
+		imp.blobs[oldFileID] = imported
+		if err := s.blobSvc.MarkBlobUploading(ctx, blob.ID); err != nil {
+			return nil, err
+		}
+		hash := sha256.New()
+		err = s.blobSvc.UploadBlobFromReader(ctx, blob.ID, io.TeeReader(tr, hash), header.Size)
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, invalidArchive("The archive is truncated or corrupt.")
+		}
+		if err != nil {
+			return nil, err
+		}
+		imported.sha256 = hex.EncodeToString(hash.Sum(nil))
+	}
+}
+
+// discardImport deletes what a failed import created.
+func (s *BucketArchiveService) discardImport(imp *bucketImport) {
+	// The request may be cancelled by now
+	ctx := context.Background()
+	if err := s.blobSvc.RemoveAllBlobsOfBucket(ctx, imp.bucketID); err != nil {
+		log.Warn().Err(err).Str("bucketId", imp.bucketID).Msg("failed to remove blobs of a failed import")
+	}
+	if err := s.bucketSvc.DestroyBucket(ctx, imp.bucketID); err != nil {
+		log.Warn().Err(err).Str("bucketId", imp.bucketID).Msg("failed to remove the bucket of a failed import")
+	}
+}
+
+// readArchiveJSON reads the current entry of the archive, which must not exceed maxArchiveJSONBytes.
+func readArchiveJSON(tr *tar.Reader) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(tr, maxArchiveJSONBytes+1))
+	if err != nil {
+		return nil, invalidArchive("The archive is truncated or corrupt.")
+	}
+	if len(data) > maxArchiveJSONBytes {
+		return nil, invalidArchive("The manifest or checksums of the archive are too large.")
+	}
+	return data, nil
+}
+
+// validateManifest checks that a manifest describes a bucket that can be imported: a known format,
+// the root directory first, every parent before its children and no duplicate IDs or names.
+func validateManifest(m *model.BucketManifest) error {
+	if m.Format != model.BucketArchiveFormat || m.Version != model.BucketArchiveVersion {
+		return invalidArchive(fmt.Sprintf("Unsupported archive format %q version %d.", m.Format, m.Version))
+	}
+	b := m.Bucket
+	if b.Name == "" || len(b.Name) > 64 || b.CryptSpec == "" || b.CryptData == "" || len(b.MetaData) == 0 {
+		return invalidArchive("The bucket in the manifest is incomplete.")
+	}
+	if len(m.Directories) == 0 || m.Directories[0].ID != b.RootDirectoryID || m.Directories[0].ParentDirectoryID != "" {
+		return invalidArchive("The manifest must list the root directory first.")
+	}
+
+	directories := map[string]bool{}
+	names := map[string]bool{}
+	for i, d := range m.Directories {
+		switch {
+		case d.ID == "" || directories[d.ID]:
+			return invalidArchive(fmt.Sprintf("Directory %q is listed more than once or has no ID.", d.ID))
+		case i > 0 && !directories[d.ParentDirectoryID]:
+			return invalidArchive(fmt.Sprintf("Directory %q is listed before its parent.", d.ID))
+		case d.Name == "" || len(d.Name) > 256 || len(d.MetaData) == 0:
+			return invalidArchive(fmt.Sprintf("Directory %q is incomplete.", d.ID))
+		}
+		key := "d/" + d.ParentDirectoryID + "/" + d.Name
+		if i > 0 && names[key] {
+			return invalidArchive(fmt.Sprintf("Directory %q has the name of another directory in its parent.", d.ID))
+		}
+		directories[d.ID] = true
+		names[key] = true
+	}
+
+	files := map[string]bool{}
+	for _, f := range m.Files {
+		switch {
+		case f.ID == "" || files[f.ID]:
+			return invalidArchive(fmt.Sprintf("File %q is listed more than once or has no ID.", f.ID))
+		case !directories[f.ParentDirectoryID]:
+			return invalidArchive(fmt.Sprintf("The directory of file %q is not in the manifest.", f.ID))
+		case f.Name == "" || len(f.Name) > 256 || len(f.MetaData) == 0:
+			return invalidArchive(fmt.Sprintf("File %q is incomplete.", f.ID))
+		}
+		key := "f/" + f.ParentDirectoryID + "/" + f.Name
+		if names[key] {
+			return invalidArchive(fmt.Sprintf("File %q has the name of another file in its directory.", f.ID))
+		}
+		files[f.ID] = true
+		names[key] = true
+	}
+	return nil
+}
+
+// verifyChecksums checks that the archive listed exactly the manifest and the blobs of its files,
+// and that their content matches.
+func verifyChecksums(checksums map[string]string, manifestSum string, manifest *model.BucketManifest, blobs map[string]*importedBlob) error {
+	if checksums[model.BucketArchiveManifest] != manifestSum {
+		return checksumMismatch(model.BucketArchiveManifest)
+	}
+	expected := 1
+	for _, f := range manifest.Files {
+		if f.Blob == nil {
+			continue
+		}
+		expected++
+		name := model.BucketArchiveBlobDir + f.ID
+		blob := blobs[f.ID]
+		if blob == nil {
+			return invalidArchive(fmt.Sprintf("The archive lacks the content of file %q.", f.ID))
+		}
+		if checksums[name] != blob.sha256 {
+			return checksumMismatch(name)
+		}
+	}
+	if len(checksums) != expected {
+		return invalidArchive("The checksums list entries that are not in the archive.")
+	}
+	return nil
+}
+
+func invalidArchive(message string) error {
+	return apperror.NewUserError("ARCHIVE_INVALID", message)
+}
+
+func checksumMismatch(name string) error {
+	return apperror.NewUserError("ARCHIVE_CHECKSUM_MISMATCH", fmt.Sprintf("The content of %s does not match its checksum.", name))
+}
@@ -0,0 +1,92 @@
+package service
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/nkrypt-xyz/nkrypt-xyz-web-server/internal/model"
+)
+
+func testManifest() *model.BucketManifest {
+	meta := json.RawMessage(`{}`)
+	return &model.BucketManifest{
+		Format:  model.BucketArchiveFormat,
+		Version: model.BucketArchiveVersion,
+		Bucket: model.ManifestBucket{
+			Name:            "photos",
+			CryptSpec:       "spec",
+			CryptData:       "data",
+			MetaData:        meta,
+			RootDirectoryID: "root000000000001",
+		},
+		Directories: []model.ManifestDirectory{
+			{ID: "root000000000001", Name: "photos", MetaData: meta},
+			{ID: "dir0000000000001", ParentDirectoryID: "root000000000001", Name: "2024", MetaData: meta},
+		},
+		Files: []model.ManifestFile{
+			{ID: "file000000000001", ParentDirectoryID: "dir0000000000001", Name: "a.jpg", MetaData: meta, Blob: &model.ManifestBlob{CryptoMeta: "iv"}},
+			// A file may share its name with a directory
+			{ID: "file000000000002", ParentDirectoryID: "root000000000001", Name: "2024", MetaData: meta},
+		},
+	}
+}
+
+func TestValidateManifest(t *testing.T) {
+	if err := validateManifest(testManifest()); err != nil {
+		t.Fatalf("Expected a valid manifest, got %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		modify func(m *model.BucketManifest)
+	}{
+		{name: "unknown version", modify: func(m *model.BucketManifest) { m.Version = 2 }},
+		{name: "missing crypt data", modify: func(m *model.BucketManifest) { m.Bucket.CryptData = "" }},
+		{name: "root not first", modify: func(m *model.BucketManifest) {
+			m.Directories[0], m.Directories[1] = m.Directories[1], m.Directories[0]
+		}},
+		{name: "unknown parent", modify: func(m *model.BucketManifest) { m.Directories[1].ParentDirectoryID = "missing000000001" }},
+		{name: "duplicate directory ID", modify: func(m *model.BucketManifest) { m.Directories[1].ID = "root000000000001" }},
+		{name: "duplicate directory name", modify: func(m *model.BucketManifest) {
+			m.Directories = append(m.Directories, model.ManifestDirectory{ID: "dir0000000000002", ParentDirectoryID: "root000000000001", Name: "2024", MetaData: json.RawMessage(`{}`)})
+		}},
+		{name: "file outside the tree", modify: func(m *model.BucketManifest) { m.Files[0].ParentDirectoryID = "file000000000002" }},
+		{name: "duplicate file name", modify: func(m *model.BucketManifest) {
+			m.Files[1].ParentDirectoryID, m.Files[1].Name = "dir0000000000001", "a.jpg"
+		}},
+		{name: "missing file metadata", modify: func(m *model.BucketManifest) { m.Files[1].MetaData = nil }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := testManifest()
+			tt.modify(m)
+			if err := validateManifest(m); errorCode(err) != "ARCHIVE_INVALID" {
+				t.Errorf("Expected ARCHIVE_INVALID, got %v", err)
+			}
+		})
+	}
+}
+
+func TestVerifyChecksums(t *testing.T) {
+	m := testManifest()
+	blobs := map[string]*importedBlob{"file000000000001": {sha256: "bbbb"}}
+	checksums := map[string]string{model.BucketArchiveManifest: "aaaa", "blobs/file000000000001": "bbbb"}
+	if err := verifyChecksums(checksums, "aaaa", m, blobs); err != nil {
+		t.Fatalf("Expected matching checksums to pass, got %v", err)
+	}
+
+	if err := verifyChecksums(checksums, "cccc", m, blobs); errorCode(err) != "ARCHIVE_CHECKSUM_MISMATCH" {
+		t.Errorf("Expected a manifest mismatch, got %v", err)
+	}
+	tampered := map[string]*importedBlob{"file000000000001": {sha256: "cccc"}}
+	if err := verifyChecksums(checksums, "aaaa", m, tampered); errorCode(err) != "ARCHIVE_CHECKSUM_MISMATCH" {
+		t.Errorf("Expected a blob mismatch, got %v", err)
+	}
+	if err := verifyChecksums(checksums, "aaaa", m, map[string]*importedBlob{}); errorCode(err) != "ARCHIVE_INVALID" {
+		t.Errorf("Expected a missing blob to be rejected, got %v", err)
+	}
+	checksums["blobs/file000000000002"] = "dddd"
+	if err := verifyChecksums(checksums, "aaaa", m, blobs); errorCode(err) != "ARCHIVE_INVALID" {
+		t.Errorf("Expected an extra checksum to be rejected, got %v", err)
+	}
+}
@@ -3,6 +3,9 @@ package service
 import (
 	"context"
 	"encoding/json"
+	"errors"
+
+	"github.com/jackc/pgx/v5"
 
 	"github.com/nkrypt-xyz/nkrypt-xyz-web-server/internal/model"
 	"github.com/nkrypt-xyz/nkrypt-xyz-web-server/internal/pkg/apperror"
@@ -13,10 +16,12 @@ import (
 type BucketService struct {
 	bucketRepo    *repository.BucketRepository
 	directoryRepo *repository.DirectoryRepository
+	groupRepo     *repository.GroupRepository
+	userRepo      *repository.UserRepository
 }
 
-func NewBucketService(bucketRepo *repository.BucketRepository, directoryRepo *repository.DirectoryRepository) *BucketService {
-	return &BucketService{bucketRepo: bucketRepo, directoryRepo: directoryRepo}
+func NewBucketService(bucketRepo *repository.BucketRepository, directoryRepo *repository.DirectoryRepository, groupRepo *repository.GroupRepository, userRepo *repository.UserRepository) *BucketService {
+	return &BucketService{bucketRepo: bucketRepo, directoryRepo: directoryRepo, groupRepo: groupRepo, userRepo: userRepo}
 }
 
 func (s *BucketService) FindBucketByID(ctx context.Context, id string) (*model.Bucket, error) {
@@ -119,6 +124,18 @@ func (s *BucketService) ListBucketsForUser(ctx context.Context, userID string) (
 				Permissions: bucketPermissionToMap(&p),
 			})
 		}
+		groupPerms, err := s.bucketRepo.ListGroupPermissionsByBucketID(ctx, bucketID)
+		if err != nil {
+			return nil, err
+		}
+		groupAuths := make([]model.BucketGroupAuthorizationItem, 0, len(groupPerms))
+		for _, p := range groupPerms {
+			groupAuths = append(groupAuths, model.BucketGroupAuthorizationItem{
+				GroupID:     p.GroupID,
+				Notes:       p.Notes,
+				Permissions: bucketGroupPermissionToMap(&p),
+			})
+		}
 		result = append(result, model.BucketListItem{
 			ID:                   b.ID,
 			Name:                 b.Name,
@@ -126,10 +143,13 @@ func (s *BucketService) ListBucketsForUser(ctx context.Context, userID string) (
 			CryptSpec:            b.CryptSpec,
 			CryptData:            b.CryptData,
 			MetaData:             b.MetaData,
+			Compression:          b.Compression,
 			CreatedByUserID:      b.CreatedByUserID,
 			CreatedAt:            b.CreatedAt,
 			UpdatedAt:            b.UpdatedAt,
+			Version:              b.Version,
 			BucketAuthorizations: auths,
+			BucketGroupAuthorizations: groupAuths,
 		})
 	}
 	return result, nil
@@ -145,20 +165,38 @@ func bucketPermissionToMap(p *model.BucketPermission) map[string]bool {
 	}
 }
 
-func (s *BucketService) RenameBucket(ctx context.Context, bucketID, name string) error {
+func bucketGroupPermissionToMap(p *model.BucketGroupPermission) map[string]bool {
+	return map[string]bool{
+		"MODIFY":               p.PermModify,
+		"MANAGE_AUTHORIZATION": p.PermManageAuthorization,
+		"DESTROY":              p.PermDestroy,
+		"VIEW_CONTENT":         p.PermViewContent,
+		"MANAGE_CONTENT":       p.PermManageContent,
+	}
+}
+
+// RenameBucket renames the bucket and returns its new version. A non-zero expectedVersion makes the
+// rename fail with VERSION_CONFLICT unless the bucket is still at that version; likewise for
+// SetBucketMetaData.
+func (s *BucketService) RenameBucket(ctx context.Context, bucketID, name string, expectedVersion int64) (int64, error) {
 	existing, _ := s.bucketRepo.FindByName(ctx, name)
 	if existing != nil && existing.ID != bucketID {
-		return apperror.NewUserError("DUPLICATE_BUCKET_NAME", "A bucket with this name already exists.")
+		return 0, apperror.NewUserError("DUPLICATE_BUCKET_NAME", "A bucket with this name already exists.")
 	}
-	return s.bucketRepo.UpdateName(ctx, bucketID, name)
+	return versioned(s.bucketRepo.UpdateName(ctx, bucketID, name, expectedVersion))
 }
 
-func (s *BucketService) SetBucketMetaData(ctx context.Context, bucketID string, metaData interface{}) error {
+func (s *BucketService) SetBucketMetaData(ctx context.Context, bucketID string, metaData interface{}, expectedVersion int64) (int64, error) {
 	metaBytes, err := json.Marshal(metaData)
 	if err != nil {
-		return apperror.NewDeveloperError("INVALID_METADATA", "Failed to serialize metadata.")
+		return 0, apperror.NewDeveloperError("INVALID_METADATA", "Failed to serialize metadata.")
 	}
-	return s.bucketRepo.UpdateMetaData(ctx, bucketID, metaBytes)
+	return versioned(s.bucketRepo.UpdateMetaData(ctx, bucketID, metaBytes, expectedVersion))
+}
+
+// SetBucketCompression sets the codec that blobs written to the bucket from now on are stored with.
+func (s *BucketService) SetBucketCompression(ctx context.Context, bucketID, compression string, expectedVersion int64) (int64, error) {
+	return versioned(s.bucketRepo.UpdateCompression(ctx, bucketID, compression, expectedVersion))
 }
 
 func (s *BucketService) DestroyBucket(ctx context.Context, bucketID string) error {
@@ -186,6 +224,11 @@ func (s *BucketService) SetBucketAuthorization(ctx context.Context, bucketID, ta
 		p.PermModify = v
 	}
 	if v, ok := permissionsToSet["MANAGE_AUTHORIZATION"]; ok {
+		if p.PermManageAuthorization && !v {
+			if err := s.ensureAuthorizationManagerRemains(ctx, bucketID, targetUserID, ""); err != nil {
+				return err
+			}
+		}
 		p.PermManageAuthorization = v
 	}
 	if v, ok := permissionsToSet["DESTROY"]; ok {
@@ -200,6 +243,222 @@ func (s *BucketService) SetBucketAuthorization(ctx context.Context, bucketID, ta
 	return s.bucketRepo.UpdatePermission(ctx, p)
 }
 
+// SetBucketGroupAuthorization creates or updates the permissions granted to a group on a bucket.
+func (s *BucketService) SetBucketGroupAuthorization(ctx context.Context, bucketID, targetGroupID string, permissionsToSet map[string]bool, authorizingUserName string) error {
+	if g, err := s.groupRepo.FindByID(ctx, targetGroupID); err != nil || g == nil {
+		return apperror.NewUserError("GROUP_NOT_FOUND", "The requested group could not be found.")
+	}
+	p, err := s.bucketRepo.FindGroupPermission(ctx, bucketID, targetGroupID)
+	if err != nil || p == nil {
+		p = &model.BucketGroupPermission{
+			BucketID: bucketID,
+			GroupID:  targetGroupID,
+			Notes:    "Authorized by @" + authorizingUserName,
+		}
+		if err := s.bucketRepo.CreateGroupPermission(ctx, p); err != nil {
+			return err
+		}
+	}
+	if v, ok := permissionsToSet["MODIFY"]; ok {
+		p.PermModify = v
+	}
+	if v, ok := permissionsToSet["MANAGE_AUTHORIZATION"]; ok {
+		if p.PermManageAuthorization && !v {
+			if err := s.ensureAuthorizationManagerRemains(ctx, bucketID, "", targetGroupID); err != nil {
+				return err
+			}
+		}
+		p.PermManageAuthorization = v
+	}
+	if v, ok := permissionsToSet["DESTROY"]; ok {
+		p.PermDestroy = v
+	}
+	if v, ok := permissionsToSet["VIEW_CONTENT"]; ok {
+		p.PermViewContent = v
+	}
+	if v, ok := permissionsToSet["MANAGE_CONTENT"]; ok {
+		p.PermManageContent = v
+	}
+	return s.bucketRepo.UpdateGroupPermission(ctx, p)
+}
+
+// RemoveBucketMember deletes the user's direct grant on the bucket. Access the user holds through
+// groups is unaffected. The owner cannot be removed, and neither can the last user holding
+// MANAGE_AUTHORIZATION.
+func (s *BucketService) RemoveBucketMember(ctx context.Context, bucketID, targetUserID string) error {
+	bucket, err := s.bucketRepo.FindByID(ctx, bucketID)
+	if err != nil || bucket == nil {
+		return apperror.NewUserError("BUCKET_NOT_FOUND", "The requested bucket could not be found.")
+	}
+	if bucket.CreatedByUserID == targetUserID {
+		return apperror.NewUserError("CANNOT_REMOVE_BUCKET_OWNER", "The bucket owner cannot be removed. Transfer ownership first.")
+	}
+	p, err := s.bucketRepo.FindPermission(ctx, bucketID, targetUserID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return apperror.NewUserError("USER_NOT_BUCKET_MEMBER", "The user is not directly authorized on this bucket.")
+	}
+	if err != nil {
+		return err
+	}
+	if p.PermManageAuthorization {
+		if err := s.ensureAuthorizationManagerRemains(ctx, bucketID, targetUserID, ""); err != nil {
+			return err
+		}
+	}
+	return s.bucketRepo.DeletePermission(ctx, bucketID, targetUserID)
+}
+
+// TransferBucketOwnership makes newOwnerUserID the owner of the bucket and grants them every
+// bucket permission. The previous owner keeps their existing grant.
+func (s *BucketService) TransferBucketOwnership(ctx context.Context, bucketID, newOwnerUserID, authorizingUserName string) error {
+	bucket, err := s.bucketRepo.FindByID(ctx, bucketID)
+	if err != nil || bucket == nil {
+		return apperror.NewUserError("BUCKET_NOT_FOUND", "The requested bucket could not be found.")
+	}
+	newOwner, err := s.userRepo.FindUserByID(ctx, newOwnerUserID)
+	if err != nil || newOwner == nil {
+		return apperror.NewUserError("USER_NOT_FOUND", "The requested user could not be found.")
+	}
+	if newOwner.IsBanned {
+		return apperror.NewUserError("USER_BANNED", "A banned user cannot own a bucket.")
+	}
+	if bucket.CreatedByUserID == newOwnerUserID {
+		return nil
+	}
+	allPermissions := map[string]bool{
+		"MODIFY":               true,
+		"MANAGE_AUTHORIZATION": true,
+		"DESTROY":              true,
+		"VIEW_CONTENT":         true,
+		"MANAGE_CONTENT":       true,
+	}
+	if err := s.SetBucketAuthorization(ctx, bucketID, newOwnerUserID, allPermissions, authorizingUserName); err != nil {
+		return err
+	}
+	return s.bucketRepo.UpdateOwner(ctx, bucketID, newOwnerUserID)
+}
+
+// ListBucketMembers returns every user with access to the bucket, merging direct and group grants.
+func (s *BucketService) ListBucketMembers(ctx context.Context, bucketID string) ([]model.BucketMember, error) {
+	bucket, err := s.bucketRepo.FindByID(ctx, bucketID)
+	if err != nil || bucket == nil {
+		return nil, apperror.NewUserError("BUCKET_NOT_FOUND", "The requested bucket could not be found.")
+	}
+	directPerms, err := s.bucketRepo.ListPermissionsByBucketID(ctx, bucketID)
+	if err != nil {
+		return nil, err
+	}
+	groupPerms, err := s.bucketRepo.ListGroupPermissionsByBucketID(ctx, bucketID)
+	if err != nil {
+		return nil, err
+	}
+
+	var userIDs []string
+	directByUser := make(map[string]*model.BucketPermission, len(directPerms))
+	for i := range directPerms {
+		directByUser[directPerms[i].UserID] = &directPerms[i]
+		userIDs = append(userIDs, directPerms[i].UserID)
+	}
+	groupsByUser := make(map[string][]model.BucketGroupPermission)
+	for _, gp := range groupPerms {
+		members, err := s.groupRepo.ListMembers(ctx, gp.GroupID)
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range members {
+			if _, seen := directByUser[m.UserID]; !seen && len(groupsByUser[m.UserID]) == 0 {
+				userIDs = append(userIDs, m.UserID)
+			}
+			groupsByUser[m.UserID] = append(groupsByUser[m.UserID], gp)
+		}
+	}
+	if len(userIDs) == 0 {
+		return nil, nil
+	}
+
+	users, err := s.userRepo.QueryUsersByIDs(ctx, userIDs)
+	if err != nil {
+		return nil, err
+	}
+	usersByID := make(map[string]model.User, len(users))
+	for _, u := range users {
+		usersByID[u.ID] = u
+	}
+
+	out := make([]model.BucketMember, 0, len(userIDs))
+	for _, userID := range userIDs {
+		direct := directByUser[userID]
+		groups := groupsByUser[userID]
+		merged := mergeBucketPermissions(direct, groups)
+		member := model.BucketMember{
+			UserID:      userID,
+			UserName:    usersByID[userID].UserName,
+			DisplayName: usersByID[userID].DisplayName,
+			Permissions: bucketPermissionToMap(merged),
+			GroupIDs:    make([]string, 0, len(groups)),
+			IsOwner:     bucket.CreatedByUserID == userID,
+		}
+		if direct != nil {
+			member.Notes = direct.Notes
+		}
+		for _, g := range groups {
+			member.GroupIDs = append(member.GroupIDs, g.GroupID)
+		}
+		out = append(out, member)
+	}
+	return out, nil
+}
+
+// ensureAuthorizationManagerRemains rejects a change that would leave the bucket without any user
+// holding MANAGE_AUTHORIZATION once the given user's direct grant or group's grant loses it.
+func (s *BucketService) ensureAuthorizationManagerRemains(ctx context.Context, bucketID, excludeUserID, excludeGroupID string) error {
+	count, err := s.bucketRepo.CountAuthorizationManagers(ctx, bucketID, excludeUserID, excludeGroupID)
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return lastAuthorizationManager()
+	}
+	return nil
+}
+
+func lastAuthorizationManager() error {
+	return apperror.NewUserError("LAST_AUTHORIZATION_MANAGER",
+		"This change would leave the bucket without anyone holding the \"MANAGE_AUTHORIZATION\" permission.")
+}
+
+// GetUserBucketPermissions returns the user's effective permissions on a bucket: the direct
+// bucket_user_permissions grant merged with every grant made to a group the user belongs to.
+// Returns nil when the user has neither kind of grant.
 func (s *BucketService) GetUserBucketPermissions(ctx context.Context, bucketID, userID string) (*model.BucketPermission, error) {
-	return s.bucketRepo.FindPermission(ctx, bucketID, userID)
+	direct, err := s.bucketRepo.FindPermission(ctx, bucketID, userID)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return nil, err
+	}
+	groupPerms, err := s.bucketRepo.ListGroupPermissionsForUser(ctx, bucketID, userID)
+	if err != nil {
+		return nil, err
+	}
+	return mergeBucketPermissions(direct, groupPerms), nil
+}
+
+// mergeBucketPermissions ORs the group grants into the direct grant. A permission is held if any
+// of the grants holds it.
+func mergeBucketPermissions(direct *model.BucketPermission, groupPerms []model.BucketGroupPermission) *model.BucketPermission {
+	if direct == nil && len(groupPerms) == 0 {
+		return nil
+	}
+	merged := model.BucketPermission{}
+	if direct != nil {
+		merged = *direct
+	}
+	for _, g := range groupPerms {
+		merged.BucketID = g.BucketID
+		merged.PermModify = merged.PermModify || g.PermModify
+		merged.PermManageAuthorization = merged.PermManageAuthorization || g.PermManageAuthorization
+		merged.PermDestroy = merged.PermDestroy || g.PermDestroy
+		merged.PermViewContent = merged.PermViewContent || g.PermViewContent
+		merged.PermManageContent = merged.PermManageContent || g.PermManageContent
+	}
+	return &merged
 }
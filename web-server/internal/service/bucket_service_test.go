@@ -0,0 +1,66 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/nkrypt-xyz/nkrypt-xyz-web-server/internal/model"
+)
+
+func TestMergeBucketPermissions_NoGrants(t *testing.T) {
+	if merged := mergeBucketPermissions(nil, nil); merged != nil {
+		t.Errorf("Expected nil when there are no grants, got %+v", merged)
+	}
+}
+
+func TestMergeBucketPermissions_DirectOnly(t *testing.T) {
+	direct := &model.BucketPermission{
+		BucketID:        "bucket0000000001",
+		UserID:          "user000000000001",
+		PermViewContent: true,
+	}
+
+	merged := mergeBucketPermissions(direct, nil)
+	if merged == nil {
+		t.Fatal("Expected merged permissions, got nil")
+	}
+	if !merged.PermViewContent {
+		t.Error("Expected VIEW_CONTENT from direct grant")
+	}
+	if merged.PermManageContent || merged.PermModify || merged.PermDestroy || merged.PermManageAuthorization {
+		t.Errorf("Expected no other permissions, got %+v", merged)
+	}
+}
+
+func TestMergeBucketPermissions_GroupOnly(t *testing.T) {
+	groups := []model.BucketGroupPermission{
+		{BucketID: "bucket0000000001", GroupID: "group00000000001", PermViewContent: true},
+		{BucketID: "bucket0000000001", GroupID: "group00000000002", PermManageContent: true},
+	}
+
+	merged := mergeBucketPermissions(nil, groups)
+	if merged == nil {
+		t.Fatal("Expected merged permissions, got nil")
+	}
+	if merged.BucketID != "bucket0000000001" {
+		t.Errorf("Expected bucket ID to be carried over, got %q", merged.BucketID)
+	}
+	if !merged.PermViewContent || !merged.PermManageContent {
+		t.Errorf("Expected VIEW_CONTENT and MANAGE_CONTENT from groups, got %+v", merged)
+	}
+	if merged.PermDestroy {
+		t.Error("Expected DESTROY to remain false")
+	}
+}
+
+func TestMergeBucketPermissions_DoesNotMutateDirect(t *testing.T) {
+	direct := &model.BucketPermission{PermViewContent: true}
+	groups := []model.BucketGroupPermission{{PermDestroy: true}}
+
+	merged := mergeBucketPermissions(direct, groups)
+	if !merged.PermDestroy || !merged.PermViewContent {
+		t.Errorf("Expected union of grants, got %+v", merged)
+	}
+	if direct.PermDestroy {
+		t.Error("Expected direct grant to be left untouched")
+	}
+}
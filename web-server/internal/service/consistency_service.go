@@ -0,0 +1,240 @@
+package service
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/nkrypt-xyz/nkrypt-xyz-web-server/internal/model"
+	"github.com/nkrypt-xyz/nkrypt-xyz-web-server/internal/pkg/storage"
+	"github.com/nkrypt-xyz/nkrypt-xyz-web-server/internal/repository"
+)
+
+// Kinds of blob/object inconsistencies
+const (
+	// IssueMissingObject is a finished blob whose object, or deduplicated content object, is gone
+	// from both the hot bucket and the tiering store.
+	// Repair copies the object back from the replica if replication is on and the replica has it,
+	// and otherwise marks the blob erroneous.
+	IssueMissingObject = "MISSING_OBJECT"
+	// IssueOrphanObject is a blob object without a blob row, or whose blob uses deduplicated
+	// content instead, or a content object without a content row. Repair deletes the object, also
+	// from the replica unless it is in the tiering store.
+	IssueOrphanObject = "ORPHAN_OBJECT"
+	// IssueOrphanChunk is a chunk object whose blob is not being uploaded. Repair deletes it.
+	IssueOrphanChunk = "ORPHAN_CHUNK"
+	// IssueStaleUpload is a blob that started uploading too long ago. Repair marks it erroneous
+	// and deletes its chunks.
+	IssueStaleUpload = "STALE_UPLOAD"
+	// IssueSupersededBlob is a superseded blob kept longer than a read can hold it, e.g. because
+	// the server reading it stopped. Repair deletes the blob and its object.
+	IssueSupersededBlob = "SUPERSEDED_BLOB"
+	// IssueContentRefCount is deduplicated content whose reference count differs from the number
+	// of blobs referencing it, e.g. because a bucket was destroyed along with its blobs. Repair
+	// recounts the references and deletes the content if none are left.
+	IssueContentRefCount = "CONTENT_REF_COUNT"
+)
+
+// staleUploadAge matches the expiry of the chunk offsets kept in Redis; an upload older than
+// that can no longer be finalized.
+const staleUploadAge = 24 * time.Hour
+
+// objectGracePeriod skips recently written objects, whose blob row may not be visible yet.
+const objectGracePeriod = time.Hour
+
+// ConsistencyIssue is one mismatch between the blobs table and object storage.
+type ConsistencyIssue struct {
+	Kind          string `json:"kind"`
+	BlobID        string `json:"blobId"`
+	ContentSHA256 string `json:"contentSha256,omitempty"`
+	ObjectKey     string `json:"objectKey,omitempty"`
+	Cold          bool   `json:"cold,omitempty"` // the object is in the tiering store
+	Repaired      bool   `json:"repaired"`
+}
+
+// ConsistencyReport is the result of a consistency check.
+type ConsistencyReport struct {
+	BlobsChecked   int                `json:"blobsChecked"`
+	ObjectsChecked int                `json:"objectsChecked"`
+	Issues         []ConsistencyIssue `json:"issues"`
+}
+
+type ConsistencyService struct {
+	blobRepo      *repository.BlobRepository
+	storageClient *storage.MinIOClient
+	replication   *ReplicationService // nil unless replication is on
+}
+
+func NewConsistencyService(blobRepo *repository.BlobRepository, storageClient *storage.MinIOClient, replication *ReplicationService) *ConsistencyService {
+	return &ConsistencyService{blobRepo: blobRepo, storageClient: storageClient, replication: replication}
+}
+
+// Check compares the blobs table with the stored objects. With repair set, every issue found is
+// also fixed; a failed repair is returned as the error after the remaining issues were tried.
+func (s *ConsistencyService) Check(ctx context.Context, repair bool) (*ConsistencyReport, error) {
+	// List objects before blobs, so an upload finishing in between shows up as a blob
+	objects, err := s.storageClient.ListBlobObjects(ctx)
+	if err != nil {
+		return nil, err
+	}
+	contentObjects, err := s.storageClient.ListContentObjects(ctx)
+	if err != nil {
+		return nil, err
+	}
+	coldObjects, err := s.storageClient.ListColdBlobObjects(ctx)
+	if err != nil {
+		return nil, err
+	}
+	objects = append(append(objects, contentObjects...), coldObjects...)
+	// List contents before blobs, so that a blob referencing new content finds it
+	contents, err := s.blobRepo.ListAllContents(ctx)
+	if err != nil {
+		return nil, err
+	}
+	blobs, err := s.blobRepo.ListAllBlobs(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &ConsistencyReport{
+		BlobsChecked:   len(blobs),
+		ObjectsChecked: len(objects),
+		Issues:         findInconsistencies(blobs, contents, objects, time.Now()),
+	}
+	if !repair {
+		return report, nil
+	}
+
+	var firstErr error
+	for i := range report.Issues {
+		if err := s.repair(ctx, &report.Issues[i]); err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		report.Issues[i].Repaired = true
+	}
+	return report, firstErr
+}
+
+func (s *ConsistencyService) repair(ctx context.Context, issue *ConsistencyIssue) error {
+	switch issue.Kind {
+	case IssueMissingObject:
+		if s.replication != nil {
+			err := s.replication.RestoreObject(ctx, issue.ObjectKey)
+			if err == nil {
+				return nil
+			}
+			log.Warn().Err(err).Str("objectKey", issue.ObjectKey).Msg("failed to restore missing object from the replica")
+		}
+		return s.blobRepo.MarkErroneous(ctx, issue.BlobID)
+	case IssueStaleUpload:
+		return s.blobRepo.MarkErroneous(ctx, issue.BlobID)
+	case IssueSupersededBlob:
+		return removeBlob(ctx, s.blobRepo, s.storageClient, s.replication, issue.BlobID)
+	case IssueContentRefCount:
+		_, err := s.blobRepo.RecountContentReferences(ctx, issue.ContentSHA256, deleteContentFunc(s.storageClient, s.replication))
+		return err
+	case IssueOrphanObject:
+		if issue.Cold {
+			return s.storageClient.ColdTier().DeleteObject(ctx, issue.ObjectKey)
+		}
+		if issue.ContentSHA256 != "" {
+			// The content may have been added again since it was checked
+			return s.blobRepo.DeleteUnusedContent(ctx, issue.ContentSHA256, deleteContentFunc(s.storageClient, s.replication))
+		}
+		if err := s.storageClient.DeleteObject(ctx, issue.ObjectKey); err != nil {
+			return err
+		}
+		s.replication.Enqueue(ctx, model.ReplicationOpDelete, issue.ObjectKey)
+		return nil
+	default:
+		return s.storageClient.DeleteObject(ctx, issue.ObjectKey)
+	}
+}
+
+// blobObjectKey returns the key of the object holding the content of a blob.
+func blobObjectKey(b *model.Blob) string {
+	if b.ContentSHA256 != nil {
+		return storage.ContentKey(*b.ContentSHA256)
+	}
+	return "blobs/" + b.ID
+}
+
+// findInconsistencies matches blobs and deduplicated contents against objects. A stale upload is
+// reported once; its chunks are reported as orphan chunks so that repairing deletes them. A blob
+// object may be in the hot bucket, the tiering store or both.
+func findInconsistencies(blobs []model.Blob, contents []model.BlobContent, objects []storage.ObjectInfo, now time.Time) []ConsistencyIssue {
+	byID := make(map[string]*model.Blob, len(blobs))
+	refCounts := make(map[string]int)
+	for i := range blobs {
+		byID[blobs[i].ID] = &blobs[i]
+		if blobs[i].ContentSHA256 != nil {
+			refCounts[*blobs[i].ContentSHA256]++
+		}
+	}
+
+	var issues []ConsistencyIssue
+	stale := make(map[string]bool)
+	for _, b := range blobs {
+		if b.InProgress() && now.Sub(b.StartedAt) > staleUploadAge {
+			stale[b.ID] = true
+			issues = append(issues, ConsistencyIssue{Kind: IssueStaleUpload, BlobID: b.ID})
+		}
+		if b.Status == model.BlobStatusSuperseded && b.SupersededAt != nil && now.Sub(*b.SupersededAt) > storage.ReadLeaseTTL {
+			issues = append(issues, ConsistencyIssue{Kind: IssueSupersededBlob, BlobID: b.ID, ObjectKey: blobObjectKey(&b)})
+		}
+	}
+
+	contentRows := make(map[string]bool, len(contents))
+	for _, c := range contents {
+		contentRows[c.SHA256] = true
+		if c.RefCount != refCounts[c.SHA256] {
+			issues = append(issues, ConsistencyIssue{Kind: IssueContentRefCount, ContentSHA256: c.SHA256, ObjectKey: storage.ContentKey(c.SHA256)})
+		}
+	}
+
+	stored := make(map[string]bool, len(objects))
+	for _, o := range objects {
+		if !o.IsChunk {
+			stored[o.Key] = true
+		}
+		if now.Sub(o.LastModified) < objectGracePeriod {
+			continue
+		}
+
+		if o.ContentSHA256 != "" {
+			if !contentRows[o.ContentSHA256] {
+				issues = append(issues, ConsistencyIssue{Kind: IssueOrphanObject, ContentSHA256: o.ContentSHA256, ObjectKey: o.Key})
+			}
+			continue
+		}
+		b := byID[o.BlobID]
+		switch {
+		case o.IsChunk && (b == nil || !b.InProgress() || stale[b.ID]):
+			issues = append(issues, ConsistencyIssue{Kind: IssueOrphanChunk, BlobID: o.BlobID, ObjectKey: o.Key})
+		case !o.IsChunk && (b == nil || b.ContentSHA256 != nil):
+			issues = append(issues, ConsistencyIssue{Kind: IssueOrphanObject, BlobID: o.BlobID, ObjectKey: o.Key, Cold: o.Cold})
+		}
+	}
+
+	for _, b := range blobs {
+		if b.Status == model.BlobStatusFinished && !stored[blobObjectKey(&b)] {
+			issues = append(issues, ConsistencyIssue{Kind: IssueMissingObject, BlobID: b.ID, ObjectKey: blobObjectKey(&b)})
+		}
+	}
+
+	sort.SliceStable(issues, func(i, j int) bool {
+		if issues[i].Kind != issues[j].Kind {
+			return issues[i].Kind < issues[j].Kind
+		}
+		if issues[i].BlobID != issues[j].BlobID {
+			return issues[i].BlobID < issues[j].BlobID
+		}
+		return issues[i].ContentSHA256 < issues[j].ContentSHA256
+	})
+	return issues
+}
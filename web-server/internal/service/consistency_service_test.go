@@ -0,0 +1,79 @@
+package service
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nkrypt-xyz/nkrypt-xyz-web-server/internal/model"
+	"github.com/nkrypt-xyz/nkrypt-xyz-web-server/internal/pkg/storage"
+)
+
+func TestFindInconsistencies(t *testing.T) {
+	now := time.Now()
+	old := now.Add(-48 * time.Hour)
+	recent := now.Add(-time.Minute)
+	shared := strings.Repeat("a", 64)
+	miscounted := strings.Repeat("b", 64)
+	orphaned := strings.Repeat("c", 64)
+
+	blobs := []model.Blob{
+		{ID: "blobfinishedok01", Status: "finished", StartedAt: old},
+		{ID: "blobfinishedgone", Status: "finished", StartedAt: old},
+		{ID: "blobuploading001", Status: "started", StartedAt: now.Add(-time.Minute)},
+		{ID: "blobstaleupload1", Status: "started", StartedAt: old},
+		{ID: "bloberroneous001", Status: "error", StartedAt: old},
+		{ID: "blobstalewrite01", Status: "uploading", StartedAt: old},
+		{ID: "blobsupersededok", Status: "superseded", StartedAt: old, SupersededAt: &recent},
+		{ID: "blobsupersededgo", Status: "superseded", StartedAt: old, SupersededAt: &old},
+		{ID: "blobdeduplicate1", Status: "finished", StartedAt: old, ContentSHA256: &shared},
+		{ID: "blobdeduplicate2", Status: "finished", StartedAt: old, ContentSHA256: &shared},
+		{ID: "blobmiscounted01", Status: "finished", StartedAt: old, ContentSHA256: &miscounted},
+		{ID: "blobcoldonly0001", Status: "finished", StartedAt: old, Location: model.BlobLocationCold},
+		{ID: "blobcoolingboth1", Status: "finished", StartedAt: old, Location: model.BlobLocationCooling},
+	}
+	contents := []model.BlobContent{
+		{SHA256: shared, RefCount: 2},
+		{SHA256: miscounted, RefCount: 3},
+	}
+	objects := []storage.ObjectInfo{
+		{Key: "blobs/blobfinishedok01", BlobID: "blobfinishedok01", LastModified: old},
+		{Key: "blobs/blobuploading001.chunk.0", BlobID: "blobuploading001", IsChunk: true, LastModified: old},
+		{Key: "blobs/blobstaleupload1.chunk.0", BlobID: "blobstaleupload1", IsChunk: true, LastModified: old},
+		{Key: "blobs/bloberroneous001.chunk.5", BlobID: "bloberroneous001", IsChunk: true, LastModified: old},
+		{Key: "blobs/blobnotindb0001", BlobID: "blobnotindb0001", LastModified: old},
+		{Key: "blobs/blobsupersededok", BlobID: "blobsupersededok", LastModified: old},
+		{Key: "blobs/blobsupersededgo", BlobID: "blobsupersededgo", LastModified: old},
+		// Written moments ago; its blob row may not be committed yet
+		{Key: "blobs/blobjustwritten1", BlobID: "blobjustwritten1", LastModified: now},
+		// Left behind after its content was deduplicated
+		{Key: "blobs/blobdeduplicate1", BlobID: "blobdeduplicate1", LastModified: old},
+		{Key: "contents/" + shared, ContentSHA256: shared, LastModified: old},
+		{Key: "contents/" + orphaned, ContentSHA256: orphaned, LastModified: old},
+		// In the tiering store only, in both tiers, and left behind in the tiering store
+		{Key: "blobs/blobcoldonly0001", BlobID: "blobcoldonly0001", Cold: true, LastModified: old},
+		{Key: "blobs/blobcoolingboth1", BlobID: "blobcoolingboth1", LastModified: old},
+		{Key: "blobs/blobcoolingboth1", BlobID: "blobcoolingboth1", Cold: true, LastModified: old},
+		{Key: "blobs/blobcoldorphan01", BlobID: "blobcoldorphan01", Cold: true, LastModified: old},
+	}
+
+	got := findInconsistencies(blobs, contents, objects, now)
+	want := []ConsistencyIssue{
+		{Kind: IssueContentRefCount, ContentSHA256: miscounted, ObjectKey: "contents/" + miscounted},
+		{Kind: IssueMissingObject, BlobID: "blobfinishedgone", ObjectKey: "blobs/blobfinishedgone"},
+		{Kind: IssueMissingObject, BlobID: "blobmiscounted01", ObjectKey: "contents/" + miscounted},
+		{Kind: IssueOrphanChunk, BlobID: "bloberroneous001", ObjectKey: "blobs/bloberroneous001.chunk.5"},
+		{Kind: IssueOrphanChunk, BlobID: "blobstaleupload1", ObjectKey: "blobs/blobstaleupload1.chunk.0"},
+		{Kind: IssueOrphanObject, ContentSHA256: orphaned, ObjectKey: "contents/" + orphaned},
+		{Kind: IssueOrphanObject, BlobID: "blobcoldorphan01", ObjectKey: "blobs/blobcoldorphan01", Cold: true},
+		{Kind: IssueOrphanObject, BlobID: "blobdeduplicate1", ObjectKey: "blobs/blobdeduplicate1"},
+		{Kind: IssueOrphanObject, BlobID: "blobnotindb0001", ObjectKey: "blobs/blobnotindb0001"},
+		{Kind: IssueStaleUpload, BlobID: "blobstaleupload1"},
+		{Kind: IssueStaleUpload, BlobID: "blobstalewrite01"},
+		{Kind: IssueSupersededBlob, BlobID: "blobsupersededgo", ObjectKey: "blobs/blobsupersededgo"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("findInconsistencies =\n%+v\nwant\n%+v", got, want)
+	}
+}
@@ -0,0 +1,280 @@
+package service
+
+import (
+	"context"
+
+	"github.com/nkrypt-xyz/nkrypt-xyz-web-server/internal/model"
+	"github.com/nkrypt-xyz/nkrypt-xyz-web-server/internal/pkg/apperror"
+	"github.com/nkrypt-xyz/nkrypt-xyz-web-server/internal/repository"
+)
+
+// DirectoryPermissionService resolves per-directory permission overrides on top of bucket-level grants.
+//
+// Only VIEW_CONTENT and MANAGE_CONTENT can be overridden. Overrides inherit down the tree: the
+// closest override on the path from the root to a directory decides, and a user override wins over
+// group overrides on the same directory. Overrides can narrow a bucket-level grant, or restore a
+// permission narrowed higher up, but never grant more than the bucket-level permission.
+type DirectoryPermissionService struct {
+	permRepo  *repository.DirectoryPermissionRepository
+	dirRepo   *repository.DirectoryRepository
+	groupRepo *repository.GroupRepository
+	bucketSvc *BucketService
+}
+
+func NewDirectoryPermissionService(permRepo *repository.DirectoryPermissionRepository, dirRepo *repository.DirectoryRepository, groupRepo *repository.GroupRepository, bucketSvc *BucketService) *DirectoryPermissionService {
+	return &DirectoryPermissionService{permRepo: permRepo, dirRepo: dirRepo, groupRepo: groupRepo, bucketSvc: bucketSvc}
+}
+
+// GetEffectivePermissions returns the user's permissions on a directory after applying overrides.
+func (s *DirectoryPermissionService) GetEffectivePermissions(ctx context.Context, bucketID, directoryID, userID string) (*model.BucketPermission, error) {
+	base, err := s.bucketSvc.GetUserBucketPermissions(ctx, bucketID, userID)
+	if err != nil || base == nil {
+		return nil, apperror.NewUserError("NO_AUTHORIZATION", "You do not have access to this bucket.")
+	}
+	path, err := s.dirRepo.ListAncestorIDs(ctx, bucketID, directoryID)
+	if err != nil {
+		return nil, err
+	}
+	if len(path) == 0 {
+		return nil, apperror.NewUserError("DIRECTORY_NOT_IN_BUCKET", "The requested directory could not be found in this bucket.")
+	}
+	overrides, err := s.loadOverrides(ctx, bucketID, userID)
+	if err != nil {
+		return nil, err
+	}
+	return resolveDirectoryPermissions(base, path, overrides, userID), nil
+}
+
+// FilterVisibleDirectories drops the child directories of parentDirectoryID that the user cannot view.
+func (s *DirectoryPermissionService) FilterVisibleDirectories(ctx context.Context, bucketID, parentDirectoryID, userID string, children []model.Directory) ([]model.Directory, error) {
+	overrides, err := s.loadOverrides(ctx, bucketID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if len(overrides) == 0 {
+		return children, nil
+	}
+	base, err := s.bucketSvc.GetUserBucketPermissions(ctx, bucketID, userID)
+	if err != nil || base == nil {
+		return nil, apperror.NewUserError("NO_AUTHORIZATION", "You do not have access to this bucket.")
+	}
+	path, err := s.dirRepo.ListAncestorIDs(ctx, bucketID, parentDirectoryID)
+	if err != nil {
+		return nil, err
+	}
+	parent := resolveDirectoryPermissions(base, path, overrides, userID)
+	visible := make([]model.Directory, 0, len(children))
+	for _, child := range children {
+		eff := applyDirectoryOverrides(base, parent, overrides[child.ID], userID)
+		if eff.PermViewContent {
+			visible = append(visible, child)
+		}
+	}
+	return visible, nil
+}
+
+// ListViewableDirectoryIDs returns the directories of the bucket the user can view. all is true,
+// and the list nil, when the user can view every directory because no override narrows their
+// VIEW_CONTENT. A user without access to the bucket can view none of its directories.
+func (s *DirectoryPermissionService) ListViewableDirectoryIDs(ctx context.Context, bucketID, userID string) (ids []string, all bool, err error) {
+	base, err := s.bucketSvc.GetUserBucketPermissions(ctx, bucketID, userID)
+	if err != nil || base == nil || !base.PermViewContent {
+		return nil, false, err
+	}
+	overrides, err := s.loadOverrides(ctx, bucketID, userID)
+	if err != nil {
+		return nil, false, err
+	}
+	if len(overrides) == 0 {
+		return nil, true, nil
+	}
+
+	parents, err := s.dirRepo.ListParentIDs(ctx, bucketID)
+	if err != nil {
+		return nil, false, err
+	}
+	return viewableDirectories(base, parents, overrides, userID), false, nil
+}
+
+// viewableDirectories returns the directories of a tree, given as a map from directory to parent,
+// on which the user holds VIEW_CONTENT after applying overrides.
+func viewableDirectories(base *model.BucketPermission, parents map[string]string, overrides map[string][]model.DirectoryPermissionOverride, userID string) []string {
+	resolved := make(map[string]*model.BucketPermission, len(parents))
+	var resolve func(dirID string) *model.BucketPermission
+	resolve = func(dirID string) *model.BucketPermission {
+		if eff, ok := resolved[dirID]; ok {
+			return eff
+		}
+		inherited := base
+		if parentID := parents[dirID]; parentID != "" {
+			inherited = resolve(parentID)
+		}
+		eff := applyDirectoryOverrides(base, inherited, overrides[dirID], userID)
+		resolved[dirID] = eff
+		return eff
+	}
+	var ids []string
+	for dirID := range parents {
+		if resolve(dirID).PermViewContent {
+			ids = append(ids, dirID)
+		}
+	}
+	return ids
+}
+
+// EnsureSubtreeManageable returns an error if any directory below directoryID is one the user
+// cannot manage, so that deleting a directory cannot remove content hidden from the user.
+func (s *DirectoryPermissionService) EnsureSubtreeManageable(ctx context.Context, bucketID, directoryID, userID string) error {
+	overrides, err := s.loadOverrides(ctx, bucketID, userID)
+	if err != nil {
+		return err
+	}
+	for overrideDirID := range overrides {
+		if overrideDirID == directoryID {
+			continue
+		}
+		path, err := s.dirRepo.ListAncestorIDs(ctx, bucketID, overrideDirID)
+		if err != nil {
+			return err
+		}
+		if !containsString(path, directoryID) {
+			continue
+		}
+		eff, err := s.GetEffectivePermissions(ctx, bucketID, overrideDirID, userID)
+		if err != nil {
+			return err
+		}
+		if !eff.PermManageContent {
+			return apperror.NewUserError("INSUFFICIENT_DIRECTORY_PERMISSION",
+				"This directory contains a directory you do not have the \"MANAGE_CONTENT\" permission on.")
+		}
+	}
+	return nil
+}
+
+// SetOverride creates, updates or (when every permission is reset to inherit) removes the override
+// for a user or group on a directory. Exactly one of targetUserID and targetGroupID must be set.
+func (s *DirectoryPermissionService) SetOverride(ctx context.Context, bucketID, directoryID, targetUserID, targetGroupID string, permissionsToSet map[string]*bool, authorizingUserName string) error {
+	if (targetUserID == "") == (targetGroupID == "") {
+		return apperror.NewUserError("INVALID_OVERRIDE_TARGET", "Exactly one of targetUserId and targetGroupId must be provided.")
+	}
+	for p := range permissionsToSet {
+		if p != "VIEW_CONTENT" && p != "MANAGE_CONTENT" {
+			return apperror.NewUserError("PERMISSION_NOT_OVERRIDABLE",
+				"Only \"VIEW_CONTENT\" and \"MANAGE_CONTENT\" can be overridden per directory, got \""+p+"\".")
+		}
+	}
+	var userID, groupID *string
+	if targetUserID != "" {
+		userID = &targetUserID
+	} else {
+		if g, err := s.groupRepo.FindByID(ctx, targetGroupID); err != nil || g == nil {
+			return apperror.NewUserError("GROUP_NOT_FOUND", "The requested group could not be found.")
+		}
+		groupID = &targetGroupID
+	}
+
+	o, err := s.permRepo.FindForSubject(ctx, bucketID, directoryID, userID, groupID)
+	isNew := err != nil || o == nil
+	if isNew {
+		o = &model.DirectoryPermissionOverride{
+			BucketID:    bucketID,
+			DirectoryID: directoryID,
+			UserID:      userID,
+			GroupID:     groupID,
+			Notes:       "Overridden by @" + authorizingUserName,
+		}
+	}
+	if v, ok := permissionsToSet["VIEW_CONTENT"]; ok {
+		o.PermViewContent = v
+	}
+	if v, ok := permissionsToSet["MANAGE_CONTENT"]; ok {
+		o.PermManageContent = v
+	}
+
+	inheritsAll := o.PermViewContent == nil && o.PermManageContent == nil
+	switch {
+	case isNew && inheritsAll:
+		return nil
+	case isNew:
+		return s.permRepo.Create(ctx, o)
+	case inheritsAll:
+		return s.permRepo.Delete(ctx, o.ID)
+	default:
+		return s.permRepo.Update(ctx, o)
+	}
+}
+
+// ListOverrides returns every override set directly on a directory.
+func (s *DirectoryPermissionService) ListOverrides(ctx context.Context, bucketID, directoryID string) ([]model.DirectoryPermissionOverride, error) {
+	return s.permRepo.ListByDirectory(ctx, bucketID, directoryID)
+}
+
+// loadOverrides returns the overrides in the bucket that apply to the user, keyed by directory ID.
+func (s *DirectoryPermissionService) loadOverrides(ctx context.Context, bucketID, userID string) (map[string][]model.DirectoryPermissionOverride, error) {
+	groupIDs, err := s.groupRepo.ListGroupIDsByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	list, err := s.permRepo.ListForSubjects(ctx, bucketID, userID, groupIDs)
+	if err != nil {
+		return nil, err
+	}
+	byDir := make(map[string][]model.DirectoryPermissionOverride, len(list))
+	for _, o := range list {
+		byDir[o.DirectoryID] = append(byDir[o.DirectoryID], o)
+	}
+	return byDir, nil
+}
+
+// resolveDirectoryPermissions walks path (root first) applying the overrides of each directory.
+func resolveDirectoryPermissions(base *model.BucketPermission, path []string, overrides map[string][]model.DirectoryPermissionOverride, userID string) *model.BucketPermission {
+	current := *base
+	eff := &current
+	for _, dirID := range path {
+		eff = applyDirectoryOverrides(base, eff, overrides[dirID], userID)
+	}
+	return eff
+}
+
+// applyDirectoryOverrides applies the overrides of a single directory to the permissions inherited
+// from its parent. The user's own override decides when it sets a value; otherwise any group
+// override granting the permission wins over group overrides revoking it.
+func applyDirectoryOverrides(base, inherited *model.BucketPermission, overrides []model.DirectoryPermissionOverride, userID string) *model.BucketPermission {
+	out := *inherited
+	if v, ok := decideOverride(overrides, userID, func(o *model.DirectoryPermissionOverride) *bool { return o.PermViewContent }); ok {
+		out.PermViewContent = base.PermViewContent && v
+	}
+	if v, ok := decideOverride(overrides, userID, func(o *model.DirectoryPermissionOverride) *bool { return o.PermManageContent }); ok {
+		out.PermManageContent = base.PermManageContent && v
+	}
+	return &out
+}
+
+func decideOverride(overrides []model.DirectoryPermissionOverride, userID string, field func(*model.DirectoryPermissionOverride) *bool) (bool, bool) {
+	var groupSet, groupValue bool
+	for i := range overrides {
+		o := &overrides[i]
+		v := field(o)
+		if v == nil {
+			continue
+		}
+		if o.UserID != nil && *o.UserID == userID {
+			return *v, true
+		}
+		if o.GroupID != nil {
+			groupSet = true
+			groupValue = groupValue || *v
+		}
+	}
+	return groupValue, groupSet
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,118 @@
+package service
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/nkrypt-xyz/nkrypt-xyz-web-server/internal/model"
+)
+
+func boolPtr(v bool) *bool    { return &v }
+func strPtr(v string) *string { return &v }
+
+const testUserID = "user000000000001"
+
+func fullContentAccess() *model.BucketPermission {
+	return &model.BucketPermission{PermViewContent: true, PermManageContent: true}
+}
+
+func TestResolveDirectoryPermissions_NoOverridesInheritsBucket(t *testing.T) {
+	eff := resolveDirectoryPermissions(fullContentAccess(), []string{"root", "child"}, nil, testUserID)
+	if !eff.PermViewContent || !eff.PermManageContent {
+		t.Errorf("Expected bucket permissions to be inherited, got %+v", eff)
+	}
+}
+
+func TestResolveDirectoryPermissions_RevokeInheritsDown(t *testing.T) {
+	overrides := map[string][]model.DirectoryPermissionOverride{
+		"child": {{DirectoryID: "child", UserID: strPtr(testUserID), PermManageContent: boolPtr(false)}},
+	}
+
+	eff := resolveDirectoryPermissions(fullContentAccess(), []string{"root", "child", "grandchild"}, overrides, testUserID)
+	if eff.PermManageContent {
+		t.Error("Expected MANAGE_CONTENT to be revoked below the override")
+	}
+	if !eff.PermViewContent {
+		t.Error("Expected VIEW_CONTENT to be inherited")
+	}
+
+	eff = resolveDirectoryPermissions(fullContentAccess(), []string{"root"}, overrides, testUserID)
+	if !eff.PermManageContent {
+		t.Error("Expected override not to affect ancestors")
+	}
+}
+
+func TestResolveDirectoryPermissions_NestedOverrideRestores(t *testing.T) {
+	overrides := map[string][]model.DirectoryPermissionOverride{
+		"child":      {{UserID: strPtr(testUserID), PermViewContent: boolPtr(false)}},
+		"grandchild": {{UserID: strPtr(testUserID), PermViewContent: boolPtr(true)}},
+	}
+
+	eff := resolveDirectoryPermissions(fullContentAccess(), []string{"root", "child", "grandchild"}, overrides, testUserID)
+	if !eff.PermViewContent {
+		t.Error("Expected nested override to restore VIEW_CONTENT")
+	}
+}
+
+func TestResolveDirectoryPermissions_CannotExceedBucketGrant(t *testing.T) {
+	base := &model.BucketPermission{PermViewContent: true}
+	overrides := map[string][]model.DirectoryPermissionOverride{
+		"root": {{UserID: strPtr(testUserID), PermManageContent: boolPtr(true)}},
+	}
+
+	eff := resolveDirectoryPermissions(base, []string{"root"}, overrides, testUserID)
+	if eff.PermManageContent {
+		t.Error("Expected override not to grant more than the bucket-level permission")
+	}
+}
+
+func TestApplyDirectoryOverrides_UserWinsOverGroup(t *testing.T) {
+	overrides := []model.DirectoryPermissionOverride{
+		{GroupID: strPtr("group00000000001"), PermViewContent: boolPtr(true)},
+		{UserID: strPtr(testUserID), PermViewContent: boolPtr(false)},
+	}
+
+	eff := applyDirectoryOverrides(fullContentAccess(), fullContentAccess(), overrides, testUserID)
+	if eff.PermViewContent {
+		t.Error("Expected the user's own override to win over a group override")
+	}
+}
+
+func TestApplyDirectoryOverrides_GroupGrantWinsOverGroupRevoke(t *testing.T) {
+	inherited := &model.BucketPermission{PermViewContent: false, PermManageContent: true}
+	overrides := []model.DirectoryPermissionOverride{
+		{GroupID: strPtr("group00000000001"), PermViewContent: boolPtr(false), PermManageContent: boolPtr(false)},
+		{GroupID: strPtr("group00000000002"), PermViewContent: boolPtr(true)},
+	}
+
+	eff := applyDirectoryOverrides(fullContentAccess(), inherited, overrides, testUserID)
+	if !eff.PermViewContent {
+		t.Error("Expected a granting group override to win")
+	}
+	if eff.PermManageContent {
+		t.Error("Expected the only group override on MANAGE_CONTENT to revoke it")
+	}
+}
+
+func TestViewableDirectories(t *testing.T) {
+	parents := map[string]string{
+		"root":        "",
+		"public":      "root",
+		"private":     "root",
+		"hidden":      "private",
+		"restored":    "private",
+		"restoredKid": "restored",
+	}
+	overrides := map[string][]model.DirectoryPermissionOverride{
+		"private":  {{UserID: strPtr(testUserID), PermViewContent: boolPtr(false)}},
+		"restored": {{UserID: strPtr(testUserID), PermViewContent: boolPtr(true)}},
+	}
+
+	ids := viewableDirectories(fullContentAccess(), parents, overrides, testUserID)
+	sort.Strings(ids)
+	want := []string{"public", "restored", "restoredKid", "root"}
+	if !reflect.DeepEqual(ids, want) {
+		t.Errorf("viewableDirectories = %v, want %v", ids, want)
+	}
+}
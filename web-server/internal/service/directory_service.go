@@ -72,20 +72,23 @@ func (s *DirectoryService) GetDirectoryContents(ctx context.Context, bucketID, d
 	return dir, children, files, nil
 }
 
-func (s *DirectoryService) RenameDirectory(ctx context.Context, bucketID, directoryID, name string) error {
-	return s.dirRepo.UpdateName(ctx, bucketID, directoryID, name)
+// RenameDirectory renames the directory and returns its new version. A non-zero expectedVersion
+// makes the rename fail with VERSION_CONFLICT unless the directory is still at that version;
+// likewise below.
+func (s *DirectoryService) RenameDirectory(ctx context.Context, bucketID, directoryID, name string, expectedVersion int64) (int64, error) {
+	return versioned(s.dirRepo.UpdateName(ctx, bucketID, directoryID, name, expectedVersion))
 }
 
-func (s *DirectoryService) SetMetaData(ctx context.Context, bucketID, directoryID string, metaData interface{}) error {
+func (s *DirectoryService) SetMetaData(ctx context.Context, bucketID, directoryID string, metaData interface{}, expectedVersion int64) (int64, error) {
 	metaBytes, err := json.Marshal(metaData)
 	if err != nil {
-		return apperror.NewDeveloperError("INVALID_METADATA", "Failed to serialize metadata.")
+		return 0, apperror.NewDeveloperError("INVALID_METADATA", "Failed to serialize metadata.")
 	}
-	return s.dirRepo.UpdateMetaData(ctx, bucketID, directoryID, metaBytes)
+	return versioned(s.dirRepo.UpdateMetaData(ctx, bucketID, directoryID, metaBytes, expectedVersion))
 }
 
-func (s *DirectoryService) SetEncryptedMetaData(ctx context.Context, bucketID, directoryID, encryptedMetaData string) error {
-	return s.dirRepo.UpdateEncryptedMetaData(ctx, bucketID, directoryID, encryptedMetaData)
+func (s *DirectoryService) SetEncryptedMetaData(ctx context.Context, bucketID, directoryID, encryptedMetaData string, expectedVersion int64) (int64, error) {
+	return versioned(s.dirRepo.UpdateEncryptedMetaData(ctx, bucketID, directoryID, encryptedMetaData, expectedVersion))
 }
 
 // isDescendantOf walks up from dirID's ancestors; if we ever reach ancestorID, dirID is a descendant of ancestorID (cycle risk).
@@ -107,19 +110,19 @@ func (s *DirectoryService) isDescendantOf(ctx context.Context, bucketID, dirID,
 	return false, nil
 }
 
-func (s *DirectoryService) MoveDirectory(ctx context.Context, bucketID, directoryID, newParentDirectoryID, newName string) error {
+func (s *DirectoryService) MoveDirectory(ctx context.Context, bucketID, directoryID, newParentDirectoryID, newName string, expectedVersion int64) (int64, error) {
 	descendant, err := s.isDescendantOf(ctx, bucketID, newParentDirectoryID, directoryID)
 	if err != nil {
-		return err
+		return 0, err
 	}
 	if descendant {
-		return apperror.NewUserError("INVALID_MOVE", "Cannot move a directory into its own descendant.")
+		return 0, apperror.NewUserError("INVALID_MOVE", "Cannot move a directory into its own descendant.")
 	}
 	var newParentID *string
 	if newParentDirectoryID != "" {
 		newParentID = &newParentDirectoryID
 	}
-	return s.dirRepo.Move(ctx, bucketID, directoryID, newParentID, newName)
+	return versioned(s.dirRepo.Move(ctx, bucketID, directoryID, newParentID, newName, expectedVersion))
 }
 
 func (s *DirectoryService) DeleteDirectory(ctx context.Context, bucketID, directoryID string) error {
@@ -55,28 +55,30 @@ func (s *FileService) CreateFile(ctx context.Context, name, bucketID string, met
 	return id, nil
 }
 
-func (s *FileService) RenameFile(ctx context.Context, bucketID, fileID, name string) error {
-	return s.fileRepo.UpdateName(ctx, bucketID, fileID, name)
+// RenameFile renames the file and returns its new version. A non-zero expectedVersion makes the
+// rename fail with VERSION_CONFLICT unless the file is still at that version; likewise below.
+func (s *FileService) RenameFile(ctx context.Context, bucketID, fileID, name string, expectedVersion int64) (int64, error) {
+	return versioned(s.fileRepo.UpdateName(ctx, bucketID, fileID, name, expectedVersion))
 }
 
-func (s *FileService) MoveFile(ctx context.Context, bucketID, fileID, newParentDirectoryID, newName string) error {
+func (s *FileService) MoveFile(ctx context.Context, bucketID, fileID, newParentDirectoryID, newName string, expectedVersion int64) (int64, error) {
 	existing, _ := s.fileRepo.FindByNameAndParent(ctx, newName, bucketID, newParentDirectoryID)
 	if existing != nil && existing.ID != fileID {
-		return apperror.NewUserError("DUPLICATE_FILE_NAME", "A file with this name already exists in the target directory.")
+		return 0, apperror.NewUserError("DUPLICATE_FILE_NAME", "A file with this name already exists in the target directory.")
 	}
-	return s.fileRepo.Move(ctx, bucketID, fileID, newParentDirectoryID, newName)
+	return versioned(s.fileRepo.Move(ctx, bucketID, fileID, newParentDirectoryID, newName, expectedVersion))
 }
 
-func (s *FileService) SetMetaData(ctx context.Context, bucketID, fileID string, metaData interface{}) error {
+func (s *FileService) SetMetaData(ctx context.Context, bucketID, fileID string, metaData interface{}, expectedVersion int64) (int64, error) {
 	metaBytes, err := json.Marshal(metaData)
 	if err != nil {
-		return apperror.NewDeveloperError("INVALID_METADATA", "Failed to serialize metadata.")
+		return 0, apperror.NewDeveloperError("INVALID_METADATA", "Failed to serialize metadata.")
 	}
-	return s.fileRepo.UpdateMetaData(ctx, bucketID, fileID, metaBytes)
+	return versioned(s.fileRepo.UpdateMetaData(ctx, bucketID, fileID, metaBytes, expectedVersion))
 }
 
-func (s *FileService) SetEncryptedMetaData(ctx context.Context, bucketID, fileID, encryptedMetaData string) error {
-	return s.fileRepo.UpdateEncryptedMetaData(ctx, bucketID, fileID, encryptedMetaData)
+func (s *FileService) SetEncryptedMetaData(ctx context.Context, bucketID, fileID, encryptedMetaData string, expectedVersion int64) (int64, error) {
+	return versioned(s.fileRepo.UpdateEncryptedMetaData(ctx, bucketID, fileID, encryptedMetaData, expectedVersion))
 }
 
 func (s *FileService) SetContentUpdatedAt(ctx context.Context, bucketID, fileID string) error {
@@ -0,0 +1,127 @@
+package service
+
+import (
+	"context"
+
+	"github.com/nkrypt-xyz/nkrypt-xyz-web-server/internal/model"
+	"github.com/nkrypt-xyz/nkrypt-xyz-web-server/internal/pkg/apperror"
+	"github.com/nkrypt-xyz/nkrypt-xyz-web-server/internal/pkg/randstr"
+	"github.com/nkrypt-xyz/nkrypt-xyz-web-server/internal/repository"
+)
+
+type GroupService struct {
+	groupRepo  *repository.GroupRepository
+	userRepo   *repository.UserRepository
+	bucketRepo *repository.BucketRepository
+}
+
+func NewGroupService(groupRepo *repository.GroupRepository, userRepo *repository.UserRepository, bucketRepo *repository.BucketRepository) *GroupService {
+	return &GroupService{groupRepo: groupRepo, userRepo: userRepo, bucketRepo: bucketRepo}
+}
+
+func (s *GroupService) FindGroupByIDOrFail(ctx context.Context, groupID string) (*model.UserGroup, error) {
+	g, err := s.groupRepo.FindByID(ctx, groupID)
+	if err != nil || g == nil {
+		return nil, apperror.NewUserError("GROUP_NOT_FOUND", "The requested group could not be found.")
+	}
+	return g, nil
+}
+
+// CreateGroup creates a new, empty user group and returns its ID.
+func (s *GroupService) CreateGroup(ctx context.Context, name, description, createdByUserID string) (string, error) {
+	if existing, _ := s.groupRepo.FindByName(ctx, name); existing != nil {
+		return "", apperror.NewUserError("DUPLICATE_GROUP_NAME", "A group with this name already exists.")
+	}
+	id, err := randstr.GenerateID(16)
+	if err != nil {
+		return "", apperror.NewDeveloperError("ID_GENERATION_FAILED", "Failed to generate group ID.")
+	}
+	g := &model.UserGroup{
+		ID:              id,
+		Name:            name,
+		Description:     description,
+		CreatedByUserID: createdByUserID,
+	}
+	if err := s.groupRepo.Create(ctx, g); err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+// DeleteGroup removes the group; memberships and bucket grants cascade. It is rejected if a bucket
+// would be left without anyone holding MANAGE_AUTHORIZATION.
+func (s *GroupService) DeleteGroup(ctx context.Context, groupID string) error {
+	if _, err := s.FindGroupByIDOrFail(ctx, groupID); err != nil {
+		return err
+	}
+	if err := s.ensureAuthorizationManagersRemain(ctx, groupID, func(bucketID string) (int, error) {
+		return s.bucketRepo.CountAuthorizationManagers(ctx, bucketID, "", groupID)
+	}); err != nil {
+		return err
+	}
+	return s.groupRepo.Delete(ctx, groupID)
+}
+
+func (s *GroupService) AddMember(ctx context.Context, groupID, userID string) error {
+	if _, err := s.FindGroupByIDOrFail(ctx, groupID); err != nil {
+		return err
+	}
+	if _, err := s.userRepo.FindUserByID(ctx, userID); err != nil {
+		return apperror.NewUserError("USER_NOT_FOUND", "The requested user could not be found.")
+	}
+	return s.groupRepo.AddMember(ctx, groupID, userID)
+}
+
+// RemoveMember removes the user from the group. It is rejected if a bucket would be left without
+// anyone holding MANAGE_AUTHORIZATION.
+func (s *GroupService) RemoveMember(ctx context.Context, groupID, userID string) error {
+	if _, err := s.FindGroupByIDOrFail(ctx, groupID); err != nil {
+		return err
+	}
+	if err := s.ensureAuthorizationManagersRemain(ctx, groupID, func(bucketID string) (int, error) {
+		return s.bucketRepo.CountAuthorizationManagersWithoutMembership(ctx, bucketID, groupID, userID)
+	}); err != nil {
+		return err
+	}
+	return s.groupRepo.RemoveMember(ctx, groupID, userID)
+}
+
+// ensureAuthorizationManagersRemain rejects a change to the group if countManagers, the number of
+// users holding MANAGE_AUTHORIZATION after it, is zero for any bucket the group grants it on.
+func (s *GroupService) ensureAuthorizationManagersRemain(ctx context.Context, groupID string, countManagers func(bucketID string) (int, error)) error {
+	bucketIDs, err := s.bucketRepo.ListBucketIDsManagedByGroup(ctx, groupID)
+	if err != nil {
+		return err
+	}
+	for _, bucketID := range bucketIDs {
+		count, err := countManagers(bucketID)
+		if err != nil {
+			return err
+		}
+		if count == 0 {
+			return lastAuthorizationManager()
+		}
+	}
+	return nil
+}
+
+// ListGroups returns every group along with the IDs of its members.
+func (s *GroupService) ListGroups(ctx context.Context) ([]model.UserGroupListItem, error) {
+	groups, err := s.groupRepo.ListAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]model.UserGroupListItem, 0, len(groups))
+	for _, g := range groups {
+		members, err := s.groupRepo.ListMembers(ctx, g.ID)
+		if err != nil {
+			return nil, err
+		}
+		memberIDs := make([]string, 0, len(members))
+		for _, m := range members {
+			memberIDs = append(memberIDs, m.UserID)
+		}
+		out = append(out, model.UserGroupListItem{Group: g, MemberUserIDs: memberIDs})
+	}
+	return out, nil
+}
@@ -0,0 +1,200 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/nkrypt-xyz/nkrypt-xyz-web-server/internal/config"
+	"github.com/nkrypt-xyz/nkrypt-xyz-web-server/internal/model"
+	"github.com/nkrypt-xyz/nkrypt-xyz-web-server/internal/pkg/apperror"
+	"github.com/nkrypt-xyz/nkrypt-xyz-web-server/internal/pkg/randstr"
+	"github.com/nkrypt-xyz/nkrypt-xyz-web-server/internal/repository"
+)
+
+// invitationTokenLength is the length of the secret handed to the invitee.
+const invitationTokenLength = 48
+
+type InvitationService struct {
+	invRepo   *repository.InvitationRepository
+	userRepo  *repository.UserRepository
+	adminSvc  *AdminService
+	bucketSvc *BucketService
+	cfg       *config.Config
+}
+
+func NewInvitationService(invRepo *repository.InvitationRepository, userRepo *repository.UserRepository, adminSvc *AdminService, bucketSvc *BucketService, cfg *config.Config) *InvitationService {
+	return &InvitationService{invRepo: invRepo, userRepo: userRepo, adminSvc: adminSvc, bucketSvc: bucketSvc, cfg: cfg}
+}
+
+// CreateInvitation creates an invitation on behalf of creator and returns it along with the
+// plaintext token, which is never stored. The creator can only preset global permissions they hold
+// themselves and can only grant access to buckets on which they hold MANAGE_AUTHORIZATION.
+// A zero validity uses the configured default.
+func (s *InvitationService) CreateInvitation(ctx context.Context, creator *model.User, notes string, validity time.Duration, globalPermissions map[string]bool, bucketGrants []model.InvitationBucketGrantRequest) (*model.Invitation, string, error) {
+	if validity == 0 {
+		validity = s.cfg.IAM.InvitationValidityDuration
+	}
+	inv := &model.Invitation{
+		CreatedByUserID:  creator.ID,
+		Notes:            notes,
+		PermCreateBucket: true,
+		ExpiresAt:        time.Now().Add(validity),
+	}
+	if v, ok := globalPermissions["MANAGE_ALL_USER"]; ok {
+		inv.PermManageAllUser = v
+	}
+	if v, ok := globalPermissions["CREATE_USER"]; ok {
+		inv.PermCreateUser = v
+	}
+	if v, ok := globalPermissions["CREATE_BUCKET"]; ok {
+		inv.PermCreateBucket = v
+	}
+	if inv.PermManageAllUser {
+		if err := RequireGlobalPermission(creator, "MANAGE_ALL_USER"); err != nil {
+			return nil, "", err
+		}
+	}
+	if inv.PermCreateUser {
+		if err := RequireGlobalPermission(creator, "CREATE_USER"); err != nil {
+			return nil, "", err
+		}
+	}
+
+	for _, g := range bucketGrants {
+		if err := RequireBucketPermission(ctx, s.bucketSvc, creator.ID, g.BucketID, "MANAGE_AUTHORIZATION"); err != nil {
+			return nil, "", err
+		}
+	}
+
+	id, err := randstr.GenerateID(16)
+	if err != nil {
+		return nil, "", apperror.NewDeveloperError("ID_GENERATION_FAILED", "Failed to generate invitation ID.")
+	}
+	token, err := randstr.GenerateAPIKey(invitationTokenLength)
+	if err != nil {
+		return nil, "", apperror.NewDeveloperError("TOKEN_GENERATION_FAILED", "Failed to generate invitation token.")
+	}
+	inv.ID = id
+	inv.TokenHash = sha256Hex(token)
+	grants := make([]model.InvitationBucketGrant, len(bucketGrants))
+	for i, g := range bucketGrants {
+		grants[i] = model.InvitationBucketGrant{
+			InvitationID:            id,
+			BucketID:                g.BucketID,
+			PermModify:              g.PermissionsToSet["MODIFY"],
+			PermManageAuthorization: g.PermissionsToSet["MANAGE_AUTHORIZATION"],
+			PermDestroy:             g.PermissionsToSet["DESTROY"],
+			PermViewContent:         g.PermissionsToSet["VIEW_CONTENT"],
+			PermManageContent:       g.PermissionsToSet["MANAGE_CONTENT"],
+		}
+	}
+	if err := s.invRepo.Create(ctx, inv, grants); err != nil {
+		return nil, "", err
+	}
+	return inv, token, nil
+}
+
+// ListInvitations returns invitations with their bucket grants. An empty createdByUserID lists all.
+func (s *InvitationService) ListInvitations(ctx context.Context, createdByUserID string) ([]model.InvitationListItem, error) {
+	invs, err := s.invRepo.List(ctx, createdByUserID)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]model.InvitationListItem, 0, len(invs))
+	for _, inv := range invs {
+		grants, err := s.invRepo.ListBucketGrants(ctx, inv.ID)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, model.InvitationListItem{Invitation: inv, BucketGrants: grants})
+	}
+	return out, nil
+}
+
+// RevokeInvitation deletes an unredeemed invitation. Only its creator or a user holding
+// MANAGE_ALL_USER may revoke it.
+func (s *InvitationService) RevokeInvitation(ctx context.Context, requester *model.User, invitationID string) error {
+	inv, err := s.invRepo.FindByID(ctx, invitationID)
+	if err != nil || inv == nil {
+		return apperror.NewUserError("INVITATION_NOT_FOUND", "The requested invitation could not be found.")
+	}
+	if inv.CreatedByUserID != requester.ID {
+		if err := RequireGlobalPermission(requester, "MANAGE_ALL_USER"); err != nil {
+			return err
+		}
+	}
+	if inv.RedeemedAt != nil {
+		return apperror.NewUserError("INVITATION_ALREADY_REDEEMED", "The invitation has already been redeemed.")
+	}
+	return s.invRepo.Delete(ctx, invitationID)
+}
+
+// RedeemInvitation creates the invitee's account with the invitation's preset permissions and
+// returns the new user ID. Bucket grants are only applied while the invitation's creator still
+// holds MANAGE_AUTHORIZATION on the bucket. The account, the redemption and the grants are stored
+// together, so a failed redemption leaves the invitation usable.
+func (s *InvitationService) RedeemInvitation(ctx context.Context, token, displayName, userName, password string) (string, error) {
+	inv, err := s.invRepo.FindByTokenHash(ctx, sha256Hex(token))
+	if err != nil || inv == nil || inv.RedeemedAt != nil || !time.Now().Before(inv.ExpiresAt) {
+		return "", invitationInvalidError()
+	}
+	user, err := s.adminSvc.newUser(ctx, displayName, userName, password, inv.PermManageAllUser, inv.PermCreateUser, inv.PermCreateBucket)
+	if err != nil {
+		return "", err
+	}
+	grants, err := s.grantsToApply(ctx, inv)
+	if err != nil {
+		return "", err
+	}
+
+	redeemed, err := s.invRepo.Redeem(ctx, inv.ID, user, grants)
+	if err != nil {
+		return "", err
+	}
+	if !redeemed {
+		return "", invitationInvalidError()
+	}
+	return user.ID, nil
+}
+
+// grantsToApply returns the bucket permissions the invitation grants, leaving out buckets on which
+// its creator no longer holds MANAGE_AUTHORIZATION.
+func (s *InvitationService) grantsToApply(ctx context.Context, inv *model.Invitation) ([]model.BucketPermission, error) {
+	grants, err := s.invRepo.ListBucketGrants(ctx, inv.ID)
+	if err != nil || len(grants) == 0 {
+		return nil, err
+	}
+	creator, err := s.userRepo.FindUserByID(ctx, inv.CreatedByUserID)
+	if err != nil || creator == nil {
+		return nil, nil
+	}
+	var out []model.BucketPermission
+	for _, g := range grants {
+		creatorPerm, err := s.bucketSvc.GetUserBucketPermissions(ctx, g.BucketID, creator.ID)
+		if err != nil || creatorPerm == nil || !creatorPerm.PermManageAuthorization {
+			continue
+		}
+		out = append(out, model.BucketPermission{
+			BucketID:                g.BucketID,
+			Notes:                   "Authorized by @" + creator.UserName,
+			PermModify:              g.PermModify,
+			PermManageAuthorization: g.PermManageAuthorization,
+			PermDestroy:             g.PermDestroy,
+			PermViewContent:         g.PermViewContent,
+			PermManageContent:       g.PermManageContent,
+		})
+	}
+	return out, nil
+}
+
+// Register creates an account with default permissions when open registration is enabled.
+func (s *InvitationService) Register(ctx context.Context, displayName, userName, password string) (string, error) {
+	if !s.cfg.IAM.OpenRegistration {
+		return "", apperror.NewUserError("REGISTRATION_CLOSED", "Open registration is disabled. Ask an administrator for an invitation.")
+	}
+	return s.adminSvc.AddUser(ctx, displayName, userName, password)
+}
+
+func invitationInvalidError() error {
+	return apperror.NewUserError("INVITATION_INVALID", "The invitation is invalid, has expired, or has already been used.")
+}
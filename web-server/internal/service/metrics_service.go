@@ -2,17 +2,38 @@ package service
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"sort"
+	"time"
 
+	"github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog/log"
+
+	"github.com/nkrypt-xyz/nkrypt-xyz-web-server/internal/config"
 	"github.com/nkrypt-xyz/nkrypt-xyz-web-server/internal/model"
 	"github.com/nkrypt-xyz/nkrypt-xyz-web-server/internal/pkg/storage"
+	"github.com/nkrypt-xyz/nkrypt-xyz-web-server/internal/repository"
 )
 
 type MetricsService struct {
 	storageClient *storage.MinIOClient
+	usageRepo     *repository.UsageRepository
+	bucketRepo    *repository.BucketRepository
+	dirPermSvc    *DirectoryPermissionService
+	redis         *redis.Client
+	cacheTTL      time.Duration
 }
 
-func NewMetricsService(storageClient *storage.MinIOClient) *MetricsService {
-	return &MetricsService{storageClient: storageClient}
+func NewMetricsService(storageClient *storage.MinIOClient, usageRepo *repository.UsageRepository, bucketRepo *repository.BucketRepository, dirPermSvc *DirectoryPermissionService, redis *redis.Client, cfg *config.Config) *MetricsService {
+	return &MetricsService{
+		storageClient: storageClient,
+		usageRepo:     usageRepo,
+		bucketRepo:    bucketRepo,
+		dirPermSvc:    dirPermSvc,
+		redis:         redis,
+		cacheTTL:      cfg.Metrics.UsageCacheTTL,
+	}
 }
 
 // GetDiskUsage returns disk usage statistics from MinIO.
@@ -27,3 +48,140 @@ func (s *MetricsService) GetDiskUsage(ctx context.Context) (*model.DiskUsage, er
 		TotalBytes: totalBytes,
 	}, nil
 }
+
+// GetUserUsage returns the usage of the content the user created. The result is cached in Redis,
+// so it may be up to the cache TTL old.
+func (s *MetricsService) GetUserUsage(ctx context.Context, userID string) (*model.UsageStats, error) {
+	key := "nk:usage:user:" + userID
+	var cached model.UsageStats
+	if s.getCached(ctx, key, &cached) {
+		return &cached, nil
+	}
+
+	usage, err := s.usageRepo.UsageByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	s.setCached(ctx, map[string]interface{}{key: usage})
+	return usage, nil
+}
+
+// ListBucketUsageForUser returns the usage of every bucket the user can access, sorted by name,
+// counting only the directories the user can view. Each bucket the user can view entirely is cached
+// in Redis separately, so buckets shared between users are aggregated once per cache TTL; the
+// usage of the rest is aggregated on every call.
+func (s *MetricsService) ListBucketUsageForUser(ctx context.Context, userID string) ([]model.BucketUsage, error) {
+	bucketIDs, err := s.bucketRepo.ListBucketIDsByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if len(bucketIDs) == 0 {
+		return nil, nil
+	}
+
+	var result []model.BucketUsage
+	var missing []string
+	for _, id := range bucketIDs {
+		viewable, all, err := s.dirPermSvc.ListViewableDirectoryIDs(ctx, id, userID)
+		if err != nil {
+			return nil, err
+		}
+		if !all {
+			usage, err := s.partialBucketUsage(ctx, id, viewable)
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, *usage)
+			continue
+		}
+
+		var cached model.BucketUsage
+		if s.getCached(ctx, bucketUsageKey(id), &cached) {
+			result = append(result, cached)
+		} else {
+			missing = append(missing, id)
+		}
+	}
+
+	if len(missing) > 0 {
+		usages, err := s.usageRepo.ListBucketUsage(ctx, missing)
+		if err != nil {
+			return nil, err
+		}
+		values := make(map[string]interface{}, len(usages))
+		for _, u := range usages {
+			values[bucketUsageKey(u.BucketID)] = u
+		}
+		s.setCached(ctx, values)
+		result = append(result, usages...)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Name != result[j].Name {
+			return result[i].Name < result[j].Name
+		}
+		return result[i].BucketID < result[j].BucketID
+	})
+	return result, nil
+}
+
+// partialBucketUsage returns the usage of the given directories of a bucket.
+func (s *MetricsService) partialBucketUsage(ctx context.Context, bucketID string, directoryIDs []string) (*model.BucketUsage, error) {
+	bucket, err := s.bucketRepo.FindByID(ctx, bucketID)
+	if err != nil {
+		return nil, err
+	}
+	usage := &model.BucketUsage{BucketID: bucket.ID, Name: bucket.Name}
+	if len(directoryIDs) == 0 {
+		return usage, nil
+	}
+	stats, err := s.usageRepo.DirectoryUsage(ctx, bucketID, directoryIDs)
+	if err != nil {
+		return nil, err
+	}
+	usage.Usage = *stats
+	return usage, nil
+}
+
+func bucketUsageKey(bucketID string) string {
+	return "nk:usage:bucket:" + bucketID
+}
+
+// getCached decodes the cached value at key into dest. A Redis error is logged and treated as a
+// miss, so usage is still served from the database while Redis is unavailable.
+func (s *MetricsService) getCached(ctx context.Context, key string, dest interface{}) bool {
+	if s.cacheTTL <= 0 {
+		return false
+	}
+	val, err := s.redis.Get(ctx, key).Bytes()
+	if err != nil {
+		if !errors.Is(err, redis.Nil) {
+			log.Warn().Err(err).Msg("failed to read cached usage")
+		}
+		return false
+	}
+	if err := json.Unmarshal(val, dest); err != nil {
+		log.Warn().Err(err).Msg("failed to decode cached usage")
+		return false
+	}
+	return true
+}
+
+// setCached stores each value as JSON with the cache TTL. Failures are logged, not returned.
+func (s *MetricsService) setCached(ctx context.Context, values map[string]interface{}) {
+	if s.cacheTTL <= 0 || len(values) == 0 {
+		return
+	}
+	pipe := s.redis.Pipeline()
+	for key, value := range values {
+		data, err := json.Marshal(value)
+		if err != nil {
+			log.Warn().Err(err).Msg("failed to encode usage for caching")
+			continue
+		}
+		pipe.Set(ctx, key, data, s.cacheTTL)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Warn().Err(err).Msg("failed to cache usage")
+	}
+}
@@ -23,7 +23,8 @@ func RequireGlobalPermission(user *model.User, permissions ...string) error {
 	return nil
 }
 
-// RequireBucketPermission ensures the bucket exists and the user has all listed bucket permissions.
+// RequireBucketPermission ensures the bucket exists and the user has all listed bucket permissions,
+// granted either directly or through one of the user's groups.
 func RequireBucketPermission(ctx context.Context, bucketSvc *BucketService, userID, bucketID string, permissions ...string) error {
 	bucket, err := bucketSvc.FindBucketByID(ctx, bucketID)
 	if err != nil || bucket == nil {
@@ -67,3 +68,33 @@ func EnsureFileBelongsToBucket(ctx context.Context, fileSvc *FileService, bucket
 	return nil
 }
 
+
+// RequireDirectoryPermission ensures the user has all listed permissions on the directory once
+// directory-level overrides are applied. The bucket-level check must have passed already.
+func RequireDirectoryPermission(ctx context.Context, dirPermSvc *DirectoryPermissionService, userID, bucketID, directoryID string, permissions ...string) error {
+	perm, err := dirPermSvc.GetEffectivePermissions(ctx, bucketID, directoryID, userID)
+	if err != nil {
+		return err
+	}
+	perms := map[string]bool{
+		"VIEW_CONTENT":   perm.PermViewContent,
+		"MANAGE_CONTENT": perm.PermManageContent,
+	}
+	for _, p := range permissions {
+		if !perms[p] {
+			return apperror.NewUserError("INSUFFICIENT_DIRECTORY_PERMISSION",
+				"You do not have the required permission on this directory: \""+p+"\".")
+		}
+	}
+	return nil
+}
+
+// RequireFilePermission ensures the file is in the bucket and the user has all listed permissions
+// on the directory containing it.
+func RequireFilePermission(ctx context.Context, dirPermSvc *DirectoryPermissionService, fileSvc *FileService, userID, bucketID, fileID string, permissions ...string) error {
+	file, err := fileSvc.FindFileByID(ctx, bucketID, fileID)
+	if err != nil || file == nil {
+		return apperror.NewUserError("FILE_NOT_IN_BUCKET", "The requested file could not be found in this bucket.")
+	}
+	return RequireDirectoryPermission(ctx, dirPermSvc, userID, bucketID, file.ParentDirectoryID, permissions...)
+}
@@ -0,0 +1,180 @@
+package service
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/nkrypt-xyz/nkrypt-xyz-web-server/internal/config"
+	"github.com/nkrypt-xyz/nkrypt-xyz-web-server/internal/model"
+	"github.com/nkrypt-xyz/nkrypt-xyz-web-server/internal/pkg/metrics"
+	"github.com/nkrypt-xyz/nkrypt-xyz-web-server/internal/pkg/storage"
+	"github.com/nkrypt-xyz/nkrypt-xyz-web-server/internal/repository"
+)
+
+// replicationClaimTTL is how long a server may take to replicate a batch before another server
+// takes the rest of it over.
+const replicationClaimTTL = time.Hour
+
+// maxReplicationBackoff caps the delay before a failed change is retried.
+const maxReplicationBackoff = time.Hour
+
+// ReplicationService copies stored objects to a replica object store. Changes are queued in the
+// database as they happen and replicated in the background, so a change queued by one server may
+// be replicated by another.
+type ReplicationService struct {
+	queueRepo    *repository.ReplicationRepository
+	blobRepo     *repository.BlobRepository
+	primary      *storage.MinIOClient
+	replica      *storage.MinIOClient
+	pollInterval time.Duration
+	batchSize    int
+}
+
+func NewReplicationService(queueRepo *repository.ReplicationRepository, blobRepo *repository.BlobRepository, primary, replica *storage.MinIOClient, cfg *config.Config) *ReplicationService {
+	return &ReplicationService{
+		queueRepo:    queueRepo,
+		blobRepo:     blobRepo,
+		primary:      primary,
+		replica:      replica,
+		pollInterval: cfg.Replication.PollInterval,
+		batchSize:    cfg.Replication.BatchSize,
+	}
+}
+
+// EnsureReplicaBucket creates the bucket of the replica if it does not exist.
+func (s *ReplicationService) EnsureReplicaBucket(ctx context.Context) error {
+	return s.replica.EnsureBucket(ctx)
+}
+
+// Enqueue queues the replication of changed objects. It does nothing on a nil ReplicationService,
+// so that callers need not check whether replication is on. A change that cannot be queued is
+// logged rather than failing the request that made it; a backfill queues it again.
+func (s *ReplicationService) Enqueue(ctx context.Context, operation string, keys ...string) {
+	if s == nil {
+		return
+	}
+	// The change has happened; queue it even if the request was cancelled meanwhile
+	if err := s.queueRepo.Enqueue(context.WithoutCancel(ctx), operation, keys); err != nil {
+		log.Error().Err(err).Str("operation", operation).Strs("objectKeys", keys).Msg("failed to queue replication")
+	}
+}
+
+// Run replicates queued changes until ctx is cancelled.
+func (s *ReplicationService) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.pollInterval)
+	defer ticker.Stop()
+	for {
+		// Keep going while full batches show that more is due
+		for {
+			n, err := s.ReplicateBatch(ctx)
+			if err != nil && ctx.Err() == nil {
+				log.Warn().Err(err).Msg("failed to read the replication queue")
+			}
+			if err != nil || n < s.batchSize {
+				break
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// ReplicateBatch replicates one batch of due changes and returns how many it took.
+func (s *ReplicationService) ReplicateBatch(ctx context.Context) (int, error) {
+	tasks, err := s.queueRepo.Claim(ctx, s.batchSize, replicationClaimTTL)
+	if err != nil {
+		return 0, err
+	}
+	for i := range tasks {
+		task := &tasks[i]
+		err := s.replicate(ctx, task)
+		if err != nil {
+			metrics.ReplicationOperations.WithLabelValues(task.Operation, "failure").Inc()
+			log.Warn().Err(err).Str("objectKey", task.ObjectKey).Str("operation", task.Operation).Int("attempts", task.Attempts).Msg("failed to replicate object")
+			err = s.queueRepo.Fail(context.WithoutCancel(ctx), task, err.Error(), replicationBackoff(s.pollInterval, task.Attempts))
+		} else {
+			metrics.ReplicationOperations.WithLabelValues(task.Operation, "success").Inc()
+			err = s.queueRepo.Complete(context.WithoutCancel(ctx), task)
+		}
+		if err != nil {
+			return len(tasks), err
+		}
+	}
+	return len(tasks), nil
+}
+
+func (s *ReplicationService) replicate(ctx context.Context, task *model.ReplicationTask) error {
+	if task.Operation == model.ReplicationOpDelete {
+		return s.replica.DeleteObject(ctx, task.ObjectKey)
+	}
+	copied, err := s.primary.CopyObjectTo(ctx, s.replica, task.ObjectKey)
+	if storage.IsNotFound(err) {
+		// Deleted before it was replicated; the deletion is queued in its place
+		return nil
+	}
+	metrics.ReplicationBytes.Add(float64(copied))
+	return err
+}
+
+// replicationBackoff doubles the delay for each failed attempt, up to maxReplicationBackoff.
+func replicationBackoff(base time.Duration, attempts int) time.Duration {
+	delay := base
+	for i := 1; i < attempts && delay < maxReplicationBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, maxReplicationBackoff)
+}
+
+// OpenReplica returns a reader for the replicated copy of an object and its size.
+func (s *ReplicationService) OpenReplica(ctx context.Context, key string) (io.ReadCloser, int64, error) {
+	return s.replica.GetObject(ctx, key)
+}
+
+// RestoreObject copies an object from the replica back to the primary store.
+func (s *ReplicationService) RestoreObject(ctx context.Context, key string) error {
+	_, err := s.replica.CopyObjectTo(ctx, s.primary, key)
+	return err
+}
+
+// Backfill queues the objects of every finished blob, e.g. after replication was turned on or a
+// backup was restored. Objects the replica already has are not copied again. Returns the number
+// of objects queued.
+func (s *ReplicationService) Backfill(ctx context.Context) (int, error) {
+	blobs, err := s.blobRepo.ListAllBlobs(ctx)
+	if err != nil {
+		return 0, err
+	}
+	seen := make(map[string]bool)
+	var keys []string
+	for i := range blobs {
+		key := blobObjectKey(&blobs[i])
+		if blobs[i].Status == model.BlobStatusFinished && !seen[key] {
+			seen[key] = true
+			keys = append(keys, key)
+		}
+	}
+	if err := s.queueRepo.Enqueue(ctx, model.ReplicationOpPut, keys); err != nil {
+		return 0, err
+	}
+	return len(keys), nil
+}
+
+// Status summarizes the replication queue.
+func (s *ReplicationService) Status(ctx context.Context) (*model.ReplicationStatus, error) {
+	return s.queueRepo.Status(ctx)
+}
+
+// QueueStatus is Status in the form metrics.NewReplicationCollector takes.
+func (s *ReplicationService) QueueStatus(ctx context.Context) (queued, retrying int64, lag time.Duration, err error) {
+	status, err := s.queueRepo.Status(ctx)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	return status.Queued, status.Retrying, time.Duration(status.LagSeconds * float64(time.Second)), nil
+}
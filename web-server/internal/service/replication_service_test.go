@@ -0,0 +1,30 @@
+package service
+
+import (
+	"testing"
+	"time"
+)
+
+func TestReplicationBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{attempts: 1, want: 5 * time.Second},
+		{attempts: 2, want: 10 * time.Second},
+		{attempts: 4, want: 40 * time.Second},
+		{attempts: 20, want: time.Hour},
+		{attempts: 1000, want: time.Hour},
+	}
+	for _, tt := range tests {
+		if got := replicationBackoff(5*time.Second, tt.attempts); got != tt.want {
+			t.Errorf("replicationBackoff(5s, %d) = %v, want %v", tt.attempts, got, tt.want)
+		}
+	}
+}
+
+func TestNilReplicationServiceIgnoresChanges(t *testing.T) {
+	var s *ReplicationService
+	// Must not panic: callers rely on a nil service meaning replication is off
+	s.Enqueue(t.Context(), "put", "blobs/blob000000000001")
+}
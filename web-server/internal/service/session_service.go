@@ -164,6 +164,43 @@ func (s *SessionService) ExpireAllSessionsByUserID(ctx context.Context, userID,
 	return s.repo.ExpireAllSessionsByUserID(ctx, userID, "ForceLogout: "+message)
 }
 
+// ListSessions lists the newest sessions of all users, or of one user if userID is set.
+func (s *SessionService) ListSessions(ctx context.Context, userID string, includeExpired bool, limit int32) ([]model.Session, error) {
+	return s.repo.ListSessions(ctx, userID, includeExpired, limit)
+}
+
+// CountActiveSessions counts the sessions that are still within their validity and not expired.
+func (s *SessionService) CountActiveSessions(ctx context.Context) (int64, error) {
+	return s.repo.CountActiveSessions(ctx, time.Now().Add(-s.config.IAM.SessionValidityDuration))
+}
+
+// ForceExpireSessionByID expires one session without knowing its API key. The key is found among
+// the user's active keys in Redis by its hash.
+func (s *SessionService) ForceExpireSessionByID(ctx context.Context, sessionID, message string) error {
+	sess, err := s.GetSessionByIDOrFail(ctx, sessionID)
+	if err != nil {
+		return err
+	}
+
+	apiKeys, err := s.redis.SMembers(ctx, "nk:user_sessions:"+sess.UserID).Result()
+	if err != nil {
+		return err
+	}
+	for _, apiKey := range apiKeys {
+		if sha256Hex(apiKey) != sess.APIKeyHash {
+			continue
+		}
+		pipe := s.redis.Pipeline()
+		pipe.Del(ctx, "nk:session:"+apiKey)
+		pipe.SRem(ctx, "nk:user_sessions:"+sess.UserID, apiKey)
+		if _, err := pipe.Exec(ctx); err != nil {
+			return err
+		}
+		break
+	}
+	return s.repo.ExpireSessionByID(ctx, sessionID, "ForceLogout: "+message)
+}
+
 func sha256Hex(input string) string {
 	h := sha256.New()
 	h.Write([]byte(input))
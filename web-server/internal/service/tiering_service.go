@@ -0,0 +1,161 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/rs/zerolog/log"
+
+	"github.com/nkrypt-xyz/nkrypt-xyz-web-server/internal/config"
+	"github.com/nkrypt-xyz/nkrypt-xyz-web-server/internal/model"
+	"github.com/nkrypt-xyz/nkrypt-xyz-web-server/internal/pkg/metrics"
+	"github.com/nkrypt-xyz/nkrypt-xyz-web-server/internal/pkg/storage"
+	"github.com/nkrypt-xyz/nkrypt-xyz-web-server/internal/repository"
+)
+
+// TieringService moves the objects of blobs matching the tiering rules from the hot bucket to the
+// tiering store. A moved blob is first cooling: it is read from the tiering store, but its hot
+// copy is kept until reads that began before the move have ended, and then deleted. Reads promote
+// blobs back to hot storage; see BlobService.OpenBlob.
+type TieringService struct {
+	blobRepo      *repository.BlobRepository
+	storageClient *storage.MinIOClient
+	rules         []config.TieringRule
+	interval      time.Duration
+	batchSize     int
+}
+
+// NewTieringService returns the tiering service of a storage client whose tiering store is set.
+func NewTieringService(blobRepo *repository.BlobRepository, storageClient *storage.MinIOClient, cfg *config.Config) (*TieringService, error) {
+	if storageClient.ColdTier() == nil {
+		return nil, errors.New("the storage client has no tiering store")
+	}
+	rules, err := config.ParseTieringRules(cfg.Tiering.Rules)
+	if err != nil {
+		return nil, err
+	}
+	return &TieringService{
+		blobRepo:      blobRepo,
+		storageClient: storageClient,
+		rules:         rules,
+		interval:      cfg.Tiering.Interval,
+		batchSize:     cfg.Tiering.BatchSize,
+	}, nil
+}
+
+// EnsureColdBucket creates the bucket of the tiering store if it does not exist.
+func (s *TieringService) EnsureColdBucket(ctx context.Context) error {
+	return s.storageClient.ColdTier().EnsureBucket(ctx)
+}
+
+// Run sweeps every interval until ctx is cancelled.
+func (s *TieringService) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		summary, err := s.Sweep(ctx)
+		if err != nil && ctx.Err() == nil {
+			log.Warn().Err(err).Msg("tiering sweep failed")
+		} else if summary != nil && (summary.Demoted > 0 || summary.Purged > 0 || summary.Failed > 0) {
+			log.Info().Int("demoted", summary.Demoted).Int("purged", summary.Purged).Int("failed", summary.Failed).Msg("tiering sweep done")
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Sweep deletes the hot copies of blobs that have been cooling for longer than a read may take,
+// then demotes up to a batch of blobs for each rule. Blobs that fail to move are logged, counted
+// and left for the next sweep.
+func (s *TieringService) Sweep(ctx context.Context) (*model.TieringSummary, error) {
+	summary := &model.TieringSummary{}
+	cooling, err := s.blobRepo.ListCoolingBlobs(ctx, storage.ReadLeaseTTL, s.batchSize)
+	if err != nil {
+		return nil, err
+	}
+	for i := range cooling {
+		if recordTiering("purge", cooling[i].ID, s.purge(ctx, cooling[i].ID)) {
+			summary.Purged++
+		} else {
+			summary.Failed++
+		}
+	}
+
+	for _, rule := range s.rules {
+		blobs, err := s.blobRepo.ListTieringCandidates(ctx, rule.MinAge, rule.BucketID, rule.MinSizeBytes, s.batchSize)
+		if err != nil {
+			return nil, err
+		}
+		for i := range blobs {
+			if recordTiering("demote", blobs[i].ID, s.demote(ctx, blobs[i].ID)) {
+				summary.Demoted++
+			} else {
+				summary.Failed++
+			}
+		}
+	}
+	return summary, nil
+}
+
+// recordTiering counts and logs the result of moving a blob, and reports whether it succeeded.
+func recordTiering(operation, blobID string, err error) bool {
+	if err != nil {
+		metrics.TieringOperations.WithLabelValues(operation, "failure").Inc()
+		log.Warn().Err(err).Str("blobId", blobID).Str("operation", operation).Msg("failed to move blob between storage tiers")
+		return false
+	}
+	metrics.TieringOperations.WithLabelValues(operation, "success").Inc()
+	return true
+}
+
+// demote copies a hot blob to the tiering store and marks it cooling. If the blob was deleted
+// meanwhile, so is the copy.
+func (s *TieringService) demote(ctx context.Context, blobID string) error {
+	key := "blobs/" + blobID
+	cold := s.storageClient.ColdTier()
+	if _, err := s.storageClient.CopyObjectTo(ctx, cold, key); err != nil {
+		return err
+	}
+	ok, err := s.blobRepo.SetLocation(ctx, blobID, model.BlobLocationCooling, model.BlobLocationHot)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return cold.DeleteObject(ctx, key)
+	}
+	return nil
+}
+
+// purge deletes the hot copy of a cooling blob and marks it cold. If a read promoted the blob
+// meanwhile, the hot copy is restored from the tiering store.
+func (s *TieringService) purge(ctx context.Context, blobID string) error {
+	key := "blobs/" + blobID
+	if err := s.storageClient.DeleteObject(ctx, key); err != nil {
+		return err
+	}
+	ok, err := s.blobRepo.SetLocation(ctx, blobID, model.BlobLocationCold, model.BlobLocationCooling)
+	if err != nil || ok {
+		return err
+	}
+	if _, err := s.blobRepo.FindByID(ctx, blobID); errors.Is(err, pgx.ErrNoRows) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	_, err = s.storageClient.ColdTier().CopyObjectTo(ctx, s.storageClient, key)
+	if storage.IsNotFound(err) {
+		// Deleted meanwhile
+		return nil
+	}
+	return err
+}
+
+// CountBlobsByLocation returns the number of finished blobs per location.
+func (s *TieringService) CountBlobsByLocation(ctx context.Context) (map[string]int64, error) {
+	return s.blobRepo.CountBlobsByLocation(ctx)
+}
@@ -0,0 +1,17 @@
+package service
+
+import (
+	"errors"
+
+	"github.com/nkrypt-xyz/nkrypt-xyz-web-server/internal/pkg/apperror"
+	"github.com/nkrypt-xyz/nkrypt-xyz-web-server/internal/repository"
+)
+
+// versioned passes through the result of a versioned repository update, turning a version
+// conflict into the VERSION_CONFLICT user error.
+func versioned(version int64, err error) (int64, error) {
+	if errors.Is(err, repository.ErrVersionConflict) {
+		return 0, apperror.NewUserError("VERSION_CONFLICT", "This entity was changed by someone else since the expected version. Read it again before updating it.")
+	}
+	return version, err
+}
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS bucket_group_permissions;
+DROP TABLE IF EXISTS user_group_members;
+DROP TABLE IF EXISTS user_groups;
@@ -0,0 +1,39 @@
+CREATE TABLE IF NOT EXISTS user_groups (
+    id                      CHAR(16) PRIMARY KEY,
+    name                    VARCHAR(64) NOT NULL UNIQUE,
+    description             VARCHAR(256) NOT NULL DEFAULT '',
+    created_by_user_id      CHAR(16) NOT NULL REFERENCES users(id),
+    created_at              TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at              TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS user_group_members (
+    group_id                CHAR(16) NOT NULL REFERENCES user_groups(id) ON DELETE CASCADE,
+    user_id                 CHAR(16) NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at              TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+    PRIMARY KEY (group_id, user_id)
+);
+
+CREATE INDEX idx_ugm_user_id ON user_group_members(user_id);
+
+CREATE TABLE IF NOT EXISTS bucket_group_permissions (
+    id                      BIGSERIAL PRIMARY KEY,
+    bucket_id               CHAR(16) NOT NULL REFERENCES buckets(id) ON DELETE CASCADE,
+    group_id                CHAR(16) NOT NULL REFERENCES user_groups(id) ON DELETE CASCADE,
+    notes                   VARCHAR(256) NOT NULL DEFAULT '',
+
+    perm_modify             BOOLEAN NOT NULL DEFAULT FALSE,
+    perm_manage_authorization BOOLEAN NOT NULL DEFAULT FALSE,
+    perm_destroy            BOOLEAN NOT NULL DEFAULT FALSE,
+    perm_view_content       BOOLEAN NOT NULL DEFAULT FALSE,
+    perm_manage_content     BOOLEAN NOT NULL DEFAULT FALSE,
+
+    created_at              TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at              TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+    UNIQUE(bucket_id, group_id)
+);
+
+CREATE INDEX idx_bgp_bucket_id ON bucket_group_permissions(bucket_id);
+CREATE INDEX idx_bgp_group_id ON bucket_group_permissions(group_id);
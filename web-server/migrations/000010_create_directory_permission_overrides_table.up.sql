@@ -0,0 +1,23 @@
+-- Per-directory permission overrides. A NULL permission column means "inherit from the parent
+-- directory"; overrides can narrow the bucket-level grant but never widen it.
+CREATE TABLE IF NOT EXISTS directory_permission_overrides (
+    id                      BIGSERIAL PRIMARY KEY,
+    bucket_id               CHAR(16) NOT NULL REFERENCES buckets(id) ON DELETE CASCADE,
+    directory_id            CHAR(16) NOT NULL REFERENCES directories(id) ON DELETE CASCADE,
+    user_id                 CHAR(16) REFERENCES users(id) ON DELETE CASCADE,
+    group_id                CHAR(16) REFERENCES user_groups(id) ON DELETE CASCADE,
+    notes                   VARCHAR(256) NOT NULL DEFAULT '',
+
+    perm_view_content       BOOLEAN,
+    perm_manage_content     BOOLEAN,
+
+    created_at              TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at              TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+    -- Exactly one subject: a user or a group
+    CHECK ((user_id IS NULL) <> (group_id IS NULL))
+);
+
+CREATE UNIQUE INDEX idx_dpo_directory_user ON directory_permission_overrides(directory_id, user_id) WHERE user_id IS NOT NULL;
+CREATE UNIQUE INDEX idx_dpo_directory_group ON directory_permission_overrides(directory_id, group_id) WHERE group_id IS NOT NULL;
+CREATE INDEX idx_dpo_bucket_id ON directory_permission_overrides(bucket_id);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS invitation_bucket_grants;
+DROP TABLE IF EXISTS invitations;
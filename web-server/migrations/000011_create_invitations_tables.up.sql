@@ -0,0 +1,33 @@
+-- Invitations let users holding CREATE_USER pre-authorize an account that the invitee creates
+-- themselves. Only the SHA-256 hash of the invitation token is stored.
+CREATE TABLE IF NOT EXISTS invitations (
+    id                      CHAR(16) PRIMARY KEY,
+    token_hash              TEXT NOT NULL UNIQUE,
+    created_by_user_id      CHAR(16) NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    notes                   VARCHAR(256) NOT NULL DEFAULT '',
+
+    perm_manage_all_user    BOOLEAN NOT NULL DEFAULT FALSE,
+    perm_create_user        BOOLEAN NOT NULL DEFAULT FALSE,
+    perm_create_bucket      BOOLEAN NOT NULL DEFAULT TRUE,
+
+    expires_at              TIMESTAMPTZ NOT NULL,
+    redeemed_at             TIMESTAMPTZ,
+    redeemed_by_user_id     CHAR(16) REFERENCES users(id) ON DELETE SET NULL,
+
+    created_at              TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_invitations_created_by ON invitations(created_by_user_id);
+
+CREATE TABLE IF NOT EXISTS invitation_bucket_grants (
+    invitation_id           CHAR(16) NOT NULL REFERENCES invitations(id) ON DELETE CASCADE,
+    bucket_id               CHAR(16) NOT NULL REFERENCES buckets(id) ON DELETE CASCADE,
+
+    perm_modify             BOOLEAN NOT NULL DEFAULT FALSE,
+    perm_manage_authorization BOOLEAN NOT NULL DEFAULT FALSE,
+    perm_destroy            BOOLEAN NOT NULL DEFAULT FALSE,
+    perm_view_content       BOOLEAN NOT NULL DEFAULT FALSE,
+    perm_manage_content     BOOLEAN NOT NULL DEFAULT FALSE,
+
+    PRIMARY KEY (invitation_id, bucket_id)
+);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS blob_upload_parts;
+DROP TABLE IF EXISTS blob_uploads;
@@ -0,0 +1,24 @@
+-- An upload session writes a blob as numbered parts through a MinIO multipart upload. Every part
+-- but the last is part_size_bytes long; the parts are assembled when the session is completed.
+CREATE TABLE IF NOT EXISTS blob_uploads (
+    blob_id             CHAR(16) PRIMARY KEY REFERENCES blobs(id) ON DELETE CASCADE,
+    storage_upload_id   TEXT NOT NULL,
+    total_size_bytes    BIGINT NOT NULL,
+    part_size_bytes     BIGINT NOT NULL,
+    part_count          INTEGER NOT NULL,
+    created_at          TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    expires_at          TIMESTAMPTZ NOT NULL
+);
+
+-- Only parts whose content was stored and verified are recorded, with the SHA-256 the server
+-- computed and the ETag needed to complete the multipart upload.
+CREATE TABLE IF NOT EXISTS blob_upload_parts (
+    blob_id             CHAR(16) NOT NULL REFERENCES blob_uploads(blob_id) ON DELETE CASCADE,
+    part_number         INTEGER NOT NULL,
+    size_bytes          BIGINT NOT NULL,
+    sha256              CHAR(64) NOT NULL,
+    etag                TEXT NOT NULL,
+    uploaded_at         TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+    PRIMARY KEY (blob_id, part_number)
+);
@@ -0,0 +1,17 @@
+-- Enum values cannot be dropped, so the type is recreated. Uploading blobs go back to started, and
+-- superseded blobs to finished, where reads still pick the latest one.
+
+ALTER TABLE blobs DROP COLUMN IF EXISTS superseded_at;
+
+ALTER TABLE blobs ALTER COLUMN status DROP DEFAULT;
+ALTER TYPE blob_status RENAME TO blob_status_old;
+CREATE TYPE blob_status AS ENUM ('started', 'finished', 'error');
+ALTER TABLE blobs ALTER COLUMN status TYPE blob_status USING (
+    CASE status::text
+        WHEN 'uploading' THEN 'started'
+        WHEN 'superseded' THEN 'finished'
+        ELSE status::text
+    END
+)::blob_status;
+ALTER TABLE blobs ALTER COLUMN status SET DEFAULT 'started';
+DROP TYPE blob_status_old;
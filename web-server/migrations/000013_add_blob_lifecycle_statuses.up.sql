@@ -0,0 +1,7 @@
+-- Blob lifecycle: started -> uploading -> finished / error, and finished -> superseded once a newer
+-- blob of the file finishes. Superseded blobs are kept until no read of them is in flight.
+
+ALTER TYPE blob_status ADD VALUE IF NOT EXISTS 'uploading' AFTER 'started';
+ALTER TYPE blob_status ADD VALUE IF NOT EXISTS 'superseded';
+
+ALTER TABLE blobs ADD COLUMN superseded_at TIMESTAMPTZ;
@@ -0,0 +1,3 @@
+ALTER TABLE files DROP COLUMN IF EXISTS version;
+ALTER TABLE directories DROP COLUMN IF EXISTS version;
+ALTER TABLE buckets DROP COLUMN IF EXISTS version;
@@ -0,0 +1,6 @@
+-- Versions for optimistic concurrency. Renames, moves and metadata updates increment the version
+-- and can require the version the client last read.
+
+ALTER TABLE buckets ADD COLUMN version BIGINT NOT NULL DEFAULT 1;
+ALTER TABLE directories ADD COLUMN version BIGINT NOT NULL DEFAULT 1;
+ALTER TABLE files ADD COLUMN version BIGINT NOT NULL DEFAULT 1;
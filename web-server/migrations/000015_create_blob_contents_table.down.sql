@@ -0,0 +1,6 @@
+-- The objects of deduplicated content are not moved back, so blobs using them lose their content
+UPDATE blobs SET status='error', updated_at=NOW() WHERE content_sha256 IS NOT NULL;
+
+DROP INDEX IF EXISTS idx_blobs_content_sha256;
+ALTER TABLE blobs DROP COLUMN IF EXISTS content_sha256;
+DROP TABLE IF EXISTS blob_contents;
@@ -0,0 +1,15 @@
+-- Deduplicated blob content is stored once, as the object contents/<sha256>, and shared by every
+-- blob that has it. ref_count is the number of blobs referencing the content; the object and the
+-- row are deleted together with the last reference. Blobs without content_sha256 keep their own
+-- object, blobs/<id>.
+CREATE TABLE IF NOT EXISTS blob_contents (
+    sha256              CHAR(64) PRIMARY KEY,
+    size_bytes          BIGINT NOT NULL,
+    ref_count           INTEGER NOT NULL CHECK (ref_count >= 0),
+    created_at          TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at          TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+ALTER TABLE blobs ADD COLUMN content_sha256 CHAR(64) REFERENCES blob_contents(sha256);
+
+CREATE INDEX idx_blobs_content_sha256 ON blobs(content_sha256);
@@ -0,0 +1,16 @@
+-- Changes to stored objects that are still to be copied to, or deleted from, the replica object
+-- store. There is one row per object key: a newer change replaces an older one, bumping version,
+-- so that a worker finishing the older change leaves the row in place. enqueued_at is when the
+-- oldest unreplicated change of the object was queued.
+CREATE TABLE IF NOT EXISTS replication_queue (
+    object_key          TEXT PRIMARY KEY,
+    operation           VARCHAR(16) NOT NULL CHECK (operation IN ('put', 'delete')),
+    version             BIGINT NOT NULL DEFAULT 1,
+    attempts            INTEGER NOT NULL DEFAULT 0,
+    last_error          TEXT,
+    enqueued_at         TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    next_attempt_at     TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    claimed_until       TIMESTAMPTZ
+);
+
+CREATE INDEX idx_replication_queue_next_attempt_at ON replication_queue(next_attempt_at);
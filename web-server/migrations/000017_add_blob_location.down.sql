@@ -0,0 +1,6 @@
+-- Cold objects are not moved back, so blobs stored there lose their content
+UPDATE blobs SET status='error', updated_at=NOW() WHERE location='cold';
+
+DROP INDEX IF EXISTS idx_blobs_location;
+ALTER TABLE blobs DROP COLUMN IF EXISTS location_changed_at;
+ALTER TABLE blobs DROP COLUMN IF EXISTS location;
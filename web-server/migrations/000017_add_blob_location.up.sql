@@ -0,0 +1,8 @@
+-- Where the object of a blob is stored: 'hot' in the MinIO bucket, or 'cold' in the tiering
+-- store. A blob moving to cold storage is 'cooling' while its hot object is kept for reads
+-- already in flight. location_changed_at is when the blob last moved; a blob promoted back to hot
+-- storage ages from then.
+ALTER TABLE blobs ADD COLUMN location VARCHAR(16) NOT NULL DEFAULT 'hot' CHECK (location IN ('hot', 'cooling', 'cold'));
+ALTER TABLE blobs ADD COLUMN location_changed_at TIMESTAMPTZ;
+
+CREATE INDEX idx_blobs_location ON blobs(location) WHERE location <> 'hot';
@@ -0,0 +1,7 @@
+-- Compressed objects are not decompressed, so blobs stored compressed lose their content
+UPDATE blobs SET status='error', updated_at=NOW() WHERE codec <> 'none';
+
+ALTER TABLE blobs DROP COLUMN IF EXISTS stored_size_bytes;
+ALTER TABLE blobs DROP COLUMN IF EXISTS size_bytes;
+ALTER TABLE blobs DROP COLUMN IF EXISTS codec;
+ALTER TABLE buckets DROP COLUMN IF EXISTS compression;
@@ -0,0 +1,9 @@
+-- Codec that new blob objects of a bucket are compressed with: 'none' or 'zstd'
+ALTER TABLE buckets ADD COLUMN compression VARCHAR(16) NOT NULL DEFAULT 'none' CHECK (compression IN ('none', 'zstd'));
+
+-- Codec the object of a blob is stored with, so compressed and uncompressed objects can coexist,
+-- and the sizes of the content (logical) and of the object (stored). The sizes are NULL for blobs
+-- stored before they were recorded.
+ALTER TABLE blobs ADD COLUMN codec VARCHAR(16) NOT NULL DEFAULT 'none' CHECK (codec IN ('none', 'zstd'));
+ALTER TABLE blobs ADD COLUMN size_bytes BIGINT;
+ALTER TABLE blobs ADD COLUMN stored_size_bytes BIGINT;
@@ -6,9 +6,13 @@ import (
 	"bytes"
 	"context"
 	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"io"
+	"net/http"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -207,6 +211,153 @@ func TestBlobWriteOverwrite(t *testing.T) {
 	}
 }
 
+func TestBlobWriteConflict(t *testing.T) {
+	bucketID, fileID := createBlobTestFile(t, fmt.Sprintf("test-bucket-blob-conflict-%d", time.Now().UnixNano()))
+	ctx := context.Background()
+
+	write := func(data string, ifMatch string) (*http.Response, map[string]interface{}) {
+		t.Helper()
+		headers := map[string]string{"nk-crypto-meta": "test-crypto-meta"}
+		if ifMatch != "" {
+			headers["If-Match"] = `"` + ifMatch + `"`
+		}
+		resp, err := testutil.CallPostRaw(httpClient, baseURL+"/api/blob/write/"+bucketID+"/"+fileID, strings.NewReader(data), headers, adminAPIKey)
+		if err != nil {
+			t.Fatalf("Blob write failed: %v", err)
+		}
+		defer resp.Body.Close()
+		var result map[string]interface{}
+		if err := testutil.ParseJSONResponse(resp, &result); err != nil {
+			t.Fatalf("Failed to parse write response: %v", err)
+		}
+		return resp, result
+	}
+
+	_, result := write("first", "")
+	firstBlobID := result["blobId"].(string)
+
+	// The read reports the current blob as its ETag
+	readResp, err := testutil.CallPostRaw(httpClient, baseURL+"/api/blob/read/"+bucketID+"/"+fileID, strings.NewReader(""), nil, adminAPIKey)
+	if err != nil {
+		t.Fatalf("Blob read failed: %v", err)
+	}
+	readResp.Body.Close()
+	if etag := readResp.Header.Get("ETag"); etag != `"`+firstBlobID+`"` {
+		t.Fatalf("Expected ETag %q, got %q", firstBlobID, etag)
+	}
+
+	_, result = write("second", firstBlobID)
+	if result["hasError"] != false {
+		t.Fatalf("Write expecting the current blob failed: %v", result)
+	}
+	secondBlobID := result["blobId"].(string)
+
+	// A writer still expecting the first blob conflicts
+	resp, result := write("third", firstBlobID)
+	if resp.StatusCode != http.StatusConflict {
+		t.Errorf("Expected status 409, got %d", resp.StatusCode)
+	}
+	testutil.AssertErrorCode(t, result, "WRITE_CONFLICT")
+
+	readResp, err = testutil.CallPostRaw(httpClient, baseURL+"/api/blob/read/"+bucketID+"/"+fileID, strings.NewReader(""), nil, adminAPIKey)
+	if err != nil {
+		t.Fatalf("Blob read failed: %v", err)
+	}
+	defer readResp.Body.Close()
+	data, _ := io.ReadAll(readResp.Body)
+	if string(data) != "second" || readResp.Header.Get("ETag") != `"`+secondBlobID+`"` {
+		t.Errorf("Expected the second blob, got %q with ETag %s", data, readResp.Header.Get("ETag"))
+	}
+
+	// Without reads in flight, the superseded blob is deleted once the newer one finishes
+	if exists, err := minioHelper.BlobExists(ctx, firstBlobID); err == nil && exists {
+		t.Errorf("Expected superseded blob %s to be deleted", firstBlobID)
+	}
+}
+
+// With deduplication on, both files share one content object, which must outlive the first
+// file. Without it, each file has its own object and the test passes all the same.
+func TestBlobIdenticalContentAcrossFiles(t *testing.T) {
+	content := fmt.Sprintf("identical ciphertext %d", time.Now().UnixNano())
+	var bucketIDs, fileIDs [2]string
+	for i := range fileIDs {
+		bucketIDs[i], fileIDs[i] = createBlobTestFile(t, fmt.Sprintf("test-bucket-blob-identical-%d-%d", i, time.Now().UnixNano()))
+		resp, err := testutil.CallPostRaw(httpClient, baseURL+"/api/blob/write/"+bucketIDs[i]+"/"+fileIDs[i], strings.NewReader(content), map[string]string{"nk-crypto-meta": "test-crypto-meta"}, adminAPIKey)
+		if err != nil {
+			t.Fatalf("Blob write failed: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("Expected status 200 writing file %d, got %d", i, resp.StatusCode)
+		}
+	}
+
+	testutil.CallPostJSONExpectSuccess(t, httpClient, baseURL+"/api/file/delete", map[string]interface{}{
+		"bucketId": bucketIDs[0],
+		"fileId":   fileIDs[0],
+	}, adminAPIKey)
+
+	readResp, err := testutil.CallPostRaw(httpClient, baseURL+"/api/blob/read/"+bucketIDs[1]+"/"+fileIDs[1], strings.NewReader(""), nil, adminAPIKey)
+	if err != nil {
+		t.Fatalf("Blob read failed: %v", err)
+	}
+	defer readResp.Body.Close()
+	data, _ := io.ReadAll(readResp.Body)
+	if readResp.StatusCode != http.StatusOK || string(data) != content {
+		t.Errorf("Expected the second file to keep its content, got status %d and %q", readResp.StatusCode, data)
+	}
+}
+
+// Destroying a bucket releases its blobs: shared content outlives the first bucket and is deleted
+// along with the second.
+func TestBlobIdenticalContentAcrossDestroyedBuckets(t *testing.T) {
+	ctx := context.Background()
+	content := fmt.Sprintf("identical ciphertext %d", time.Now().UnixNano())
+	sum := sha256.Sum256([]byte(content))
+	var bucketNames, bucketIDs, fileIDs, blobIDs [2]string
+	for i := range fileIDs {
+		bucketNames[i] = fmt.Sprintf("test-bucket-blob-destroyed-%d-%d", i, time.Now().UnixNano())
+		bucketIDs[i], fileIDs[i] = createBlobTestFile(t, bucketNames[i])
+		resp, err := testutil.CallPostRaw(httpClient, baseURL+"/api/blob/write/"+bucketIDs[i]+"/"+fileIDs[i], strings.NewReader(content), map[string]string{"nk-crypto-meta": "test-crypto-meta"}, adminAPIKey)
+		if err != nil {
+			t.Fatalf("Blob write failed: %v", err)
+		}
+		var result map[string]interface{}
+		if err := testutil.ParseJSONResponse(resp, &result); err != nil {
+			t.Fatalf("Failed to parse write response: %v", err)
+		}
+		blobIDs[i] = result["blobId"].(string)
+	}
+
+	destroy := func(i int) {
+		testutil.CallPostJSONExpectSuccess(t, httpClient, baseURL+"/api/bucket/destroy", map[string]interface{}{
+			"bucketId": bucketIDs[i],
+			"name":     bucketNames[i],
+		}, adminAPIKey)
+	}
+
+	destroy(0)
+	readResp, err := testutil.CallPostRaw(httpClient, baseURL+"/api/blob/read/"+bucketIDs[1]+"/"+fileIDs[1], strings.NewReader(""), nil, adminAPIKey)
+	if err != nil {
+		t.Fatalf("Blob read failed: %v", err)
+	}
+	data, _ := io.ReadAll(readResp.Body)
+	readResp.Body.Close()
+	if readResp.StatusCode != http.StatusOK || string(data) != content {
+		t.Errorf("Expected the second bucket to keep its content, got status %d and %q", readResp.StatusCode, data)
+	}
+
+	destroy(1)
+	if exists, err := minioHelper.ContentExists(ctx, hex.EncodeToString(sum[:])); err != nil || exists {
+		t.Errorf("Expected the shared content to be deleted with the last bucket, exists=%v err=%v", exists, err)
+	}
+	for _, blobID := range blobIDs {
+		if exists, err := minioHelper.BlobExists(ctx, blobID); err != nil || exists {
+			t.Errorf("Expected blob %s to be deleted with its bucket, exists=%v err=%v", blobID, exists, err)
+		}
+	}
+}
+
 func TestBlobWriteLargeStream(t *testing.T) {
 	bucketName := fmt.Sprintf("test-bucket-blob-large-%d", time.Now().Unix())
 	// Create bucket
@@ -441,9 +592,303 @@ func TestBlobWriteQuantized(t *testing.T) {
 	}
 }
 
+func TestBlobWriteQuantizedRejectsGapsAndOverlaps(t *testing.T) {
+	bucketID, fileID := createBlobTestFile(t, fmt.Sprintf("test-bucket-blob-quantized-gaps-%d", time.Now().UnixNano()))
+	headers := map[string]string{"nk-crypto-meta": "test-crypto-meta"}
+
+	writeChunk := func(blobID string, offset int, shouldEnd bool, body io.Reader) map[string]interface{} {
+		t.Helper()
+		endpoint := fmt.Sprintf("%s/api/blob/write-quantized/%s/%s/%s/%d/%t", baseURL, bucketID, fileID, blobID, offset, shouldEnd)
+		resp, err := testutil.CallPostRaw(httpClient, endpoint, body, headers, adminAPIKey)
+		if err != nil {
+			t.Fatalf("Chunk at offset %d upload failed: %v", offset, err)
+		}
+		defer resp.Body.Close()
+		var result map[string]interface{}
+		if err := testutil.ParseJSONResponse(resp, &result); err != nil {
+			t.Fatalf("Failed to parse response for chunk at offset %d: %v", offset, err)
+		}
+		return result
+	}
+
+	chunk := make([]byte, 1000)
+	result := writeChunk("null", 0, false, bytes.NewReader(chunk))
+	if result["hasError"] != false {
+		t.Fatalf("First chunk failed: %v", result)
+	}
+	blobID := result["blobId"].(string)
+	if result["nextExpectedOffset"] != float64(1000) {
+		t.Errorf("Expected nextExpectedOffset 1000, got %v", result["nextExpectedOffset"])
+	}
+
+	// A chunk after a gap is accepted, but the next expected offset stays at the gap
+	result = writeChunk(blobID, 2000, false, bytes.NewReader(chunk))
+	if result["hasError"] != false {
+		t.Fatalf("Chunk at offset 2000 failed: %v", result)
+	}
+	if result["nextExpectedOffset"] != float64(1000) {
+		t.Errorf("Expected nextExpectedOffset 1000, got %v", result["nextExpectedOffset"])
+	}
+
+	// Overlapping a stored chunk is rejected
+	result = writeChunk(blobID, 500, false, bytes.NewReader(chunk))
+	testutil.AssertErrorCode(t, result, "CHUNK_OVERLAP")
+
+	// Finalizing with the gap still open is refused and leaves the blob in progress
+	result = writeChunk(blobID, 3000, true, bytes.NewReader(chunk))
+	testutil.AssertErrorCode(t, result, "CHUNK_MISSING")
+
+	result = writeChunk(blobID, 1000, false, bytes.NewReader(chunk))
+	if result["hasError"] != false {
+		t.Fatalf("Chunk at offset 1000 failed: %v", result)
+	}
+	if result["nextExpectedOffset"] != float64(4000) {
+		t.Errorf("Expected nextExpectedOffset 4000, got %v", result["nextExpectedOffset"])
+	}
+
+	// A resend without Content-Length is checked only once stored; rejecting it keeps the chunk
+	// stored at its offset and leaves no object behind
+	result = writeChunk(blobID, 0, false, io.MultiReader(bytes.NewReader(chunk[:500])))
+	testutil.AssertErrorCode(t, result, "CHUNK_OVERLAP")
+	chunkObjects, err := minioHelper.ListBlobs(context.Background(), blobID+".chunk.")
+	if err != nil {
+		t.Fatalf("Failed to list chunk objects: %v", err)
+	}
+	if len(chunkObjects) != 4 {
+		t.Errorf("Expected the 4 recorded chunk objects, got %v", chunkObjects)
+	}
+
+	result = writeChunk(blobID, 3000, true, bytes.NewReader(chunk))
+	if result["hasError"] != false {
+		t.Fatalf("Finalizing failed: %v", result)
+	}
+}
+
 func min(a, b int) int {
 	if a < b {
 		return a
 	}
 	return b
 }
+
+// createBlobTestFile creates a bucket and a file in it, returning their IDs.
+func createBlobTestFile(t *testing.T, bucketName string) (string, string) {
+	t.Helper()
+	bucketResult := testutil.CallPostJSONExpectSuccess(t, httpClient, baseURL+"/api/bucket/create", map[string]interface{}{
+		"name":      bucketName,
+		"cryptSpec": "aes-256-gcm",
+		"cryptData": "test-crypt-data",
+		"metaData":  map[string]interface{}{},
+	}, adminAPIKey)
+	bucketID := bucketResult["bucketId"].(string)
+	createResult := testutil.CallPostJSONExpectSuccess(t, httpClient, baseURL+"/api/file/create", map[string]interface{}{
+		"name":              "test-blob-upload.bin",
+		"bucketId":          bucketID,
+		"parentDirectoryId": bucketResult["rootDirectoryId"].(string),
+		"metaData":          map[string]interface{}{},
+		"encryptedMetaData": "encrypted-data",
+	}, adminAPIKey)
+	return bucketID, createResult["fileId"].(string)
+}
+
+// uploadPart sends one part of an upload session and returns the decoded response.
+func uploadPart(t *testing.T, bucketID, fileID, blobID string, partNumber int, data []byte, headers map[string]string) map[string]interface{} {
+	t.Helper()
+	endpoint := fmt.Sprintf("%s/api/blob/upload/part/%s/%s/%s/%d", baseURL, bucketID, fileID, blobID, partNumber)
+	resp, err := testutil.CallPostRaw(httpClient, endpoint, bytes.NewReader(data), headers, adminAPIKey)
+	if err != nil {
+		t.Fatalf("Part %d upload failed: %v", partNumber, err)
+	}
+	defer resp.Body.Close()
+	var result map[string]interface{}
+	if err := testutil.ParseJSONResponse(resp, &result); err != nil {
+		t.Fatalf("Failed to parse part %d response: %v", partNumber, err)
+	}
+	return result
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func TestBlobUploadSession(t *testing.T) {
+	bucketID, fileID := createBlobTestFile(t, fmt.Sprintf("test-bucket-blob-upload-%d", time.Now().UnixNano()))
+
+	// Two full 5 MiB parts and a short last part
+	partSize := 5 * 1024 * 1024
+	data := make([]byte, 2*partSize+1000)
+	if _, err := rand.Read(data); err != nil {
+		t.Fatalf("Failed to generate random data: %v", err)
+	}
+	parts := [][]byte{data[:partSize], data[partSize : 2*partSize], data[2*partSize:]}
+
+	initResult := testutil.CallPostJSONExpectSuccess(t, httpClient, baseURL+"/api/blob/upload/initiate", map[string]interface{}{
+		"bucketId":       bucketID,
+		"fileId":         fileID,
+		"totalSizeBytes": len(data),
+		"partSizeBytes":  partSize,
+		"cryptoMeta":     "test-crypto-meta",
+	}, adminAPIKey)
+	blobID := initResult["blobId"].(string)
+	if initResult["partCount"] != float64(3) {
+		t.Fatalf("Expected 3 parts, got %v", initResult["partCount"])
+	}
+
+	// Upload the parts concurrently, except part 2
+	var wg sync.WaitGroup
+	for _, n := range []int{3, 1} {
+		wg.Add(1)
+		go func(n int) {
+			defer wg.Done()
+			result := uploadPart(t, bucketID, fileID, blobID, n, parts[n-1], map[string]string{"nk-part-sha256": sha256Hex(parts[n-1])})
+			if result["hasError"] != false {
+				t.Errorf("Part %d failed: %v", n, result["error"])
+			}
+		}(n)
+	}
+	wg.Wait()
+
+	// Completing now fails, and the status reports the missing part
+	resp, result, err := testutil.CallPostJSON(httpClient, baseURL+"/api/blob/upload/complete", map[string]interface{}{
+		"bucketId":      bucketID,
+		"fileId":        fileID,
+		"blobId":        blobID,
+		"partChecksums": []string{sha256Hex(parts[0]), sha256Hex(parts[1]), sha256Hex(parts[2])},
+	}, adminAPIKey)
+	if err != nil {
+		t.Fatalf("Complete request failed: %v", err)
+	}
+	resp.Body.Close()
+	testutil.AssertErrorCode(t, result, "UPLOAD_INCOMPLETE")
+
+	status := testutil.CallPostJSONExpectSuccess(t, httpClient, baseURL+"/api/blob/upload/status", map[string]interface{}{
+		"bucketId": bucketID,
+		"fileId":   fileID,
+		"blobId":   blobID,
+	}, adminAPIKey)
+	missing, _ := status["missingPartNumbers"].([]interface{})
+	if len(missing) != 1 || missing[0] != float64(2) {
+		t.Fatalf("Expected part 2 to be missing, got %v", status["missingPartNumbers"])
+	}
+
+	// A part of the wrong size or content is rejected
+	result = uploadPart(t, bucketID, fileID, blobID, 2, parts[1][:100], nil)
+	testutil.AssertErrorCode(t, result, "PART_SIZE_MISMATCH")
+	result = uploadPart(t, bucketID, fileID, blobID, 2, parts[1], map[string]string{"nk-part-sha256": sha256Hex(parts[0])})
+	testutil.AssertErrorCode(t, result, "PART_CHECKSUM_MISMATCH")
+
+	result = uploadPart(t, bucketID, fileID, blobID, 2, parts[1], nil)
+	if result["sha256"] != sha256Hex(parts[1]) {
+		t.Errorf("Expected part 2 checksum %s, got %v", sha256Hex(parts[1]), result["sha256"])
+	}
+
+	completeResult := testutil.CallPostJSONExpectSuccess(t, httpClient, baseURL+"/api/blob/upload/complete", map[string]interface{}{
+		"bucketId":      bucketID,
+		"fileId":        fileID,
+		"blobId":        blobID,
+		"partChecksums": []string{sha256Hex(parts[0]), sha256Hex(parts[1]), sha256Hex(parts[2])},
+	}, adminAPIKey)
+	if completeResult["blobId"] != blobID {
+		t.Errorf("Expected blobId %s, got %v", blobID, completeResult["blobId"])
+	}
+
+	readResp, err := testutil.CallPostRaw(httpClient, baseURL+"/api/blob/read/"+bucketID+"/"+fileID, strings.NewReader(""), nil, adminAPIKey)
+	if err != nil {
+		t.Fatalf("Blob read failed: %v", err)
+	}
+	defer readResp.Body.Close()
+	readData, err := io.ReadAll(readResp.Body)
+	if err != nil {
+		t.Fatalf("Failed to read blob: %v", err)
+	}
+	if !bytes.Equal(readData, data) {
+		t.Errorf("Blob content doesn't match: expected %d bytes, got %d", len(data), len(readData))
+	}
+	if readResp.Header.Get("nk-crypto-meta") != "test-crypto-meta" {
+		t.Errorf("Expected crypto meta to be kept, got %q", readResp.Header.Get("nk-crypto-meta"))
+	}
+}
+
+// A bucket's compression applies to blobs completed through an upload session too
+func TestBlobUploadSessionCompressed(t *testing.T) {
+	bucketID, fileID := createBlobTestFile(t, fmt.Sprintf("test-bucket-blob-upload-zstd-%d", time.Now().UnixNano()))
+	testutil.CallPostJSONExpectSuccess(t, httpClient, baseURL+"/api/bucket/set-compression", map[string]interface{}{
+		"bucketId":    bucketID,
+		"compression": "zstd",
+	}, adminAPIKey)
+
+	partSize := 5 * 1024 * 1024
+	data := bytes.Repeat([]byte("compressible "), (partSize+1000)/13)
+	parts := [][]byte{data[:partSize], data[partSize:]}
+
+	initResult := testutil.CallPostJSONExpectSuccess(t, httpClient, baseURL+"/api/blob/upload/initiate", map[string]interface{}{
+		"bucketId":       bucketID,
+		"fileId":         fileID,
+		"totalSizeBytes": len(data),
+		"partSizeBytes":  partSize,
+		"cryptoMeta":     "test-crypto-meta",
+	}, adminAPIKey)
+	blobID := initResult["blobId"].(string)
+	for i, part := range parts {
+		if result := uploadPart(t, bucketID, fileID, blobID, i+1, part, nil); result["hasError"] != false {
+			t.Fatalf("Part %d failed: %v", i+1, result["error"])
+		}
+	}
+	testutil.CallPostJSONExpectSuccess(t, httpClient, baseURL+"/api/blob/upload/complete", map[string]interface{}{
+		"bucketId":      bucketID,
+		"fileId":        fileID,
+		"blobId":        blobID,
+		"partChecksums": []string{sha256Hex(parts[0]), sha256Hex(parts[1])},
+	}, adminAPIKey)
+
+	if size, err := minioHelper.GetBlobSize(context.Background(), blobID); err != nil || size >= int64(len(data)) {
+		t.Errorf("Expected the stored object to be compressed, got %d bytes of %d (err=%v)", size, len(data), err)
+	}
+
+	readResp, err := testutil.CallPostRaw(httpClient, baseURL+"/api/blob/read/"+bucketID+"/"+fileID, strings.NewReader(""), nil, adminAPIKey)
+	if err != nil {
+		t.Fatalf("Blob read failed: %v", err)
+	}
+	defer readResp.Body.Close()
+	readData, _ := io.ReadAll(readResp.Body)
+	if !bytes.Equal(readData, data) {
+		t.Errorf("Blob content doesn't match: expected %d bytes, got %d", len(data), len(readData))
+	}
+}
+
+func TestBlobUploadSessionAbort(t *testing.T) {
+	bucketID, fileID := createBlobTestFile(t, fmt.Sprintf("test-bucket-blob-abort-%d", time.Now().UnixNano()))
+
+	initResult := testutil.CallPostJSONExpectSuccess(t, httpClient, baseURL+"/api/blob/upload/initiate", map[string]interface{}{
+		"bucketId":       bucketID,
+		"fileId":         fileID,
+		"totalSizeBytes": 10,
+		"partSizeBytes":  10,
+		"cryptoMeta":     "test-crypto-meta",
+	}, adminAPIKey)
+	blobID := initResult["blobId"].(string)
+	uploadPart(t, bucketID, fileID, blobID, 1, []byte("0123456789"), nil)
+
+	session := map[string]interface{}{"bucketId": bucketID, "fileId": fileID, "blobId": blobID}
+	testutil.CallPostJSONExpectSuccess(t, httpClient, baseURL+"/api/blob/upload/abort", session, adminAPIKey)
+
+	resp, result, err := testutil.CallPostJSON(httpClient, baseURL+"/api/blob/upload/status", session, adminAPIKey)
+	if err != nil {
+		t.Fatalf("Status request failed: %v", err)
+	}
+	resp.Body.Close()
+	testutil.AssertErrorCode(t, result, "BLOB_INVALID")
+
+	// Nothing was written to the file
+	readResp, err := testutil.CallPostRaw(httpClient, baseURL+"/api/blob/read/"+bucketID+"/"+fileID, strings.NewReader(""), nil, adminAPIKey)
+	if err != nil {
+		t.Fatalf("Blob read failed: %v", err)
+	}
+	defer readResp.Body.Close()
+	var readResult map[string]interface{}
+	if err := testutil.ParseJSONResponse(readResp, &readResult); err != nil {
+		t.Fatalf("Failed to parse read response: %v", err)
+	}
+	testutil.AssertErrorCode(t, readResult, "BLOB_NOT_FOUND")
+}
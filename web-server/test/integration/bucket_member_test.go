@@ -0,0 +1,104 @@
+//go:build integration
+
+package integration
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/nkrypt-xyz/nkrypt-xyz-web-server/test/testutil"
+)
+
+func TestBucketMembersAndOwnership(t *testing.T) {
+	timestamp := time.Now().Unix()
+	bucketName := fmt.Sprintf("test-bucket-members-%d", timestamp)
+	userName := fmt.Sprintf("testmemberuser%d", timestamp)
+
+	userResult := testutil.CallPostJSONExpectSuccess(t, httpClient, baseURL+"/api/admin/iam/add-user", map[string]interface{}{
+		"displayName": "Test Member User",
+		"userName":    userName,
+		"password":    "TestPass123!",
+	}, adminAPIKey)
+	userID := userResult["userId"].(string)
+
+	loginResult := testutil.CallPostJSONExpectSuccess(t, httpClient, baseURL+"/api/user/login", map[string]interface{}{
+		"userName": userName,
+		"password": "TestPass123!",
+	}, "")
+	userAPIKey := loginResult["apiKey"].(string)
+
+	assertResult := testutil.CallPostJSONExpectSuccess(t, httpClient, baseURL+"/api/user/assert", map[string]interface{}{}, adminAPIKey)
+	adminUserID := assertResult["user"].(map[string]interface{})["_id"].(string)
+
+	bucketResult := testutil.CallPostJSONExpectSuccess(t, httpClient, baseURL+"/api/bucket/create", map[string]interface{}{
+		"name":      bucketName,
+		"cryptSpec": "aes-256-gcm",
+		"cryptData": "test-crypt-data",
+		"metaData":  map[string]interface{}{},
+	}, adminAPIKey)
+	bucketID := bucketResult["bucketId"].(string)
+	bucketReq := map[string]interface{}{"bucketId": bucketID}
+
+	// The admin is the only manager and cannot revoke their own MANAGE_AUTHORIZATION
+	_, result, _ := testutil.CallPostJSON(httpClient, baseURL+"/api/bucket/set-authorization", map[string]interface{}{
+		"bucketId":         bucketID,
+		"targetUserId":     adminUserID,
+		"permissionsToSet": map[string]bool{"MANAGE_AUTHORIZATION": false},
+	}, adminAPIKey)
+	testutil.AssertErrorCode(t, result, "LAST_AUTHORIZATION_MANAGER")
+
+	testutil.CallPostJSONExpectSuccess(t, httpClient, baseURL+"/api/bucket/set-authorization", map[string]interface{}{
+		"bucketId":         bucketID,
+		"targetUserId":     userID,
+		"permissionsToSet": map[string]bool{"VIEW_CONTENT": true},
+	}, adminAPIKey)
+
+	listResult := testutil.CallPostJSONExpectSuccess(t, httpClient, baseURL+"/api/bucket/list-members", bucketReq, userAPIKey)
+	members := listResult["memberList"].([]interface{})
+	if len(members) != 2 {
+		t.Fatalf("Expected 2 members, got %v", members)
+	}
+	for _, m := range members {
+		member := m.(map[string]interface{})
+		if member["userId"].(string) == adminUserID && !member["isOwner"].(bool) {
+			t.Error("Expected admin to be listed as owner")
+		}
+		if member["userId"].(string) == userID && member["userName"].(string) != userName {
+			t.Errorf("Expected userName %s, got %v", userName, member["userName"])
+		}
+	}
+
+	// Only the owner can transfer ownership, and the owner cannot be removed
+	_, result, _ = testutil.CallPostJSON(httpClient, baseURL+"/api/bucket/remove-member", map[string]interface{}{
+		"bucketId":     bucketID,
+		"targetUserId": adminUserID,
+	}, adminAPIKey)
+	testutil.AssertErrorCode(t, result, "CANNOT_REMOVE_BUCKET_OWNER")
+
+	testutil.CallPostJSONExpectSuccess(t, httpClient, baseURL+"/api/bucket/transfer-ownership", map[string]interface{}{
+		"bucketId":       bucketID,
+		"newOwnerUserId": userID,
+	}, adminAPIKey)
+
+	_, result, _ = testutil.CallPostJSON(httpClient, baseURL+"/api/bucket/transfer-ownership", map[string]interface{}{
+		"bucketId":       bucketID,
+		"newOwnerUserId": adminUserID,
+	}, adminAPIKey)
+	testutil.AssertErrorCode(t, result, "NOT_BUCKET_OWNER")
+
+	// The new owner received full permissions and can remove the previous owner
+	testutil.CallPostJSONExpectSuccess(t, httpClient, baseURL+"/api/bucket/remove-member", map[string]interface{}{
+		"bucketId":     bucketID,
+		"targetUserId": adminUserID,
+	}, userAPIKey)
+
+	_, result, _ = testutil.CallPostJSON(httpClient, baseURL+"/api/bucket/list-members", bucketReq, adminAPIKey)
+	testutil.AssertErrorCode(t, result, "NO_AUTHORIZATION")
+
+	_, result, _ = testutil.CallPostJSON(httpClient, baseURL+"/api/bucket/remove-member", map[string]interface{}{
+		"bucketId":     bucketID,
+		"targetUserId": adminUserID,
+	}, userAPIKey)
+	testutil.AssertErrorCode(t, result, "USER_NOT_BUCKET_MEMBER")
+}
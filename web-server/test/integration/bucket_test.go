@@ -3,7 +3,10 @@
 package integration
 
 import (
+	"bytes"
 	"fmt"
+	"io"
+	"strings"
 	"testing"
 	"time"
 
@@ -196,3 +199,83 @@ func TestBucketDestroy(t *testing.T) {
 		}
 	}
 }
+
+func TestBucketExportImport(t *testing.T) {
+	suffix := time.Now().UnixNano()
+	bucketID, fileID := createBlobTestFile(t, fmt.Sprintf("test-bucket-export-%d", suffix))
+	content := []byte("exported ciphertext")
+	writeResp, err := testutil.CallPostRaw(httpClient, baseURL+"/api/blob/write/"+bucketID+"/"+fileID, bytes.NewReader(content), map[string]string{"nk-crypto-meta": "export-crypto-meta"}, adminAPIKey)
+	if err != nil {
+		t.Fatalf("Blob write failed: %v", err)
+	}
+	writeResp.Body.Close()
+
+	exportResp, err := testutil.CallPostRaw(httpClient, baseURL+"/api/bucket/export", strings.NewReader(`{"bucketId":"`+bucketID+`"}`), nil, adminAPIKey)
+	if err != nil {
+		t.Fatalf("Export failed: %v", err)
+	}
+	archive, err := io.ReadAll(exportResp.Body)
+	exportResp.Body.Close()
+	if err != nil || exportResp.StatusCode != 200 {
+		t.Fatalf("Expected an archive, got status %d: %v", exportResp.StatusCode, err)
+	}
+
+	// Import under a new name and read the content back
+	importName := fmt.Sprintf("test-bucket-import-%d", suffix)
+	importResp, err := testutil.CallPostRaw(httpClient, baseURL+"/api/bucket/import", bytes.NewReader(archive), map[string]string{"nk-bucket-name": importName}, adminAPIKey)
+	if err != nil {
+		t.Fatalf("Import failed: %v", err)
+	}
+	var imported map[string]interface{}
+	if err := testutil.ParseJSONResponse(importResp, &imported); err != nil {
+		t.Fatalf("Failed to parse import response: %v", err)
+	}
+	importResp.Body.Close()
+	newBucketID, _ := imported["bucketId"].(string)
+	if newBucketID == "" || newBucketID == bucketID {
+		t.Fatalf("Expected a new bucket ID, got %v", imported)
+	}
+
+	dirResult := testutil.CallPostJSONExpectSuccess(t, httpClient, baseURL+"/api/directory/get", map[string]interface{}{
+		"bucketId":    newBucketID,
+		"directoryId": imported["rootDirectoryId"],
+	}, adminAPIKey)
+	files := dirResult["childFileList"].([]interface{})
+	if len(files) != 1 {
+		t.Fatalf("Expected 1 imported file, got %d", len(files))
+	}
+	newFileID := files[0].(map[string]interface{})["_id"].(string)
+	if newFileID == fileID {
+		t.Error("Expected the imported file to get a new ID")
+	}
+	readResp, err := testutil.CallPostRaw(httpClient, baseURL+"/api/blob/read/"+newBucketID+"/"+newFileID, strings.NewReader(""), nil, adminAPIKey)
+	if err != nil {
+		t.Fatalf("Blob read failed: %v", err)
+	}
+	readData, _ := io.ReadAll(readResp.Body)
+	readResp.Body.Close()
+	if !bytes.Equal(readData, content) || readResp.Header.Get("nk-crypto-meta") != "export-crypto-meta" {
+		t.Errorf("Expected the exported content and crypto meta, got %q with %q", readData, readResp.Header.Get("nk-crypto-meta"))
+	}
+
+	// A tampered archive is rejected and leaves no bucket behind
+	tampered := bytes.Replace(archive, content, []byte("tampered ciphertext"), 1)
+	tamperedName := fmt.Sprintf("test-bucket-tampered-%d", suffix)
+	tamperedResp, err := testutil.CallPostRaw(httpClient, baseURL+"/api/bucket/import", bytes.NewReader(tampered), map[string]string{"nk-bucket-name": tamperedName}, adminAPIKey)
+	if err != nil {
+		t.Fatalf("Import failed: %v", err)
+	}
+	var rejected map[string]interface{}
+	if err := testutil.ParseJSONResponse(tamperedResp, &rejected); err != nil {
+		t.Fatalf("Failed to parse import response: %v", err)
+	}
+	tamperedResp.Body.Close()
+	testutil.AssertErrorCode(t, rejected, "ARCHIVE_CHECKSUM_MISMATCH")
+
+	listResult := testutil.CallPostJSONExpectSuccess(t, httpClient, baseURL+"/api/bucket/list", map[string]interface{}{}, adminAPIKey)
+	for _, b := range listResult["bucketList"].([]interface{}) {
+		if b.(map[string]interface{})["name"] == tamperedName {
+			t.Error("Expected the bucket of the rejected import to be removed")
+		}
+	}
+}
@@ -0,0 +1,158 @@
+//go:build integration
+
+package integration
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nkrypt-xyz/nkrypt-xyz-web-server/internal/cli"
+	"github.com/nkrypt-xyz/nkrypt-xyz-web-server/test/testutil"
+)
+
+// runCLI runs the nkrypt CLI in-process with --json and decodes its output into out (if not nil)
+func runCLI(t *testing.T, sessionFile, stdin string, out interface{}, args ...string) {
+	t.Helper()
+	var stdout, stderr bytes.Buffer
+	args = append([]string{"--server", baseURL, "--session", sessionFile, "--json"}, args...)
+	if code := cli.Run(context.Background(), args, strings.NewReader(stdin), &stdout, &stderr); code != 0 {
+		t.Fatalf("nkrypt %s exited with %d: %s", strings.Join(args[5:], " "), code, stderr.String())
+	}
+	if out != nil {
+		if err := json.Unmarshal(stdout.Bytes(), out); err != nil {
+			t.Fatalf("nkrypt %s printed invalid JSON %q: %v", strings.Join(args[5:], " "), stdout.String(), err)
+		}
+	}
+}
+
+func TestCLIFileLifecycle(t *testing.T) {
+	timestamp := time.Now().Unix()
+	bucketName := fmt.Sprintf("test-bucket-cli-%d", timestamp)
+	testutil.CallPostJSONExpectSuccess(t, httpClient, baseURL+"/api/bucket/create", map[string]interface{}{
+		"name":      bucketName,
+		"cryptSpec": "aes-256-gcm",
+		"cryptData": "test-crypt-data",
+		"metaData":  map[string]interface{}{},
+	}, adminAPIKey)
+
+	dir := t.TempDir()
+	sessionFile := filepath.Join(dir, "session.json")
+	runCLI(t, sessionFile, "PleaseChangeMe@YourEarliest2Day\n", nil, "login", "admin")
+
+	var whoami struct {
+		User struct {
+			UserName string `json:"userName"`
+		} `json:"user"`
+	}
+	runCLI(t, sessionFile, "", &whoami, "whoami")
+	if whoami.User.UserName != "admin" {
+		t.Errorf("Expected admin, got %q", whoami.User.UserName)
+	}
+
+	runCLI(t, sessionFile, "", nil, "mkdir", "-p", bucketName+":/docs/2024")
+
+	// Three chunks: MinIO requires every chunk but the last to be at least 5 MiB
+	content := make([]byte, 11*1024*1024)
+	if _, err := rand.Read(content); err != nil {
+		t.Fatal(err)
+	}
+	localFile := filepath.Join(dir, "report.bin")
+	if err := os.WriteFile(localFile, content, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	runCLI(t, sessionFile, "", nil, "upload", "--chunk-size", fmt.Sprint(5*1024*1024), "--parallel", "2", "--crypto-meta", "cli-meta", localFile, bucketName+":/docs/2024/")
+
+	var listing struct {
+		ChildFileList []struct {
+			Name string `json:"name"`
+		} `json:"childFileList"`
+	}
+	runCLI(t, sessionFile, "", &listing, "ls", bucketName+":/docs/2024")
+	if len(listing.ChildFileList) != 1 || listing.ChildFileList[0].Name != "report.bin" {
+		t.Fatalf("Expected report.bin in the listing, got %+v", listing.ChildFileList)
+	}
+
+	runCLI(t, sessionFile, "", nil, "mv", bucketName+":/docs/2024/report.bin", bucketName+":/docs/")
+	runCLI(t, sessionFile, "", nil, "rename", bucketName+":/docs/report.bin", "final.bin")
+
+	var download struct {
+		Bytes      int64  `json:"bytes"`
+		CryptoMeta string `json:"cryptoMeta"`
+	}
+	downloaded := filepath.Join(dir, "final.bin")
+	runCLI(t, sessionFile, "", &download, "download", bucketName+":/docs/final.bin", dir)
+	data, err := os.ReadFile(downloaded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, content) || download.CryptoMeta != "cli-meta" {
+		t.Errorf("Downloaded %d bytes with meta %q, want %d bytes with meta cli-meta", len(data), download.CryptoMeta, len(content))
+	}
+
+	runCLI(t, sessionFile, "", nil, "rm", "-r", bucketName+":/docs")
+	var root struct {
+		ChildDirectoryList []interface{} `json:"childDirectoryList"`
+	}
+	runCLI(t, sessionFile, "", &root, "ls", bucketName+":/")
+	if len(root.ChildDirectoryList) != 0 {
+		t.Errorf("Expected an empty bucket after rm -r, got %v", root.ChildDirectoryList)
+	}
+
+	runCLI(t, sessionFile, "", nil, "logout")
+	if _, err := os.Stat(sessionFile); !os.IsNotExist(err) {
+		t.Errorf("Expected the session file to be removed, got %v", err)
+	}
+}
+
+func TestCLIBucketAuthorization(t *testing.T) {
+	timestamp := time.Now().Unix()
+	bucketName := fmt.Sprintf("test-bucket-cli-auth-%d", timestamp)
+	testutil.CallPostJSONExpectSuccess(t, httpClient, baseURL+"/api/bucket/create", map[string]interface{}{
+		"name":      bucketName,
+		"cryptSpec": "aes-256-gcm",
+		"cryptData": "test-crypt-data",
+		"metaData":  map[string]interface{}{},
+	}, adminAPIKey)
+	userName := fmt.Sprintf("testcli%d", timestamp)
+	userID, _ := createAndLoginUser(t, userName)
+
+	sessionFile := filepath.Join(t.TempDir(), "session.json")
+	runCLI(t, sessionFile, "PleaseChangeMe@YourEarliest2Day\n", nil, "login", "admin")
+
+	runCLI(t, sessionFile, "", nil, "auth", "set", bucketName, userName, "VIEW_CONTENT=true", "MODIFY=true")
+
+	type memberList struct {
+		MemberList []struct {
+			UserID      string          `json:"userId"`
+			Permissions map[string]bool `json:"permissions"`
+		} `json:"memberList"`
+	}
+	var members memberList
+	runCLI(t, sessionFile, "", &members, "auth", "list", bucketName)
+	found := false
+	for _, m := range members.MemberList {
+		if m.UserID == userID {
+			found = m.Permissions["VIEW_CONTENT"] && m.Permissions["MODIFY"] && !m.Permissions["DESTROY"]
+		}
+	}
+	if !found {
+		t.Fatalf("Expected %s with VIEW_CONTENT and MODIFY, got %+v", userName, members.MemberList)
+	}
+
+	runCLI(t, sessionFile, "", nil, "auth", "remove", bucketName, userName)
+	members = memberList{}
+	runCLI(t, sessionFile, "", &members, "auth", "list", bucketName)
+	for _, m := range members.MemberList {
+		if m.UserID == userID {
+			t.Errorf("Expected %s to be removed, got %+v", userName, m)
+		}
+	}
+}
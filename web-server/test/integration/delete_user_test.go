@@ -0,0 +1,125 @@
+//go:build integration
+
+package integration
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/nkrypt-xyz/nkrypt-xyz-web-server/test/testutil"
+)
+
+func createAndLoginUser(t *testing.T, userName string) (string, string) {
+	t.Helper()
+	userResult := testutil.CallPostJSONExpectSuccess(t, httpClient, baseURL+"/api/admin/iam/add-user", map[string]interface{}{
+		"displayName": "Test " + userName,
+		"userName":    userName,
+		"password":    "TestPass123!",
+	}, adminAPIKey)
+	loginResult := testutil.CallPostJSONExpectSuccess(t, httpClient, baseURL+"/api/user/login", map[string]interface{}{
+		"userName": userName,
+		"password": "TestPass123!",
+	}, "")
+	return userResult["userId"].(string), loginResult["apiKey"].(string)
+}
+
+func TestDeleteUserTransfersOwnership(t *testing.T) {
+	timestamp := time.Now().Unix()
+	doomedID, doomedAPIKey := createAndLoginUser(t, fmt.Sprintf("testdoomed%d", timestamp))
+	heirID, heirAPIKey := createAndLoginUser(t, fmt.Sprintf("testheir%d", timestamp))
+
+	// The doomed user owns a bucket with some content
+	ownedResult := testutil.CallPostJSONExpectSuccess(t, httpClient, baseURL+"/api/bucket/create", map[string]interface{}{
+		"name":      fmt.Sprintf("test-bucket-doomed-%d", timestamp),
+		"cryptSpec": "aes-256-gcm",
+		"cryptData": "test-crypt-data",
+		"metaData":  map[string]interface{}{},
+	}, doomedAPIKey)
+	ownedBucketID := ownedResult["bucketId"].(string)
+	ownedRootID := ownedResult["rootDirectoryId"].(string)
+	testutil.CallPostJSONExpectSuccess(t, httpClient, baseURL+"/api/directory/create", map[string]interface{}{
+		"name":              "doomed-dir",
+		"bucketId":          ownedBucketID,
+		"parentDirectoryId": ownedRootID,
+		"metaData":          map[string]interface{}{},
+		"encryptedMetaData": "encrypted",
+	}, doomedAPIKey)
+
+	// The doomed user is the only manager of a bucket owned by the admin
+	sharedResult := testutil.CallPostJSONExpectSuccess(t, httpClient, baseURL+"/api/bucket/create", map[string]interface{}{
+		"name":      fmt.Sprintf("test-bucket-shared-%d", timestamp),
+		"cryptSpec": "aes-256-gcm",
+		"cryptData": "test-crypt-data",
+		"metaData":  map[string]interface{}{},
+	}, adminAPIKey)
+	sharedBucketID := sharedResult["bucketId"].(string)
+	assertResult := testutil.CallPostJSONExpectSuccess(t, httpClient, baseURL+"/api/user/assert", map[string]interface{}{}, adminAPIKey)
+	adminUserID := assertResult["user"].(map[string]interface{})["_id"].(string)
+	testutil.CallPostJSONExpectSuccess(t, httpClient, baseURL+"/api/bucket/set-authorization", map[string]interface{}{
+		"bucketId":         sharedBucketID,
+		"targetUserId":     doomedID,
+		"permissionsToSet": map[string]bool{"MANAGE_AUTHORIZATION": true},
+	}, adminAPIKey)
+	testutil.CallPostJSONExpectSuccess(t, httpClient, baseURL+"/api/bucket/set-authorization", map[string]interface{}{
+		"bucketId":         sharedBucketID,
+		"targetUserId":     adminUserID,
+		"permissionsToSet": map[string]bool{"MANAGE_AUTHORIZATION": false},
+	}, adminAPIKey)
+
+	deleteReq := map[string]interface{}{
+		"userId":           doomedID,
+		"transferToUserId": heirID,
+	}
+	_, result, _ := testutil.CallPostJSON(httpClient, baseURL+"/api/admin/iam/delete-user", deleteReq, adminAPIKey)
+	testutil.AssertErrorCode(t, result, "LAST_AUTHORIZATION_MANAGER")
+
+	// Once another user can manage the shared bucket, the deletion goes through
+	testutil.CallPostJSONExpectSuccess(t, httpClient, baseURL+"/api/bucket/set-authorization", map[string]interface{}{
+		"bucketId":         sharedBucketID,
+		"targetUserId":     heirID,
+		"permissionsToSet": map[string]bool{"MANAGE_AUTHORIZATION": true},
+	}, doomedAPIKey)
+	testutil.CallPostJSONExpectSuccess(t, httpClient, baseURL+"/api/admin/iam/delete-user", deleteReq, adminAPIKey)
+
+	_, result, _ = testutil.CallPostJSON(httpClient, baseURL+"/api/user/assert", map[string]interface{}{}, doomedAPIKey)
+	testutil.AssertErrorCode(t, result, "API_KEY_EXPIRED")
+
+	// The heir now owns the bucket and can read its content
+	listResult := testutil.CallPostJSONExpectSuccess(t, httpClient, baseURL+"/api/bucket/list", map[string]interface{}{}, heirAPIKey)
+	found := false
+	for _, b := range listResult["bucketList"].([]interface{}) {
+		bucket := b.(map[string]interface{})
+		if bucket["_id"].(string) != ownedBucketID {
+			continue
+		}
+		found = true
+		if bucket["createdByUserIdentifier"].(string) != heirID+"@." {
+			t.Errorf("Expected bucket to be owned by heir, got %v", bucket["createdByUserIdentifier"])
+		}
+	}
+	if !found {
+		t.Fatal("Expected heir to have access to the transferred bucket")
+	}
+
+	dirResult := testutil.CallPostJSONExpectSuccess(t, httpClient, baseURL+"/api/directory/get", map[string]interface{}{
+		"bucketId":    ownedBucketID,
+		"directoryId": ownedRootID,
+	}, heirAPIKey)
+	children := dirResult["childDirectoryList"].([]interface{})
+	if len(children) != 1 || children[0].(map[string]interface{})["createdByUserIdentifier"].(string) != heirID+"@." {
+		t.Errorf("Expected directory to be reassigned to heir, got %v", children)
+	}
+}
+
+func TestDeleteUserRejectsSelf(t *testing.T) {
+	assertResult := testutil.CallPostJSONExpectSuccess(t, httpClient, baseURL+"/api/user/assert", map[string]interface{}{}, adminAPIKey)
+	adminUserID := assertResult["user"].(map[string]interface{})["_id"].(string)
+	heirID, _ := createAndLoginUser(t, fmt.Sprintf("testselfheir%d", time.Now().Unix()))
+
+	_, result, _ := testutil.CallPostJSON(httpClient, baseURL+"/api/admin/iam/delete-user", map[string]interface{}{
+		"userId":           adminUserID,
+		"transferToUserId": heirID,
+	}, adminAPIKey)
+	testutil.AssertErrorCode(t, result, "CANNOT_DELETE_SELF")
+}
@@ -0,0 +1,153 @@
+//go:build integration
+
+package integration
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/nkrypt-xyz/nkrypt-xyz-web-server/test/testutil"
+)
+
+func TestDirectoryPermissionOverrides(t *testing.T) {
+	timestamp := time.Now().Unix()
+	bucketName := fmt.Sprintf("test-bucket-dirperm-%d", timestamp)
+	userName := fmt.Sprintf("testdirpermuser%d", timestamp)
+
+	userResult := testutil.CallPostJSONExpectSuccess(t, httpClient, baseURL+"/api/admin/iam/add-user", map[string]interface{}{
+		"displayName": "Test Dir Perm User",
+		"userName":    userName,
+		"password":    "TestPass123!",
+	}, adminAPIKey)
+	userID := userResult["userId"].(string)
+
+	loginResult := testutil.CallPostJSONExpectSuccess(t, httpClient, baseURL+"/api/user/login", map[string]interface{}{
+		"userName": userName,
+		"password": "TestPass123!",
+	}, "")
+	userAPIKey := loginResult["apiKey"].(string)
+
+	bucketResult := testutil.CallPostJSONExpectSuccess(t, httpClient, baseURL+"/api/bucket/create", map[string]interface{}{
+		"name":      bucketName,
+		"cryptSpec": "aes-256-gcm",
+		"cryptData": "test-crypt-data",
+		"metaData":  map[string]interface{}{},
+	}, adminAPIKey)
+	bucketID := bucketResult["bucketId"].(string)
+	rootDirID := bucketResult["rootDirectoryId"].(string)
+
+	dirResult := testutil.CallPostJSONExpectSuccess(t, httpClient, baseURL+"/api/directory/create", map[string]interface{}{
+		"name":              "private",
+		"bucketId":          bucketID,
+		"parentDirectoryId": rootDirID,
+		"metaData":          map[string]interface{}{},
+		"encryptedMetaData": "encrypted",
+	}, adminAPIKey)
+	privateDirID := dirResult["directoryId"].(string)
+
+	testutil.CallPostJSONExpectSuccess(t, httpClient, baseURL+"/api/bucket/set-authorization", map[string]interface{}{
+		"bucketId":         bucketID,
+		"targetUserId":     userID,
+		"permissionsToSet": map[string]bool{"VIEW_CONTENT": true, "MANAGE_CONTENT": true},
+	}, adminAPIKey)
+
+	// Hide the private directory from the user
+	testutil.CallPostJSONExpectSuccess(t, httpClient, baseURL+"/api/directory/set-permission-override", map[string]interface{}{
+		"bucketId":         bucketID,
+		"directoryId":      privateDirID,
+		"targetUserId":     userID,
+		"permissionsToSet": map[string]interface{}{"VIEW_CONTENT": false, "MANAGE_CONTENT": false},
+	}, adminAPIKey)
+
+	rootResult := testutil.CallPostJSONExpectSuccess(t, httpClient, baseURL+"/api/directory/get", map[string]interface{}{
+		"bucketId":    bucketID,
+		"directoryId": rootDirID,
+	}, userAPIKey)
+	if children := rootResult["childDirectoryList"].([]interface{}); len(children) != 0 {
+		t.Errorf("Expected private directory to be hidden, got %v", children)
+	}
+
+	// Usage of the bucket leaves out what the user cannot view
+	testutil.CallPostJSONExpectSuccess(t, httpClient, baseURL+"/api/file/create", map[string]interface{}{
+		"name":              "secret.txt",
+		"bucketId":          bucketID,
+		"parentDirectoryId": privateDirID,
+		"metaData":          map[string]interface{}{},
+		"encryptedMetaData": "encrypted",
+	}, adminAPIKey)
+	for apiKey, want := range map[string]float64{adminAPIKey: 1, userAPIKey: 0} {
+		summary := testutil.CallPostJSONExpectSuccess(t, httpClient, baseURL+"/api/metrics/get-summary", map[string]interface{}{}, apiKey)
+		for _, b := range summary["buckets"].([]interface{}) {
+			bucket := b.(map[string]interface{})
+			if bucket["bucketId"] != bucketID {
+				continue
+			}
+			if bucket["fileCount"] != want || bucket["directoryCount"] != want {
+				t.Errorf("Expected %v files and directories in the bucket usage, got %v", want, bucket)
+			}
+		}
+	}
+
+	getPrivateReq := map[string]interface{}{
+		"bucketId":    bucketID,
+		"directoryId": privateDirID,
+	}
+	_, result, _ := testutil.CallPostJSON(httpClient, baseURL+"/api/directory/get", getPrivateReq, userAPIKey)
+	testutil.AssertErrorCode(t, result, "INSUFFICIENT_DIRECTORY_PERMISSION")
+
+	_, result, _ = testutil.CallPostJSON(httpClient, baseURL+"/api/directory/create", map[string]interface{}{
+		"name":              "nested",
+		"bucketId":          bucketID,
+		"parentDirectoryId": privateDirID,
+		"metaData":          map[string]interface{}{},
+		"encryptedMetaData": "encrypted",
+	}, userAPIKey)
+	testutil.AssertErrorCode(t, result, "INSUFFICIENT_DIRECTORY_PERMISSION")
+
+	// The root directory cannot be deleted because it contains a directory the user cannot manage
+	_, result, _ = testutil.CallPostJSON(httpClient, baseURL+"/api/directory/delete", map[string]interface{}{
+		"bucketId":    bucketID,
+		"directoryId": rootDirID,
+	}, userAPIKey)
+	testutil.AssertErrorCode(t, result, "INSUFFICIENT_DIRECTORY_PERMISSION")
+
+	effResult := testutil.CallPostJSONExpectSuccess(t, httpClient, baseURL+"/api/directory/get-effective-permissions", map[string]interface{}{
+		"bucketId":    bucketID,
+		"directoryId": privateDirID,
+		"userId":      userID,
+	}, adminAPIKey)
+	perms := effResult["permissions"].(map[string]interface{})
+	if perms["VIEW_CONTENT"].(bool) || perms["MANAGE_CONTENT"].(bool) {
+		t.Errorf("Expected content permissions to be revoked, got %v", perms)
+	}
+
+	// Only bucket authorization managers may inspect other users
+	assertResult := testutil.CallPostJSONExpectSuccess(t, httpClient, baseURL+"/api/user/assert", map[string]interface{}{}, adminAPIKey)
+	adminUserID := assertResult["user"].(map[string]interface{})["_id"].(string)
+	_, result, _ = testutil.CallPostJSON(httpClient, baseURL+"/api/directory/get-effective-permissions", map[string]interface{}{
+		"bucketId":    bucketID,
+		"directoryId": privateDirID,
+		"userId":      adminUserID,
+	}, userAPIKey)
+	testutil.AssertErrorCode(t, result, "INSUFFICIENT_BUCKET_PERMISSION")
+
+	listResult := testutil.CallPostJSONExpectSuccess(t, httpClient, baseURL+"/api/directory/list-permission-overrides", getPrivateReq, adminAPIKey)
+	if overrides := listResult["overrideList"].([]interface{}); len(overrides) != 1 {
+		t.Fatalf("Expected one override, got %v", overrides)
+	}
+
+	// Resetting both permissions to inherit removes the override
+	testutil.CallPostJSONExpectSuccess(t, httpClient, baseURL+"/api/directory/set-permission-override", map[string]interface{}{
+		"bucketId":         bucketID,
+		"directoryId":      privateDirID,
+		"targetUserId":     userID,
+		"permissionsToSet": map[string]interface{}{"VIEW_CONTENT": nil, "MANAGE_CONTENT": nil},
+	}, adminAPIKey)
+	testutil.CallPostJSONExpectSuccess(t, httpClient, baseURL+"/api/directory/get", getPrivateReq, userAPIKey)
+
+	listResult = testutil.CallPostJSONExpectSuccess(t, httpClient, baseURL+"/api/directory/list-permission-overrides", getPrivateReq, adminAPIKey)
+	if overrides := listResult["overrideList"].([]interface{}); len(overrides) != 0 {
+		t.Errorf("Expected no overrides, got %v", overrides)
+	}
+}
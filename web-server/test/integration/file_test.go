@@ -131,6 +131,73 @@ func TestFileRename(t *testing.T) {
 	}
 }
 
+func TestFileRenameRejectsStaleVersion(t *testing.T) {
+	bucketName := fmt.Sprintf("test-bucket-file-version-%d", time.Now().Unix())
+	createBucketReq := map[string]interface{}{
+		"name":      bucketName,
+		"cryptSpec": "aes-256-gcm",
+		"cryptData": "test-crypt-data",
+		"metaData":  map[string]interface{}{},
+	}
+	bucketResult := testutil.CallPostJSONExpectSuccess(t, httpClient, baseURL+"/api/bucket/create", createBucketReq, adminAPIKey)
+	bucketID := bucketResult["bucketId"].(string)
+	rootDirID := bucketResult["rootDirectoryId"].(string)
+
+	createFileReq := map[string]interface{}{
+		"name":              "versioned.txt",
+		"bucketId":          bucketID,
+		"parentDirectoryId": rootDirID,
+		"metaData":          map[string]interface{}{},
+		"encryptedMetaData": "encrypted-data",
+	}
+	createResult := testutil.CallPostJSONExpectSuccess(t, httpClient, baseURL+"/api/file/create", createFileReq, adminAPIKey)
+	fileID := createResult["fileId"].(string)
+
+	getReq := map[string]interface{}{
+		"bucketId": bucketID,
+		"fileId":   fileID,
+	}
+	getResult := testutil.CallPostJSONExpectSuccess(t, httpClient, baseURL+"/api/file/get", getReq, adminAPIKey)
+	version, ok := getResult["file"].(map[string]interface{})["version"].(float64)
+	if !ok || version != 1 {
+		t.Fatalf("Expected version=1 for a new file, got %v", version)
+	}
+
+	// Renaming at the current version succeeds and increments it
+	renameReq := map[string]interface{}{
+		"bucketId":        bucketID,
+		"fileId":          fileID,
+		"name":            "renamed.txt",
+		"expectedVersion": version,
+	}
+	renameResult := testutil.CallPostJSONExpectSuccess(t, httpClient, baseURL+"/api/file/rename", renameReq, adminAPIKey)
+	if newVersion, _ := renameResult["version"].(float64); newVersion != version+1 {
+		t.Errorf("Expected version=%v after rename, got %v", version+1, renameResult["version"])
+	}
+
+	// Updating metadata at the version read before the rename is rejected
+	setMetaReq := map[string]interface{}{
+		"bucketId":        bucketID,
+		"fileId":          fileID,
+		"metaData":        map[string]interface{}{"stale": true},
+		"expectedVersion": version,
+	}
+	resp, result, err := testutil.CallPostJSON(httpClient, baseURL+"/api/file/set-metadata", setMetaReq, adminAPIKey)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	if resp.StatusCode != 409 {
+		t.Errorf("Expected status 409, got %d", resp.StatusCode)
+	}
+	testutil.AssertErrorCode(t, result, "VERSION_CONFLICT")
+
+	getResult = testutil.CallPostJSONExpectSuccess(t, httpClient, baseURL+"/api/file/get", getReq, adminAPIKey)
+	file := getResult["file"].(map[string]interface{})
+	if _, stale := file["metaData"].(map[string]interface{})["stale"]; stale {
+		t.Error("Expected the stale metadata update to be discarded")
+	}
+}
+
 func TestFileDelete(t *testing.T) {
 	bucketName := fmt.Sprintf("test-bucket-file-delete-%d", time.Now().Unix())
 	// Create bucket and file
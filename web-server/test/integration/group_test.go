@@ -0,0 +1,225 @@
+//go:build integration
+
+package integration
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/nkrypt-xyz/nkrypt-xyz-web-server/test/testutil"
+)
+
+func TestGroupBucketAuthorization(t *testing.T) {
+	timestamp := time.Now().Unix()
+	bucketName := fmt.Sprintf("test-bucket-group-%d", timestamp)
+	groupName := fmt.Sprintf("test-group-%d", timestamp)
+	userName := fmt.Sprintf("testgroupuser%d", timestamp)
+
+	// Create a user that has no direct access to the bucket
+	addUserReq := map[string]interface{}{
+		"displayName": "Test Group User",
+		"userName":    userName,
+		"password":    "TestPass123!",
+	}
+	userResult := testutil.CallPostJSONExpectSuccess(t, httpClient, baseURL+"/api/admin/iam/add-user", addUserReq, adminAPIKey)
+	userID := userResult["userId"].(string)
+
+	loginReq := map[string]interface{}{
+		"userName": userName,
+		"password": "TestPass123!",
+	}
+	loginResult := testutil.CallPostJSONExpectSuccess(t, httpClient, baseURL+"/api/user/login", loginReq, "")
+	userAPIKey := loginResult["apiKey"].(string)
+
+	// Admin creates a bucket
+	createBucketReq := map[string]interface{}{
+		"name":      bucketName,
+		"cryptSpec": "aes-256-gcm",
+		"cryptData": "test-crypt-data",
+		"metaData":  map[string]interface{}{},
+	}
+	bucketResult := testutil.CallPostJSONExpectSuccess(t, httpClient, baseURL+"/api/bucket/create", createBucketReq, adminAPIKey)
+	bucketID := bucketResult["bucketId"].(string)
+	rootDirID := bucketResult["rootDirectoryId"].(string)
+
+	getDirReq := map[string]interface{}{
+		"bucketId":    bucketID,
+		"directoryId": rootDirID,
+	}
+	_, result, _ := testutil.CallPostJSON(httpClient, baseURL+"/api/directory/get", getDirReq, userAPIKey)
+	testutil.AssertErrorCode(t, result, "NO_AUTHORIZATION")
+
+	// Admin creates a group, adds the user, and grants the group VIEW_CONTENT
+	groupResult := testutil.CallPostJSONExpectSuccess(t, httpClient, baseURL+"/api/admin/iam/create-group", map[string]interface{}{
+		"name":        groupName,
+		"description": "Engineers",
+	}, adminAPIKey)
+	groupID := groupResult["groupId"].(string)
+
+	testutil.CallPostJSONExpectSuccess(t, httpClient, baseURL+"/api/admin/iam/add-group-member", map[string]interface{}{
+		"groupId": groupID,
+		"userId":  userID,
+	}, adminAPIKey)
+
+	testutil.CallPostJSONExpectSuccess(t, httpClient, baseURL+"/api/bucket/set-group-authorization", map[string]interface{}{
+		"bucketId":         bucketID,
+		"targetGroupId":    groupID,
+		"permissionsToSet": map[string]bool{"VIEW_CONTENT": true},
+	}, adminAPIKey)
+
+	// User can now read through the group grant, but not write
+	testutil.CallPostJSONExpectSuccess(t, httpClient, baseURL+"/api/directory/get", getDirReq, userAPIKey)
+
+	createDirReq := map[string]interface{}{
+		"name":              "group-dir",
+		"bucketId":          bucketID,
+		"parentDirectoryId": rootDirID,
+		"metaData":          map[string]interface{}{},
+		"encryptedMetaData": "encrypted",
+	}
+	_, result, _ = testutil.CallPostJSON(httpClient, baseURL+"/api/directory/create", createDirReq, userAPIKey)
+	testutil.AssertErrorCode(t, result, "INSUFFICIENT_BUCKET_PERMISSION")
+
+	// Direct grant merges with the group grant
+	testutil.CallPostJSONExpectSuccess(t, httpClient, baseURL+"/api/bucket/set-authorization", map[string]interface{}{
+		"bucketId":         bucketID,
+		"targetUserId":     userID,
+		"permissionsToSet": map[string]bool{"MANAGE_CONTENT": true},
+	}, adminAPIKey)
+	testutil.CallPostJSONExpectSuccess(t, httpClient, baseURL+"/api/directory/create", createDirReq, userAPIKey)
+
+	// The bucket list shows both kinds of authorization
+	listResult := testutil.CallPostJSONExpectSuccess(t, httpClient, baseURL+"/api/bucket/list", map[string]interface{}{}, userAPIKey)
+	found := false
+	for _, b := range listResult["bucketList"].([]interface{}) {
+		bucket := b.(map[string]interface{})
+		if bucket["_id"].(string) != bucketID {
+			continue
+		}
+		found = true
+		groupAuths, ok := bucket["bucketGroupAuthorizations"].([]interface{})
+		if !ok || len(groupAuths) != 1 {
+			t.Fatalf("Expected one bucketGroupAuthorizations entry, got %v", bucket["bucketGroupAuthorizations"])
+		}
+		if groupAuths[0].(map[string]interface{})["groupId"].(string) != groupID {
+			t.Errorf("Expected groupId %s, got %v", groupID, groupAuths[0])
+		}
+		if auths, ok := bucket["bucketAuthorizations"].([]interface{}); !ok || len(auths) != 2 {
+			t.Errorf("Expected two bucketAuthorizations entries, got %v", bucket["bucketAuthorizations"])
+		}
+	}
+	if !found {
+		t.Fatal("Expected bucket to be listed for group member")
+	}
+
+	// Removing the user from the group leaves only the direct grant
+	testutil.CallPostJSONExpectSuccess(t, httpClient, baseURL+"/api/admin/iam/remove-group-member", map[string]interface{}{
+		"groupId": groupID,
+		"userId":  userID,
+	}, adminAPIKey)
+	_, result, _ = testutil.CallPostJSON(httpClient, baseURL+"/api/directory/get", getDirReq, userAPIKey)
+	testutil.AssertErrorCode(t, result, "INSUFFICIENT_BUCKET_PERMISSION")
+}
+
+func TestGroupManagementRequiresManageAllUser(t *testing.T) {
+	timestamp := time.Now().Unix()
+	userName := fmt.Sprintf("testgroupnoperm%d", timestamp)
+
+	addUserReq := map[string]interface{}{
+		"displayName": "Test Group No Perm",
+		"userName":    userName,
+		"password":    "TestPass123!",
+	}
+	testutil.CallPostJSONExpectSuccess(t, httpClient, baseURL+"/api/admin/iam/add-user", addUserReq, adminAPIKey)
+
+	loginResult := testutil.CallPostJSONExpectSuccess(t, httpClient, baseURL+"/api/user/login", map[string]interface{}{
+		"userName": userName,
+		"password": "TestPass123!",
+	}, "")
+	userAPIKey := loginResult["apiKey"].(string)
+
+	_, result, _ := testutil.CallPostJSON(httpClient, baseURL+"/api/admin/iam/create-group", map[string]interface{}{
+		"name": fmt.Sprintf("test-group-noperm-%d", timestamp),
+	}, userAPIKey)
+	testutil.AssertErrorCode(t, result, "INSUFFICIENT_GLOBAL_PERMISSION")
+
+	// Listing groups is open to every authenticated user
+	testutil.CallPostJSONExpectSuccess(t, httpClient, baseURL+"/api/group/list", map[string]interface{}{}, userAPIKey)
+}
+
+func TestGroupChangesKeepAnAuthorizationManager(t *testing.T) {
+	timestamp := time.Now().Unix()
+	bucketName := fmt.Sprintf("test-bucket-group-manager-%d", timestamp)
+	groupName := fmt.Sprintf("test-group-manager-%d", timestamp)
+	userName := fmt.Sprintf("testgroupmanager%d", timestamp)
+
+	userResult := testutil.CallPostJSONExpectSuccess(t, httpClient, baseURL+"/api/admin/iam/add-user", map[string]interface{}{
+		"displayName": "Test Group Manager",
+		"userName":    userName,
+		"password":    "TestPass123!",
+	}, adminAPIKey)
+	userID := userResult["userId"].(string)
+
+	loginResult := testutil.CallPostJSONExpectSuccess(t, httpClient, baseURL+"/api/user/login", map[string]interface{}{
+		"userName": userName,
+		"password": "TestPass123!",
+	}, "")
+	userAPIKey := loginResult["apiKey"].(string)
+
+	assertResult := testutil.CallPostJSONExpectSuccess(t, httpClient, baseURL+"/api/user/assert", map[string]interface{}{}, adminAPIKey)
+	adminUserID := assertResult["user"].(map[string]interface{})["_id"].(string)
+
+	bucketResult := testutil.CallPostJSONExpectSuccess(t, httpClient, baseURL+"/api/bucket/create", map[string]interface{}{
+		"name":      bucketName,
+		"cryptSpec": "aes-256-gcm",
+		"cryptData": "test-crypt-data",
+		"metaData":  map[string]interface{}{},
+	}, adminAPIKey)
+	bucketID := bucketResult["bucketId"].(string)
+
+	groupResult := testutil.CallPostJSONExpectSuccess(t, httpClient, baseURL+"/api/admin/iam/create-group", map[string]interface{}{
+		"name":        groupName,
+		"description": "Bucket managers",
+	}, adminAPIKey)
+	groupID := groupResult["groupId"].(string)
+	membershipReq := map[string]interface{}{
+		"groupId": groupID,
+		"userId":  userID,
+	}
+	testutil.CallPostJSONExpectSuccess(t, httpClient, baseURL+"/api/admin/iam/add-group-member", membershipReq, adminAPIKey)
+
+	testutil.CallPostJSONExpectSuccess(t, httpClient, baseURL+"/api/bucket/set-group-authorization", map[string]interface{}{
+		"bucketId":         bucketID,
+		"targetGroupId":    groupID,
+		"permissionsToSet": map[string]bool{"MANAGE_AUTHORIZATION": true},
+	}, adminAPIKey)
+
+	// With the group member managing the bucket, the admin can give up MANAGE_AUTHORIZATION
+	testutil.CallPostJSONExpectSuccess(t, httpClient, baseURL+"/api/bucket/set-authorization", map[string]interface{}{
+		"bucketId":         bucketID,
+		"targetUserId":     adminUserID,
+		"permissionsToSet": map[string]bool{"MANAGE_AUTHORIZATION": false},
+	}, adminAPIKey)
+
+	// The group member is now the only manager, through the group
+	_, result, _ := testutil.CallPostJSON(httpClient, baseURL+"/api/admin/iam/remove-group-member", membershipReq, adminAPIKey)
+	testutil.AssertErrorCode(t, result, "LAST_AUTHORIZATION_MANAGER")
+
+	_, result, _ = testutil.CallPostJSON(httpClient, baseURL+"/api/admin/iam/delete-group", map[string]interface{}{
+		"groupId": groupID,
+	}, adminAPIKey)
+	testutil.AssertErrorCode(t, result, "LAST_AUTHORIZATION_MANAGER")
+
+	// Once the admin manages the bucket again, both changes go through
+	testutil.CallPostJSONExpectSuccess(t, httpClient, baseURL+"/api/bucket/set-authorization", map[string]interface{}{
+		"bucketId":         bucketID,
+		"targetUserId":     adminUserID,
+		"permissionsToSet": map[string]bool{"MANAGE_AUTHORIZATION": true},
+	}, userAPIKey)
+
+	testutil.CallPostJSONExpectSuccess(t, httpClient, baseURL+"/api/admin/iam/remove-group-member", membershipReq, adminAPIKey)
+	testutil.CallPostJSONExpectSuccess(t, httpClient, baseURL+"/api/admin/iam/delete-group", map[string]interface{}{
+		"groupId": groupID,
+	}, adminAPIKey)
+}
@@ -3,7 +3,12 @@
 package integration
 
 import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/nkrypt-xyz/nkrypt-xyz-web-server/test/testutil"
 )
@@ -30,9 +35,43 @@ func TestReadyz(t *testing.T) {
 	if resp.StatusCode != 200 {
 		t.Errorf("Expected status 200, got %d", resp.StatusCode)
 	}
+
+	var body struct {
+		Status        string `json:"status"`
+		SchemaVersion int64  `json:"schemaVersion"`
+		Dependencies  map[string]struct {
+			Status    string  `json:"status"`
+			LatencyMs float64 `json:"latencyMs"`
+		} `json:"dependencies"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if body.Status != "ok" || body.SchemaVersion < 1 {
+		t.Errorf("Expected status ok with a schema version, got %+v", body)
+	}
+	for _, name := range []string{"postgres", "redis", "minio", "schema"} {
+		if body.Dependencies[name].Status != "ok" {
+			t.Errorf("Expected dependency %s to be ok, got %+v", name, body.Dependencies[name])
+		}
+	}
+
+	// The same results are exported as gauges
+	metrics, err := httpClient.Get(baseURL + "/metrics")
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer metrics.Body.Close()
+	text, _ := io.ReadAll(metrics.Body)
+	if !strings.Contains(string(text), `nkrypt_dependency_up{dependency="minio"} 1`) {
+		t.Error("Expected the nkrypt_dependency_up gauge for minio")
+	}
 }
 
 func TestMetrics(t *testing.T) {
+	// Make a routed request to count; the login happened in the test setup
+	testutil.CallPostJSONExpectSuccess(t, httpClient, baseURL+"/api/user/assert", map[string]interface{}{}, adminAPIKey)
+
 	resp, err := httpClient.Get(baseURL + "/metrics")
 	if err != nil {
 		t.Fatalf("Request failed: %v", err)
@@ -42,6 +81,19 @@ func TestMetrics(t *testing.T) {
 	if resp.StatusCode != 200 {
 		t.Errorf("Expected status 200, got %d", resp.StatusCode)
 	}
+
+	text, _ := io.ReadAll(resp.Body)
+	for _, want := range []string{
+		`nkrypt_http_requests_total{method="POST",route="/api/user/assert",status="200"}`,
+		`nkrypt_logins_total{result="success"}`,
+		`nkrypt_active_sessions`,
+		`nkrypt_db_pool_conns{state="idle"}`,
+		`nkrypt_redis_pool_conns{state="idle"}`,
+	} {
+		if !strings.Contains(string(text), want) {
+			t.Errorf("Expected %s in the metrics", want)
+		}
+	}
 }
 
 func TestMetricsGetSummary(t *testing.T) {
@@ -58,4 +110,68 @@ func TestMetricsGetSummary(t *testing.T) {
 	if _, ok := disk["totalBytes"].(float64); !ok {
 		t.Error("Expected disk.totalBytes")
 	}
+	if _, ok := result["user"].(map[string]interface{}); !ok {
+		t.Error("Expected user object in response")
+	}
+}
+
+func TestMetricsGetSummaryUsage(t *testing.T) {
+	timestamp := time.Now().Unix()
+	_, apiKey := createAndLoginUser(t, fmt.Sprintf("testusage%d", timestamp))
+
+	bucketResult := testutil.CallPostJSONExpectSuccess(t, httpClient, baseURL+"/api/bucket/create", map[string]interface{}{
+		"name":      fmt.Sprintf("test-bucket-usage-%d", timestamp),
+		"cryptSpec": "aes-256-gcm",
+		"cryptData": "test-crypt-data",
+		"metaData":  map[string]interface{}{},
+	}, apiKey)
+	bucketID := bucketResult["bucketId"].(string)
+	rootDirID := bucketResult["rootDirectoryId"].(string)
+
+	dirResult := testutil.CallPostJSONExpectSuccess(t, httpClient, baseURL+"/api/directory/create", map[string]interface{}{
+		"name":              "usage-dir",
+		"bucketId":          bucketID,
+		"parentDirectoryId": rootDirID,
+		"metaData":          map[string]interface{}{},
+		"encryptedMetaData": "encrypted",
+	}, apiKey)
+	for _, name := range []string{"usage-file-1.txt", "usage-file-2.txt"} {
+		testutil.CallPostJSONExpectSuccess(t, httpClient, baseURL+"/api/file/create", map[string]interface{}{
+			"name":              name,
+			"bucketId":          bucketID,
+			"parentDirectoryId": dirResult["directoryId"].(string),
+			"metaData":          map[string]interface{}{},
+			"encryptedMetaData": "encrypted",
+		}, apiKey)
+	}
+
+	result := testutil.CallPostJSONExpectSuccess(t, httpClient, baseURL+"/api/metrics/get-summary", map[string]interface{}{}, apiKey)
+
+	// Cluster-wide disk figures are for admins only
+	if _, ok := result["disk"]; ok {
+		t.Error("Expected no disk object for a non-admin user")
+	}
+
+	user, ok := result["user"].(map[string]interface{})
+	if !ok {
+		t.Fatal("Expected user object in response")
+	}
+	if user["fileCount"] != float64(2) || user["directoryCount"] != float64(1) {
+		t.Errorf("Expected 2 files and 1 directory for the user, got %v", user)
+	}
+
+	buckets, ok := result["buckets"].([]interface{})
+	if !ok || len(buckets) != 1 {
+		t.Fatalf("Expected exactly one bucket, got %v", result["buckets"])
+	}
+	bucket := buckets[0].(map[string]interface{})
+	if bucket["bucketId"] != bucketID {
+		t.Errorf("Expected bucket %s, got %v", bucketID, bucket["bucketId"])
+	}
+	if bucket["fileCount"] != float64(2) || bucket["directoryCount"] != float64(1) {
+		t.Errorf("Expected 2 files and 1 directory in the bucket, got %v", bucket)
+	}
+	if _, ok := bucket["encryptedBytes"].(float64); !ok {
+		t.Error("Expected bucket encryptedBytes")
+	}
 }
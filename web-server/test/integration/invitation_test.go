@@ -0,0 +1,133 @@
+//go:build integration
+
+package integration
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/nkrypt-xyz/nkrypt-xyz-web-server/test/testutil"
+)
+
+func TestInvitationRedeem(t *testing.T) {
+	timestamp := time.Now().Unix()
+	bucketName := fmt.Sprintf("test-bucket-invite-%d", timestamp)
+	userName := fmt.Sprintf("testinvitee%d", timestamp)
+
+	bucketResult := testutil.CallPostJSONExpectSuccess(t, httpClient, baseURL+"/api/bucket/create", map[string]interface{}{
+		"name":      bucketName,
+		"cryptSpec": "aes-256-gcm",
+		"cryptData": "test-crypt-data",
+		"metaData":  map[string]interface{}{},
+	}, adminAPIKey)
+	bucketID := bucketResult["bucketId"].(string)
+	rootDirID := bucketResult["rootDirectoryId"].(string)
+
+	invResult := testutil.CallPostJSONExpectSuccess(t, httpClient, baseURL+"/api/admin/iam/create-invitation", map[string]interface{}{
+		"notes":             "For the integration test",
+		"validForSeconds":   3600,
+		"globalPermissions": map[string]bool{"CREATE_BUCKET": false},
+		"bucketGrants": []map[string]interface{}{
+			{"bucketId": bucketID, "permissionsToSet": map[string]bool{"VIEW_CONTENT": true}},
+		},
+	}, adminAPIKey)
+	invitationID := invResult["invitationId"].(string)
+	token := invResult["token"].(string)
+
+	// A bucket may only be granted once per invitation
+	_, dupResult, _ := testutil.CallPostJSON(httpClient, baseURL+"/api/admin/iam/create-invitation", map[string]interface{}{
+		"bucketGrants": []map[string]interface{}{
+			{"bucketId": bucketID, "permissionsToSet": map[string]bool{"VIEW_CONTENT": true}},
+			{"bucketId": bucketID, "permissionsToSet": map[string]bool{"MODIFY": true}},
+		},
+	}, adminAPIKey)
+	testutil.AssertErrorCode(t, dupResult, "VALIDATION_ERROR")
+
+	redeemReq := map[string]interface{}{
+		"token":       token,
+		"displayName": "Test Invitee",
+		"userName":    userName,
+		"password":    "TestPass123!",
+	}
+	redeemResult := testutil.CallPostJSONExpectSuccess(t, httpClient, baseURL+"/api/user/redeem-invitation", redeemReq, "")
+	if redeemResult["userId"].(string) == "" {
+		t.Fatal("Expected userId in redeem response")
+	}
+
+	// A token can only be used once
+	redeemReq["userName"] = userName + "x"
+	_, result, _ := testutil.CallPostJSON(httpClient, baseURL+"/api/user/redeem-invitation", redeemReq, "")
+	testutil.AssertErrorCode(t, result, "INVITATION_INVALID")
+
+	loginResult := testutil.CallPostJSONExpectSuccess(t, httpClient, baseURL+"/api/user/login", map[string]interface{}{
+		"userName": userName,
+		"password": "TestPass123!",
+	}, "")
+	userAPIKey := loginResult["apiKey"].(string)
+
+	// The bucket grant and preset global permissions were applied
+	testutil.CallPostJSONExpectSuccess(t, httpClient, baseURL+"/api/directory/get", map[string]interface{}{
+		"bucketId":    bucketID,
+		"directoryId": rootDirID,
+	}, userAPIKey)
+
+	_, result, _ = testutil.CallPostJSON(httpClient, baseURL+"/api/bucket/create", map[string]interface{}{
+		"name":      bucketName + "-invitee",
+		"cryptSpec": "aes-256-gcm",
+		"cryptData": "test-crypt-data",
+		"metaData":  map[string]interface{}{},
+	}, userAPIKey)
+	testutil.AssertErrorCode(t, result, "INSUFFICIENT_GLOBAL_PERMISSION")
+
+	// The invitation is listed as redeemed and can no longer be revoked
+	listResult := testutil.CallPostJSONExpectSuccess(t, httpClient, baseURL+"/api/admin/iam/list-invitations", map[string]interface{}{}, adminAPIKey)
+	found := false
+	for _, i := range listResult["invitationList"].([]interface{}) {
+		inv := i.(map[string]interface{})
+		if inv["_id"].(string) != invitationID {
+			continue
+		}
+		found = true
+		if inv["redeemedByUserId"] != redeemResult["userId"] {
+			t.Errorf("Expected redeemedByUserId %v, got %v", redeemResult["userId"], inv["redeemedByUserId"])
+		}
+	}
+	if !found {
+		t.Fatal("Expected invitation to be listed")
+	}
+
+	_, result, _ = testutil.CallPostJSON(httpClient, baseURL+"/api/admin/iam/revoke-invitation", map[string]interface{}{
+		"invitationId": invitationID,
+	}, adminAPIKey)
+	testutil.AssertErrorCode(t, result, "INVITATION_ALREADY_REDEEMED")
+
+	// The invitee lacks CREATE_USER and cannot invite others
+	_, result, _ = testutil.CallPostJSON(httpClient, baseURL+"/api/admin/iam/create-invitation", map[string]interface{}{}, userAPIKey)
+	testutil.AssertErrorCode(t, result, "INSUFFICIENT_GLOBAL_PERMISSION")
+}
+
+func TestInvitationRevoke(t *testing.T) {
+	invResult := testutil.CallPostJSONExpectSuccess(t, httpClient, baseURL+"/api/admin/iam/create-invitation", map[string]interface{}{}, adminAPIKey)
+
+	testutil.CallPostJSONExpectSuccess(t, httpClient, baseURL+"/api/admin/iam/revoke-invitation", map[string]interface{}{
+		"invitationId": invResult["invitationId"].(string),
+	}, adminAPIKey)
+
+	_, result, _ := testutil.CallPostJSON(httpClient, baseURL+"/api/user/redeem-invitation", map[string]interface{}{
+		"token":       invResult["token"].(string),
+		"displayName": "Test Revoked",
+		"userName":    fmt.Sprintf("testrevoked%d", time.Now().Unix()),
+		"password":    "TestPass123!",
+	}, "")
+	testutil.AssertErrorCode(t, result, "INVITATION_INVALID")
+}
+
+func TestRegisterClosedByDefault(t *testing.T) {
+	_, result, _ := testutil.CallPostJSON(httpClient, baseURL+"/api/user/register", map[string]interface{}{
+		"displayName": "Test Register",
+		"userName":    fmt.Sprintf("testregister%d", time.Now().Unix()),
+		"password":    "TestPass123!",
+	}, "")
+	testutil.AssertErrorCode(t, result, "REGISTRATION_CLOSED")
+}
@@ -67,6 +67,20 @@ func (m *MinIOHelper) BlobExists(ctx context.Context, blobID string) (bool, erro
 	return true, nil
 }
 
+// ContentExists checks if the object of deduplicated content exists in MinIO
+func (m *MinIOHelper) ContentExists(ctx context.Context, sha256 string) (bool, error) {
+	objectName := "contents/" + sha256
+	_, err := m.client.StatObject(ctx, m.bucketName, objectName, minio.StatObjectOptions{})
+	if err != nil {
+		errResp := minio.ToErrorResponse(err)
+		if errResp.Code == "NoSuchKey" || errResp.Code == "NoSuchBucket" {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
 // GetBlobSize returns the size of a blob in MinIO
 func (m *MinIOHelper) GetBlobSize(ctx context.Context, blobID string) (int64, error) {
 	objectName := "blobs/" + blobID